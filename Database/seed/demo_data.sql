@@ -224,4 +224,7 @@ INSERT INTO sensor_readings (deviceId, temperature, humidity, carbondioxide, air
 (5, 23.5, 80.0, 1200, 220, DATE_SUB(CONCAT(CURDATE(), ' 20:00:00'), INTERVAL 0 HOUR)), -- Evening shower
 (5, 23.0, 70.0, 1100, 200, DATE_SUB(CONCAT(CURDATE(), ' 21:00:00'), INTERVAL 0 HOUR)),
 (5, 22.5, 65.0, 1000, 180, DATE_SUB(CONCAT(CURDATE(), ' 22:00:00'), INTERVAL 0 HOUR)),
-(5, 22.0, 60.0, 950, 160, DATE_SUB(CONCAT(CURDATE(), ' 23:00:00'), INTERVAL 0 HOUR));
\ No newline at end of file
+(5, 22.0, 60.0, 950, 160, DATE_SUB(CONCAT(CURDATE(), ' 23:00:00'), INTERVAL 0 HOUR));
+
+-- Test readings are measured when they were created
+UPDATE sensor_readings SET measuredAt = createdAt;
@@ -6,9 +6,11 @@
 
 char ssid[] = SECRET_SSID;
 char pass[] = SECRET_PASS;
+char deviceKey[] = SECRET_DEVICE_KEY;
 
 const char serverAddress[] = "172.18.14.27";
 const int serverPort = 8080;
+const char firmwareVersion[] = "1.1.0";
 
 Bsec iaqSensor;
 String output;
@@ -23,6 +25,10 @@ bool deviceRegistered = false;
 bool deviceDeclined = false;
 unsigned long lastSensorReadingTime = 0;
 const unsigned long sensorReadingInterval = 10000;
+unsigned long lastHeartbeatTime = 0;
+unsigned long lastDeclinedRequestTime = 0;
+const unsigned long declinedRequestInterval = 600000;
+const unsigned long heartbeatInterval = 60000;
 
 void checkIaqSensorStatus(void);
 void connectToWiFi();
@@ -32,6 +38,7 @@ void requestDevice();
 bool isDeviceRegistered();
 bool readSensorData();
 void sendSensorReading();
+void sendHeartbeat();
 void readI2CBUS();
 
 void setup()
@@ -101,6 +108,13 @@ void loop()
       }
       lastSensorReadingTime = currentTime;
     }
+
+    // a declined request can be reinstated in the dashboard
+    if (WiFi.status() == WL_CONNECTED && currentTime - lastDeclinedRequestTime >= declinedRequestInterval)
+    {
+      requestDevice();
+      lastDeclinedRequestTime = currentTime;
+    }
     return;
   }
 
@@ -123,6 +137,12 @@ void loop()
     sendSensorReading();
     lastSensorReadingTime = currentTime;
   }
+
+  if (currentTime - lastHeartbeatTime >= heartbeatInterval)
+  {
+    sendHeartbeat();
+    lastHeartbeatTime = currentTime;
+  }
 }
 
 void connectToWiFi()
@@ -232,7 +252,12 @@ void requestDevice()
     deviceRequested = true;
     Serial.println("Device is already registered");
   }
-  else if (response.indexOf("device was declined") > -1)
+  else if (response.indexOf("device already requested") > -1)
+  {
+    deviceDeclined = false;
+    Serial.println("Device request is pending");
+  }
+  else if (response.indexOf("device was declined") > -1 || response.indexOf("device is blocked") > -1)
   {
     deviceDeclined = true;
     Serial.println("Device was declined");
@@ -297,7 +322,13 @@ void sendSensorReading()
                     "\",\"temperature\":" + String(iaqSensor.temperature) +
                     ",\"humidity\":" + String(iaqSensor.humidity) +
                     ",\"airQualityIndex\":" + String(iaqSensor.iaq) +
-                    ",\"carbondioxide\":" + String(iaqSensor.co2Equivalent) + "}";
+                    ",\"carbondioxide\":" + String(iaqSensor.co2Equivalent) +
+                    ",\"staticIaq\":" + String(iaqSensor.staticIaq) +
+                    ",\"iaqAccuracy\":" + String(iaqSensor.iaqAccuracy) +
+                    ",\"breathVocEquivalent\":" + String(iaqSensor.breathVocEquivalent) +
+                    ",\"pressure\":" + String(iaqSensor.pressure / 100.0) +
+                    ",\"gasResistance\":" + String(iaqSensor.gasResistance) +
+                    ",\"stabilizationStatus\":" + String(iaqSensor.stabStatus == 1.0 ? "true" : "false") + "}";
 
   Serial.println("Sending sensor data...");
   Serial.println(jsonData);
@@ -305,6 +336,7 @@ void sendSensorReading()
   httpClient.beginRequest();
   httpClient.post("/sensorreading");
   httpClient.sendHeader("Content-Type", "application/json");
+  httpClient.sendHeader("Authorization", "Bearer " + String(deviceKey));
   httpClient.sendHeader("Content-Length", jsonData.length());
   httpClient.beginBody();
   httpClient.print(jsonData);
@@ -321,6 +353,28 @@ void sendSensorReading()
   Serial.println(statusCode >= 200 && statusCode < 300 ? "Sensor data sent successfully" : "Failed to send sensor data");
 }
 
+void sendHeartbeat()
+{
+  String jsonData = "{\"rssi\":" + String(WiFi.RSSI()) +
+                    ",\"uptime\":" + String(millis()) +
+                    ",\"firmwareVersion\":\"" + String(firmwareVersion) + "\"}";
+
+  httpClient.beginRequest();
+  httpClient.post("/device/" + macAddress + "/heartbeat");
+  httpClient.sendHeader("Content-Type", "application/json");
+  httpClient.sendHeader("Authorization", "Bearer " + String(deviceKey));
+  httpClient.sendHeader("Content-Length", jsonData.length());
+  httpClient.beginBody();
+  httpClient.print(jsonData);
+  httpClient.endRequest();
+
+  int statusCode = httpClient.responseStatusCode();
+  httpClient.responseBody();
+
+  Serial.print("Heartbeat status code: ");
+  Serial.println(statusCode);
+}
+
 void checkIaqSensorStatus(void)
 {
   if (iaqSensor.bsecStatus != BSEC_OK)
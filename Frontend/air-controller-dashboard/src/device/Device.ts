@@ -71,4 +71,47 @@ export class DeviceApi {
             throw error
         }
     }
-}
\ No newline at end of file
+
+    async getDeclinedDevices(): Promise<IRequestedDevice[]> {
+        try {
+            const response = await apiClient.get('/device/request/declined')
+            const declinedDevices: IRequestedDevice[] = response.data
+            return declinedDevices
+        } catch (error) {
+            console.error(error)
+            throw error
+        }
+    }
+
+    async reinstateDevice(declinedDevice: IRequestedDevice): Promise<IRequestedDevice> {
+        try {
+            const response = await apiClient.post(`/device/request/${declinedDevice.macAddress}/reinstate`)
+            const requestedDevice: IRequestedDevice = response.data
+            return requestedDevice
+        } catch (error) {
+            console.error(error)
+            throw error
+        }
+    }
+
+    async blockDevice(macAddress: string, reason: string): Promise<IError | null> {
+        const headers = {
+            'Content-Type': 'application/json'
+        }
+        try {
+            const data = { "macAddress": macAddress, "reason": reason };
+            const response = await apiClient.post('/device/blocked', data, { headers: headers })
+            if (response.status != 201) {
+                return {
+                    message: response.data,
+                    status: response.status
+                }
+            } else {
+                return null
+            }
+        } catch (error) {
+            console.error(error)
+            throw error
+        }
+    }
+}
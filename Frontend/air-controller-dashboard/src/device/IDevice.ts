@@ -1,7 +1,18 @@
+export interface IDeviceHeartbeat {
+    rssi: number | null;
+    uptime: number | null;
+    freeHeap: number | null;
+    firmwareVersion: string;
+    receivedAt: Date
+}
+
 export interface IDevice {
     id: number;
     name: string;
     localization: string;
     macAddress: string;
-    createdAt: Date
-}
\ No newline at end of file
+    createdAt: Date;
+    lastSeenAt?: Date | null;
+    online?: boolean;
+    heartbeat?: IDeviceHeartbeat | null
+}
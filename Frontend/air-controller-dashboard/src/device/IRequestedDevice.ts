@@ -2,5 +2,7 @@ export interface IRequestedDevice {
     id: number,
     macAddress: string,
     createdAt: Date,
-    active: boolean
-}
\ No newline at end of file
+    active: boolean,
+    decidedBy?: number | null,
+    decidedAt?: Date | null
+}
@@ -5,5 +5,12 @@ export interface ISensorReading {
     airQualityIndex: number;
     humidity: number;
     carbondioxide: number;
+    staticIaq?: number;
+    iaqAccuracy?: number;
+    breathVocEquivalent?: number;
+    pressure?: number;
+    gasResistance?: number;
+    stabilizationStatus?: boolean;
+    metrics?: Record<string, number>;
     createdAt: Date;
 }
\ No newline at end of file
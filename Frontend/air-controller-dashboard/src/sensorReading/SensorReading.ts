@@ -2,17 +2,42 @@ import type { ISensorReading } from "./ISensorReading";
 import axios from 'axios'
 import apiClient from "@/services/HttpService";
 
+const HISTORY_DAYS = 31
+const PAGE_SIZE = 10000
+
 export class SensorReadingApi {
 
     async getSensorReadingsByDeviceId(id: number): Promise<ISensorReading[]> {
 
         try {
-            const response = await apiClient.get('/sensorreading/device/' + id)
-            const sensorReadings: ISensorReading[] = response.data
+            const from = new Date(Date.now() - HISTORY_DAYS * 24 * 60 * 60 * 1000)
+            const sensorReadings: ISensorReading[] = []
+            // the readings come in pages, X-Next-Cursor points to the next one
+            let cursor: string | undefined
+            do {
+                const response = await apiClient.get('/sensorreading/device/' + id, {
+                    params: { from: from.toISOString(), limit: PAGE_SIZE, cursor }
+                })
+                sensorReadings.push(...response.data)
+                cursor = response.headers['x-next-cursor']
+            } while (cursor)
             return sensorReadings
         } catch (error) {
             console.error(error)
             throw error
         }
     }
+
+    // streams readings of the device as they arrive, close the returned
+    // EventSource to stop
+    streamSensorReadings(id: number, onReading: (reading: ISensorReading) => void): EventSource {
+        const url = new URL('/sensorreading/stream', apiClient.defaults.baseURL)
+        url.searchParams.set('deviceId', String(id))
+
+        const source = new EventSource(url)
+        source.addEventListener('reading', (event) => {
+            onReading(JSON.parse((event as MessageEvent).data))
+        })
+        return source
+    }
 }
\ No newline at end of file
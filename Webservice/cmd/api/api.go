@@ -1,9 +1,21 @@
 package api
 
 import (
+	"air-controller-webservice/config"
+	"air-controller-webservice/db"
+	"air-controller-webservice/services/alert"
 	"air-controller-webservice/services/device"
+	"air-controller-webservice/services/email"
+	"air-controller-webservice/services/events"
+	"air-controller-webservice/services/live"
+	"air-controller-webservice/services/metric"
+	"air-controller-webservice/services/mqtt"
+	"air-controller-webservice/services/rollup"
 	sensorreading "air-controller-webservice/services/sensor-reading"
 	"air-controller-webservice/services/user"
+	"air-controller-webservice/services/webhook"
+	"air-controller-webservice/types"
+	"context"
 	"database/sql"
 	"log"
 	"net/http"
@@ -27,29 +39,128 @@ func (s *APIServer) Run() error {
 	router := mux.NewRouter()
 	router.Use(enableCORS)
 
+	eventBroker := events.NewBroker()
+
 	userStore := user.NewStore(s.db)
 	userHandler := user.NewHandler(userStore)
 	userHandler.RegisterRoutes(router)
 
-	deviceStore := device.NewStore(s.db)
-	deviceHandler := device.NewHandler(deviceStore)
+	stores, err := NewStores(s.db)
+	if err != nil {
+		return err
+	}
+
+	deviceStore := stores.Device
+	deviceMonitor := device.NewMonitor(deviceStore, eventBroker, config.Envs.DeviceOfflineAfter)
+	go deviceMonitor.Run(context.Background())
+	deviceHandler := device.NewHandler(deviceStore, eventBroker, deviceMonitor)
 	deviceHandler.RegisterRoutes(router)
 
-	sensorReadingStore := sensorreading.NewStore(s.db)
-	sensorReadingHandler := sensorreading.NewHandler(sensorReadingStore, s.db)
+	metricStore := metric.NewCachedStore(metric.NewStore(s.db))
+	metricHandler := metric.NewHandler(metricStore)
+	metricHandler.RegisterRoutes(router)
+
+	sensorReadingStore := stores.SensorReading
+	ingester := sensorreading.NewIngester(sensorReadingStore, metricStore, deviceMonitor, eventBroker)
+	sensorReadingHandler := sensorreading.NewHandler(sensorReadingStore, deviceStore, ingester, eventBroker)
 	sensorReadingHandler.RegisterRoutes(router)
 
+	alertStore := alert.NewCachedStore(alert.NewStore(s.db))
+	alertHandler := alert.NewHandler(alertStore, metricStore)
+	alertHandler.RegisterRoutes(router)
+	alert.NewEngine(alertStore, deviceStore, eventBroker).Start()
+
+	webhookStore := webhook.NewStore(s.db)
+	webhookDispatcher := webhook.NewDispatcher(webhookStore)
+	webhookDispatcher.Start(eventBroker)
+	go webhookDispatcher.Run(context.Background())
+	webhookHandler := webhook.NewHandler(webhookStore, webhookDispatcher)
+	webhookHandler.RegisterRoutes(router)
+
+	emailStore := email.NewStore(s.db)
+	emailNotifier := email.NewNotifier(emailStore, deviceStore, metricStore)
+	if emailNotifier.Enabled() {
+		emailNotifier.Start(eventBroker)
+		go emailNotifier.Run(context.Background())
+	}
+	emailHandler := email.NewHandler(emailStore, deviceStore, emailNotifier)
+	emailHandler.RegisterRoutes(router)
+
+	liveHandler := live.NewHandler(eventBroker)
+	liveHandler.RegisterRoutes(router)
+
+	rollupStore := stores.Rollup
+	rollupHandler := rollup.NewHandler(rollupStore)
+	rollupHandler.RegisterRoutes(router)
+	go rollup.NewWorker(rollupStore, config.Envs.RollupInterval).Run(context.Background())
+
+	if config.Envs.MQTTBroker != "" {
+		mqtt.NewListener(ingester, deviceStore).Start()
+	}
+
+	if config.Envs.MQTTListenAddress != "" {
+		broker, err := mqtt.NewBroker(ingester, deviceStore)
+		if err != nil {
+			return err
+		}
+		if err := broker.Start(); err != nil {
+			return err
+		}
+	}
+
 	log.Println("listening on", s.addr)
 	log.Println("Adjusted ports")
 	return http.ListenAndServe(s.addr, router)
 }
 
+// Stores are the stores that depend on the configured database backend. The
+// metric, alert, webhook and email stores use SQL all backends understand,
+// the PostgreSQL connection rewrites their placeholders and backticks. Their
+// conformance suites in storetest run against each backend.
+type Stores struct {
+	Device        types.DeviceStore
+	SensorReading types.SensorReadingStore
+	Rollup        types.RollupStore
+}
+
+func NewStores(database *sql.DB) (*Stores, error) {
+	switch config.Envs.DBBackend {
+	case db.SQLite:
+		return &Stores{
+			Device:        device.NewSQLiteStore(database),
+			SensorReading: sensorreading.NewSQLiteStore(database),
+			Rollup:        rollup.NewSQLiteStore(database),
+		}, nil
+	case db.Postgres:
+		continuous, err := rollup.HasContinuousAggregates(database)
+		if err != nil {
+			return nil, err
+		}
+		var rollupStore types.RollupStore = rollup.NewPostgresStore(database)
+		if continuous {
+			rollupStore = rollup.NewTimescaleStore(database)
+		}
+		return &Stores{
+			Device:        device.NewPostgresStore(database),
+			SensorReading: sensorreading.NewPostgresStore(database),
+			Rollup:        rollupStore,
+		}, nil
+	}
+
+	return &Stores{
+		Device:        device.NewStore(database),
+		SensorReading: sensorreading.NewStore(database),
+		Rollup:        rollup.NewStore(database),
+	}, nil
+}
+
 func enableCORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
 		w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, Accept")
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
+		w.Header().Set("Access-Control-Expose-Headers", "X-Next-Cursor")
 
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
@@ -4,38 +4,155 @@ import (
 	"air-controller-webservice/cmd/api"
 	"air-controller-webservice/config"
 	"air-controller-webservice/db"
+	"air-controller-webservice/services/rollup"
 	"database/sql"
 	"fmt"
 	"log"
+	"os"
+	"strconv"
+	"time"
 
 	"github.com/go-sql-driver/mysql"
 )
 
 func main() {
 	fmt.Println("Starting...")
-	db, err := db.NewMariaDBStorage(mysql.Config{
-		User:                 config.Envs.DBUser,
-		Passwd:               config.Envs.DBPassword,
-		Addr:                 config.Envs.DBAddress,
-		DBName:               config.Envs.DBName,
-		Net:                  "tcp",
-		AllowNativePasswords: true,
-		ParseTime:            true,
-	})
-	initStorage(db)
+	db, err := openStorage()
 	if err != nil {
 		log.Fatal(err)
 	}
+	initStorage(db)
+
+	if len(os.Args) > 1 {
+		runCommand(db, os.Args[1], os.Args[2:])
+		return
+	}
+
+	if config.Envs.MigrateOnStart {
+		migrate(db, []string{"up"})
+	}
+
 	server := api.NewAPIServer(":8080", db)
 	if err := server.Run(); err != nil {
 		log.Fatal(err)
 	}
 }
 
-func initStorage(db *sql.DB) {
-	if err := db.Ping(); err != nil {
+// openStorage connects to the database backend selected by DB_BACKEND.
+func openStorage() (*sql.DB, error) {
+	switch config.Envs.DBBackend {
+	case db.MariaDB:
+		return db.NewMariaDBStorage(mysql.Config{
+			User:                 config.Envs.DBUser,
+			Passwd:               config.Envs.DBPassword,
+			Addr:                 config.Envs.DBAddress,
+			DBName:               config.Envs.DBName,
+			Net:                  "tcp",
+			AllowNativePasswords: true,
+			ParseTime:            true,
+		})
+	case db.SQLite:
+		return db.NewSQLiteStorage(config.Envs.SQLitePath)
+	case db.Postgres:
+		return db.NewPostgresStorage(config.Envs.PostgresURL)
+	default:
+		return nil, fmt.Errorf("unknown database backend %q", config.Envs.DBBackend)
+	}
+}
+
+func initStorage(database *sql.DB) {
+	if err := database.Ping(); err != nil {
 		log.Fatal(err)
 	}
+	if config.Envs.DBBackend == db.MariaDB {
+		if err := db.CheckMariaDBVersion(database); err != nil {
+			log.Fatal(err)
+		}
+	}
 
 	log.Println("DB: Sucessfully connected")
 }
+
+// runCommand executes a maintenance command instead of starting the API server.
+func runCommand(database *sql.DB, command string, args []string) {
+	switch command {
+	case "migrate":
+		migrate(database, args)
+	case "rollup-backfill":
+		stores, err := api.NewStores(database)
+		if err != nil {
+			log.Fatal(err)
+		}
+		worker := rollup.NewWorker(stores.Rollup, config.Envs.RollupInterval)
+		n, err := worker.Backfill()
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("rollup: rebuilt from %d sensor readings", n)
+	default:
+		log.Fatalf("unknown command %q", command)
+	}
+}
+
+// migrate runs `migrate up`, `migrate down [n]`, `migrate status` or
+// `migrate force <version>`.
+func migrate(database *sql.DB, args []string) {
+	migrator, err := db.NewMigrator(database, config.Envs.DBBackend)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	action := "up"
+	if len(args) > 0 {
+		action = args[0]
+	}
+
+	switch action {
+	case "up":
+		versions, err := migrator.Up()
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("migrate: applied %d migrations", len(versions))
+	case "down":
+		n := 1
+		if len(args) > 1 {
+			if n, err = strconv.Atoi(args[1]); err != nil || n < 1 {
+				log.Fatalf("migrate down: invalid count %q", args[1])
+			}
+		}
+		versions, err := migrator.Down(n)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("migrate: rolled back %d migrations", len(versions))
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, status := range statuses {
+			state := "pending"
+			if status.Dirty {
+				state = "dirty"
+			} else if status.Applied {
+				state = "applied " + status.AppliedAt.Format(time.DateTime)
+			}
+			fmt.Printf("%04d_%-40s %s\n", status.Version, status.Name, state)
+		}
+	case "force":
+		if len(args) < 2 {
+			log.Fatal("migrate force: missing version")
+		}
+		version, err := strconv.Atoi(args[1])
+		if err != nil {
+			log.Fatalf("migrate force: invalid version %q", args[1])
+		}
+		if err := migrator.Force(version); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("migrate: recorded schema version %d", version)
+	default:
+		log.Fatalf("unknown migrate action %q", action)
+	}
+}
@@ -0,0 +1,49 @@
+// Command webhooksink is a local stand-in for webhook receivers. It logs every
+// request it gets and checks the signature if it knows the webhook secret:
+//
+//	go run ./cmd/webhooksink -addr :9000 -secret <secret>
+package main
+
+import (
+	"air-controller-webservice/services/webhook"
+	"crypto/hmac"
+	"flag"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+func main() {
+	addr := flag.String("addr", ":9000", "listen address")
+	secret := flag.String("secret", "", "webhook secret, signatures are not checked if empty")
+	status := flag.Int("status", http.StatusNoContent, "response status, e.g. 500 to try the retries")
+	flag.Parse()
+
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		log.Printf("%s %s event=%s delivery=%s\n%s",
+			r.Method, r.URL.Path, r.Header.Get("X-AirController-Event"), r.Header.Get("X-AirController-Delivery"), body)
+
+		if *secret != "" {
+			signature := strings.TrimPrefix(r.Header.Get("X-AirController-Signature"), "sha256=")
+			expected := webhook.Sign(*secret, r.Header.Get("X-AirController-Timestamp"), body)
+			if !hmac.Equal([]byte(signature), []byte(expected)) {
+				log.Println("invalid signature")
+				http.Error(w, "invalid signature", http.StatusUnauthorized)
+				return
+			}
+			log.Println("signature ok")
+		}
+
+		w.WriteHeader(*status)
+	})
+
+	log.Println("webhook sink listening on", *addr)
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
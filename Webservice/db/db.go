@@ -2,9 +2,21 @@ package db
 
 import (
 	"database/sql"
+	"fmt"
 	"log"
+	"net/url"
+	"strconv"
+	"strings"
 
 	"github.com/go-sql-driver/mysql"
+	_ "modernc.org/sqlite"
+)
+
+// Backends selectable with config.Envs.DBBackend.
+const (
+	MariaDB  = "mariadb"
+	SQLite   = "sqlite"
+	Postgres = "postgres"
 )
 
 func NewMariaDBStorage(cfg mysql.Config) (*sql.DB, error) {
@@ -16,3 +28,67 @@ func NewMariaDBStorage(cfg mysql.Config) (*sql.DB, error) {
 
 	return db, nil
 }
+
+// minMariaDBVersion is the first MariaDB release with INSERT ... RETURNING,
+// which the stores use to read the ids of new rows. MySQL does not have it.
+var minMariaDBVersion = [2]int{10, 5}
+
+// CheckMariaDBVersion fails unless the server is MariaDB 10.5 or newer.
+func CheckMariaDBVersion(db *sql.DB) error {
+	var version string
+	if err := db.QueryRow("SELECT VERSION()").Scan(&version); err != nil {
+		return err
+	}
+
+	return checkMariaDBVersion(version)
+}
+
+// checkMariaDBVersion checks a version string like 10.11.6-MariaDB-1:10.11.6.
+func checkMariaDBVersion(version string) error {
+	unsupported := fmt.Errorf("database server %s is not supported, MariaDB %d.%d or newer is required",
+		version, minMariaDBVersion[0], minMariaDBVersion[1])
+	if !strings.Contains(version, "MariaDB") {
+		return unsupported
+	}
+
+	// old servers report 5.5.5- in front of the version to old clients
+	fields := strings.SplitN(strings.TrimPrefix(version, "5.5.5-"), ".", 3)
+	if len(fields) < 2 {
+		return unsupported
+	}
+	major, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return unsupported
+	}
+	minor, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return unsupported
+	}
+
+	if major < minMariaDBVersion[0] || major == minMariaDBVersion[0] && minor < minMariaDBVersion[1] {
+		return unsupported
+	}
+
+	return nil
+}
+
+// NewSQLiteStorage opens the database file at path, creating it if needed.
+// Transactions take the write lock when they begin, so concurrent writers wait
+// for each other instead of failing halfway, and times are written in a
+// format the SQLite date functions understand.
+func NewSQLiteStorage(path string) (*sql.DB, error) {
+	params := url.Values{}
+	params.Add("_pragma", "foreign_keys(1)")
+	params.Add("_pragma", "busy_timeout(5000)")
+	params.Add("_pragma", "journal_mode(WAL)")
+	params.Set("_time_format", "sqlite")
+	params.Set("_txlock", "immediate")
+
+	db, err := sql.Open("sqlite", "file:"+path+"?"+params.Encode())
+	if err != nil {
+		log.Fatal(err)
+		return nil, err
+	}
+
+	return db, nil
+}
@@ -0,0 +1,29 @@
+package db
+
+import "testing"
+
+func TestCheckMariaDBVersion(t *testing.T) {
+	tests := []struct {
+		version   string
+		supported bool
+	}{
+		{"10.11.6-MariaDB-1:10.11.6+maria~ubu2204", true},
+		{"11.4.2-MariaDB", true},
+		{"10.5.0-MariaDB-log", true},
+		{"5.5.5-10.6.12-MariaDB", true},
+		{"10.4.32-MariaDB", false},
+		{"5.5.68-MariaDB", false},
+		{"8.0.36", false},
+		{"8.4.0-0ubuntu0.24.04.1", false},
+		{"MariaDB", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.version, func(t *testing.T) {
+			err := checkMariaDBVersion(test.version)
+			if (err == nil) != test.supported {
+				t.Errorf("checkMariaDBVersion(%q) = %v, want supported %v", test.version, err, test.supported)
+			}
+		})
+	}
+}
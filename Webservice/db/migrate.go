@@ -0,0 +1,576 @@
+package db
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Migrations are embedded per backend as
+// migrations/<backend>/<version>_<name>.up.sql and .down.sql. Statements are
+// separated by a semicolon at the end of a line outside of $$ quoted bodies.
+//
+//go:embed migrations/*/*.sql
+var migrationFiles embed.FS
+
+// lockTimeout is how long Up, Down and Force wait for another instance that
+// is migrating the same MariaDB or PostgreSQL database, in seconds. SQLite
+// waits for the busy timeout of the connection.
+const lockTimeout = 60
+
+type Migration struct {
+	Version int
+	Name    string
+	up      []string
+	down    []string
+}
+
+type MigrationStatus struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`
+	Dirty     bool       `json:"dirty"`
+	AppliedAt *time.Time `json:"appliedAt"`
+}
+
+type appliedMigration struct {
+	dirty     bool
+	appliedAt time.Time
+}
+
+type Migrator struct {
+	db         *sql.DB
+	backend    string
+	migrations []*Migration
+}
+
+func NewMigrator(db *sql.DB, backend string) (*Migrator, error) {
+	migrations, err := loadMigrations(migrationFiles, backend)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{db: db, backend: backend, migrations: migrations}, nil
+}
+
+// Up applies all pending migrations in order and returns their versions. A
+// MariaDB database created by an init script before migrations existed is
+// adopted at the version of that script first.
+func (m *Migrator) Up() ([]int, error) {
+	var done []int
+	err := m.withLock(func(conn *sql.Conn) error {
+		tracked, err := m.tableExists(conn, "schema_migrations")
+		if err != nil {
+			return err
+		}
+		if !tracked {
+			untracked, err := m.tableExists(conn, "devices")
+			if err != nil {
+				return err
+			}
+			if untracked && m.backend != MariaDB {
+				return fmt.Errorf("the database has a schema but no schema_migrations table, record its version with `migrate force <version>` first")
+			}
+			if untracked {
+				version, err := m.baselineVersion(conn)
+				if err != nil {
+					return err
+				}
+				log.Printf("migrate: the database has no schema_migrations table, adopting it at version %d", version)
+				if err := renameIndexes(conn); err != nil {
+					return err
+				}
+				if err := m.record(conn, version); err != nil {
+					return err
+				}
+			}
+		}
+
+		applied, err := m.appliedMigrations(conn)
+		if err != nil {
+			return err
+		}
+		if err := checkDirty(applied); err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+
+			log.Printf("migrate: applying %04d_%s", migration.Version, migration.Name)
+			if err := m.run(conn, migration, migration.up); err != nil {
+				return err
+			}
+			if _, err := conn.ExecContext(context.Background(), "UPDATE schema_migrations SET dirty = false WHERE version = ?", migration.Version); err != nil {
+				return err
+			}
+			done = append(done, migration.Version)
+		}
+
+		return nil
+	})
+
+	return done, err
+}
+
+// Down rolls back the last n applied migrations and returns their versions.
+func (m *Migrator) Down(n int) ([]int, error) {
+	var done []int
+	err := m.withLock(func(conn *sql.Conn) error {
+		applied, err := m.appliedMigrations(conn)
+		if err != nil {
+			return err
+		}
+		if err := checkDirty(applied); err != nil {
+			return err
+		}
+
+		versions := make([]int, 0, len(applied))
+		for version := range applied {
+			versions = append(versions, version)
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+
+		for _, version := range versions[:min(n, len(versions))] {
+			migration := m.find(version)
+			if migration == nil {
+				return fmt.Errorf("no migration for applied version %d", version)
+			}
+
+			log.Printf("migrate: rolling back %04d_%s", migration.Version, migration.Name)
+			if err := m.run(conn, migration, migration.down); err != nil {
+				return err
+			}
+			if _, err := conn.ExecContext(context.Background(), "DELETE FROM schema_migrations WHERE version = ?", version); err != nil {
+				return err
+			}
+			done = append(done, version)
+		}
+
+		return nil
+	})
+
+	return done, err
+}
+
+// Force records the schema as being exactly at version without running any
+// migration. It adopts databases that were created before migrations existed
+// and clears the dirty flag after a failed migration was repaired by hand.
+func (m *Migrator) Force(version int) error {
+	if version != 0 && m.find(version) == nil {
+		return fmt.Errorf("unknown migration version %d", version)
+	}
+
+	return m.withLock(func(conn *sql.Conn) error {
+		return m.record(conn, version)
+	})
+}
+
+// record marks the migrations up to version as applied and the later ones as
+// not applied.
+func (m *Migrator) record(conn *sql.Conn, version int) error {
+	if err := createMigrationsTable(conn); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	if _, err := conn.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version > ?", version); err != nil {
+		return err
+	}
+	if _, err := conn.ExecContext(ctx, "UPDATE schema_migrations SET dirty = false"); err != nil {
+		return err
+	}
+
+	applied, err := m.appliedMigrations(conn)
+	if err != nil {
+		return err
+	}
+	for _, migration := range m.migrations {
+		if migration.Version > version {
+			break
+		}
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		if _, err := conn.ExecContext(ctx, "INSERT INTO schema_migrations (version, name) VALUES (?, ?)",
+			migration.Version, migration.Name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// baselineVersion tells the MariaDB init scripts used before migrations
+// apart. The last one created the device decision tables of migration 14,
+// the original one only the tables of migration 1.
+func (m *Migrator) baselineVersion(conn *sql.Conn) (int, error) {
+	decisions, err := m.tableExists(conn, "device_decisions")
+	if err != nil {
+		return 0, err
+	}
+	if decisions {
+		return 14, nil
+	}
+
+	return 1, nil
+}
+
+// namedIndexes are the indexes the migrations up to version 14 name because
+// later migrations refer to them. The init scripts left the names to MariaDB,
+// which names an index after its first column, e.g. deviceId_2.
+var namedIndexes = []struct {
+	table   string
+	name    string
+	columns string
+}{
+	{"devices", "devices_online", "online,lastSeenAt"},
+	{"devices", "devices_active_mac", "activeMacAddress"},
+	{"sensor_readings", "sensor_readings_device_measured", "deviceId,measuredAt,id"},
+	{"sensor_readings", "sensor_readings_measured", "measuredAt,id"},
+	{"sensor_readings", "sensor_readings_sequence", "deviceId,sequence"},
+	{"sensor_readings", "sensor_readings_idempotency_key", "deviceId,idempotencyKey"},
+}
+
+// renameIndexes gives the indexes an init script created the names of
+// namedIndexes, found by their columns. Indexes the script did not create are
+// left to the migrations.
+func renameIndexes(conn *sql.Conn) error {
+	ctx := context.Background()
+	for _, index := range namedIndexes {
+		var name string
+		err := conn.QueryRowContext(ctx, `SELECT INDEX_NAME FROM information_schema.STATISTICS
+			WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?
+			GROUP BY INDEX_NAME
+			HAVING GROUP_CONCAT(COLUMN_NAME ORDER BY SEQ_IN_INDEX) = ?`, index.table, index.columns).Scan(&name)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if name == index.name {
+			continue
+		}
+
+		log.Printf("migrate: renaming index %s of %s to %s", name, index.table, index.name)
+		if _, err := conn.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s RENAME INDEX `%s` TO %s", index.table, name, index.name)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Status lists every known migration and whether it is applied.
+func (m *Migrator) Status() ([]*MigrationStatus, error) {
+	conn, err := m.db.Conn(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	tracked, err := m.tableExists(conn, "schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	applied := map[int]appliedMigration{}
+	if tracked {
+		if applied, err = m.appliedMigrations(conn); err != nil {
+			return nil, err
+		}
+	}
+
+	statuses := []*MigrationStatus{}
+	for _, migration := range m.migrations {
+		status := &MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if a, ok := applied[migration.Version]; ok {
+			status.Applied = true
+			status.Dirty = a.dirty
+			status.AppliedAt = &a.appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// withLock runs fn on a dedicated connection that holds a named lock for the
+// database, so two instances starting at the same time do not migrate
+// concurrently. The server drops the lock of an instance that dies halfway.
+// SQLite and PostgreSQL run fn in one transaction instead, their schema
+// changes are transactional.
+func (m *Migrator) withLock(fn func(conn *sql.Conn) error) error {
+	ctx := context.Background()
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	switch m.backend {
+	case SQLite:
+		// Migrations rebuild tables that other tables refer to, dropping one
+		// would cascade to the referring rows. SQLite ignores the pragma
+		// within a transaction, so the foreign keys are turned off for the
+		// whole run and checked before it commits.
+		if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF"); err != nil {
+			return err
+		}
+		defer conn.ExecContext(ctx, "PRAGMA foreign_keys = ON")
+
+		return inTransaction(conn, "BEGIN IMMEDIATE", func(conn *sql.Conn) error {
+			if err := fn(conn); err != nil {
+				return err
+			}
+			return checkForeignKeys(conn)
+		})
+	case Postgres:
+		return inTransaction(conn, "BEGIN", func(conn *sql.Conn) error {
+			if _, err := conn.ExecContext(ctx, fmt.Sprintf("SET LOCAL lock_timeout = '%ds'", lockTimeout)); err != nil {
+				return err
+			}
+			if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext(current_database() || '.schema_migrations'))"); err != nil {
+				return fmt.Errorf("another instance is migrating the database: %w", err)
+			}
+			return fn(conn)
+		})
+	}
+
+	var locked sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(CONCAT(DATABASE(), '.schema_migrations'), ?)", lockTimeout).Scan(&locked); err != nil {
+		return err
+	}
+	if !locked.Valid || locked.Int64 != 1 {
+		return fmt.Errorf("another instance is migrating the database")
+	}
+	defer conn.ExecContext(ctx, "DO RELEASE_LOCK(CONCAT(DATABASE(), '.schema_migrations'))")
+
+	return fn(conn)
+}
+
+func inTransaction(conn *sql.Conn, begin string, fn func(conn *sql.Conn) error) error {
+	ctx := context.Background()
+	if _, err := conn.ExecContext(ctx, begin); err != nil {
+		return err
+	}
+	if err := fn(conn); err != nil {
+		conn.ExecContext(ctx, "ROLLBACK")
+		return err
+	}
+	_, err := conn.ExecContext(ctx, "COMMIT")
+	return err
+}
+
+// checkForeignKeys fails if a SQLite migration left rows referring to rows
+// that do not exist.
+func checkForeignKeys(conn *sql.Conn) error {
+	rows, err := conn.QueryContext(context.Background(), "PRAGMA foreign_key_check")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		var table string
+		var rowId sql.NullInt64
+		var parent string
+		var index int
+		if err := rows.Scan(&table, &rowId, &parent, &index); err != nil {
+			return err
+		}
+		return fmt.Errorf("row %d of %s refers to a missing row of %s", rowId.Int64, table, parent)
+	}
+
+	return rows.Err()
+}
+
+// run executes statements of migration. The version is marked dirty first,
+// because MariaDB commits DDL statements implicitly and a failure leaves the
+// schema half migrated.
+func (m *Migrator) run(conn *sql.Conn, migration *Migration, statements []string) error {
+	ctx := context.Background()
+	if _, err := conn.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = ?", migration.Version); err != nil {
+		return err
+	}
+	if _, err := conn.ExecContext(ctx, "INSERT INTO schema_migrations (version, name, dirty) VALUES (?, ?, true)",
+		migration.Version, migration.Name); err != nil {
+		return err
+	}
+
+	for _, statement := range statements {
+		if _, err := conn.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("migration %04d_%s: %w", migration.Version, migration.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// appliedMigrations creates the schema_migrations table if needed.
+func (m *Migrator) appliedMigrations(conn *sql.Conn) (map[int]appliedMigration, error) {
+	if err := createMigrationsTable(conn); err != nil {
+		return nil, err
+	}
+
+	rows, err := conn.QueryContext(context.Background(), "SELECT version, dirty, appliedAt FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]appliedMigration{}
+	for rows.Next() {
+		var version int
+		var a appliedMigration
+		if err := rows.Scan(&version, &a.dirty, &a.appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = a
+	}
+
+	return applied, rows.Err()
+}
+
+// checkDirty refuses to migrate further while a migration failed halfway.
+func checkDirty(applied map[int]appliedMigration) error {
+	for version, a := range applied {
+		if a.dirty {
+			return fmt.Errorf("migration %d failed halfway, repair the schema and run `migrate force <version>`", version)
+		}
+	}
+	return nil
+}
+
+func (m *Migrator) find(version int) *Migration {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return migration
+		}
+	}
+	return nil
+}
+
+func createMigrationsTable(conn *sql.Conn) error {
+	_, err := conn.ExecContext(context.Background(), `CREATE TABLE IF NOT EXISTS schema_migrations(
+		version INT PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		dirty BOOLEAN NOT NULL DEFAULT false,
+		appliedAt timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`)
+
+	return err
+}
+
+func (m *Migrator) tableExists(conn *sql.Conn, table string) (bool, error) {
+	query := "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?"
+	switch m.backend {
+	case SQLite:
+		query = "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?"
+	case Postgres:
+		query = "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = ?"
+	}
+
+	var count int
+	err := conn.QueryRowContext(context.Background(), query, table).Scan(&count)
+
+	return count > 0, err
+}
+
+func loadMigrations(files fs.FS, backend string) ([]*Migration, error) {
+	names, err := fs.Glob(files, "migrations/"+backend+"/*.sql")
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no migrations for database backend %q", backend)
+	}
+
+	index := map[int]*Migration{}
+	for _, name := range names {
+		base := path.Base(name)
+		var direction string
+		switch {
+		case strings.HasSuffix(base, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(base, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("%s: expected .up.sql or .down.sql", name)
+		}
+
+		prefix, label, ok := strings.Cut(strings.TrimSuffix(base, "."+direction+".sql"), "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("%s: expected <version>_<name>", name)
+		}
+
+		content, err := fs.ReadFile(files, name)
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := index[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: label}
+			index[version] = migration
+		} else if migration.Name != label {
+			return nil, fmt.Errorf("%s: version %d is already used by %s", name, version, migration.Name)
+		}
+
+		if direction == "up" {
+			migration.up = splitStatements(string(content))
+		} else {
+			migration.down = splitStatements(string(content))
+		}
+	}
+
+	migrations := make([]*Migration, 0, len(index))
+	for _, migration := range index {
+		if migration.up == nil || migration.down == nil {
+			return nil, fmt.Errorf("migration %04d_%s needs an up and a down file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+func splitStatements(content string) []string {
+	statements := []string{}
+	var statement strings.Builder
+
+	dollarQuoted := false
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+		statement.WriteString(line)
+		statement.WriteString("\n")
+
+		if strings.Count(line, "$$")%2 == 1 {
+			dollarQuoted = !dollarQuoted
+		}
+		if !dollarQuoted && strings.HasSuffix(strings.TrimSpace(line), ";") {
+			statements = append(statements, strings.TrimSpace(statement.String()))
+			statement.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(statement.String()); rest != "" {
+		statements = append(statements, rest)
+	}
+
+	return statements
+}
@@ -0,0 +1,134 @@
+package db_test
+
+import (
+	"air-controller-webservice/db"
+	"air-controller-webservice/services/storetest"
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestUntrackedSchema checks databases that have tables but no
+// schema_migrations table, like the ones created by the old init scripts in
+// testdata.
+func TestUntrackedSchema(t *testing.T) {
+	for _, backend := range storetest.Backends() {
+		if backend.Name != db.MariaDB {
+			// only MariaDB databases were created without migrations
+			t.Run(backend.Name, func(t *testing.T) {
+				database := backend.Open(t)
+				if _, err := database.Exec("DROP TABLE schema_migrations"); err != nil {
+					t.Fatal(err)
+				}
+
+				migrator, err := db.NewMigrator(database, backend.Name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if applied, err := migrator.Up(); err == nil {
+					t.Errorf("Up on an untracked %s schema applied %v", backend.Name, applied)
+				}
+			})
+			continue
+		}
+
+		for _, baseline := range []int{1, 14} {
+			t.Run(fmt.Sprintf("%s/version %d", backend.Name, baseline), func(t *testing.T) {
+				database := backend.Open(t)
+				dropTables(t, database)
+				loadScript(t, database, fmt.Sprintf("testdata/init_v%d.sql", baseline))
+
+				migrator, err := db.NewMigrator(database, backend.Name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				applied, err := migrator.Up()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				statuses, err := migrator.Status()
+				if err != nil {
+					t.Fatal(err)
+				}
+				var want []int
+				for _, status := range statuses {
+					if !status.Applied || status.Dirty {
+						t.Errorf("migration %04d_%s is not applied", status.Version, status.Name)
+					}
+					if status.Version > baseline {
+						want = append(want, status.Version)
+					}
+				}
+				if !slices.Equal(applied, want) {
+					t.Errorf("Up on the schema of version %d applied %v, want %v", baseline, applied, want)
+				}
+
+				if _, err := migrator.Down(len(want)); err != nil {
+					t.Errorf("Down to version %d: %v", baseline, err)
+				}
+			})
+		}
+	}
+}
+
+// dropTables empties a migrated MariaDB database.
+func dropTables(t *testing.T, database *sql.DB) {
+	t.Helper()
+
+	ctx := context.Background()
+	conn, err := database.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	rows, err := conn.QueryContext(ctx, "SELECT TABLE_NAME FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE()")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tables []string
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			t.Fatal(err)
+		}
+		tables = append(tables, "`"+table+"`")
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := conn.ExecContext(ctx, "SET FOREIGN_KEY_CHECKS = 0"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.ExecContext(ctx, "DROP TABLE "+strings.Join(tables, ", ")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.ExecContext(ctx, "SET FOREIGN_KEY_CHECKS = 1"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// loadScript runs the statements of an init script, each ends with a
+// semicolon at the end of a line.
+func loadScript(t *testing.T, database *sql.DB, name string) {
+	t.Helper()
+
+	script, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, statement := range strings.Split(string(script), ";\n") {
+		if strings.TrimSpace(statement) == "" {
+			continue
+		}
+		if _, err := database.Exec(statement); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,4 @@
+DROP TABLE users;
+DROP TABLE sensor_readings;
+DROP TABLE requested_devices;
+DROP TABLE devices;
@@ -0,0 +1,8 @@
+-- Dropping measuredAt alone would shrink sensor_readings_device_measured to
+-- (deviceId, id) instead of removing it. The foreign key on deviceId needs an
+-- index of its own once it is gone.
+ALTER TABLE sensor_readings
+    ADD INDEX IF NOT EXISTS deviceId (deviceId),
+    DROP INDEX sensor_readings_device_measured,
+    DROP INDEX sensor_readings_measured,
+    DROP COLUMN measuredAt;
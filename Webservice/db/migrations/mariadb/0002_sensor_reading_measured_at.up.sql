@@ -0,0 +1,7 @@
+ALTER TABLE sensor_readings ADD COLUMN measuredAt timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP AFTER createdAt;
+
+UPDATE sensor_readings SET measuredAt = createdAt;
+
+ALTER TABLE sensor_readings
+    ADD INDEX sensor_readings_device_measured (deviceId, measuredAt, id),
+    ADD INDEX sensor_readings_measured (measuredAt, id);
@@ -0,0 +1,2 @@
+DROP TABLE sensor_reading_rollup_state;
+DROP TABLE sensor_reading_rollups;
@@ -0,0 +1,32 @@
+CREATE TABLE sensor_reading_rollups(
+    deviceId INT NOT NULL,
+    resolution VARCHAR(16) NOT NULL,
+    bucketStart DATETIME NOT NULL,
+    count INT NOT NULL,
+    temperatureSum DOUBLE NOT NULL,
+    temperatureMin DOUBLE NOT NULL,
+    temperatureMax DOUBLE NOT NULL,
+    temperatureLast DOUBLE NOT NULL,
+    airQualityIndexSum DOUBLE NOT NULL,
+    airQualityIndexMin DOUBLE NOT NULL,
+    airQualityIndexMax DOUBLE NOT NULL,
+    airQualityIndexLast DOUBLE NOT NULL,
+    humiditySum DOUBLE NOT NULL,
+    humidityMin DOUBLE NOT NULL,
+    humidityMax DOUBLE NOT NULL,
+    humidityLast DOUBLE NOT NULL,
+    carbondioxideSum DOUBLE NOT NULL,
+    carbondioxideMin DOUBLE NOT NULL,
+    carbondioxideMax DOUBLE NOT NULL,
+    carbondioxideLast DOUBLE NOT NULL,
+    lastAt DATETIME NOT NULL,
+    PRIMARY KEY (deviceId, resolution, bucketStart),
+    FOREIGN KEY (deviceId) References devices(id)
+);
+
+CREATE TABLE sensor_reading_rollup_state(
+    id INT PRIMARY KEY,
+    lastReadingId INT NOT NULL
+);
+
+INSERT INTO sensor_reading_rollup_state (id, lastReadingId) VALUES (1, 0);
@@ -0,0 +1,5 @@
+ALTER TABLE sensor_readings
+    DROP INDEX sensor_readings_idempotency_key,
+    DROP INDEX sensor_readings_sequence,
+    DROP COLUMN idempotencyKey,
+    DROP COLUMN sequence;
@@ -0,0 +1,5 @@
+ALTER TABLE sensor_readings
+    ADD COLUMN sequence BIGINT,
+    ADD COLUMN idempotencyKey VARCHAR(64),
+    ADD UNIQUE KEY sensor_readings_sequence (deviceId, sequence),
+    ADD UNIQUE KEY sensor_readings_idempotency_key (deviceId, idempotencyKey);
@@ -0,0 +1,7 @@
+CREATE TABLE device_keys(
+    deviceId INT PRIMARY KEY,
+    keyHash CHAR(64) NOT NULL,
+    createdAt timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY (keyHash),
+    FOREIGN KEY (deviceId) References devices(id)
+);
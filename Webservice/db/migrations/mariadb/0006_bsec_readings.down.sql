@@ -0,0 +1,7 @@
+ALTER TABLE sensor_readings
+    DROP COLUMN stabilizationStatus,
+    DROP COLUMN gasResistance,
+    DROP COLUMN pressure,
+    DROP COLUMN breathVocEquivalent,
+    DROP COLUMN iaqAccuracy,
+    DROP COLUMN staticIaq;
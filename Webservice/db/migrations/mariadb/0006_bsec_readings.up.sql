@@ -0,0 +1,7 @@
+ALTER TABLE sensor_readings
+    ADD COLUMN staticIaq decimal(5,2) AFTER airQualityIndex,
+    ADD COLUMN iaqAccuracy TINYINT AFTER staticIaq,
+    ADD COLUMN breathVocEquivalent decimal(7,2) AFTER iaqAccuracy,
+    ADD COLUMN pressure decimal(6,2) AFTER breathVocEquivalent,
+    ADD COLUMN gasResistance decimal(10,2) AFTER pressure,
+    ADD COLUMN stabilizationStatus BOOLEAN AFTER gasResistance;
@@ -0,0 +1,2 @@
+DROP TABLE sensor_reading_values;
+DROP TABLE metrics;
@@ -0,0 +1,32 @@
+CREATE TABLE metrics(
+    name VARCHAR(64) PRIMARY KEY,
+    unit VARCHAR(16) NOT NULL DEFAULT '',
+    minValue DOUBLE,
+    maxValue DOUBLE,
+    `precision` TINYINT NOT NULL DEFAULT 2,
+    builtin BOOLEAN NOT NULL DEFAULT false,
+    createdAt timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO metrics (name, unit, minValue, maxValue, `precision`, builtin) VALUES
+    ('temperature', '°C', -40, 85, 2, true),
+    ('humidity', '%', 0, 100, 2, true),
+    ('carbondioxide', 'ppm', 0, 99999, 2, true),
+    ('airQualityIndex', '', 0, 500, 0, true),
+    ('staticIaq', '', 0, 500, 2, true),
+    ('iaqAccuracy', '', 0, 3, 0, true),
+    ('breathVocEquivalent', 'ppm', 0, 99999, 2, true),
+    ('pressure', 'hPa', 300, 1100, 2, true),
+    ('gasResistance', 'Ohm', 0, 99999999, 2, true),
+    ('stabilizationStatus', '', 0, 1, 0, true),
+    ('pm25', 'µg/m³', 0, 1000, 1, false),
+    ('noise', 'dB', 0, 140, 1, false);
+
+CREATE TABLE sensor_reading_values(
+    readingId INT NOT NULL,
+    metric VARCHAR(64) NOT NULL,
+    value DOUBLE NOT NULL,
+    PRIMARY KEY (readingId, metric),
+    FOREIGN KEY (readingId) References sensor_readings(id) ON DELETE CASCADE,
+    FOREIGN KEY (metric) References metrics(name)
+);
@@ -0,0 +1,11 @@
+CREATE TABLE rejected_readings(
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    deviceId INT NOT NULL,
+    status SMALLINT NOT NULL,
+    error VARCHAR(255) NOT NULL,
+    fieldErrors JSON,
+    payload JSON NOT NULL,
+    createdAt timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (deviceId) References devices(id),
+    INDEX (deviceId, id)
+);
@@ -0,0 +1,3 @@
+DROP TABLE alert_transitions;
+DROP TABLE alerts;
+DROP TABLE alert_rules;
@@ -0,0 +1,43 @@
+CREATE TABLE alert_rules(
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    deviceId INT,
+    localization VARCHAR(255),
+    metric VARCHAR(64) NOT NULL,
+    comparator VARCHAR(2) NOT NULL,
+    threshold DOUBLE NOT NULL,
+    durationSeconds INT NOT NULL DEFAULT 0,
+    hysteresis DOUBLE NOT NULL DEFAULT 0,
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    createdAt timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (deviceId) References devices(id) ON DELETE CASCADE,
+    FOREIGN KEY (metric) References metrics(name)
+);
+
+CREATE TABLE alerts(
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    ruleId INT NOT NULL,
+    deviceId INT NOT NULL,
+    state VARCHAR(16) NOT NULL,
+    value DOUBLE NOT NULL,
+    startedAt timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    firedAt timestamp NULL,
+    resolvedAt timestamp NULL,
+    FOREIGN KEY (ruleId) References alert_rules(id) ON DELETE CASCADE,
+    FOREIGN KEY (deviceId) References devices(id),
+    INDEX (ruleId, deviceId, state),
+    INDEX (state, id)
+);
+
+CREATE TABLE alert_transitions(
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    alertId INT NOT NULL,
+    ruleId INT NOT NULL,
+    deviceId INT NOT NULL,
+    state VARCHAR(16) NOT NULL,
+    value DOUBLE NOT NULL,
+    at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (alertId) References alerts(id) ON DELETE CASCADE,
+    INDEX (deviceId, id),
+    INDEX (ruleId, id)
+);
@@ -0,0 +1,27 @@
+CREATE TABLE webhooks(
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    url VARCHAR(2048) NOT NULL,
+    format VARCHAR(16) NOT NULL DEFAULT 'json',
+    events VARCHAR(1024) NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    secret VARCHAR(64) NOT NULL,
+    createdAt timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE webhook_deliveries(
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    webhookId INT NOT NULL,
+    event VARCHAR(64) NOT NULL,
+    body JSON NOT NULL,
+    status VARCHAR(16) NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    nextAttemptAt timestamp NULL,
+    responseStatus SMALLINT,
+    error VARCHAR(1024) NOT NULL DEFAULT '',
+    createdAt timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    deliveredAt timestamp NULL,
+    FOREIGN KEY (webhookId) References webhooks(id) ON DELETE CASCADE,
+    INDEX (status, nextAttemptAt),
+    INDEX (webhookId, id)
+);
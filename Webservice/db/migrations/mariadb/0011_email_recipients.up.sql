@@ -0,0 +1,10 @@
+CREATE TABLE email_recipients(
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    email VARCHAR(254) NOT NULL,
+    language CHAR(2) NOT NULL DEFAULT 'de',
+    events VARCHAR(1024) NOT NULL,
+    deviceId INT,
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    createdAt timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (deviceId) References devices(id) ON DELETE CASCADE
+);
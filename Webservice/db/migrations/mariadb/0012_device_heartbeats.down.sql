@@ -0,0 +1,6 @@
+DROP TABLE device_heartbeats;
+
+ALTER TABLE devices
+    DROP INDEX devices_online,
+    DROP COLUMN online,
+    DROP COLUMN lastSeenAt;
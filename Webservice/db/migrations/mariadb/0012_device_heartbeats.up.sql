@@ -0,0 +1,14 @@
+ALTER TABLE devices
+    ADD COLUMN lastSeenAt timestamp NULL,
+    ADD COLUMN online BOOLEAN NOT NULL DEFAULT false,
+    ADD INDEX devices_online (online, lastSeenAt);
+
+CREATE TABLE device_heartbeats(
+    deviceId INT PRIMARY KEY,
+    rssi SMALLINT,
+    uptime BIGINT,
+    freeHeap INT,
+    firmwareVersion VARCHAR(64) NOT NULL DEFAULT '',
+    receivedAt timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (deviceId) References devices(id) ON DELETE CASCADE
+);
@@ -0,0 +1,9 @@
+DROP TABLE archived_sensor_readings;
+DROP TABLE archived_devices;
+
+-- fails while a soft deleted device shares its mac address with another device
+ALTER TABLE devices
+    ADD UNIQUE KEY macAddress (macAddress),
+    DROP INDEX devices_active_mac,
+    DROP COLUMN activeMacAddress,
+    DROP COLUMN deletedAt;
@@ -0,0 +1,36 @@
+ALTER TABLE devices
+    ADD COLUMN deletedAt timestamp NULL,
+    ADD COLUMN activeMacAddress VARCHAR(255) AS (IF(deletedAt IS NULL, macAddress, NULL)) STORED,
+    ADD UNIQUE KEY devices_active_mac (activeMacAddress),
+    DROP INDEX macAddress;
+
+CREATE TABLE archived_devices(
+    id INT PRIMARY KEY,
+    macAddress VARCHAR(255),
+    name VARCHAR(255),
+    localization VARCHAR(255),
+    createdAt timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    archivedAt timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE archived_sensor_readings(
+    id INT PRIMARY KEY,
+    deviceId INT NOT NULL,
+    temperature decimal(5,2),
+    humidity decimal(5,2),
+    carbondioxide decimal(7,2),
+    airQualityIndex SMALLINT,
+    staticIaq decimal(5,2),
+    iaqAccuracy TINYINT,
+    breathVocEquivalent decimal(7,2),
+    pressure decimal(6,2),
+    gasResistance decimal(10,2),
+    stabilizationStatus BOOLEAN,
+    metrics JSON,
+    createdAt timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    measuredAt timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    sequence BIGINT,
+    idempotencyKey VARCHAR(64),
+    FOREIGN KEY (deviceId) References archived_devices(id),
+    INDEX (deviceId, measuredAt)
+);
@@ -0,0 +1,6 @@
+DROP TABLE device_decisions;
+DROP TABLE blocked_devices;
+
+ALTER TABLE requested_devices
+    DROP COLUMN decidedAt,
+    DROP COLUMN decidedBy;
@@ -0,0 +1,24 @@
+ALTER TABLE requested_devices
+    ADD COLUMN decidedBy INT,
+    ADD COLUMN decidedAt timestamp NULL;
+
+CREATE TABLE blocked_devices(
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    macAddress VARCHAR(255) NOT NULL,
+    reason VARCHAR(255) NOT NULL DEFAULT '',
+    blockedBy INT,
+    createdAt timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY (macAddress),
+    FOREIGN KEY (blockedBy) References users(id) ON DELETE SET NULL
+);
+
+CREATE TABLE device_decisions(
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    macAddress VARCHAR(255) NOT NULL,
+    decision VARCHAR(16) NOT NULL,
+    reason VARCHAR(255) NOT NULL DEFAULT '',
+    userId INT,
+    createdAt timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (userId) References users(id) ON DELETE SET NULL,
+    INDEX (macAddress, id)
+);
@@ -0,0 +1,20 @@
+DELETE FROM sensor_reading_rollups;
+UPDATE sensor_reading_rollup_state SET lastReadingId = 0 WHERE id = 1;
+
+ALTER TABLE sensor_reading_rollups
+    DROP COLUMN temperatureCount,
+    MODIFY temperatureMin DOUBLE NOT NULL,
+    MODIFY temperatureMax DOUBLE NOT NULL,
+    MODIFY temperatureLast DOUBLE NOT NULL,
+    DROP COLUMN airQualityIndexCount,
+    MODIFY airQualityIndexMin DOUBLE NOT NULL,
+    MODIFY airQualityIndexMax DOUBLE NOT NULL,
+    MODIFY airQualityIndexLast DOUBLE NOT NULL,
+    DROP COLUMN humidityCount,
+    MODIFY humidityMin DOUBLE NOT NULL,
+    MODIFY humidityMax DOUBLE NOT NULL,
+    MODIFY humidityLast DOUBLE NOT NULL,
+    DROP COLUMN carbondioxideCount,
+    MODIFY carbondioxideMin DOUBLE NOT NULL,
+    MODIFY carbondioxideMax DOUBLE NOT NULL,
+    MODIFY carbondioxideLast DOUBLE NOT NULL;
@@ -0,0 +1,22 @@
+-- The rollups counted readings without a value as zeros. Missing values are
+-- left out now and the rollup worker builds the rollups again from the start.
+DELETE FROM sensor_reading_rollups;
+UPDATE sensor_reading_rollup_state SET lastReadingId = 0 WHERE id = 1;
+
+ALTER TABLE sensor_reading_rollups
+    ADD COLUMN temperatureCount INT NOT NULL DEFAULT 0 AFTER temperatureLast,
+    MODIFY temperatureMin DOUBLE NULL,
+    MODIFY temperatureMax DOUBLE NULL,
+    MODIFY temperatureLast DOUBLE NULL,
+    ADD COLUMN airQualityIndexCount INT NOT NULL DEFAULT 0 AFTER airQualityIndexLast,
+    MODIFY airQualityIndexMin DOUBLE NULL,
+    MODIFY airQualityIndexMax DOUBLE NULL,
+    MODIFY airQualityIndexLast DOUBLE NULL,
+    ADD COLUMN humidityCount INT NOT NULL DEFAULT 0 AFTER humidityLast,
+    MODIFY humidityMin DOUBLE NULL,
+    MODIFY humidityMax DOUBLE NULL,
+    MODIFY humidityLast DOUBLE NULL,
+    ADD COLUMN carbondioxideCount INT NOT NULL DEFAULT 0 AFTER carbondioxideLast,
+    MODIFY carbondioxideMin DOUBLE NULL,
+    MODIFY carbondioxideMax DOUBLE NULL,
+    MODIFY carbondioxideLast DOUBLE NULL;
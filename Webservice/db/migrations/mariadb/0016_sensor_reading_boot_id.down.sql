@@ -0,0 +1,15 @@
+-- Readings of later boots that repeat a sequence number lose it, the key is
+-- unique per device again.
+UPDATE sensor_readings r
+    JOIN (SELECT deviceId, sequence, MIN(id) AS id FROM sensor_readings WHERE sequence IS NOT NULL
+          GROUP BY deviceId, sequence) first ON first.deviceId = r.deviceId AND first.sequence = r.sequence
+    SET r.sequence = NULL
+    WHERE r.id <> first.id;
+
+ALTER TABLE sensor_readings
+    DROP INDEX sensor_readings_sequence,
+    ADD UNIQUE KEY sensor_readings_sequence (deviceId, sequence),
+    DROP COLUMN bootId;
+
+ALTER TABLE archived_sensor_readings
+    DROP COLUMN bootId;
@@ -0,0 +1,10 @@
+-- Devices count their sequence numbers from the start again after a reboot,
+-- the numbers are unique per boot ID sent by the device. Devices without one
+-- keep the empty boot ID.
+ALTER TABLE sensor_readings
+    ADD COLUMN bootId VARCHAR(64) NOT NULL DEFAULT '' AFTER measuredAt,
+    DROP INDEX sensor_readings_sequence,
+    ADD UNIQUE KEY sensor_readings_sequence (deviceId, bootId, sequence);
+
+ALTER TABLE archived_sensor_readings
+    ADD COLUMN bootId VARCHAR(64) NOT NULL DEFAULT '' AFTER measuredAt;
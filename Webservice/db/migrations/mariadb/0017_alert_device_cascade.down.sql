@@ -0,0 +1,3 @@
+ALTER TABLE alerts
+    DROP FOREIGN KEY alerts_device,
+    ADD CONSTRAINT alerts_ibfk_2 FOREIGN KEY (deviceId) REFERENCES devices(id);
@@ -0,0 +1,4 @@
+-- The alerts of a device are deleted with it, like its alert rules.
+ALTER TABLE alerts
+    DROP FOREIGN KEY alerts_ibfk_2,
+    ADD CONSTRAINT alerts_device FOREIGN KEY (deviceId) REFERENCES devices(id) ON DELETE CASCADE;
@@ -0,0 +1,299 @@
+-- PostgreSQL starts at the schema of MariaDB migration 0014. sensor_readings
+-- is laid out so that migration 0002 can turn it into a TimescaleDB
+-- hypertable: its keys include measuredAt, sequence and idempotencyKey are
+-- checked by the store instead of unique keys, and sensor_reading_values has
+-- no foreign key to it.
+CREATE TABLE users(
+    id SERIAL PRIMARY KEY,
+    username VARCHAR(255) NOT NULL,
+    password VARCHAR(255) NOT NULL,
+    createdAt TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (username)
+);
+
+CREATE TABLE devices (
+    id SERIAL PRIMARY KEY,
+    macAddress VARCHAR(255),
+    name VARCHAR(255),
+    localization VARCHAR(255),
+    createdAt TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    lastSeenAt TIMESTAMPTZ NULL,
+    online BOOLEAN NOT NULL DEFAULT false,
+    deletedAt TIMESTAMPTZ NULL
+);
+
+CREATE UNIQUE INDEX devices_active_mac ON devices(macAddress) WHERE deletedAt IS NULL;
+CREATE INDEX devices_online ON devices(online, lastSeenAt);
+
+CREATE TABLE requested_devices (
+    id SERIAL PRIMARY KEY,
+    macAddress VARCHAR(255),
+    createdAt TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    active BOOLEAN,
+    decidedBy INT,
+    decidedAt TIMESTAMPTZ NULL,
+    UNIQUE (macAddress)
+);
+
+CREATE TABLE sensor_readings(
+    id SERIAL,
+    deviceId INT NOT NULL,
+    temperature DECIMAL(5,2),
+    humidity DECIMAL(5,2),
+    carbondioxide DECIMAL(7,2),
+    airQualityIndex SMALLINT,
+    staticIaq DECIMAL(5,2),
+    iaqAccuracy SMALLINT,
+    breathVocEquivalent DECIMAL(7,2),
+    pressure DECIMAL(6,2),
+    gasResistance DECIMAL(10,2),
+    stabilizationStatus BOOLEAN,
+    createdAt TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    measuredAt TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    sequence BIGINT,
+    idempotencyKey VARCHAR(64),
+    PRIMARY KEY (id, measuredAt),
+    FOREIGN KEY (deviceId) References devices(id)
+);
+
+CREATE INDEX sensor_readings_id ON sensor_readings(id);
+CREATE INDEX sensor_readings_sequence ON sensor_readings(deviceId, sequence);
+CREATE INDEX sensor_readings_idempotency_key ON sensor_readings(deviceId, idempotencyKey);
+CREATE INDEX sensor_readings_device_measured ON sensor_readings(deviceId, measuredAt, id);
+CREATE INDEX sensor_readings_measured ON sensor_readings(measuredAt, id);
+
+CREATE TABLE sensor_reading_rollups(
+    deviceId INT NOT NULL,
+    resolution VARCHAR(16) NOT NULL,
+    bucketStart TIMESTAMPTZ NOT NULL,
+    count INT NOT NULL,
+    temperatureSum DOUBLE PRECISION NOT NULL,
+    temperatureMin DOUBLE PRECISION NOT NULL,
+    temperatureMax DOUBLE PRECISION NOT NULL,
+    temperatureLast DOUBLE PRECISION NOT NULL,
+    airQualityIndexSum DOUBLE PRECISION NOT NULL,
+    airQualityIndexMin DOUBLE PRECISION NOT NULL,
+    airQualityIndexMax DOUBLE PRECISION NOT NULL,
+    airQualityIndexLast DOUBLE PRECISION NOT NULL,
+    humiditySum DOUBLE PRECISION NOT NULL,
+    humidityMin DOUBLE PRECISION NOT NULL,
+    humidityMax DOUBLE PRECISION NOT NULL,
+    humidityLast DOUBLE PRECISION NOT NULL,
+    carbondioxideSum DOUBLE PRECISION NOT NULL,
+    carbondioxideMin DOUBLE PRECISION NOT NULL,
+    carbondioxideMax DOUBLE PRECISION NOT NULL,
+    carbondioxideLast DOUBLE PRECISION NOT NULL,
+    lastAt TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (deviceId, resolution, bucketStart),
+    FOREIGN KEY (deviceId) References devices(id)
+);
+
+CREATE TABLE sensor_reading_rollup_state(
+    id INT PRIMARY KEY,
+    lastReadingId INT NOT NULL
+);
+
+INSERT INTO sensor_reading_rollup_state (id, lastReadingId) VALUES (1, 0);
+
+CREATE TABLE device_keys(
+    deviceId INT PRIMARY KEY,
+    keyHash CHAR(64) NOT NULL,
+    createdAt TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (keyHash),
+    FOREIGN KEY (deviceId) References devices(id)
+);
+
+CREATE TABLE metrics(
+    name VARCHAR(64) PRIMARY KEY,
+    unit VARCHAR(16) NOT NULL DEFAULT '',
+    minValue DOUBLE PRECISION,
+    maxValue DOUBLE PRECISION,
+    "precision" SMALLINT NOT NULL DEFAULT 2,
+    builtin BOOLEAN NOT NULL DEFAULT false,
+    createdAt TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO metrics (name, unit, minValue, maxValue, "precision", builtin) VALUES
+    ('temperature', '°C', -40, 85, 2, true),
+    ('humidity', '%', 0, 100, 2, true),
+    ('carbondioxide', 'ppm', 0, 99999, 2, true),
+    ('airQualityIndex', '', 0, 500, 0, true),
+    ('staticIaq', '', 0, 500, 2, true),
+    ('iaqAccuracy', '', 0, 3, 0, true),
+    ('breathVocEquivalent', 'ppm', 0, 99999, 2, true),
+    ('pressure', 'hPa', 300, 1100, 2, true),
+    ('gasResistance', 'Ohm', 0, 99999999, 2, true),
+    ('stabilizationStatus', '', 0, 1, 0, true),
+    ('pm25', 'µg/m³', 0, 1000, 1, false),
+    ('noise', 'dB', 0, 140, 1, false);
+
+CREATE TABLE sensor_reading_values(
+    readingId INT NOT NULL,
+    metric VARCHAR(64) NOT NULL,
+    value DOUBLE PRECISION NOT NULL,
+    PRIMARY KEY (readingId, metric),
+    FOREIGN KEY (metric) References metrics(name)
+);
+
+CREATE TABLE rejected_readings(
+    id SERIAL PRIMARY KEY,
+    deviceId INT NOT NULL,
+    status SMALLINT NOT NULL,
+    error VARCHAR(255) NOT NULL,
+    fieldErrors JSONB,
+    payload JSONB NOT NULL,
+    createdAt TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (deviceId) References devices(id)
+);
+
+CREATE INDEX rejected_readings_device ON rejected_readings(deviceId, id);
+
+CREATE TABLE alert_rules(
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    deviceId INT,
+    localization VARCHAR(255),
+    metric VARCHAR(64) NOT NULL,
+    comparator VARCHAR(2) NOT NULL,
+    threshold DOUBLE PRECISION NOT NULL,
+    durationSeconds INT NOT NULL DEFAULT 0,
+    hysteresis DOUBLE PRECISION NOT NULL DEFAULT 0,
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    createdAt TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (deviceId) References devices(id) ON DELETE CASCADE,
+    FOREIGN KEY (metric) References metrics(name)
+);
+
+CREATE TABLE alerts(
+    id SERIAL PRIMARY KEY,
+    ruleId INT NOT NULL,
+    deviceId INT NOT NULL,
+    state VARCHAR(16) NOT NULL,
+    value DOUBLE PRECISION NOT NULL,
+    startedAt TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    firedAt TIMESTAMPTZ NULL,
+    resolvedAt TIMESTAMPTZ NULL,
+    FOREIGN KEY (ruleId) References alert_rules(id) ON DELETE CASCADE,
+    FOREIGN KEY (deviceId) References devices(id)
+);
+
+CREATE INDEX alerts_rule_device ON alerts(ruleId, deviceId, state);
+CREATE INDEX alerts_state ON alerts(state, id);
+
+CREATE TABLE alert_transitions(
+    id SERIAL PRIMARY KEY,
+    alertId INT NOT NULL,
+    ruleId INT NOT NULL,
+    deviceId INT NOT NULL,
+    state VARCHAR(16) NOT NULL,
+    value DOUBLE PRECISION NOT NULL,
+    at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (alertId) References alerts(id) ON DELETE CASCADE
+);
+
+CREATE INDEX alert_transitions_device ON alert_transitions(deviceId, id);
+CREATE INDEX alert_transitions_rule ON alert_transitions(ruleId, id);
+
+CREATE TABLE webhooks(
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    url VARCHAR(2048) NOT NULL,
+    format VARCHAR(16) NOT NULL DEFAULT 'json',
+    events VARCHAR(1024) NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    secret VARCHAR(64) NOT NULL,
+    createdAt TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE webhook_deliveries(
+    id SERIAL PRIMARY KEY,
+    webhookId INT NOT NULL,
+    event VARCHAR(64) NOT NULL,
+    body JSONB NOT NULL,
+    status VARCHAR(16) NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    nextAttemptAt TIMESTAMPTZ NULL,
+    responseStatus SMALLINT,
+    error VARCHAR(1024) NOT NULL DEFAULT '',
+    createdAt TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    deliveredAt TIMESTAMPTZ NULL,
+    FOREIGN KEY (webhookId) References webhooks(id) ON DELETE CASCADE
+);
+
+CREATE INDEX webhook_deliveries_due ON webhook_deliveries(status, nextAttemptAt);
+CREATE INDEX webhook_deliveries_webhook ON webhook_deliveries(webhookId, id);
+
+CREATE TABLE email_recipients(
+    id SERIAL PRIMARY KEY,
+    email VARCHAR(254) NOT NULL,
+    language CHAR(2) NOT NULL DEFAULT 'de',
+    events VARCHAR(1024) NOT NULL,
+    deviceId INT,
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    createdAt TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (deviceId) References devices(id) ON DELETE CASCADE
+);
+
+CREATE TABLE device_heartbeats(
+    deviceId INT PRIMARY KEY,
+    rssi SMALLINT,
+    uptime BIGINT,
+    freeHeap INT,
+    firmwareVersion VARCHAR(64) NOT NULL DEFAULT '',
+    receivedAt TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (deviceId) References devices(id) ON DELETE CASCADE
+);
+
+CREATE TABLE archived_devices(
+    id INT PRIMARY KEY,
+    macAddress VARCHAR(255),
+    name VARCHAR(255),
+    localization VARCHAR(255),
+    createdAt TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    archivedAt TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE archived_sensor_readings(
+    id INT PRIMARY KEY,
+    deviceId INT NOT NULL,
+    temperature DECIMAL(5,2),
+    humidity DECIMAL(5,2),
+    carbondioxide DECIMAL(7,2),
+    airQualityIndex SMALLINT,
+    staticIaq DECIMAL(5,2),
+    iaqAccuracy SMALLINT,
+    breathVocEquivalent DECIMAL(7,2),
+    pressure DECIMAL(6,2),
+    gasResistance DECIMAL(10,2),
+    stabilizationStatus BOOLEAN,
+    metrics JSONB,
+    createdAt TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    measuredAt TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    sequence BIGINT,
+    idempotencyKey VARCHAR(64),
+    FOREIGN KEY (deviceId) References archived_devices(id)
+);
+
+CREATE INDEX archived_sensor_readings_device ON archived_sensor_readings(deviceId, measuredAt);
+
+CREATE TABLE blocked_devices(
+    id SERIAL PRIMARY KEY,
+    macAddress VARCHAR(255) NOT NULL,
+    reason VARCHAR(255) NOT NULL DEFAULT '',
+    blockedBy INT,
+    createdAt TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (macAddress),
+    FOREIGN KEY (blockedBy) References users(id) ON DELETE SET NULL
+);
+
+CREATE TABLE device_decisions(
+    id SERIAL PRIMARY KEY,
+    macAddress VARCHAR(255) NOT NULL,
+    decision VARCHAR(16) NOT NULL,
+    reason VARCHAR(255) NOT NULL DEFAULT '',
+    userId INT,
+    createdAt TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (userId) References users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX device_decisions_mac ON device_decisions(macAddress, id);
@@ -0,0 +1,41 @@
+DO $$
+BEGIN
+    IF to_regclass('sensor_reading_rollups_hourly') IS NOT NULL THEN
+        DROP VIEW sensor_reading_rollups;
+        CREATE VIEW sensor_reading_rollups AS
+            SELECT 'hourly' AS resolution, * FROM sensor_reading_rollups_hourly
+            UNION ALL
+            SELECT 'daily' AS resolution, * FROM sensor_reading_rollups_daily;
+        CREATE RULE sensor_reading_rollups_delete AS ON DELETE TO sensor_reading_rollups DO INSTEAD NOTHING;
+        RETURN;
+    END IF;
+
+    DROP TABLE sensor_reading_rollups;
+    CREATE TABLE sensor_reading_rollups(
+        deviceId INT NOT NULL,
+        resolution VARCHAR(16) NOT NULL,
+        bucketStart TIMESTAMPTZ NOT NULL,
+        count INT NOT NULL,
+        temperatureSum DOUBLE PRECISION NOT NULL,
+        temperatureMin DOUBLE PRECISION NOT NULL,
+        temperatureMax DOUBLE PRECISION NOT NULL,
+        temperatureLast DOUBLE PRECISION NOT NULL,
+        airQualityIndexSum DOUBLE PRECISION NOT NULL,
+        airQualityIndexMin DOUBLE PRECISION NOT NULL,
+        airQualityIndexMax DOUBLE PRECISION NOT NULL,
+        airQualityIndexLast DOUBLE PRECISION NOT NULL,
+        humiditySum DOUBLE PRECISION NOT NULL,
+        humidityMin DOUBLE PRECISION NOT NULL,
+        humidityMax DOUBLE PRECISION NOT NULL,
+        humidityLast DOUBLE PRECISION NOT NULL,
+        carbondioxideSum DOUBLE PRECISION NOT NULL,
+        carbondioxideMin DOUBLE PRECISION NOT NULL,
+        carbondioxideMax DOUBLE PRECISION NOT NULL,
+        carbondioxideLast DOUBLE PRECISION NOT NULL,
+        lastAt TIMESTAMPTZ NOT NULL,
+        PRIMARY KEY (deviceId, resolution, bucketStart),
+        FOREIGN KEY (deviceId) References devices(id)
+    );
+    UPDATE sensor_reading_rollup_state SET lastReadingId = 0 WHERE id = 1;
+END
+$$;
@@ -0,0 +1,53 @@
+-- The rollups counted readings without a value as zeros. Missing values are
+-- left out now and the rollup worker builds the rollups again from the start.
+-- The continuous aggregates of TimescaleDB still count missing values as
+-- zeros, their view gets the count columns of the table.
+DO $$
+BEGIN
+    IF to_regclass('sensor_reading_rollups_hourly') IS NOT NULL THEN
+        DROP VIEW sensor_reading_rollups;
+        CREATE VIEW sensor_reading_rollups AS
+            SELECT 'hourly' AS resolution, *, count AS temperatureCount, count AS airQualityIndexCount,
+                count AS humidityCount, count AS carbondioxideCount
+            FROM sensor_reading_rollups_hourly
+            UNION ALL
+            SELECT 'daily' AS resolution, *, count AS temperatureCount, count AS airQualityIndexCount,
+                count AS humidityCount, count AS carbondioxideCount
+            FROM sensor_reading_rollups_daily;
+        CREATE RULE sensor_reading_rollups_delete AS ON DELETE TO sensor_reading_rollups DO INSTEAD NOTHING;
+        RETURN;
+    END IF;
+
+    DROP TABLE sensor_reading_rollups;
+    CREATE TABLE sensor_reading_rollups(
+        deviceId INT NOT NULL,
+        resolution VARCHAR(16) NOT NULL,
+        bucketStart TIMESTAMPTZ NOT NULL,
+        count INT NOT NULL,
+        temperatureCount INT NOT NULL,
+        temperatureSum DOUBLE PRECISION NOT NULL,
+        temperatureMin DOUBLE PRECISION,
+        temperatureMax DOUBLE PRECISION,
+        temperatureLast DOUBLE PRECISION,
+        airQualityIndexCount INT NOT NULL,
+        airQualityIndexSum DOUBLE PRECISION NOT NULL,
+        airQualityIndexMin DOUBLE PRECISION,
+        airQualityIndexMax DOUBLE PRECISION,
+        airQualityIndexLast DOUBLE PRECISION,
+        humidityCount INT NOT NULL,
+        humiditySum DOUBLE PRECISION NOT NULL,
+        humidityMin DOUBLE PRECISION,
+        humidityMax DOUBLE PRECISION,
+        humidityLast DOUBLE PRECISION,
+        carbondioxideCount INT NOT NULL,
+        carbondioxideSum DOUBLE PRECISION NOT NULL,
+        carbondioxideMin DOUBLE PRECISION,
+        carbondioxideMax DOUBLE PRECISION,
+        carbondioxideLast DOUBLE PRECISION,
+        lastAt TIMESTAMPTZ NOT NULL,
+        PRIMARY KEY (deviceId, resolution, bucketStart),
+        FOREIGN KEY (deviceId) References devices(id)
+    );
+    UPDATE sensor_reading_rollup_state SET lastReadingId = 0 WHERE id = 1;
+END
+$$;
@@ -0,0 +1,5 @@
+ALTER TABLE archived_sensor_readings DROP COLUMN bootId;
+
+DROP INDEX sensor_readings_sequence;
+ALTER TABLE sensor_readings DROP COLUMN bootId;
+CREATE INDEX sensor_readings_sequence ON sensor_readings(deviceId, sequence);
@@ -0,0 +1,9 @@
+-- Devices count their sequence numbers from the start again after a reboot,
+-- the numbers are unique per boot ID sent by the device. Devices without one
+-- keep the empty boot ID.
+ALTER TABLE sensor_readings ADD COLUMN bootId VARCHAR(64) NOT NULL DEFAULT '';
+
+DROP INDEX sensor_readings_sequence;
+CREATE INDEX sensor_readings_sequence ON sensor_readings(deviceId, bootId, sequence);
+
+ALTER TABLE archived_sensor_readings ADD COLUMN bootId VARCHAR(64) NOT NULL DEFAULT '';
@@ -0,0 +1,3 @@
+ALTER TABLE alerts
+    DROP CONSTRAINT alerts_deviceid_fkey,
+    ADD CONSTRAINT alerts_deviceid_fkey FOREIGN KEY (deviceId) REFERENCES devices(id);
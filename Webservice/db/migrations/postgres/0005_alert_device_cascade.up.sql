@@ -0,0 +1,4 @@
+-- The alerts of a device are deleted with it, like its alert rules.
+ALTER TABLE alerts
+    DROP CONSTRAINT alerts_deviceid_fkey,
+    ADD CONSTRAINT alerts_deviceid_fkey FOREIGN KEY (deviceId) REFERENCES devices(id) ON DELETE CASCADE;
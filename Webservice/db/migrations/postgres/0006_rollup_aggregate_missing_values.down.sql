@@ -0,0 +1,78 @@
+-- Builds the continuous aggregates of migration 0002 again, they count
+-- missing values as zeros.
+DO $$
+BEGIN
+    IF to_regclass('sensor_reading_rollups_hourly') IS NULL THEN
+        RETURN;
+    END IF;
+
+    DROP VIEW sensor_reading_rollups;
+    DROP MATERIALIZED VIEW sensor_reading_rollups_daily;
+    DROP MATERIALIZED VIEW sensor_reading_rollups_hourly;
+
+    CREATE MATERIALIZED VIEW sensor_reading_rollups_hourly
+        WITH (timescaledb.continuous, timescaledb.materialized_only = false) AS
+        SELECT deviceId, time_bucket(INTERVAL '1 hour', measuredAt) AS bucketStart, COUNT(*) AS count,
+            SUM(COALESCE(temperature, 0)) AS temperatureSum,
+            MIN(COALESCE(temperature, 0)) AS temperatureMin,
+            MAX(COALESCE(temperature, 0)) AS temperatureMax,
+            last(COALESCE(temperature, 0), measuredAt) AS temperatureLast,
+            SUM(COALESCE(airQualityIndex, 0)) AS airQualityIndexSum,
+            MIN(COALESCE(airQualityIndex, 0)) AS airQualityIndexMin,
+            MAX(COALESCE(airQualityIndex, 0)) AS airQualityIndexMax,
+            last(COALESCE(airQualityIndex, 0), measuredAt) AS airQualityIndexLast,
+            SUM(COALESCE(humidity, 0)) AS humiditySum,
+            MIN(COALESCE(humidity, 0)) AS humidityMin,
+            MAX(COALESCE(humidity, 0)) AS humidityMax,
+            last(COALESCE(humidity, 0), measuredAt) AS humidityLast,
+            SUM(COALESCE(carbondioxide, 0)) AS carbondioxideSum,
+            MIN(COALESCE(carbondioxide, 0)) AS carbondioxideMin,
+            MAX(COALESCE(carbondioxide, 0)) AS carbondioxideMax,
+            last(COALESCE(carbondioxide, 0), measuredAt) AS carbondioxideLast,
+            MAX(measuredAt) AS lastAt
+        FROM sensor_readings
+        GROUP BY deviceId, bucketStart
+        WITH NO DATA;
+
+    CREATE MATERIALIZED VIEW sensor_reading_rollups_daily
+        WITH (timescaledb.continuous, timescaledb.materialized_only = false) AS
+        SELECT deviceId, time_bucket(INTERVAL '1 day', measuredAt) AS bucketStart, COUNT(*) AS count,
+            SUM(COALESCE(temperature, 0)) AS temperatureSum,
+            MIN(COALESCE(temperature, 0)) AS temperatureMin,
+            MAX(COALESCE(temperature, 0)) AS temperatureMax,
+            last(COALESCE(temperature, 0), measuredAt) AS temperatureLast,
+            SUM(COALESCE(airQualityIndex, 0)) AS airQualityIndexSum,
+            MIN(COALESCE(airQualityIndex, 0)) AS airQualityIndexMin,
+            MAX(COALESCE(airQualityIndex, 0)) AS airQualityIndexMax,
+            last(COALESCE(airQualityIndex, 0), measuredAt) AS airQualityIndexLast,
+            SUM(COALESCE(humidity, 0)) AS humiditySum,
+            MIN(COALESCE(humidity, 0)) AS humidityMin,
+            MAX(COALESCE(humidity, 0)) AS humidityMax,
+            last(COALESCE(humidity, 0), measuredAt) AS humidityLast,
+            SUM(COALESCE(carbondioxide, 0)) AS carbondioxideSum,
+            MIN(COALESCE(carbondioxide, 0)) AS carbondioxideMin,
+            MAX(COALESCE(carbondioxide, 0)) AS carbondioxideMax,
+            last(COALESCE(carbondioxide, 0), measuredAt) AS carbondioxideLast,
+            MAX(measuredAt) AS lastAt
+        FROM sensor_readings
+        GROUP BY deviceId, bucketStart
+        WITH NO DATA;
+
+    -- Readings may arrive up to MAX_READING_AGE late, seven days by default.
+    PERFORM add_continuous_aggregate_policy('sensor_reading_rollups_hourly',
+        start_offset => INTERVAL '8 days', end_offset => INTERVAL '1 hour', schedule_interval => INTERVAL '15 minutes');
+    PERFORM add_continuous_aggregate_policy('sensor_reading_rollups_daily',
+        start_offset => INTERVAL '9 days', end_offset => INTERVAL '1 day', schedule_interval => INTERVAL '1 hour');
+
+    CREATE VIEW sensor_reading_rollups AS
+        SELECT 'hourly' AS resolution, *, count AS temperatureCount, count AS airQualityIndexCount,
+            count AS humidityCount, count AS carbondioxideCount
+        FROM sensor_reading_rollups_hourly
+        UNION ALL
+        SELECT 'daily' AS resolution, *, count AS temperatureCount, count AS airQualityIndexCount,
+            count AS humidityCount, count AS carbondioxideCount
+        FROM sensor_reading_rollups_daily;
+
+    CREATE RULE sensor_reading_rollups_delete AS ON DELETE TO sensor_reading_rollups DO INSTEAD NOTHING;
+END
+$$;
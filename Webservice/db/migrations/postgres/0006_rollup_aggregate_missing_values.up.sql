@@ -0,0 +1,87 @@
+-- The continuous aggregates of migration 0002 counted readings without a
+-- value as zeros. They are built again leaving missing values out, like the
+-- rollup table since migration 0003, and count the values of every metric.
+-- Without TimescaleDB the migration changes nothing.
+--
+-- Only the readings of the last days are materialized by the refresh
+-- policies, `rollup-backfill` materializes the older ones again.
+DO $$
+BEGIN
+    IF to_regclass('sensor_reading_rollups_hourly') IS NULL THEN
+        RETURN;
+    END IF;
+
+    DROP VIEW sensor_reading_rollups;
+    DROP MATERIALIZED VIEW sensor_reading_rollups_daily;
+    DROP MATERIALIZED VIEW sensor_reading_rollups_hourly;
+
+    CREATE MATERIALIZED VIEW sensor_reading_rollups_hourly
+        WITH (timescaledb.continuous, timescaledb.materialized_only = false) AS
+        SELECT deviceId, time_bucket(INTERVAL '1 hour', measuredAt) AS bucketStart, COUNT(*) AS count,
+            COUNT(temperature) AS temperatureCount,
+            COALESCE(SUM(temperature), 0) AS temperatureSum,
+            MIN(temperature) AS temperatureMin,
+            MAX(temperature) AS temperatureMax,
+            last(temperature, measuredAt) AS temperatureLast,
+            COUNT(airQualityIndex) AS airQualityIndexCount,
+            COALESCE(SUM(airQualityIndex), 0) AS airQualityIndexSum,
+            MIN(airQualityIndex) AS airQualityIndexMin,
+            MAX(airQualityIndex) AS airQualityIndexMax,
+            last(airQualityIndex, measuredAt) AS airQualityIndexLast,
+            COUNT(humidity) AS humidityCount,
+            COALESCE(SUM(humidity), 0) AS humiditySum,
+            MIN(humidity) AS humidityMin,
+            MAX(humidity) AS humidityMax,
+            last(humidity, measuredAt) AS humidityLast,
+            COUNT(carbondioxide) AS carbondioxideCount,
+            COALESCE(SUM(carbondioxide), 0) AS carbondioxideSum,
+            MIN(carbondioxide) AS carbondioxideMin,
+            MAX(carbondioxide) AS carbondioxideMax,
+            last(carbondioxide, measuredAt) AS carbondioxideLast,
+            MAX(measuredAt) AS lastAt
+        FROM sensor_readings
+        GROUP BY deviceId, bucketStart
+        WITH NO DATA;
+
+    CREATE MATERIALIZED VIEW sensor_reading_rollups_daily
+        WITH (timescaledb.continuous, timescaledb.materialized_only = false) AS
+        SELECT deviceId, time_bucket(INTERVAL '1 day', measuredAt) AS bucketStart, COUNT(*) AS count,
+            COUNT(temperature) AS temperatureCount,
+            COALESCE(SUM(temperature), 0) AS temperatureSum,
+            MIN(temperature) AS temperatureMin,
+            MAX(temperature) AS temperatureMax,
+            last(temperature, measuredAt) AS temperatureLast,
+            COUNT(airQualityIndex) AS airQualityIndexCount,
+            COALESCE(SUM(airQualityIndex), 0) AS airQualityIndexSum,
+            MIN(airQualityIndex) AS airQualityIndexMin,
+            MAX(airQualityIndex) AS airQualityIndexMax,
+            last(airQualityIndex, measuredAt) AS airQualityIndexLast,
+            COUNT(humidity) AS humidityCount,
+            COALESCE(SUM(humidity), 0) AS humiditySum,
+            MIN(humidity) AS humidityMin,
+            MAX(humidity) AS humidityMax,
+            last(humidity, measuredAt) AS humidityLast,
+            COUNT(carbondioxide) AS carbondioxideCount,
+            COALESCE(SUM(carbondioxide), 0) AS carbondioxideSum,
+            MIN(carbondioxide) AS carbondioxideMin,
+            MAX(carbondioxide) AS carbondioxideMax,
+            last(carbondioxide, measuredAt) AS carbondioxideLast,
+            MAX(measuredAt) AS lastAt
+        FROM sensor_readings
+        GROUP BY deviceId, bucketStart
+        WITH NO DATA;
+
+    -- Readings may arrive up to MAX_READING_AGE late, seven days by default.
+    PERFORM add_continuous_aggregate_policy('sensor_reading_rollups_hourly',
+        start_offset => INTERVAL '8 days', end_offset => INTERVAL '1 hour', schedule_interval => INTERVAL '15 minutes');
+    PERFORM add_continuous_aggregate_policy('sensor_reading_rollups_daily',
+        start_offset => INTERVAL '9 days', end_offset => INTERVAL '1 day', schedule_interval => INTERVAL '1 hour');
+
+    CREATE VIEW sensor_reading_rollups AS
+        SELECT 'hourly' AS resolution, * FROM sensor_reading_rollups_hourly
+        UNION ALL
+        SELECT 'daily' AS resolution, * FROM sensor_reading_rollups_daily;
+
+    CREATE RULE sensor_reading_rollups_delete AS ON DELETE TO sensor_reading_rollups DO INSTEAD NOTHING;
+END
+$$;
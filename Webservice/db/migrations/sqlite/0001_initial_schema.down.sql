@@ -0,0 +1,21 @@
+DROP TABLE device_decisions;
+DROP TABLE blocked_devices;
+DROP TABLE archived_sensor_readings;
+DROP TABLE archived_devices;
+DROP TABLE device_heartbeats;
+DROP TABLE email_recipients;
+DROP TABLE webhook_deliveries;
+DROP TABLE webhooks;
+DROP TABLE alert_transitions;
+DROP TABLE alerts;
+DROP TABLE alert_rules;
+DROP TABLE rejected_readings;
+DROP TABLE sensor_reading_values;
+DROP TABLE metrics;
+DROP TABLE device_keys;
+DROP TABLE sensor_reading_rollup_state;
+DROP TABLE sensor_reading_rollups;
+DROP TABLE sensor_readings;
+DROP TABLE requested_devices;
+DROP TABLE devices;
+DROP TABLE users;
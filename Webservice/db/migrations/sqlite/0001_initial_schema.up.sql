@@ -0,0 +1,295 @@
+-- SQLite has no separate schema history, it starts at the schema of MariaDB
+-- migration 0014. Times are stored as text in UTC.
+CREATE TABLE users(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    username VARCHAR(255) NOT NULL,
+    password VARCHAR(255) NOT NULL,
+    createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (username)
+);
+
+CREATE TABLE devices (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    macAddress VARCHAR(255),
+    name VARCHAR(255),
+    localization VARCHAR(255),
+    createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    lastSeenAt TIMESTAMP NULL,
+    online BOOLEAN NOT NULL DEFAULT false,
+    deletedAt TIMESTAMP NULL
+);
+
+CREATE UNIQUE INDEX devices_active_mac ON devices(macAddress) WHERE deletedAt IS NULL;
+CREATE INDEX devices_online ON devices(online, lastSeenAt);
+
+CREATE TABLE requested_devices (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    macAddress VARCHAR(255),
+    createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    active BOOLEAN,
+    decidedBy INT,
+    decidedAt TIMESTAMP NULL,
+    UNIQUE (macAddress)
+);
+
+CREATE TABLE sensor_readings(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    deviceId INT NOT NULL,
+    temperature DECIMAL(5,2),
+    humidity DECIMAL(5,2),
+    carbondioxide DECIMAL(7,2),
+    airQualityIndex SMALLINT,
+    staticIaq DECIMAL(5,2),
+    iaqAccuracy TINYINT,
+    breathVocEquivalent DECIMAL(7,2),
+    pressure DECIMAL(6,2),
+    gasResistance DECIMAL(10,2),
+    stabilizationStatus BOOLEAN,
+    createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    measuredAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    sequence BIGINT,
+    idempotencyKey VARCHAR(64),
+    FOREIGN KEY (deviceId) References devices(id),
+    UNIQUE (deviceId, sequence),
+    UNIQUE (deviceId, idempotencyKey)
+);
+
+CREATE INDEX sensor_readings_device_measured ON sensor_readings(deviceId, measuredAt, id);
+CREATE INDEX sensor_readings_measured ON sensor_readings(measuredAt, id);
+
+CREATE TABLE sensor_reading_rollups(
+    deviceId INT NOT NULL,
+    resolution VARCHAR(16) NOT NULL,
+    bucketStart DATETIME NOT NULL,
+    count INT NOT NULL,
+    temperatureSum DOUBLE NOT NULL,
+    temperatureMin DOUBLE NOT NULL,
+    temperatureMax DOUBLE NOT NULL,
+    temperatureLast DOUBLE NOT NULL,
+    airQualityIndexSum DOUBLE NOT NULL,
+    airQualityIndexMin DOUBLE NOT NULL,
+    airQualityIndexMax DOUBLE NOT NULL,
+    airQualityIndexLast DOUBLE NOT NULL,
+    humiditySum DOUBLE NOT NULL,
+    humidityMin DOUBLE NOT NULL,
+    humidityMax DOUBLE NOT NULL,
+    humidityLast DOUBLE NOT NULL,
+    carbondioxideSum DOUBLE NOT NULL,
+    carbondioxideMin DOUBLE NOT NULL,
+    carbondioxideMax DOUBLE NOT NULL,
+    carbondioxideLast DOUBLE NOT NULL,
+    lastAt DATETIME NOT NULL,
+    PRIMARY KEY (deviceId, resolution, bucketStart),
+    FOREIGN KEY (deviceId) References devices(id)
+);
+
+CREATE TABLE sensor_reading_rollup_state(
+    id INT PRIMARY KEY,
+    lastReadingId INT NOT NULL
+);
+
+INSERT INTO sensor_reading_rollup_state (id, lastReadingId) VALUES (1, 0);
+
+CREATE TABLE device_keys(
+    deviceId INT PRIMARY KEY,
+    keyHash CHAR(64) NOT NULL,
+    createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (keyHash),
+    FOREIGN KEY (deviceId) References devices(id)
+);
+
+CREATE TABLE metrics(
+    name VARCHAR(64) PRIMARY KEY,
+    unit VARCHAR(16) NOT NULL DEFAULT '',
+    minValue DOUBLE,
+    maxValue DOUBLE,
+    `precision` TINYINT NOT NULL DEFAULT 2,
+    builtin BOOLEAN NOT NULL DEFAULT false,
+    createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO metrics (name, unit, minValue, maxValue, `precision`, builtin) VALUES
+    ('temperature', '°C', -40, 85, 2, true),
+    ('humidity', '%', 0, 100, 2, true),
+    ('carbondioxide', 'ppm', 0, 99999, 2, true),
+    ('airQualityIndex', '', 0, 500, 0, true),
+    ('staticIaq', '', 0, 500, 2, true),
+    ('iaqAccuracy', '', 0, 3, 0, true),
+    ('breathVocEquivalent', 'ppm', 0, 99999, 2, true),
+    ('pressure', 'hPa', 300, 1100, 2, true),
+    ('gasResistance', 'Ohm', 0, 99999999, 2, true),
+    ('stabilizationStatus', '', 0, 1, 0, true),
+    ('pm25', 'µg/m³', 0, 1000, 1, false),
+    ('noise', 'dB', 0, 140, 1, false);
+
+CREATE TABLE sensor_reading_values(
+    readingId INT NOT NULL,
+    metric VARCHAR(64) NOT NULL,
+    value DOUBLE NOT NULL,
+    PRIMARY KEY (readingId, metric),
+    FOREIGN KEY (readingId) References sensor_readings(id) ON DELETE CASCADE,
+    FOREIGN KEY (metric) References metrics(name)
+);
+
+CREATE TABLE rejected_readings(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    deviceId INT NOT NULL,
+    status SMALLINT NOT NULL,
+    error VARCHAR(255) NOT NULL,
+    fieldErrors JSON,
+    payload JSON NOT NULL,
+    createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (deviceId) References devices(id)
+);
+
+CREATE INDEX rejected_readings_device ON rejected_readings(deviceId, id);
+
+CREATE TABLE alert_rules(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name VARCHAR(255) NOT NULL,
+    deviceId INT,
+    localization VARCHAR(255),
+    metric VARCHAR(64) NOT NULL,
+    comparator VARCHAR(2) NOT NULL,
+    threshold DOUBLE NOT NULL,
+    durationSeconds INT NOT NULL DEFAULT 0,
+    hysteresis DOUBLE NOT NULL DEFAULT 0,
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (deviceId) References devices(id) ON DELETE CASCADE,
+    FOREIGN KEY (metric) References metrics(name)
+);
+
+CREATE TABLE alerts(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    ruleId INT NOT NULL,
+    deviceId INT NOT NULL,
+    state VARCHAR(16) NOT NULL,
+    value DOUBLE NOT NULL,
+    startedAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    firedAt TIMESTAMP NULL,
+    resolvedAt TIMESTAMP NULL,
+    FOREIGN KEY (ruleId) References alert_rules(id) ON DELETE CASCADE,
+    FOREIGN KEY (deviceId) References devices(id)
+);
+
+CREATE INDEX alerts_rule_device ON alerts(ruleId, deviceId, state);
+CREATE INDEX alerts_state ON alerts(state, id);
+
+CREATE TABLE alert_transitions(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    alertId INT NOT NULL,
+    ruleId INT NOT NULL,
+    deviceId INT NOT NULL,
+    state VARCHAR(16) NOT NULL,
+    value DOUBLE NOT NULL,
+    at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (alertId) References alerts(id) ON DELETE CASCADE
+);
+
+CREATE INDEX alert_transitions_device ON alert_transitions(deviceId, id);
+CREATE INDEX alert_transitions_rule ON alert_transitions(ruleId, id);
+
+CREATE TABLE webhooks(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name VARCHAR(255) NOT NULL,
+    url VARCHAR(2048) NOT NULL,
+    format VARCHAR(16) NOT NULL DEFAULT 'json',
+    events VARCHAR(1024) NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    secret VARCHAR(64) NOT NULL,
+    createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE webhook_deliveries(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    webhookId INT NOT NULL,
+    event VARCHAR(64) NOT NULL,
+    body JSON NOT NULL,
+    status VARCHAR(16) NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    nextAttemptAt TIMESTAMP NULL,
+    responseStatus SMALLINT,
+    error VARCHAR(1024) NOT NULL DEFAULT '',
+    createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    deliveredAt TIMESTAMP NULL,
+    FOREIGN KEY (webhookId) References webhooks(id) ON DELETE CASCADE
+);
+
+CREATE INDEX webhook_deliveries_due ON webhook_deliveries(status, nextAttemptAt);
+CREATE INDEX webhook_deliveries_webhook ON webhook_deliveries(webhookId, id);
+
+CREATE TABLE email_recipients(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    email VARCHAR(254) NOT NULL,
+    language CHAR(2) NOT NULL DEFAULT 'de',
+    events VARCHAR(1024) NOT NULL,
+    deviceId INT,
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (deviceId) References devices(id) ON DELETE CASCADE
+);
+
+CREATE TABLE device_heartbeats(
+    deviceId INT PRIMARY KEY,
+    rssi SMALLINT,
+    uptime BIGINT,
+    freeHeap INT,
+    firmwareVersion VARCHAR(64) NOT NULL DEFAULT '',
+    receivedAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (deviceId) References devices(id) ON DELETE CASCADE
+);
+
+CREATE TABLE archived_devices(
+    id INT PRIMARY KEY,
+    macAddress VARCHAR(255),
+    name VARCHAR(255),
+    localization VARCHAR(255),
+    createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    archivedAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE archived_sensor_readings(
+    id INT PRIMARY KEY,
+    deviceId INT NOT NULL,
+    temperature DECIMAL(5,2),
+    humidity DECIMAL(5,2),
+    carbondioxide DECIMAL(7,2),
+    airQualityIndex SMALLINT,
+    staticIaq DECIMAL(5,2),
+    iaqAccuracy TINYINT,
+    breathVocEquivalent DECIMAL(7,2),
+    pressure DECIMAL(6,2),
+    gasResistance DECIMAL(10,2),
+    stabilizationStatus BOOLEAN,
+    metrics JSON,
+    createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    measuredAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    sequence BIGINT,
+    idempotencyKey VARCHAR(64),
+    FOREIGN KEY (deviceId) References archived_devices(id)
+);
+
+CREATE INDEX archived_sensor_readings_device ON archived_sensor_readings(deviceId, measuredAt);
+
+CREATE TABLE blocked_devices(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    macAddress VARCHAR(255) NOT NULL,
+    reason VARCHAR(255) NOT NULL DEFAULT '',
+    blockedBy INT,
+    createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (macAddress),
+    FOREIGN KEY (blockedBy) References users(id) ON DELETE SET NULL
+);
+
+CREATE TABLE device_decisions(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    macAddress VARCHAR(255) NOT NULL,
+    decision VARCHAR(16) NOT NULL,
+    reason VARCHAR(255) NOT NULL DEFAULT '',
+    userId INT,
+    createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (userId) References users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX device_decisions_mac ON device_decisions(macAddress, id);
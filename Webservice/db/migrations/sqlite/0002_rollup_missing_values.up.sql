@@ -0,0 +1,35 @@
+-- The rollups counted readings without a value as zeros. Missing values are
+-- left out now and the rollup worker builds the rollups again from the start.
+DROP TABLE sensor_reading_rollups;
+
+CREATE TABLE sensor_reading_rollups(
+    deviceId INT NOT NULL,
+    resolution VARCHAR(16) NOT NULL,
+    bucketStart DATETIME NOT NULL,
+    count INT NOT NULL,
+    temperatureCount INT NOT NULL,
+    temperatureSum DOUBLE NOT NULL,
+    temperatureMin DOUBLE,
+    temperatureMax DOUBLE,
+    temperatureLast DOUBLE,
+    airQualityIndexCount INT NOT NULL,
+    airQualityIndexSum DOUBLE NOT NULL,
+    airQualityIndexMin DOUBLE,
+    airQualityIndexMax DOUBLE,
+    airQualityIndexLast DOUBLE,
+    humidityCount INT NOT NULL,
+    humiditySum DOUBLE NOT NULL,
+    humidityMin DOUBLE,
+    humidityMax DOUBLE,
+    humidityLast DOUBLE,
+    carbondioxideCount INT NOT NULL,
+    carbondioxideSum DOUBLE NOT NULL,
+    carbondioxideMin DOUBLE,
+    carbondioxideMax DOUBLE,
+    carbondioxideLast DOUBLE,
+    lastAt DATETIME NOT NULL,
+    PRIMARY KEY (deviceId, resolution, bucketStart),
+    FOREIGN KEY (deviceId) References devices(id)
+);
+
+UPDATE sensor_reading_rollup_state SET lastReadingId = 0 WHERE id = 1;
@@ -0,0 +1,41 @@
+-- Readings of later boots that repeat a sequence number lose it, the key is
+-- unique per device again.
+CREATE TABLE sensor_readings_new(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    deviceId INT NOT NULL,
+    temperature DECIMAL(5,2),
+    humidity DECIMAL(5,2),
+    carbondioxide DECIMAL(7,2),
+    airQualityIndex SMALLINT,
+    staticIaq DECIMAL(5,2),
+    iaqAccuracy TINYINT,
+    breathVocEquivalent DECIMAL(7,2),
+    pressure DECIMAL(6,2),
+    gasResistance DECIMAL(10,2),
+    stabilizationStatus BOOLEAN,
+    createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    measuredAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    sequence BIGINT,
+    idempotencyKey VARCHAR(64),
+    FOREIGN KEY (deviceId) References devices(id),
+    UNIQUE (deviceId, sequence),
+    UNIQUE (deviceId, idempotencyKey)
+);
+
+INSERT INTO sensor_readings_new(id, deviceId, temperature, humidity, carbondioxide, airQualityIndex, staticIaq,
+        iaqAccuracy, breathVocEquivalent, pressure, gasResistance, stabilizationStatus, createdAt, measuredAt,
+        sequence, idempotencyKey)
+    SELECT id, deviceId, temperature, humidity, carbondioxide, airQualityIndex, staticIaq,
+        iaqAccuracy, breathVocEquivalent, pressure, gasResistance, stabilizationStatus, createdAt, measuredAt,
+        CASE WHEN id = (SELECT MIN(id) FROM sensor_readings first
+            WHERE first.deviceId = sensor_readings.deviceId AND first.sequence = sensor_readings.sequence)
+        THEN sequence END, idempotencyKey
+    FROM sensor_readings;
+
+DROP TABLE sensor_readings;
+ALTER TABLE sensor_readings_new RENAME TO sensor_readings;
+
+CREATE INDEX sensor_readings_device_measured ON sensor_readings(deviceId, measuredAt, id);
+CREATE INDEX sensor_readings_measured ON sensor_readings(measuredAt, id);
+
+ALTER TABLE archived_sensor_readings DROP COLUMN bootId;
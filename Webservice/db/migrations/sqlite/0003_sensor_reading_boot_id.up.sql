@@ -0,0 +1,41 @@
+-- Devices count their sequence numbers from the start again after a reboot,
+-- the numbers are unique per boot ID sent by the device. Devices without one
+-- keep the empty boot ID. SQLite cannot change a unique key, the table is
+-- rebuilt.
+CREATE TABLE sensor_readings_new(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    deviceId INT NOT NULL,
+    temperature DECIMAL(5,2),
+    humidity DECIMAL(5,2),
+    carbondioxide DECIMAL(7,2),
+    airQualityIndex SMALLINT,
+    staticIaq DECIMAL(5,2),
+    iaqAccuracy TINYINT,
+    breathVocEquivalent DECIMAL(7,2),
+    pressure DECIMAL(6,2),
+    gasResistance DECIMAL(10,2),
+    stabilizationStatus BOOLEAN,
+    createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    measuredAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    bootId VARCHAR(64) NOT NULL DEFAULT '',
+    sequence BIGINT,
+    idempotencyKey VARCHAR(64),
+    FOREIGN KEY (deviceId) References devices(id),
+    UNIQUE (deviceId, bootId, sequence),
+    UNIQUE (deviceId, idempotencyKey)
+);
+
+INSERT INTO sensor_readings_new(id, deviceId, temperature, humidity, carbondioxide, airQualityIndex, staticIaq,
+        iaqAccuracy, breathVocEquivalent, pressure, gasResistance, stabilizationStatus, createdAt, measuredAt,
+        sequence, idempotencyKey)
+    SELECT id, deviceId, temperature, humidity, carbondioxide, airQualityIndex, staticIaq,
+        iaqAccuracy, breathVocEquivalent, pressure, gasResistance, stabilizationStatus, createdAt, measuredAt,
+        sequence, idempotencyKey FROM sensor_readings;
+
+DROP TABLE sensor_readings;
+ALTER TABLE sensor_readings_new RENAME TO sensor_readings;
+
+CREATE INDEX sensor_readings_device_measured ON sensor_readings(deviceId, measuredAt, id);
+CREATE INDEX sensor_readings_measured ON sensor_readings(measuredAt, id);
+
+ALTER TABLE archived_sensor_readings ADD COLUMN bootId VARCHAR(64) NOT NULL DEFAULT '';
@@ -0,0 +1,23 @@
+-- The alerts of a device are deleted with it, like its alert rules. SQLite
+-- cannot change a foreign key, the table is rebuilt.
+CREATE TABLE alerts_new(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    ruleId INT NOT NULL,
+    deviceId INT NOT NULL,
+    state VARCHAR(16) NOT NULL,
+    value DOUBLE NOT NULL,
+    startedAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    firedAt TIMESTAMP NULL,
+    resolvedAt TIMESTAMP NULL,
+    FOREIGN KEY (ruleId) References alert_rules(id) ON DELETE CASCADE,
+    FOREIGN KEY (deviceId) References devices(id) ON DELETE CASCADE
+);
+
+INSERT INTO alerts_new(id, ruleId, deviceId, state, value, startedAt, firedAt, resolvedAt)
+    SELECT id, ruleId, deviceId, state, value, startedAt, firedAt, resolvedAt FROM alerts;
+
+DROP TABLE alerts;
+ALTER TABLE alerts_new RENAME TO alerts;
+
+CREATE INDEX alerts_rule_device ON alerts(ruleId, deviceId, state);
+CREATE INDEX alerts_state ON alerts(state, id);
@@ -0,0 +1,157 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// NewPostgresStorage connects to the PostgreSQL database at url. The stores
+// are written with ? placeholders and backtick quoted identifiers, every
+// connection rewrites them to the PostgreSQL syntax before a query is sent.
+// The jsonb operators ?, ?| and ?& are written ??, ??| and ??&.
+func NewPostgresStorage(url string) (*sql.DB, error) {
+	cfg, err := pgx.ParseConfig(url)
+	if err != nil {
+		log.Fatal(err)
+		return nil, err
+	}
+
+	return sql.OpenDB(postgresConnector{stdlib.GetConnector(*cfg)}), nil
+}
+
+type postgresConnector struct {
+	driver.Connector
+}
+
+func (c postgresConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &postgresConn{conn.(*stdlib.Conn)}, nil
+}
+
+type postgresConn struct {
+	*stdlib.Conn
+}
+
+func (c *postgresConn) Prepare(query string) (driver.Stmt, error) {
+	return c.Conn.Prepare(rebind(query))
+}
+
+func (c *postgresConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	return c.Conn.PrepareContext(ctx, rebind(query))
+}
+
+func (c *postgresConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.Conn.ExecContext(ctx, rebind(query), args)
+}
+
+func (c *postgresConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.Conn.QueryContext(ctx, rebind(query), args)
+}
+
+// rebind numbers the ? placeholders of query and replaces backticks with
+// double quotes. String literals, quoted identifiers, dollar quoted bodies
+// and comments are copied unchanged, elsewhere ?? stands for a literal ?.
+func rebind(query string) string {
+	var b strings.Builder
+	b.Grow(len(query) + 16)
+
+	n := 0
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'' || c == '"':
+			end := len(query)
+			if close := strings.IndexByte(query[i+1:], c); close >= 0 {
+				end = i + close + 2
+			}
+			b.WriteString(query[i:end])
+			i = end - 1
+			continue
+		case strings.HasPrefix(query[i:], "--"):
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				end = len(query) - i
+			}
+			b.WriteString(query[i : i+end])
+			i += end - 1
+			continue
+		case strings.HasPrefix(query[i:], "/*"):
+			end := blockCommentEnd(query[i:])
+			b.WriteString(query[i : i+end])
+			i += end - 1
+			continue
+		case c == '$' && (i == 0 || !isIdentifierByte(query[i-1])):
+			if tag := dollarTag(query[i:]); tag != "" {
+				end := strings.Index(query[i+len(tag):], tag)
+				if end < 0 {
+					end = len(query) - i - 2*len(tag)
+				}
+				end += 2 * len(tag)
+				b.WriteString(query[i : i+end])
+				i += end - 1
+				continue
+			}
+		case strings.HasPrefix(query[i:], "??"):
+			i++
+		case c == '?':
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		case c == '`':
+			c = '"'
+		}
+		b.WriteByte(c)
+	}
+
+	return b.String()
+}
+
+// blockCommentEnd returns the length of the block comment query starts with,
+// PostgreSQL block comments nest.
+func blockCommentEnd(query string) int {
+	depth := 0
+	for i := 0; i < len(query)-1; i++ {
+		switch query[i : i+2] {
+		case "/*":
+			depth++
+			i++
+		case "*/":
+			depth--
+			i++
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+
+	return len(query)
+}
+
+// dollarTag returns the $tag$ query starts with, if any.
+func dollarTag(query string) string {
+	for i := 1; i < len(query); i++ {
+		switch c := query[i]; {
+		case c == '$':
+			return query[:i+1]
+		case c >= '0' && c <= '9' && i == 1, !isIdentifierByte(c):
+			return ""
+		}
+	}
+
+	return ""
+}
+
+func isIdentifierByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80
+}
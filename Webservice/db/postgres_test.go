@@ -0,0 +1,34 @@
+package db
+
+import "testing"
+
+func TestRebind(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{"placeholders", "SELECT id FROM devices WHERE id = ? AND name = ?", "SELECT id FROM devices WHERE id = $1 AND name = $2"},
+		{"backticks", "SELECT `precision` FROM metrics WHERE name = ?", `SELECT "precision" FROM metrics WHERE name = $1`},
+		{"string literal", "SELECT '?', ? FROM t WHERE a = 'it''s ?'", "SELECT '?', $1 FROM t WHERE a = 'it''s ?'"},
+		{"quoted identifier", `SELECT "what?" FROM t WHERE "a?b" = ?`, `SELECT "what?" FROM t WHERE "a?b" = $1`},
+		{"backtick in string", "SELECT '`' FROM t", "SELECT '`' FROM t"},
+		{"line comment", "SELECT ? -- why?\nFROM t WHERE a = ?", "SELECT $1 -- why?\nFROM t WHERE a = $2"},
+		{"line comment at the end", "SELECT ? -- why?", "SELECT $1 -- why?"},
+		{"block comment", "SELECT /* a ? /* nested ? */ b ? */ ?", "SELECT /* a ? /* nested ? */ b ? */ $1"},
+		{"dollar quotes", "DO $$ BEGIN PERFORM '?'; END $$; SELECT ?", "DO $$ BEGIN PERFORM '?'; END $$; SELECT $1"},
+		{"tagged dollar quotes", "SELECT $body$ a ? $$ b $body$, ?", "SELECT $body$ a ? $$ b $body$, $1"},
+		{"jsonb operators", "SELECT metrics ?? 'pm25', metrics ??| ?, metrics ??& ? FROM t", "SELECT metrics ? 'pm25', metrics ?| $1, metrics ?& $2 FROM t"},
+		{"native placeholders", "SELECT $1, a$b FROM t", "SELECT $1, a$b FROM t"},
+		{"unterminated string", "SELECT 'a ?", "SELECT 'a ?"},
+		{"unterminated dollar quote", "SELECT $x$ ?", "SELECT $x$ ?"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := rebind(test.query); got != test.want {
+				t.Errorf("rebind(%q) = %q, want %q", test.query, got, test.want)
+			}
+		})
+	}
+}
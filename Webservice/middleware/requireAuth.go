@@ -3,14 +3,18 @@ package middleware
 import (
 	"air-controller-webservice/config"
 	"air-controller-webservice/utils"
+	"context"
 	"errors"
-	"fmt"
 	"net/http"
 	"strings"
 
 	"github.com/golang-jwt/jwt/v4"
 )
 
+const userContextKey contextKey = "user"
+
+// RequireAuth checks the JWT of a user. The id of the user is available to the
+// handler through UserIdFromContext.
 func RequireAuth() func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -21,9 +25,6 @@ func RequireAuth() func(http.Handler) http.Handler {
 			}
 
 			tokenParts := strings.Split(authHeader, " ")
-			fmt.Println(tokenParts)
-			fmt.Println(len(tokenParts))
-			fmt.Println(tokenParts[0])
 			if len(tokenParts) != 2 || tokenParts[0] != "Bearer" {
 				utils.WriteError(w, http.StatusUnauthorized, errors.New("invalid authorization format"))
 				return
@@ -40,8 +41,9 @@ func RequireAuth() func(http.Handler) http.Handler {
 				return
 			}
 
-			if _, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-				next.ServeHTTP(w, r)
+			if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
+				userId, _ := claims["sub"].(float64)
+				next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userContextKey, int(userId))))
 				return
 			}
 
@@ -49,3 +51,9 @@ func RequireAuth() func(http.Handler) http.Handler {
 		})
 	}
 }
+
+// UserIdFromContext returns the id of the user authenticated by RequireAuth.
+func UserIdFromContext(ctx context.Context) int {
+	userId, _ := ctx.Value(userContextKey).(int)
+	return userId
+}
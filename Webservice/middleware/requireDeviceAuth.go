@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"air-controller-webservice/services/auth"
+	"air-controller-webservice/types"
+	"air-controller-webservice/utils"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+type contextKey string
+
+const deviceContextKey contextKey = "device"
+
+// RequireDeviceAuth authenticates a device by the API key it was issued on
+// approval, sent as "Authorization: Bearer <key>". The device is available to
+// the handler through DeviceFromContext.
+func RequireDeviceAuth(store types.DeviceStore) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || key == "" {
+				utils.WriteError(w, http.StatusUnauthorized, errors.New("device key is required"))
+				return
+			}
+
+			device, err := store.GetDeviceByKeyHash(auth.HashDeviceKey(key))
+			if err != nil {
+				utils.WriteError(w, http.StatusInternalServerError, err)
+				return
+			}
+
+			if device.ID == 0 {
+				utils.WriteError(w, http.StatusUnauthorized, errors.New("invalid device key"))
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), deviceContextKey, device)))
+		})
+	}
+}
+
+// DeviceFromContext returns the device authenticated by RequireDeviceAuth.
+func DeviceFromContext(ctx context.Context) *types.Device {
+	device, _ := ctx.Value(deviceContextKey).(*types.Device)
+	return device
+}
@@ -0,0 +1,66 @@
+package alert
+
+import (
+	"air-controller-webservice/types"
+	"sync"
+	"time"
+)
+
+// cacheTTL bounds how long rules changed elsewhere, through another instance
+// of the webservice or by deleting a device, are evaluated in their old state.
+const cacheTTL = time.Minute
+
+// CachedStore keeps the alert rules in memory, the engine reads them for every
+// reading. Changing a rule through the store drops the cache. The returned
+// rules are shared and must not be modified.
+type CachedStore struct {
+	types.AlertStore
+
+	mu       sync.Mutex
+	rules    []*types.AlertRule
+	loadedAt time.Time
+}
+
+func NewCachedStore(store types.AlertStore) *CachedStore {
+	return &CachedStore{AlertStore: store}
+}
+
+func (s *CachedStore) GetAlertRules() ([]*types.AlertRule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.rules == nil || time.Since(s.loadedAt) > cacheTTL {
+		rules, err := s.AlertStore.GetAlertRules()
+		if err != nil {
+			return nil, err
+		}
+		s.rules = rules
+		s.loadedAt = time.Now()
+	}
+
+	return append([]*types.AlertRule{}, s.rules...), nil
+}
+
+func (s *CachedStore) CreateAlertRule(rule types.AlertRulePayload) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rules = nil
+	return s.AlertStore.CreateAlertRule(rule)
+}
+
+func (s *CachedStore) UpdateAlertRule(id int, rule types.AlertRulePayload) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rules = nil
+	return s.AlertStore.UpdateAlertRule(id, rule)
+}
+
+func (s *CachedStore) DeleteAlertRule(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rules = nil
+	return s.AlertStore.DeleteAlertRule(id)
+}
@@ -0,0 +1,172 @@
+package alert
+
+import (
+	"air-controller-webservice/services/events"
+	sensorreading "air-controller-webservice/services/sensor-reading"
+	"air-controller-webservice/types"
+	"log"
+	"sync"
+	"time"
+)
+
+// Engine evaluates the alert rules against every new reading and moves the
+// alerts of each rule and device through pending, firing and resolved. Every
+// transition is published as alert event. The store should be a CachedStore,
+// the rules are read for every reading.
+type Engine struct {
+	store       types.AlertStore
+	deviceStore types.DeviceStore
+	events      *events.Broker
+
+	// mu serializes evaluations, Evaluate may be called besides the
+	// evaluations started by Start.
+	mu sync.Mutex
+}
+
+func NewEngine(store types.AlertStore, deviceStore types.DeviceStore, events *events.Broker) *Engine {
+	return &Engine{store: store, deviceStore: deviceStore, events: events}
+}
+
+// Start evaluates the readings published from now on. They are queued, so
+// ingestion does not wait for the evaluation.
+func (e *Engine) Start() {
+	e.events.HandleAsync(func(event events.Event) bool {
+		return event.Type == events.ReadingCreated
+	}, func(event events.Event) {
+		if reading, ok := event.Data.(*types.SensorReading); ok {
+			if err := e.Evaluate(reading); err != nil {
+				log.Println("alert: could not evaluate reading", reading.ID, err)
+			}
+		}
+	})
+}
+
+func (e *Engine) Evaluate(reading *types.SensorReading) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	rules, err := e.store.GetAlertRules()
+	if err != nil {
+		return err
+	}
+
+	var device *types.Device
+	for _, rule := range rules {
+		if !rule.Enabled {
+			continue
+		}
+		if rule.DeviceId != nil && *rule.DeviceId != reading.DeviceId {
+			continue
+		}
+		if rule.Localization != nil {
+			if device == nil {
+				if device, err = e.deviceStore.GetDeviceById(reading.DeviceId); err != nil {
+					return err
+				}
+			}
+			if device.Localization != *rule.Localization {
+				continue
+			}
+		}
+
+		value, ok := sensorreading.MetricValue(reading, rule.Metric)
+		if !ok {
+			continue
+		}
+
+		if err := e.evaluateRule(rule, reading, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (e *Engine) evaluateRule(rule *types.AlertRule, reading *types.SensorReading, value float64) error {
+	alert, err := e.store.GetActiveAlert(rule.ID, reading.DeviceId)
+	if err != nil {
+		return err
+	}
+
+	at := reading.MeasuredAt
+	breaching := compare(value, rule.Comparator, rule.Threshold)
+
+	switch {
+	case alert.ID == 0:
+		if !breaching {
+			return nil
+		}
+
+		alert = &types.Alert{RuleId: rule.ID, DeviceId: reading.DeviceId, State: types.AlertPending, Value: value, StartedAt: at}
+		if rule.DurationSeconds == 0 {
+			alert.State = types.AlertFiring
+			alert.FiredAt = &at
+		}
+		if err := e.store.CreateAlert(alert); err != nil {
+			return err
+		}
+
+	case alert.State == types.AlertPending && !breaching:
+		// the condition did not hold long enough, the alert never fired
+		alert.State = types.AlertResolved
+		alert.Value = value
+		alert.ResolvedAt = &at
+		if err := e.store.UpdateAlert(alert, true); err != nil {
+			return err
+		}
+
+	case alert.State == types.AlertPending && at.Sub(alert.StartedAt) >= time.Duration(rule.DurationSeconds)*time.Second:
+		alert.State = types.AlertFiring
+		alert.Value = value
+		alert.FiredAt = &at
+		if err := e.store.UpdateAlert(alert, true); err != nil {
+			return err
+		}
+
+	case alert.State == types.AlertFiring && cleared(value, rule):
+		alert.State = types.AlertResolved
+		alert.Value = value
+		alert.ResolvedAt = &at
+		if err := e.store.UpdateAlert(alert, true); err != nil {
+			return err
+		}
+
+	default:
+		alert.Value = value
+		return e.store.UpdateAlert(alert, false)
+	}
+
+	e.events.Publish(events.Event{
+		Type:     "alert." + string(alert.State),
+		DeviceId: alert.DeviceId,
+		Data:     &types.AlertEvent{Rule: rule, Alert: alert},
+	})
+
+	return nil
+}
+
+func compare(value float64, comparator string, threshold float64) bool {
+	switch comparator {
+	case ">":
+		return value > threshold
+	case ">=":
+		return value >= threshold
+	case "<":
+		return value < threshold
+	case "<=":
+		return value <= threshold
+	}
+	return false
+}
+
+// cleared reports whether value is back beyond the threshold of rule by its
+// hysteresis, so a value hovering around the threshold does not flap.
+func cleared(value float64, rule *types.AlertRule) bool {
+	switch rule.Comparator {
+	case ">", ">=":
+		return value < rule.Threshold-rule.Hysteresis
+	case "<", "<=":
+		return value > rule.Threshold+rule.Hysteresis
+	}
+	return true
+}
@@ -0,0 +1,126 @@
+package alert_test
+
+import (
+	"air-controller-webservice/services/alert"
+	"air-controller-webservice/services/device"
+	"air-controller-webservice/services/events"
+	"air-controller-webservice/services/storetest"
+	"air-controller-webservice/types"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEngine(t *testing.T) {
+	database := storetest.OpenSQLite(t)
+	store, devices := alert.NewStore(database), device.NewSQLiteStore(database)
+	a := approveDevice(t, devices, "AA:BB:CC:DD:EE:01")
+	b := approveDevice(t, devices, "AA:BB:CC:DD:EE:02")
+
+	ruleId, err := store.CreateAlertRule(types.AlertRulePayload{Name: "co2 high", DeviceId: &a, Metric: "carbondioxide",
+		Comparator: ">", Threshold: 1500, DurationSeconds: 300, Hysteresis: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	broker := events.NewBroker()
+	alerts := broker.Subscribe(func(event events.Event) bool { return strings.HasPrefix(event.Type, "alert.") })
+	alert.NewEngine(store, devices, broker).Start()
+
+	t0 := time.Date(2025, 4, 20, 12, 0, 0, 0, time.UTC)
+	for _, reading := range []struct {
+		deviceId      int
+		after         time.Duration
+		carbondioxide float32
+	}{
+		{a, 0, 1600},
+		{b, 0, 1600}, // the rule is for device a only
+		{a, 2 * time.Minute, 1700},
+		{a, 5 * time.Minute, 1650}, // breaching for DurationSeconds
+		{a, 6 * time.Minute, 1450}, // below the threshold, but within the hysteresis
+		{a, 7 * time.Minute, 1350},
+		{a, 10 * time.Minute, 1600},
+		{a, 11 * time.Minute, 1000}, // before DurationSeconds passed
+	} {
+		broker.Publish(events.Event{Type: events.ReadingCreated, DeviceId: reading.deviceId, Data: &types.SensorReading{
+			DeviceId: reading.deviceId, Carbondioxide: reading.carbondioxide, MeasuredAt: t0.Add(reading.after)}})
+	}
+
+	for i, want := range []struct {
+		state types.AlertState
+		value float64
+		at    time.Duration
+	}{
+		{types.AlertPending, 1600, 0},
+		{types.AlertFiring, 1650, 5 * time.Minute},
+		{types.AlertResolved, 1350, 7 * time.Minute},
+		{types.AlertPending, 1600, 10 * time.Minute},
+		{types.AlertResolved, 1000, 11 * time.Minute},
+	} {
+		select {
+		case event := <-alerts.Events():
+			data, ok := event.Data.(*types.AlertEvent)
+			if !ok || event.Type != "alert."+string(want.state) || event.DeviceId != a || data.Rule.ID != ruleId ||
+				data.Alert.State != want.state || data.Alert.Value != want.value {
+				t.Fatalf("event %d = %+v, want %s with value %v", i, event, want.state, want.value)
+			}
+
+			var at *time.Time
+			switch want.state {
+			case types.AlertPending:
+				at = &data.Alert.StartedAt
+			case types.AlertFiring:
+				at = data.Alert.FiredAt
+			case types.AlertResolved:
+				at = data.Alert.ResolvedAt
+			}
+			if at == nil || !at.Equal(t0.Add(want.at)) {
+				t.Errorf("event %d: %s at %v, want %v", i, want.state, at, t0.Add(want.at))
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("event %d: timed out waiting for %s", i, want.state)
+		}
+	}
+
+	// the last reading was evaluated, any further event would be queued by now
+	select {
+	case event := <-alerts.Events():
+		t.Errorf("unexpected event %+v", event)
+	default:
+	}
+
+	firing := 0
+	history, err := store.GetAlerts(types.AlertQuery{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, alert := range history {
+		if alert.FiredAt != nil {
+			firing++
+		}
+	}
+	if len(history) != 2 || firing != 1 {
+		t.Errorf("alerts = %+v, want two of which one fired", history)
+	}
+}
+
+// approveDevice registers a device and returns its id.
+func approveDevice(t *testing.T, devices types.DeviceStore, macAddress string) int {
+	t.Helper()
+
+	if err := devices.RequestDevice(types.RequestDevicePayload{MACAddress: macAddress}); err != nil {
+		t.Fatal(err)
+	}
+	outcomes, err := devices.ApproveDevices([]types.DeviceApproval{{
+		Device:  types.DevicePayload{MACAddress: macAddress, Name: macAddress},
+		KeyHash: macAddress,
+	}}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(outcomes) != 1 || outcomes[0].Err != nil || outcomes[0].DeviceId == 0 {
+		t.Fatalf("ApproveDevices = %+v", outcomes)
+	}
+
+	return outcomes[0].DeviceId
+}
@@ -0,0 +1,263 @@
+package alert
+
+import (
+	"air-controller-webservice/middleware"
+	"air-controller-webservice/types"
+	"air-controller-webservice/utils"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+type Handler struct {
+	store       types.AlertStore
+	metricStore types.MetricStore
+}
+
+func NewHandler(store types.AlertStore, metricStore types.MetricStore) *Handler {
+	return &Handler{store: store, metricStore: metricStore}
+}
+
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/alert", h.handleGetAlerts).Methods("GET")
+	router.HandleFunc("/alert/history", h.handleGetHistory).Methods("GET")
+	router.HandleFunc("/alert/rule", h.handleGetRules).Methods("GET")
+	router.HandleFunc("/alert/rule", h.handleOptions).Methods("OPTIONS")
+	router.HandleFunc("/alert/rule/{id:[0-9]+}", h.handleGetRule).Methods("GET")
+	router.HandleFunc("/alert/rule/{id:[0-9]+}", h.handleOptions).Methods("OPTIONS")
+
+	middlewareRouter := router.NewRoute().Subrouter()
+	middlewareRouter.HandleFunc("/alert/rule", h.handlePostRule).Methods("POST")
+	middlewareRouter.HandleFunc("/alert/rule/{id:[0-9]+}", h.handlePutRule).Methods("PUT")
+	middlewareRouter.HandleFunc("/alert/rule/{id:[0-9]+}", h.handleDeleteRule).Methods("DELETE")
+	middlewareRouter.Use(middleware.RequireAuth())
+}
+
+func (h *Handler) handleGetRules(w http.ResponseWriter, r *http.Request) {
+	rules, err := h.store.GetAlertRules()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, rules)
+}
+
+func (h *Handler) handleGetRule(w http.ResponseWriter, r *http.Request) {
+	rule, ok := h.getRuleFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, rule)
+}
+
+func (h *Handler) handlePostRule(w http.ResponseWriter, r *http.Request) {
+	var payload types.AlertRulePayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if !h.validateRule(w, payload) {
+		return
+	}
+
+	id, err := h.store.CreateAlertRule(payload)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	rule, err := h.store.GetAlertRuleById(id)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, rule)
+}
+
+// handlePutRule replaces a rule. Its open alerts are kept and evaluated with
+// the new settings.
+func (h *Handler) handlePutRule(w http.ResponseWriter, r *http.Request) {
+	rule, ok := h.getRuleFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var payload types.AlertRulePayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if !h.validateRule(w, payload) {
+		return
+	}
+
+	if err := h.store.UpdateAlertRule(rule.ID, payload); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	rule, err := h.store.GetAlertRuleById(rule.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, rule)
+}
+
+func (h *Handler) handleDeleteRule(w http.ResponseWriter, r *http.Request) {
+	rule, ok := h.getRuleFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.store.DeleteAlertRule(rule.ID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, nil)
+}
+
+// handleGetAlerts lists alerts, newest first, filtered by the optional state,
+// ruleId and deviceId query parameters.
+func (h *Handler) handleGetAlerts(w http.ResponseWriter, r *http.Request) {
+	query, err := parseAlertQuery(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	alerts, err := h.store.GetAlerts(query)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, alerts)
+}
+
+// handleGetHistory lists the state transitions of alerts, newest first.
+func (h *Handler) handleGetHistory(w http.ResponseWriter, r *http.Request) {
+	query, err := parseAlertQuery(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	transitions, err := h.store.GetAlertTransitions(query)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, transitions)
+}
+
+func (h *Handler) handleOptions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, PUT, OPTIONS, GET, DELETE")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.WriteHeader(http.StatusOK)
+}
+
+// getRuleFromPath loads the rule of the {id} path variable and writes the
+// error response if there is none.
+func (h *Handler) getRuleFromPath(w http.ResponseWriter, r *http.Request) (*types.AlertRule, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid rule id"))
+		return nil, false
+	}
+
+	rule, err := h.store.GetAlertRuleById(id)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+
+	if rule.ID == 0 {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("alert rule %d not found", id))
+		return nil, false
+	}
+
+	return rule, true
+}
+
+// validateRule writes the error response for an invalid rule.
+func (h *Handler) validateRule(w http.ResponseWriter, rule types.AlertRulePayload) bool {
+	var err error
+	switch {
+	case rule.Name == "":
+		err = fmt.Errorf("name is required")
+	case rule.DeviceId != nil && rule.Localization != nil:
+		err = fmt.Errorf("a rule applies either to a device or to a localization")
+	case rule.Comparator != ">" && rule.Comparator != ">=" && rule.Comparator != "<" && rule.Comparator != "<=":
+		err = fmt.Errorf("comparator must be one of >, >=, < and <=")
+	case rule.DurationSeconds < 0:
+		err = fmt.Errorf("durationSeconds must not be negative")
+	case rule.Hysteresis < 0:
+		err = fmt.Errorf("hysteresis must not be negative")
+	}
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return false
+	}
+
+	metric, err := h.metricStore.GetMetricByName(rule.Metric)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return false
+	}
+
+	if metric.Name == "" {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("unknown metric: %s", rule.Metric))
+		return false
+	}
+
+	return true
+}
+
+func parseAlertQuery(r *http.Request) (types.AlertQuery, error) {
+	query := types.AlertQuery{Limit: defaultPageSize}
+	params := r.URL.Query()
+
+	if state := params.Get("state"); state != "" {
+		query.State = types.AlertState(state)
+		if query.State != types.AlertPending && query.State != types.AlertFiring && query.State != types.AlertResolved {
+			return query, fmt.Errorf("state must be one of pending, firing and resolved")
+		}
+	}
+
+	for name, target := range map[string]*int{"ruleId": &query.RuleId, "deviceId": &query.DeviceId} {
+		if value := params.Get(name); value != "" {
+			id, err := strconv.Atoi(value)
+			if err != nil {
+				return query, fmt.Errorf("invalid %s: %s", name, value)
+			}
+			*target = id
+		}
+	}
+
+	if limit := params.Get("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil || l < 1 || l > maxPageSize {
+			return query, fmt.Errorf("limit must be between 1 and %d", maxPageSize)
+		}
+		query.Limit = l
+	}
+
+	return query, nil
+}
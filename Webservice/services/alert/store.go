@@ -0,0 +1,283 @@
+package alert
+
+import (
+	"air-controller-webservice/types"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+const (
+	ruleColumns       = "id, name, deviceId, localization, metric, comparator, threshold, durationSeconds, hysteresis, enabled, createdAt"
+	alertColumns      = "id, ruleId, deviceId, state, value, startedAt, firedAt, resolvedAt"
+	transitionColumns = "id, alertId, ruleId, deviceId, state, value, at"
+)
+
+func (s *Store) GetAlertRules() ([]*types.AlertRule, error) {
+	rows, err := s.db.Query("SELECT " + ruleColumns + " FROM alert_rules ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []*types.AlertRule{}
+	for rows.Next() {
+		rule, err := scanRowIntoRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, rows.Err()
+}
+
+func (s *Store) GetAlertRuleById(id int) (*types.AlertRule, error) {
+	rule, err := scanRowIntoRule(s.db.QueryRow("SELECT "+ruleColumns+" FROM alert_rules WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return new(types.AlertRule), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return rule, nil
+}
+
+func (s *Store) CreateAlertRule(rule types.AlertRulePayload) (int, error) {
+	var id int
+	err := s.db.QueryRow(`INSERT INTO alert_rules(name, deviceId, localization, metric, comparator, threshold, durationSeconds, hysteresis, enabled)
+		VALUES (?,?,?,?,?,?,?,?,?) RETURNING id`,
+		rule.Name, rule.DeviceId, rule.Localization, rule.Metric, rule.Comparator, rule.Threshold,
+		rule.DurationSeconds, rule.Hysteresis, rule.Enabled == nil || *rule.Enabled).Scan(&id)
+
+	return id, err
+}
+
+func (s *Store) UpdateAlertRule(id int, rule types.AlertRulePayload) error {
+	_, err := s.db.Exec(`UPDATE alert_rules SET name = ?, deviceId = ?, localization = ?, metric = ?, comparator = ?,
+		threshold = ?, durationSeconds = ?, hysteresis = ?, enabled = ? WHERE id = ?`,
+		rule.Name, rule.DeviceId, rule.Localization, rule.Metric, rule.Comparator, rule.Threshold,
+		rule.DurationSeconds, rule.Hysteresis, rule.Enabled == nil || *rule.Enabled, id)
+
+	return err
+}
+
+// DeleteAlertRule removes the rule together with its alerts and their history.
+func (s *Store) DeleteAlertRule(id int) error {
+	_, err := s.db.Exec("DELETE FROM alert_rules WHERE id = ?", id)
+	return err
+}
+
+// GetActiveAlert returns the pending or firing alert of the rule for the
+// device, an empty alert if there is none.
+func (s *Store) GetActiveAlert(ruleId int, deviceId int) (*types.Alert, error) {
+	alert, err := scanRowIntoAlert(s.db.QueryRow("SELECT "+alertColumns+" FROM alerts WHERE ruleId = ? AND deviceId = ? AND state IN (?, ?)",
+		ruleId, deviceId, types.AlertPending, types.AlertFiring))
+	if err == sql.ErrNoRows {
+		return new(types.Alert), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return alert, nil
+}
+
+// CreateAlert inserts the alert and records its first transition.
+func (s *Store) CreateAlert(alert *types.Alert) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow("INSERT INTO alerts(ruleId, deviceId, state, value, startedAt, firedAt, resolvedAt) VALUES (?,?,?,?,?,?,?) RETURNING id",
+		alert.RuleId, alert.DeviceId, alert.State, alert.Value, alert.StartedAt, alert.FiredAt, alert.ResolvedAt).Scan(&alert.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := insertTransition(tx, alert); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UpdateAlert stores the state and value of the alert. If transition is set,
+// the alert changed its state and the transition is recorded.
+func (s *Store) UpdateAlert(alert *types.Alert, transition bool) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE alerts SET state = ?, value = ?, firedAt = ?, resolvedAt = ? WHERE id = ?",
+		alert.State, alert.Value, alert.FiredAt, alert.ResolvedAt, alert.ID); err != nil {
+		return err
+	}
+
+	if transition {
+		if err := insertTransition(tx, alert); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func insertTransition(tx *sql.Tx, alert *types.Alert) error {
+	at := alert.StartedAt
+	switch {
+	case alert.State == types.AlertResolved && alert.ResolvedAt != nil:
+		at = *alert.ResolvedAt
+	case alert.State == types.AlertFiring && alert.FiredAt != nil:
+		at = *alert.FiredAt
+	}
+
+	_, err := tx.Exec("INSERT INTO alert_transitions(alertId, ruleId, deviceId, state, value, at) VALUES (?,?,?,?,?,?)",
+		alert.ID, alert.RuleId, alert.DeviceId, alert.State, alert.Value, at)
+
+	return err
+}
+
+func (s *Store) GetAlerts(query types.AlertQuery) ([]*types.Alert, error) {
+	where, args := alertConditions(query)
+	args = append(args, query.Limit)
+
+	rows, err := s.db.Query("SELECT "+alertColumns+" FROM alerts"+where+" ORDER BY id DESC LIMIT ?", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	alerts := []*types.Alert{}
+	for rows.Next() {
+		alert, err := scanRowIntoAlert(rows)
+		if err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, alert)
+	}
+
+	return alerts, rows.Err()
+}
+
+func (s *Store) GetAlertTransitions(query types.AlertQuery) ([]*types.AlertTransition, error) {
+	where, args := alertConditions(query)
+	args = append(args, query.Limit)
+
+	rows, err := s.db.Query("SELECT "+transitionColumns+" FROM alert_transitions"+where+" ORDER BY id DESC LIMIT ?", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transitions := []*types.AlertTransition{}
+	for rows.Next() {
+		transition := new(types.AlertTransition)
+		if err := rows.Scan(
+			&transition.ID,
+			&transition.AlertId,
+			&transition.RuleId,
+			&transition.DeviceId,
+			&transition.State,
+			&transition.Value,
+			&transition.At,
+		); err != nil {
+			return nil, err
+		}
+		transitions = append(transitions, transition)
+	}
+
+	return transitions, rows.Err()
+}
+
+func alertConditions(query types.AlertQuery) (string, []any) {
+	var conditions []string
+	var args []any
+
+	if query.State != "" {
+		conditions = append(conditions, "state = ?")
+		args = append(args, query.State)
+	}
+	if query.RuleId != 0 {
+		conditions = append(conditions, "ruleId = ?")
+		args = append(args, query.RuleId)
+	}
+	if query.DeviceId != 0 {
+		conditions = append(conditions, "deviceId = ?")
+		args = append(args, query.DeviceId)
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+func scanRowIntoRule(rows interface{ Scan(dest ...any) error }) (*types.AlertRule, error) {
+	rule := new(types.AlertRule)
+
+	err := rows.Scan(
+		&rule.ID,
+		&rule.Name,
+		&rule.DeviceId,
+		&rule.Localization,
+		&rule.Metric,
+		&rule.Comparator,
+		&rule.Threshold,
+		&rule.DurationSeconds,
+		&rule.Hysteresis,
+		&rule.Enabled,
+		&rule.CreatedAt,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return rule, nil
+}
+
+func scanRowIntoAlert(rows interface{ Scan(dest ...any) error }) (*types.Alert, error) {
+	alert := new(types.Alert)
+	var firedAt, resolvedAt sql.NullTime
+
+	err := rows.Scan(
+		&alert.ID,
+		&alert.RuleId,
+		&alert.DeviceId,
+		&alert.State,
+		&alert.Value,
+		&alert.StartedAt,
+		&firedAt,
+		&resolvedAt,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	alert.FiredAt = nullTime(firedAt)
+	alert.ResolvedAt = nullTime(resolvedAt)
+
+	return alert, nil
+}
+
+func nullTime(value sql.NullTime) *time.Time {
+	if !value.Valid {
+		return nil
+	}
+	return &value.Time
+}
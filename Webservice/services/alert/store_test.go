@@ -0,0 +1,28 @@
+package alert_test
+
+import (
+	"air-controller-webservice/db"
+	"air-controller-webservice/services/alert"
+	"air-controller-webservice/services/device"
+	"air-controller-webservice/services/storetest"
+	"air-controller-webservice/types"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	for _, backend := range storetest.Backends() {
+		t.Run(backend.Name, func(t *testing.T) {
+			storetest.RunAlertStore(t, func(t *testing.T) (types.AlertStore, types.DeviceStore) {
+				database := backend.Open(t)
+				switch backend.Name {
+				case db.SQLite:
+					return alert.NewStore(database), device.NewSQLiteStore(database)
+				case db.Postgres:
+					return alert.NewStore(database), device.NewPostgresStore(database)
+				default:
+					return alert.NewStore(database), device.NewStore(database)
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// GenerateDeviceKey creates a random device API key. Only the hash returned
+// alongside is meant to be stored.
+func GenerateDeviceKey() (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+
+	key := hex.EncodeToString(buf)
+	return key, HashDeviceKey(key), nil
+}
+
+// HashDeviceKey returns the hex encoded SHA-256 of a device API key. The keys
+// are random, so a fast unsalted hash is enough to keep them unusable if the
+// database leaks.
+func HashDeviceKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,253 @@
+package device
+
+import (
+	"air-controller-webservice/middleware"
+	"air-controller-webservice/services/auth"
+	"air-controller-webservice/services/events"
+	"air-controller-webservice/types"
+	"air-controller-webservice/utils"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+)
+
+const maxBulkSize = 1000
+
+// handleBulkApprove approves many pending requests at once. All acceptable
+// items are approved in one transaction, the response reports the outcome
+// and the API key of every item. Items the store skips, e.g. because their
+// request was declined meanwhile, fail alone.
+func (h *Handler) handleBulkApprove(w http.ResponseWriter, r *http.Request) {
+	devices, err := parseBulkBody(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	results := make([]types.DeviceBulkResult, len(devices))
+	approvals := make([]types.DeviceApproval, 0, len(devices))
+	keys := make([]string, 0, len(devices))
+	indexes := make([]int, 0, len(devices))
+	seen := map[string]bool{}
+
+	for index, device := range devices {
+		results[index] = types.DeviceBulkResult{Index: index, MACAddress: device.MACAddress, Status: http.StatusCreated}
+
+		macAddress, status, err := checkBulkItem(device.MACAddress, seen)
+		if err == nil && device.Name == "" {
+			status, err = http.StatusBadRequest, fmt.Errorf("name is required")
+		}
+		if err != nil {
+			results[index].Status = status
+			results[index].Error = err.Error()
+			continue
+		}
+
+		key, keyHash, err := auth.GenerateDeviceKey()
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		device.MACAddress = macAddress
+		approvals = append(approvals, types.DeviceApproval{Device: device, KeyHash: keyHash})
+		keys = append(keys, key)
+		indexes = append(indexes, index)
+	}
+
+	if len(approvals) > 0 {
+		outcomes, err := h.store.ApproveDevices(approvals, middleware.UserIdFromContext(r.Context()))
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		for i, index := range indexes {
+			if outcomes[i].Err != nil {
+				results[index].Status = outcomes[i].Status
+				results[index].Error = outcomes[i].Err.Error()
+				continue
+			}
+			results[index].DeviceId = outcomes[i].DeviceId
+			results[index].Key = keys[i]
+
+			if device, err := h.store.GetDeviceById(outcomes[i].DeviceId); err == nil {
+				h.events.Publish(events.Event{Type: events.DeviceApproved, DeviceId: device.ID, Data: device})
+			}
+		}
+	}
+
+	writeBulkResults(w, http.StatusCreated, results)
+}
+
+// handleBulkDecline declines many pending requests at once in one
+// transaction and reports the outcome of every item.
+func (h *Handler) handleBulkDecline(w http.ResponseWriter, r *http.Request) {
+	devices, err := parseBulkBody(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	results := make([]types.DeviceBulkResult, len(devices))
+	macAddresses := make([]string, 0, len(devices))
+	indexes := make([]int, 0, len(devices))
+	seen := map[string]bool{}
+
+	for index, device := range devices {
+		results[index] = types.DeviceBulkResult{Index: index, MACAddress: device.MACAddress, Status: http.StatusOK}
+
+		macAddress, status, err := checkBulkItem(device.MACAddress, seen)
+		if err != nil {
+			results[index].Status = status
+			results[index].Error = err.Error()
+			continue
+		}
+
+		macAddresses = append(macAddresses, macAddress)
+		indexes = append(indexes, index)
+	}
+
+	if len(macAddresses) > 0 {
+		outcomes, err := h.store.DeclineRequestDevices(macAddresses, middleware.UserIdFromContext(r.Context()))
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		for i, index := range indexes {
+			if outcomes[i].Err != nil {
+				results[index].Status = outcomes[i].Status
+				results[index].Error = outcomes[i].Err.Error()
+				continue
+			}
+
+			h.events.Publish(events.Event{Type: events.DeviceDeclined, Data: types.RequestDevicePayload{MACAddress: macAddresses[i]}})
+		}
+	}
+
+	writeBulkResults(w, http.StatusOK, results)
+}
+
+// checkBulkItem makes sure a MAC address is valid and not listed twice and
+// returns it normalized to upper case with colons, the stores look requests
+// up ignoring case. It returns the status code for the result if not valid.
+// Whether the request is pending is checked by the store in its transaction.
+func checkBulkItem(macAddress string, seen map[string]bool) (string, int, error) {
+	normalized, err := normalizeMac(macAddress)
+	if err != nil {
+		return "", http.StatusBadRequest, err
+	}
+
+	if seen[normalized] {
+		return "", http.StatusBadRequest, fmt.Errorf("duplicate macAddress %s", macAddress)
+	}
+	seen[normalized] = true
+
+	return normalized, 0, nil
+}
+
+// normalizeMac checks a MAC address and returns it in upper case with colons.
+func normalizeMac(macAddress string) (string, error) {
+	if macAddress == "" {
+		return "", fmt.Errorf("macAddress is required")
+	}
+
+	hardwareAddr, err := net.ParseMAC(macAddress)
+	if err != nil || len(hardwareAddr) != 6 {
+		return "", fmt.Errorf("invalid macAddress %s", macAddress)
+	}
+
+	return strings.ToUpper(hardwareAddr.String()), nil
+}
+
+// writeBulkResults answers with status if every item succeeded and with 207
+// Multi-Status otherwise.
+func writeBulkResults(w http.ResponseWriter, status int, results []types.DeviceBulkResult) {
+	for _, result := range results {
+		if result.Status != status {
+			utils.WriteJSON(w, http.StatusMultiStatus, results)
+			return
+		}
+	}
+
+	utils.WriteJSON(w, status, results)
+}
+
+// parseBulkBody reads the devices of a bulk request. The body is a JSON array
+// of devices or, with Content-Type text/csv, CSV whose header row names the
+// columns macAddress, name and localization.
+func parseBulkBody(r *http.Request) ([]types.DevicePayload, error) {
+	var devices []types.DevicePayload
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "text/csv" {
+		var err error
+		if devices, err = parseBulkCSV(r.Body); err != nil {
+			return nil, err
+		}
+	} else if err := utils.ParseJSON(r, &devices); err != nil {
+		return nil, err
+	}
+
+	if len(devices) == 0 || len(devices) > maxBulkSize {
+		return nil, fmt.Errorf("bulk request must contain between 1 and %d devices", maxBulkSize)
+	}
+
+	return devices, nil
+}
+
+func parseBulkCSV(body io.Reader) ([]types.DevicePayload, error) {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("csv is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		// spreadsheet exports often start with a byte order mark
+		name = strings.TrimPrefix(name, "\ufeff")
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["macaddress"]; !ok {
+		return nil, fmt.Errorf("csv needs a macAddress column")
+	}
+
+	field := func(record []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	var devices []types.DevicePayload
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		devices = append(devices, types.DevicePayload{
+			MACAddress:   field(record, "macaddress"),
+			Name:         field(record, "name"),
+			Localization: field(record, "localization"),
+		})
+	}
+
+	return devices, nil
+}
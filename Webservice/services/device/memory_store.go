@@ -0,0 +1,620 @@
+package device
+
+import (
+	"air-controller-webservice/types"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps devices in memory. It behaves like Store and is meant for
+// tests, nothing survives the process. It knows no users and no readings:
+// decisions have no Username and DeleteDevice leaves readings alone.
+type MemoryStore struct {
+	mu         sync.Mutex
+	devices    []*memoryDevice
+	requests   []*types.RequestDevice
+	keys       map[int]string
+	heartbeats map[int]types.DeviceHeartbeat
+	blocked    []*types.BlockedDevice
+	decisions  []*types.DeviceDecision
+	lastIds    struct{ device, request, blocked, decision int }
+}
+
+type memoryDevice struct {
+	types.Device
+	deleted bool
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		keys:       map[int]string{},
+		heartbeats: map[int]types.DeviceHeartbeat{},
+	}
+}
+
+func (s *MemoryStore) CreateDevice(device types.DevicePayload) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if request := s.request(device.MACAddress); request == nil || !request.Active {
+		return fmt.Errorf("device was never requested. request the device first")
+	}
+	if s.deviceByMac(device.MACAddress) != nil {
+		return fmt.Errorf("device %s already exists", device.MACAddress)
+	}
+
+	s.request(device.MACAddress).Active = false
+	s.insertDevice(device)
+
+	return nil
+}
+
+func (s *MemoryStore) RequestDevice(requestDevice types.RequestDevicePayload) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.request(requestDevice.MACAddress) != nil {
+		return fmt.Errorf("device %s was already requested", requestDevice.MACAddress)
+	}
+
+	s.lastIds.request++
+	s.requests = append(s.requests, &types.RequestDevice{
+		ID:         s.lastIds.request,
+		MACAddress: requestDevice.MACAddress,
+		CreatedAt:  time.Now().UTC(),
+		Active:     true,
+	})
+
+	return nil
+}
+
+func (s *MemoryStore) GetDevices() ([]*types.Device, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var devices []*types.Device
+	for _, d := range s.devices {
+		if !d.deleted {
+			devices = append(devices, s.copyDevice(d))
+		}
+	}
+
+	return devices, nil
+}
+
+func (s *MemoryStore) GetDeviceById(deviceId int) (*types.Device, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if d := s.device(deviceId); d != nil && !d.deleted {
+		return s.copyDevice(d), nil
+	}
+
+	return new(types.Device), nil
+}
+
+func (s *MemoryStore) GetDeviceByIdIncludingDeleted(deviceId int) (*types.Device, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if d := s.device(deviceId); d != nil {
+		return s.copyDevice(d), nil
+	}
+
+	return new(types.Device), nil
+}
+
+func (s *MemoryStore) GetDeviceByMac(macAddress string) (*types.Device, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if d := s.deviceByMacIgnoringCase(macAddress); d != nil {
+		return s.copyDevice(d), nil
+	}
+
+	return new(types.Device), nil
+}
+
+func (s *MemoryStore) GetRequestedDevices() ([]*types.RequestDevice, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var requestedDevices []*types.RequestDevice
+	for _, request := range s.requests {
+		if request.Active {
+			requestedDevices = append(requestedDevices, copyRequest(request))
+		}
+	}
+
+	return requestedDevices, nil
+}
+
+func (s *MemoryStore) GetRequestedDevicesByMac(macAddress string) (*types.RequestDevice, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if request := s.request(macAddress); request != nil {
+		return copyRequest(request), nil
+	}
+
+	return new(types.RequestDevice), nil
+}
+
+func (s *MemoryStore) DeactivateDevice(macAddress string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if request := s.request(macAddress); request != nil {
+		request.Active = false
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) DeleteRequestDevice(macAddress string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deleteRequest(macAddress)
+
+	return nil
+}
+
+func (s *MemoryStore) SetDeviceKey(deviceId int, keyHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.device(deviceId) == nil {
+		return fmt.Errorf("device %d does not exist", deviceId)
+	}
+	for id, hash := range s.keys {
+		if hash == keyHash && id != deviceId {
+			return fmt.Errorf("key is already used by device %d", id)
+		}
+	}
+	s.keys[deviceId] = keyHash
+
+	return nil
+}
+
+func (s *MemoryStore) DeleteDeviceKey(deviceId int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.keys, deviceId)
+
+	return nil
+}
+
+func (s *MemoryStore) GetDeviceByKeyHash(keyHash string) (*types.Device, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, hash := range s.keys {
+		if d := s.device(id); hash == keyHash && d != nil && !d.deleted {
+			return s.copyDevice(d), nil
+		}
+	}
+
+	return new(types.Device), nil
+}
+
+func (s *MemoryStore) MarkDeviceSeen(deviceId int, at time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d := s.device(deviceId)
+	if d == nil {
+		return false, nil
+	}
+
+	at = at.UTC()
+	if !d.Online {
+		d.Online = true
+		d.LastSeenAt = &at
+		return true, nil
+	}
+	if d.LastSeenAt != nil && d.LastSeenAt.Before(at) {
+		d.LastSeenAt = &at
+	}
+
+	return false, nil
+}
+
+func (s *MemoryStore) MarkDevicesOffline(silentSince time.Time) ([]*types.Device, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var offline []*types.Device
+	for _, d := range s.devices {
+		if d.Online && d.LastSeenAt != nil && d.LastSeenAt.Before(silentSince) {
+			d.Online = false
+			offline = append(offline, s.copyDevice(d))
+		}
+	}
+
+	return offline, nil
+}
+
+func (s *MemoryStore) SaveHeartbeat(deviceId int, heartbeat types.DeviceHeartbeatPayload, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.device(deviceId) == nil {
+		return fmt.Errorf("device %d does not exist", deviceId)
+	}
+	s.heartbeats[deviceId] = types.DeviceHeartbeat{
+		Rssi:            heartbeat.Rssi,
+		Uptime:          heartbeat.Uptime,
+		FreeHeap:        heartbeat.FreeHeap,
+		FirmwareVersion: heartbeat.FirmwareVersion,
+		ReceivedAt:      at.UTC(),
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) UpdateDevice(deviceId int, device types.DeviceUpdatePayload) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d := s.device(deviceId)
+	if d == nil || d.deleted {
+		return nil
+	}
+	if device.Name != nil {
+		d.Name = *device.Name
+	}
+	if device.Localization != nil {
+		d.Localization = *device.Localization
+	}
+
+	return nil
+}
+
+// DeleteDevice removes the device, its key and heartbeat. With KeepReadings
+// the device is only marked as deleted, like in Store.
+func (s *MemoryStore) DeleteDevice(deviceId int, retention types.ReadingRetention) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.keys, deviceId)
+
+	d := s.device(deviceId)
+	if d == nil {
+		return nil
+	}
+	if retention == types.KeepReadings {
+		d.deleted = true
+		d.Online = false
+		return nil
+	}
+
+	delete(s.heartbeats, deviceId)
+	for i, other := range s.devices {
+		if other == d {
+			s.devices = append(s.devices[:i], s.devices[i+1:]...)
+			break
+		}
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) GetDeclinedDevices() ([]*types.RequestDevice, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	declinedDevices := []*types.RequestDevice{}
+	for _, request := range s.requests {
+		if !request.Active {
+			declinedDevices = append(declinedDevices, copyRequest(request))
+		}
+	}
+
+	// newest decision first, requests without a decision last
+	sort.SliceStable(declinedDevices, func(i, j int) bool {
+		a, b := declinedDevices[i], declinedDevices[j]
+		switch {
+		case a.DecidedAt == nil || b.DecidedAt == nil:
+			return a.DecidedAt != nil && b.DecidedAt == nil
+		case !a.DecidedAt.Equal(*b.DecidedAt):
+			return a.DecidedAt.After(*b.DecidedAt)
+		}
+		return a.ID > b.ID
+	})
+
+	return declinedDevices, nil
+}
+
+func (s *MemoryStore) DeclineRequestDevice(macAddress string, userId int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, request := range s.requests {
+		if strings.EqualFold(request.MACAddress, macAddress) {
+			decide(request, false, userId)
+		}
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) ReinstateRequestDevice(macAddress string, userId int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if request := s.request(macAddress); request != nil && !request.Active {
+		decide(request, true, userId)
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) GetBlockedDevices() ([]*types.BlockedDevice, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	blockedDevices := []*types.BlockedDevice{}
+	for i := len(s.blocked) - 1; i >= 0; i-- {
+		blockedDevice := *s.blocked[i]
+		blockedDevices = append(blockedDevices, &blockedDevice)
+	}
+
+	return blockedDevices, nil
+}
+
+func (s *MemoryStore) GetBlockedDeviceByMac(macAddress string) (*types.BlockedDevice, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, blocked := range s.blocked {
+		if strings.EqualFold(blocked.MACAddress, macAddress) {
+			blockedDevice := *blocked
+			return &blockedDevice, nil
+		}
+	}
+
+	return new(types.BlockedDevice), nil
+}
+
+func (s *MemoryStore) BlockDevice(device types.BlockedDevicePayload, userId int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, blocked := range s.blocked {
+		if blocked.MACAddress == device.MACAddress {
+			return fmt.Errorf("device %s is already blocked", device.MACAddress)
+		}
+	}
+
+	for i := len(s.requests) - 1; i >= 0; i-- {
+		if strings.EqualFold(s.requests[i].MACAddress, device.MACAddress) {
+			s.requests = append(s.requests[:i], s.requests[i+1:]...)
+		}
+	}
+	s.lastIds.blocked++
+	s.blocked = append(s.blocked, &types.BlockedDevice{
+		ID:         s.lastIds.blocked,
+		MACAddress: device.MACAddress,
+		Reason:     device.Reason,
+		BlockedBy:  nullableUserId(userId),
+		CreatedAt:  time.Now().UTC(),
+	})
+
+	return nil
+}
+
+func (s *MemoryStore) UnblockDevice(macAddress string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, blocked := range s.blocked {
+		if strings.EqualFold(blocked.MACAddress, macAddress) {
+			s.blocked = append(s.blocked[:i], s.blocked[i+1:]...)
+			break
+		}
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) CreateDeviceDecision(decision types.DeviceDecisionPayload) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.insertDecision(decision)
+
+	return nil
+}
+
+func (s *MemoryStore) GetDeviceDecisions(query types.DeviceDecisionQuery) ([]*types.DeviceDecision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	decisions := []*types.DeviceDecision{}
+	for i := len(s.decisions) - 1; i >= 0 && len(decisions) < query.Limit; i-- {
+		if query.MACAddress == "" || s.decisions[i].MACAddress == query.MACAddress {
+			decision := *s.decisions[i]
+			decisions = append(decisions, &decision)
+		}
+	}
+
+	return decisions, nil
+}
+
+// ApproveDevices skips the approvals whose request is not pending or whose
+// device already exists and approves the others. MAC addresses are matched
+// ignoring case, like in Store.
+func (s *MemoryStore) ApproveDevices(approvals []types.DeviceApproval, userId int) ([]types.DeviceBulkOutcome, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	outcomes := make([]types.DeviceBulkOutcome, len(approvals))
+	for i, approval := range approvals {
+		macAddress, status, err := s.checkPendingRequest(approval.Device.MACAddress)
+		if err != nil {
+			outcomes[i].Status, outcomes[i].Err = status, err
+			continue
+		}
+		if s.deviceByMacIgnoringCase(macAddress) != nil {
+			outcomes[i].Status, outcomes[i].Err = http.StatusConflict, fmt.Errorf("device %s already exists", macAddress)
+			continue
+		}
+
+		s.deleteRequest(macAddress)
+		approval.Device.MACAddress = macAddress
+		outcomes[i].DeviceId = s.insertDevice(approval.Device)
+		s.keys[outcomes[i].DeviceId] = approval.KeyHash
+		s.insertDecision(types.DeviceDecisionPayload{
+			MACAddress: macAddress,
+			Decision:   types.DecisionApproved,
+			UserId:     userId,
+		})
+	}
+
+	return outcomes, nil
+}
+
+// DeclineRequestDevices skips the requests that are not pending and declines
+// the others, like Store.
+func (s *MemoryStore) DeclineRequestDevices(macAddresses []string, userId int) ([]types.DeviceBulkOutcome, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	outcomes := make([]types.DeviceBulkOutcome, len(macAddresses))
+	for i, macAddress := range macAddresses {
+		macAddress, status, err := s.checkPendingRequest(macAddress)
+		if err != nil {
+			outcomes[i].Status, outcomes[i].Err = status, err
+			continue
+		}
+
+		decide(s.request(macAddress), false, userId)
+		s.insertDecision(types.DeviceDecisionPayload{
+			MACAddress: macAddress,
+			Decision:   types.DecisionDeclined,
+			UserId:     userId,
+		})
+	}
+
+	return outcomes, nil
+}
+
+func (s *MemoryStore) checkPendingRequest(macAddress string) (string, int, error) {
+	var request *types.RequestDevice
+	for _, r := range s.requests {
+		if strings.EqualFold(r.MACAddress, macAddress) {
+			request = r
+		}
+	}
+	if request == nil {
+		return "", http.StatusNotFound, fmt.Errorf("no request for %s", macAddress)
+	}
+	if !request.Active {
+		return "", http.StatusConflict, fmt.Errorf("request for %s was declined", macAddress)
+	}
+
+	return request.MACAddress, 0, nil
+}
+
+func (s *MemoryStore) deviceByMacIgnoringCase(macAddress string) *memoryDevice {
+	for _, d := range s.devices {
+		if strings.EqualFold(d.MACAddress, macAddress) && !d.deleted {
+			return d
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) insertDevice(device types.DevicePayload) int {
+	s.lastIds.device++
+	s.devices = append(s.devices, &memoryDevice{Device: types.Device{
+		ID:           s.lastIds.device,
+		MACAddress:   device.MACAddress,
+		Name:         device.Name,
+		Localization: device.Localization,
+		CreatedAt:    time.Now().UTC(),
+	}})
+
+	return s.lastIds.device
+}
+
+func (s *MemoryStore) insertDecision(decision types.DeviceDecisionPayload) {
+	s.lastIds.decision++
+	s.decisions = append(s.decisions, &types.DeviceDecision{
+		ID:         s.lastIds.decision,
+		MACAddress: decision.MACAddress,
+		Decision:   decision.Decision,
+		Reason:     decision.Reason,
+		UserId:     nullableUserId(decision.UserId),
+		CreatedAt:  time.Now().UTC(),
+	})
+}
+
+// device finds a device by id, including devices deleted with KeepReadings.
+func (s *MemoryStore) device(deviceId int) *memoryDevice {
+	for _, d := range s.devices {
+		if d.ID == deviceId {
+			return d
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) deviceByMac(macAddress string) *memoryDevice {
+	for _, d := range s.devices {
+		if d.MACAddress == macAddress && !d.deleted {
+			return d
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) request(macAddress string) *types.RequestDevice {
+	for _, request := range s.requests {
+		if request.MACAddress == macAddress {
+			return request
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) deleteRequest(macAddress string) {
+	for i, request := range s.requests {
+		if request.MACAddress == macAddress {
+			s.requests = append(s.requests[:i], s.requests[i+1:]...)
+			return
+		}
+	}
+}
+
+// copyDevice returns a copy of d with its latest heartbeat, callers cannot
+// change the stored device through it.
+func (s *MemoryStore) copyDevice(d *memoryDevice) *types.Device {
+	device := d.Device
+	if d.LastSeenAt != nil {
+		lastSeenAt := *d.LastSeenAt
+		device.LastSeenAt = &lastSeenAt
+	}
+	if heartbeat, ok := s.heartbeats[d.ID]; ok {
+		device.Heartbeat = &heartbeat
+	}
+	return &device
+}
+
+func copyRequest(request *types.RequestDevice) *types.RequestDevice {
+	requestDevice := *request
+	return &requestDevice
+}
+
+func decide(request *types.RequestDevice, active bool, userId int) {
+	now := time.Now().UTC()
+	request.Active = active
+	request.DecidedBy = nullableUserId(userId)
+	request.DecidedAt = &now
+}
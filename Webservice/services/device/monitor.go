@@ -0,0 +1,104 @@
+package device
+
+import (
+	"air-controller-webservice/services/events"
+	"air-controller-webservice/types"
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// minCheckInterval keeps short offline windows from polling the database
+// in a tight loop.
+const minCheckInterval = 5 * time.Second
+
+// Monitor tracks whether devices are alive. Every reading or heartbeat marks
+// a device as seen, a device that was silent for longer than offlineAfter is
+// marked offline. Both changes are published as events.
+type Monitor struct {
+	store        types.DeviceStore
+	events       *events.Broker
+	offlineAfter time.Duration
+
+	mu sync.Mutex
+	// written is when lastSeenAt was last written per device
+	written map[int]time.Time
+}
+
+func NewMonitor(store types.DeviceStore, events *events.Broker, offlineAfter time.Duration) *Monitor {
+	return &Monitor{store: store, events: events, offlineAfter: offlineAfter, written: map[int]time.Time{}}
+}
+
+// Seen records that a device sent something at the given time. Failing to
+// record it is only logged, it must not fail the request of the device.
+// lastSeenAt is written at most once per device every offlineAfter/4, that
+// is far more often than the offline check needs and spares the database a
+// write for every reading.
+func (m *Monitor) Seen(device *types.Device, at time.Time) {
+	m.mu.Lock()
+	written, ok := m.written[device.ID]
+	if ok && at.Before(written.Add(m.offlineAfter/4)) {
+		m.mu.Unlock()
+		return
+	}
+	m.written[device.ID] = at
+	m.mu.Unlock()
+
+	cameOnline, err := m.store.MarkDeviceSeen(device.ID, at)
+	if err != nil {
+		log.Println("device monitor:", err)
+		m.mu.Lock()
+		delete(m.written, device.ID)
+		m.mu.Unlock()
+		return
+	}
+
+	if cameOnline {
+		online := *device
+		online.Online = true
+		online.LastSeenAt = &at
+		m.events.Publish(events.Event{Type: events.DeviceOnline, DeviceId: device.ID, Time: at, Data: &online})
+	}
+}
+
+// Run checks for silent devices until ctx is done.
+func (m *Monitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(max(m.offlineAfter/4, minCheckInterval))
+	defer ticker.Stop()
+
+	for {
+		if err := m.CheckOffline(); err != nil {
+			log.Println("device monitor:", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CheckOffline marks the devices that were silent for too long as offline.
+func (m *Monitor) CheckOffline() error {
+	silentSince := time.Now().Add(-m.offlineAfter)
+	devices, err := m.store.MarkDevicesOffline(silentSince)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	for id, written := range m.written {
+		if written.Before(silentSince) {
+			delete(m.written, id)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, device := range devices {
+		m.events.Publish(events.Event{Type: events.DeviceOffline, DeviceId: device.ID, Data: device})
+	}
+
+	return nil
+}
@@ -0,0 +1,73 @@
+package device_test
+
+import (
+	"air-controller-webservice/services/device"
+	"air-controller-webservice/services/events"
+	"air-controller-webservice/types"
+	"testing"
+	"time"
+)
+
+// countingStore counts the writes of lastSeenAt.
+type countingStore struct {
+	types.DeviceStore
+	seen int
+}
+
+func (s *countingStore) MarkDeviceSeen(deviceId int, at time.Time) (bool, error) {
+	s.seen++
+	return s.DeviceStore.MarkDeviceSeen(deviceId, at)
+}
+
+func TestSeenThrottle(t *testing.T) {
+	store := &countingStore{DeviceStore: device.NewMemoryStore()}
+	if err := store.RequestDevice(types.RequestDevicePayload{MACAddress: "AA:BB:CC:DD:EE:FF"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.CreateDevice(types.DevicePayload{Name: "test", MACAddress: "AA:BB:CC:DD:EE:FF"}); err != nil {
+		t.Fatal(err)
+	}
+	d, err := store.GetDeviceByMac("AA:BB:CC:DD:EE:FF")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	broker := events.NewBroker()
+	online := broker.Subscribe(func(event events.Event) bool { return event.Type == events.DeviceOnline })
+	monitor := device.NewMonitor(store, broker, 4*time.Minute)
+
+	start := time.Now()
+	for _, seen := range []struct {
+		after  time.Duration
+		writes int
+	}{
+		{0, 1},
+		{30 * time.Second, 1},
+		{59 * time.Second, 1},
+		{time.Minute, 2},
+		{90 * time.Second, 2},
+		{2 * time.Minute, 3},
+	} {
+		monitor.Seen(d, start.Add(seen.after))
+		if store.seen != seen.writes {
+			t.Errorf("after %v: %d writes, want %d", seen.after, store.seen, seen.writes)
+		}
+	}
+
+	select {
+	case event := <-online.Events():
+		if event.DeviceId != d.ID {
+			t.Errorf("online event = %+v, want device %d", event, d.ID)
+		}
+	default:
+		t.Error("no online event")
+	}
+
+	stored, err := store.GetDeviceById(d.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := start.Add(2 * time.Minute); stored.LastSeenAt == nil || !stored.LastSeenAt.Equal(want) {
+		t.Errorf("lastSeenAt = %v, want %v", stored.LastSeenAt, want)
+	}
+}
@@ -0,0 +1,41 @@
+package device
+
+import (
+	"air-controller-webservice/types"
+	"database/sql"
+	"time"
+)
+
+// PostgresStore keeps devices in a PostgreSQL database. It upserts the device
+// key and the heartbeat with the ON CONFLICT statements of SQLiteStore, and
+// archives the metrics of deleted readings with jsonb_object_agg instead of
+// JSON_OBJECTAGG. Its timestamp columns carry the zone, so times are stored
+// as given.
+type PostgresStore struct {
+	*Store
+}
+
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{Store: NewStore(db)}
+}
+
+const postgresArchiveMetrics = "jsonb_object_agg(metric, value)"
+
+func (s *PostgresStore) SetDeviceKey(deviceId int, keyHash string) error {
+	if _, err := s.db.Exec(upsertDeviceKey, deviceId, keyHash); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *PostgresStore) SaveHeartbeat(deviceId int, heartbeat types.DeviceHeartbeatPayload, at time.Time) error {
+	_, err := s.db.Exec(upsertHeartbeat,
+		deviceId, heartbeat.Rssi, heartbeat.Uptime, heartbeat.FreeHeap, heartbeat.FirmwareVersion, at)
+
+	return err
+}
+
+func (s *PostgresStore) DeleteDevice(deviceId int, retention types.ReadingRetention) error {
+	return s.deleteDevice(deviceId, retention, postgresArchiveMetrics)
+}
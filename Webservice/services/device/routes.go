@@ -2,23 +2,52 @@ package device
 
 import (
 	"air-controller-webservice/middleware"
+	"air-controller-webservice/services/auth"
+	"air-controller-webservice/services/events"
 	"air-controller-webservice/types"
 	"air-controller-webservice/utils"
 	"fmt"
+	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 )
 
+const (
+	maxFirmwareVersionLength = 64
+	defaultDecisionPage      = 100
+	maxDecisionPage          = 1000
+)
+
 type Handler struct {
-	store types.DeviceStore
+	store   types.DeviceStore
+	events  *events.Broker
+	monitor *Monitor
 }
 
-func NewHandler(store types.DeviceStore) *Handler {
-	return &Handler{store: store}
+func NewHandler(store types.DeviceStore, events *events.Broker, monitor *Monitor) *Handler {
+	return &Handler{store: store, events: events, monitor: monitor}
 }
 
 func (h *Handler) RegisterRoutes(router *mux.Router) {
+	// registered first, the {macId} routes below would match these paths
+	decisionRouter := router.NewRoute().Subrouter()
+	decisionRouter.HandleFunc("/device/blocked", h.handleGetBlocked).Methods("GET")
+	decisionRouter.HandleFunc("/device/blocked", h.handleBlock).Methods("POST")
+	decisionRouter.HandleFunc("/device/blocked", h.handleOptions).Methods("OPTIONS")
+	decisionRouter.HandleFunc("/device/blocked/{macId}", h.handleUnblock).Methods("DELETE")
+	decisionRouter.HandleFunc("/device/blocked/{macId}", h.handleOptions).Methods("OPTIONS")
+	decisionRouter.HandleFunc("/device/request/declined", h.handleGetDeclined).Methods("GET")
+	decisionRouter.HandleFunc("/device/request/declined", h.handleOptions).Methods("OPTIONS")
+	decisionRouter.HandleFunc("/device/request/decision", h.handleGetDecisions).Methods("GET")
+	decisionRouter.HandleFunc("/device/request/decision", h.handleOptions).Methods("OPTIONS")
+	decisionRouter.HandleFunc("/device/request/{macId}/reinstate", h.handleReinstate).Methods("POST")
+	decisionRouter.HandleFunc("/device/request/{macId}/reinstate", h.handleOptions).Methods("OPTIONS")
+	decisionRouter.Use(middleware.RequireAuth())
+
 	router.HandleFunc("/device", h.handleGet).Methods("GET")
 	router.HandleFunc("/device/{macId}", h.handleGetByMac).Methods("GET")
 	router.HandleFunc("/device", h.handleOptions).Methods("OPTIONS")
@@ -29,9 +58,23 @@ func (h *Handler) RegisterRoutes(router *mux.Router) {
 
 	middlewareRouter := router.NewRoute().Subrouter()
 	middlewareRouter.HandleFunc("/device", h.handlePost).Methods("POST")
+	middlewareRouter.HandleFunc("/device/{id:[0-9]+}", h.handlePatch).Methods("PATCH")
+	middlewareRouter.HandleFunc("/device/{id:[0-9]+}", h.handleDelete).Methods("DELETE")
+	middlewareRouter.HandleFunc("/device/{id:[0-9]+}", h.handleOptions).Methods("OPTIONS")
 	middlewareRouter.HandleFunc("/device/request/decline", h.handleDeclinedRequest).Methods("POST")
 	middlewareRouter.HandleFunc("/device/request/decline", h.handleOptions).Methods("OPTIONS")
+	middlewareRouter.HandleFunc("/device/request/bulk/approve", h.handleBulkApprove).Methods("POST")
+	middlewareRouter.HandleFunc("/device/request/bulk/approve", h.handleOptions).Methods("OPTIONS")
+	middlewareRouter.HandleFunc("/device/request/bulk/decline", h.handleBulkDecline).Methods("POST")
+	middlewareRouter.HandleFunc("/device/request/bulk/decline", h.handleOptions).Methods("OPTIONS")
+	middlewareRouter.HandleFunc("/device/{id:[0-9]+}/key", h.handleRotateKey).Methods("POST")
+	middlewareRouter.HandleFunc("/device/{id:[0-9]+}/key", h.handleRevokeKey).Methods("DELETE")
+	middlewareRouter.HandleFunc("/device/{id:[0-9]+}/key", h.handleOptions).Methods("OPTIONS")
 	middlewareRouter.Use(middleware.RequireAuth())
+
+	deviceRouter := router.NewRoute().Subrouter()
+	deviceRouter.HandleFunc("/device/{macId}/heartbeat", h.handleHeartbeat).Methods("POST")
+	deviceRouter.Use(middleware.RequireDeviceAuth(h.store))
 }
 
 func (h *Handler) handleGet(w http.ResponseWriter, r *http.Request) {
@@ -70,18 +113,219 @@ func (h *Handler) handlePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.store.CreateDevice(payload); err != nil {
+	key, keyHash, err := auth.GenerateDeviceKey()
+	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	if err := h.store.DeleteRequestDevice(payload.MACAddress); err != nil {
+	// the device, its key and the decision are stored in one transaction
+	outcomes, err := h.store.ApproveDevices([]types.DeviceApproval{{Device: payload, KeyHash: keyHash}},
+		middleware.UserIdFromContext(r.Context()))
+	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
+	if outcomes[0].Err != nil {
+		utils.WriteError(w, outcomes[0].Status, outcomes[0].Err)
+		return
+	}
 
-	utils.WriteJSON(w, http.StatusCreated, nil)
+	device, err := h.store.GetDeviceById(outcomes[0].DeviceId)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.events.Publish(events.Event{Type: events.DeviceApproved, DeviceId: device.ID, Data: device})
+
+	utils.WriteJSON(w, http.StatusCreated, &types.DeviceKey{DeviceId: device.ID, MACAddress: device.MACAddress, Key: key})
+}
+
+// handlePatch renames or relocates a device.
+func (h *Handler) handlePatch(w http.ResponseWriter, r *http.Request) {
+	device, ok := h.getDeviceFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var payload types.DeviceUpdatePayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if payload.Name != nil && strings.TrimSpace(*payload.Name) == "" {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("name must not be empty"))
+		return
+	}
+
+	if err := h.store.UpdateDevice(device.ID, payload); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	device, err := h.store.GetDeviceById(device.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, device)
+}
+
+// handleDelete removes a device. The readings query parameter decides what
+// happens to its sensor readings: keep (default), archive or cascade.
+// A device deleted keeping its readings can be deleted again to archive or
+// delete them.
+func (h *Handler) handleDelete(w http.ResponseWriter, r *http.Request) {
+	retention := types.KeepReadings
+	if value := r.URL.Query().Get("readings"); value != "" {
+		retention = types.ReadingRetention(value)
+	}
+	if retention != types.KeepReadings && retention != types.ArchiveReadings && retention != types.DeleteReadings {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("readings must be keep, archive or cascade"))
+		return
+	}
+
+	lookup := h.store.GetDeviceById
+	if retention != types.KeepReadings {
+		lookup = h.store.GetDeviceByIdIncludingDeleted
+	}
+	device, ok := h.lookupDeviceFromPath(w, r, lookup)
+	if !ok {
+		return
+	}
+
+	if err := h.store.DeleteDevice(device.ID, retention); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.events.Publish(events.Event{Type: events.DeviceDeleted, DeviceId: device.ID, Data: device})
+
+	utils.WriteJSON(w, http.StatusOK, nil)
+}
+
+// handleRotateKey issues a new API key for a device, the old key stops working
+// immediately.
+func (h *Handler) handleRotateKey(w http.ResponseWriter, r *http.Request) {
+	device, ok := h.getDeviceFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	deviceKey, err := h.issueKey(device)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
 
+	utils.WriteJSON(w, http.StatusCreated, deviceKey)
+}
+
+// handleRevokeKey removes the API key of a device, it cannot send readings
+// until a new key is issued.
+func (h *Handler) handleRevokeKey(w http.ResponseWriter, r *http.Request) {
+	device, ok := h.getDeviceFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.store.DeleteDeviceKey(device.ID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, nil)
+}
+
+// handleHeartbeat stores the health report of a device and marks it as seen.
+// A device may only send heartbeats for itself.
+func (h *Handler) handleHeartbeat(w http.ResponseWriter, r *http.Request) {
+	device := middleware.DeviceFromContext(r.Context())
+	if !strings.EqualFold(mux.Vars(r)["macId"], device.MACAddress) {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("device %s may not send heartbeats for %s", device.MACAddress, mux.Vars(r)["macId"]))
+		return
+	}
+
+	var payload types.DeviceHeartbeatPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := validateHeartbeat(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	now := time.Now()
+	if err := h.store.SaveHeartbeat(device.ID, payload, now); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.monitor.Seen(device, now)
+
+	utils.WriteJSON(w, http.StatusOK, nil)
+}
+
+func validateHeartbeat(heartbeat types.DeviceHeartbeatPayload) error {
+	if heartbeat.Rssi != nil && (*heartbeat.Rssi < -127 || *heartbeat.Rssi > 0) {
+		return fmt.Errorf("rssi must be between -127 and 0 dBm")
+	}
+	if heartbeat.Uptime != nil && *heartbeat.Uptime < 0 {
+		return fmt.Errorf("uptime must not be negative")
+	}
+	if heartbeat.FreeHeap != nil && *heartbeat.FreeHeap < 0 {
+		return fmt.Errorf("freeHeap must not be negative")
+	}
+	if len(heartbeat.FirmwareVersion) > maxFirmwareVersionLength {
+		return fmt.Errorf("firmwareVersion must not be longer than %d characters", maxFirmwareVersionLength)
+	}
+
+	return nil
+}
+
+func (h *Handler) issueKey(device *types.Device) (*types.DeviceKey, error) {
+	key, keyHash, err := auth.GenerateDeviceKey()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := h.store.SetDeviceKey(device.ID, keyHash); err != nil {
+		return nil, err
+	}
+
+	return &types.DeviceKey{DeviceId: device.ID, MACAddress: device.MACAddress, Key: key}, nil
+}
+
+// getDeviceFromPath loads the device of the {id} path variable and writes the
+// error response if there is none.
+func (h *Handler) getDeviceFromPath(w http.ResponseWriter, r *http.Request) (*types.Device, bool) {
+	return h.lookupDeviceFromPath(w, r, h.store.GetDeviceById)
+}
+
+func (h *Handler) lookupDeviceFromPath(w http.ResponseWriter, r *http.Request, lookup func(int) (*types.Device, error)) (*types.Device, bool) {
+	deviceId, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid device id"))
+		return nil, false
+	}
+
+	device, err := lookup(deviceId)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+
+	if device.ID == 0 {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("device %d not found", deviceId))
+		return nil, false
+	}
+
+	return device, true
 }
 
 func (h *Handler) handleRequest(w http.ResponseWriter, r *http.Request) {
@@ -91,6 +335,17 @@ func (h *Handler) handleRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	blockedDevice, err := h.store.GetBlockedDeviceByMac(payload.MACAddress)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if blockedDevice.ID != 0 {
+		response := types.Response{Message: "device is blocked"}
+		utils.WriteJSON(w, http.StatusForbidden, response)
+		return
+	}
+
 	device, _ := h.store.GetDeviceByMac(payload.MACAddress)
 	if device.ID != 0 {
 		response := types.Response{Message: "device already registered"}
@@ -116,6 +371,10 @@ func (h *Handler) handleRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if requestedDevice, err := h.store.GetRequestedDevicesByMac(payload.MACAddress); err == nil {
+		h.events.Publish(events.Event{Type: events.DeviceRequested, Data: requestedDevice})
+	}
+
 	utils.WriteJSON(w, http.StatusCreated, nil)
 }
 
@@ -147,22 +406,191 @@ func (h *Handler) handleDeclinedRequest(w http.ResponseWriter, r *http.Request)
 		utils.WriteError(w, 400, err)
 		return
 	}
-	if payload.MACAddress == "" {
-		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("define mac-address"))
+	macAddress, err := normalizeMac(payload.MACAddress)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
 		return
 	}
+	payload.MACAddress = macAddress
 
-	if err := h.store.DeactivateDevice(payload.MACAddress); err != nil {
+	if err := h.store.DeclineRequestDevice(payload.MACAddress, middleware.UserIdFromContext(r.Context())); err != nil {
 		utils.WriteError(w, 400, err)
 		return
 	}
 
+	h.recordDecision(r, payload.MACAddress, types.DecisionDeclined, "")
+	h.events.Publish(events.Event{Type: events.DeviceDeclined, Data: payload})
+
 	utils.WriteJSON(w, http.StatusOK, nil)
 }
 
+func (h *Handler) handleGetDeclined(w http.ResponseWriter, r *http.Request) {
+	declinedDevices, err := h.store.GetDeclinedDevices()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, declinedDevices)
+}
+
+// handleReinstate turns a declined request back into a pending one, so the
+// device can be approved.
+func (h *Handler) handleReinstate(w http.ResponseWriter, r *http.Request) {
+	macAddress := mux.Vars(r)["macId"]
+	requestedDevice, err := h.store.GetRequestedDevicesByMac(macAddress)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if requestedDevice.ID == 0 {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("no request for %s", macAddress))
+		return
+	}
+	if requestedDevice.Active {
+		utils.WriteError(w, http.StatusConflict, fmt.Errorf("request for %s is not declined", macAddress))
+		return
+	}
+
+	if err := h.store.ReinstateRequestDevice(macAddress, middleware.UserIdFromContext(r.Context())); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	requestedDevice, err = h.store.GetRequestedDevicesByMac(macAddress)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.recordDecision(r, macAddress, types.DecisionReinstated, "")
+	h.events.Publish(events.Event{Type: events.DeviceRequested, Data: requestedDevice})
+
+	utils.WriteJSON(w, http.StatusOK, requestedDevice)
+}
+
+func (h *Handler) handleGetBlocked(w http.ResponseWriter, r *http.Request) {
+	blockedDevices, err := h.store.GetBlockedDevices()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, blockedDevices)
+}
+
+// handleBlock keeps a MAC address from requesting registration. A pending or
+// declined request of the address is dropped, registered devices have to be
+// deleted first.
+func (h *Handler) handleBlock(w http.ResponseWriter, r *http.Request) {
+	var payload types.BlockedDevicePayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	macAddress, err := normalizeMac(payload.MACAddress)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	payload.MACAddress = macAddress
+
+	device, err := h.store.GetDeviceByMac(payload.MACAddress)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if device.ID != 0 {
+		utils.WriteError(w, http.StatusConflict, fmt.Errorf("device %s is registered, delete it first", payload.MACAddress))
+		return
+	}
+
+	blockedDevice, err := h.store.GetBlockedDeviceByMac(payload.MACAddress)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if blockedDevice.ID != 0 {
+		utils.WriteError(w, http.StatusConflict, fmt.Errorf("device %s is already blocked", payload.MACAddress))
+		return
+	}
+
+	if err := h.store.BlockDevice(payload, middleware.UserIdFromContext(r.Context())); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	blockedDevice, err = h.store.GetBlockedDeviceByMac(payload.MACAddress)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.recordDecision(r, payload.MACAddress, types.DecisionBlocked, payload.Reason)
+
+	utils.WriteJSON(w, http.StatusCreated, blockedDevice)
+}
+
+func (h *Handler) handleUnblock(w http.ResponseWriter, r *http.Request) {
+	macAddress := mux.Vars(r)["macId"]
+	blockedDevice, err := h.store.GetBlockedDeviceByMac(macAddress)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if blockedDevice.ID == 0 {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("device %s is not blocked", macAddress))
+		return
+	}
+
+	if err := h.store.UnblockDevice(macAddress); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.recordDecision(r, macAddress, types.DecisionUnblocked, "")
+
+	utils.WriteJSON(w, http.StatusOK, nil)
+}
+
+func (h *Handler) handleGetDecisions(w http.ResponseWriter, r *http.Request) {
+	query := types.DeviceDecisionQuery{MACAddress: r.URL.Query().Get("macAddress"), Limit: defaultDecisionPage}
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxDecisionPage {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("limit must be between 1 and %d", maxDecisionPage))
+			return
+		}
+		query.Limit = limit
+	}
+
+	decisions, err := h.store.GetDeviceDecisions(query)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, decisions)
+}
+
+// recordDecision logs who decided on a device. The decision itself is already
+// stored, so failing to log it does not fail the request.
+func (h *Handler) recordDecision(r *http.Request, macAddress string, decision types.DeviceDecisionType, reason string) {
+	err := h.store.CreateDeviceDecision(types.DeviceDecisionPayload{
+		MACAddress: macAddress,
+		Decision:   decision,
+		Reason:     reason,
+		UserId:     middleware.UserIdFromContext(r.Context()),
+	})
+	if err != nil {
+		log.Println("could not record device decision:", err)
+	}
+}
+
 func (h *Handler) handleOptions(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, DELETE")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, PATCH, OPTIONS, GET, DELETE")
 	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 	w.WriteHeader(http.StatusOK)
 }
@@ -0,0 +1,397 @@
+package device_test
+
+import (
+	"air-controller-webservice/config"
+	"air-controller-webservice/services/auth"
+	"air-controller-webservice/services/device"
+	"air-controller-webservice/services/events"
+	"air-controller-webservice/types"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/gorilla/mux"
+)
+
+func TestRequest(t *testing.T) {
+	store := device.NewMemoryStore()
+	router := newRouter(store)
+	request := func(macAddress string) *httptest.ResponseRecorder {
+		return serve(router, http.MethodPost, "/device/request", "application/json",
+			strings.NewReader(`{"macAddress": "`+macAddress+`"}`))
+	}
+
+	if rr := request("AA:BB:CC:DD:EE:01"); rr.Code != http.StatusCreated {
+		t.Fatalf("request: status %d %s, want %d", rr.Code, rr.Body, http.StatusCreated)
+	}
+	requested, err := store.GetRequestedDevicesByMac("AA:BB:CC:DD:EE:01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requested.ID == 0 || !requested.Active {
+		t.Errorf("requested device = %+v, want an active request", requested)
+	}
+
+	if key := registerDevice(t, router, "AA:BB:CC:DD:EE:02"); key.Key == "" {
+		t.Fatal("no key issued")
+	}
+	if rr := request("AA:BB:CC:DD:EE:03"); rr.Code != http.StatusCreated {
+		t.Fatalf("request: status %d %s", rr.Code, rr.Body)
+	}
+	if err := store.DeclineRequestDevice("AA:BB:CC:DD:EE:03", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.BlockDevice(types.BlockedDevicePayload{MACAddress: "AA:BB:CC:DD:EE:04"}, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name       string
+		macAddress string
+		status     int
+		message    string
+	}{
+		{"pending", "AA:BB:CC:DD:EE:01", http.StatusConflict, "device already requested"},
+		{"registered", "AA:BB:CC:DD:EE:02", http.StatusConflict, "device already registered"},
+		{"declined", "AA:BB:CC:DD:EE:03", http.StatusConflict, "device was declined"},
+		{"blocked", "AA:BB:CC:DD:EE:04", http.StatusForbidden, "device is blocked"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			rr := request(test.macAddress)
+			var response types.Response
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				t.Fatal(err)
+			}
+			if rr.Code != test.status || response.Message != test.message {
+				t.Errorf("status %d %q, want %d %q", rr.Code, response.Message, test.status, test.message)
+			}
+		})
+	}
+
+	if rr := serve(router, http.MethodPost, "/device/request", "application/json", strings.NewReader("{")); rr.Code != http.StatusBadRequest {
+		t.Errorf("invalid JSON: status %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+}
+
+func TestDeclineAndBlock(t *testing.T) {
+	store := device.NewMemoryStore()
+	router := newRouter(store)
+
+	for _, macAddress := range []string{"AA:BB:CC:DD:EE:01", "AA:BB:CC:DD:EE:02"} {
+		if err := store.RequestDevice(types.RequestDevicePayload{MACAddress: macAddress}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// MAC addresses are matched ignoring case and with any separator
+	if rr := serve(router, http.MethodPost, "/device/request/decline", "application/json",
+		strings.NewReader(`{"macAddress": "aa-bb-cc-dd-ee-01"}`)); rr.Code != http.StatusOK {
+		t.Fatalf("decline: status %d %s", rr.Code, rr.Body)
+	}
+	declined, err := store.GetRequestedDevicesByMac("AA:BB:CC:DD:EE:01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if declined.ID == 0 || declined.Active {
+		t.Errorf("declined request = %+v", declined)
+	}
+
+	rr := serve(router, http.MethodPost, "/device/blocked", "application/json",
+		strings.NewReader(`{"macAddress": "aa:bb:cc:dd:ee:02", "reason": "spam"}`))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("block: status %d %s", rr.Code, rr.Body)
+	}
+	var blocked types.BlockedDevice
+	if err := json.NewDecoder(rr.Body).Decode(&blocked); err != nil {
+		t.Fatal(err)
+	}
+	if blocked.MACAddress != "AA:BB:CC:DD:EE:02" {
+		t.Errorf("blocked %s, want the normalized MAC address", blocked.MACAddress)
+	}
+	if request, err := store.GetRequestedDevicesByMac("AA:BB:CC:DD:EE:02"); err != nil || request.ID != 0 {
+		t.Errorf("request of the blocked device = %+v, %v", request, err)
+	}
+
+	for _, test := range []struct {
+		name   string
+		path   string
+		body   string
+		status int
+	}{
+		{"block again", "/device/blocked", `{"macAddress": "aa:bb:cc:dd:ee:02"}`, http.StatusConflict},
+		{"request when blocked", "/device/request", `{"macAddress": "aa:bb:cc:dd:ee:02"}`, http.StatusForbidden},
+		{"block invalid", "/device/blocked", `{"macAddress": "not a mac"}`, http.StatusBadRequest},
+		{"decline invalid", "/device/request/decline", `{"macAddress": ""}`, http.StatusBadRequest},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			rr := serve(router, http.MethodPost, test.path, "application/json", strings.NewReader(test.body))
+			if rr.Code != test.status {
+				t.Errorf("status %d %s, want %d", rr.Code, rr.Body, test.status)
+			}
+		})
+	}
+}
+
+func TestRegister(t *testing.T) {
+	store := device.NewMemoryStore()
+	router := newRouter(store)
+
+	key := registerDevice(t, router, "AA:BB:CC:DD:EE:01")
+	if key.DeviceId == 0 || key.MACAddress != "AA:BB:CC:DD:EE:01" || key.Key == "" {
+		t.Errorf("issued key = %+v", key)
+	}
+
+	registered, err := store.GetDeviceByKeyHash(auth.HashDeviceKey(key.Key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if registered.ID != key.DeviceId || registered.Name != "AA:BB:CC:DD:EE:01 name" || registered.Localization != "B204" {
+		t.Errorf("device of the key = %+v", registered)
+	}
+
+	requested, err := store.GetRequestedDevicesByMac("AA:BB:CC:DD:EE:01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requested.ID != 0 {
+		t.Errorf("request left after registering: %+v", requested)
+	}
+
+	rr := serve(router, http.MethodGet, "/device/AA:BB:CC:DD:EE:01", "", nil)
+	var got types.Device
+	if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+		t.Fatalf("status %d: %v", rr.Code, err)
+	}
+	if rr.Code != http.StatusOK || got.ID != key.DeviceId {
+		t.Errorf("GET /device/{macId}: status %d, device %+v", rr.Code, got)
+	}
+
+	if err := store.RequestDevice(types.RequestDevicePayload{MACAddress: "AA:BB:CC:DD:EE:03"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.DeclineRequestDevices([]string{"AA:BB:CC:DD:EE:03"}, 1); err != nil {
+		t.Fatal(err)
+	}
+	for macAddress, status := range map[string]int{
+		"AA:BB:CC:DD:EE:01": http.StatusNotFound, // the request is gone
+		"AA:BB:CC:DD:EE:03": http.StatusConflict,
+		"AA:BB:CC:DD:EE:09": http.StatusNotFound,
+	} {
+		rr := serve(router, http.MethodPost, "/device", "application/json",
+			strings.NewReader(`{"macAddress": "`+macAddress+`", "name": "again"}`))
+		if rr.Code != status {
+			t.Errorf("register %s: status %d %s, want %d", macAddress, rr.Code, rr.Body, status)
+		}
+	}
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/device", strings.NewReader(`{"macAddress": "AA:BB:CC:DD:EE:02"}`)))
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("register without login: status %d, want %d", rr.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+	store := device.NewMemoryStore()
+	router := newRouter(store)
+	key := registerDevice(t, router, "AA:BB:CC:DD:EE:01")
+	other := registerDevice(t, router, "AA:BB:CC:DD:EE:02")
+
+	for _, test := range []struct {
+		name   string
+		key    string
+		path   string
+		body   string
+		status int
+	}{
+		{"no key", "", "/device/AA:BB:CC:DD:EE:01/heartbeat", `{}`, http.StatusUnauthorized},
+		{"unknown key", "unknown", "/device/AA:BB:CC:DD:EE:01/heartbeat", `{}`, http.StatusUnauthorized},
+		{"other device", other.Key, "/device/AA:BB:CC:DD:EE:01/heartbeat", `{}`, http.StatusForbidden},
+		{"invalid rssi", key.Key, "/device/AA:BB:CC:DD:EE:01/heartbeat", `{"rssi": 10}`, http.StatusBadRequest},
+		{"heartbeat", key.Key, "/device/aa:bb:cc:dd:ee:01/heartbeat", `{"rssi": -60, "uptime": 3600, "firmwareVersion": "1.2.0"}`, http.StatusOK},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			rr := serveAsDevice(router, http.MethodPost, test.path, test.key, strings.NewReader(test.body))
+			if rr.Code != test.status {
+				t.Errorf("status %d %s, want %d", rr.Code, rr.Body, test.status)
+			}
+		})
+	}
+
+	got, err := store.GetDeviceById(key.DeviceId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.LastSeenAt == nil || got.Heartbeat == nil || got.Heartbeat.Rssi == nil || *got.Heartbeat.Rssi != -60 ||
+		got.Heartbeat.FirmwareVersion != "1.2.0" {
+		t.Errorf("device after the heartbeat = %+v", got)
+	}
+}
+
+func TestBulkApproveCSV(t *testing.T) {
+	tests := []struct {
+		name     string
+		csv      string
+		statuses []int
+		devices  []types.DevicePayload
+	}{
+		{
+			name:     "header in any order",
+			csv:      "localization,Name,macAddress\nB204,B204-Sensor,AA:BB:CC:DD:EE:10\n",
+			statuses: []int{http.StatusCreated},
+			devices:  []types.DevicePayload{{MACAddress: "AA:BB:CC:DD:EE:10", Name: "B204-Sensor", Localization: "B204"}},
+		},
+		{
+			name:     "byte order mark and spaces",
+			csv:      "\ufeffmacAddress, name\nAA:BB:CC:DD:EE:10, B204-Sensor\n",
+			statuses: []int{http.StatusCreated},
+			devices:  []types.DevicePayload{{MACAddress: "AA:BB:CC:DD:EE:10", Name: "B204-Sensor"}},
+		},
+		{
+			name:     "quoted fields",
+			csv:      "macAddress,name,localization\n\"AA:BB:CC:DD:EE:10\",\"Sensor, window\",\"Room \"\"B\"\"\"\n",
+			statuses: []int{http.StatusCreated},
+			devices:  []types.DevicePayload{{MACAddress: "AA:BB:CC:DD:EE:10", Name: "Sensor, window", Localization: `Room "B"`}},
+		},
+		{
+			name:     "blank trailing line",
+			csv:      "macAddress,name\nAA:BB:CC:DD:EE:10,a\nAA:BB:CC:DD:EE:11,b\n\n",
+			statuses: []int{http.StatusCreated, http.StatusCreated},
+			devices:  []types.DevicePayload{{MACAddress: "AA:BB:CC:DD:EE:10", Name: "a"}, {MACAddress: "AA:BB:CC:DD:EE:11", Name: "b"}},
+		},
+		{
+			name:     "missing columns",
+			csv:      "macAddress,name\nAA:BB:CC:DD:EE:10\n",
+			statuses: []int{http.StatusBadRequest},
+		},
+		{
+			name:     "mac addresses normalized",
+			csv:      "macAddress,name\naa-bb-cc-dd-ee-10,a\nAA:BB:CC:DD:EE:10,b\nnot a mac,c\n",
+			statuses: []int{http.StatusCreated, http.StatusBadRequest, http.StatusBadRequest},
+			devices:  []types.DevicePayload{{MACAddress: "AA:BB:CC:DD:EE:10", Name: "a"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := device.NewMemoryStore()
+			router := newRouter(store)
+			for _, macAddress := range []string{"AA:BB:CC:DD:EE:10", "AA:BB:CC:DD:EE:11"} {
+				if err := store.RequestDevice(types.RequestDevicePayload{MACAddress: macAddress}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			rr := serve(router, http.MethodPost, "/device/request/bulk/approve", "text/csv", strings.NewReader(test.csv))
+
+			var results []types.DeviceBulkResult
+			if err := json.NewDecoder(rr.Body).Decode(&results); err != nil {
+				t.Fatalf("status %d: %v", rr.Code, err)
+			}
+			if len(results) != len(test.statuses) {
+				t.Fatalf("results = %+v, want %d", results, len(test.statuses))
+			}
+			for i, result := range results {
+				if result.Index != i || result.Status != test.statuses[i] {
+					t.Errorf("result %d = %+v, want status %d", i, result, test.statuses[i])
+				}
+			}
+
+			for _, want := range test.devices {
+				got, err := store.GetDeviceByMac(want.MACAddress)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got.ID == 0 || got.Name != want.Name || got.Localization != want.Localization {
+					t.Errorf("device %s = %+v, want %+v", want.MACAddress, got, want)
+				}
+			}
+		})
+	}
+
+	for name, csv := range map[string]string{
+		"empty":          "",
+		"header only":    "macAddress,name\n",
+		"no mac address": "name\na\n",
+		"bad quoting":    "macAddress,name\n\"AA:BB:CC:DD:EE:10,a\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			rr := serve(newRouter(device.NewMemoryStore()), http.MethodPost, "/device/request/bulk/approve", "text/csv", strings.NewReader(csv))
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("status %d %s, want %d", rr.Code, rr.Body, http.StatusBadRequest)
+			}
+		})
+	}
+}
+
+// registerDevice requests and registers a device and returns its key.
+func registerDevice(t *testing.T, router http.Handler, macAddress string) *types.DeviceKey {
+	t.Helper()
+
+	if rr := serve(router, http.MethodPost, "/device/request", "application/json",
+		strings.NewReader(`{"macAddress": "`+macAddress+`"}`)); rr.Code != http.StatusCreated {
+		t.Fatalf("request %s: status %d %s", macAddress, rr.Code, rr.Body)
+	}
+
+	rr := serve(router, http.MethodPost, "/device", "application/json",
+		strings.NewReader(`{"macAddress": "`+macAddress+`", "name": "`+macAddress+` name", "localization": "B204"}`))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("register %s: status %d %s", macAddress, rr.Code, rr.Body)
+	}
+
+	key := new(types.DeviceKey)
+	if err := json.NewDecoder(rr.Body).Decode(key); err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+func newRouter(store types.DeviceStore) *mux.Router {
+	broker := events.NewBroker()
+	router := mux.NewRouter()
+	device.NewHandler(store, broker, device.NewMonitor(store, broker, time.Minute)).RegisterRoutes(router)
+
+	return router
+}
+
+// serve sends a request as a logged in user.
+func serve(handler http.Handler, method, path, contentType string, body io.Reader) *httptest.ResponseRecorder {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": 1,
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte(config.Envs.Secret))
+	if err != nil {
+		panic(err)
+	}
+
+	r := httptest.NewRequest(method, path, body)
+	r.Header.Set("Authorization", "Bearer "+token)
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, r)
+
+	return rr
+}
+
+// serveAsDevice sends a request authenticated with a device key.
+func serveAsDevice(handler http.Handler, method, path, key string, body io.Reader) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, body)
+	if key != "" {
+		r.Header.Set("Authorization", "Bearer "+key)
+	}
+	r.Header.Set("Content-Type", "application/json")
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, r)
+
+	return rr
+}
@@ -0,0 +1,48 @@
+package device
+
+import (
+	"air-controller-webservice/types"
+	"database/sql"
+	"time"
+)
+
+// SQLiteStore keeps devices in a SQLite database. The device key and the
+// heartbeat are upserted with ON CONFLICT instead of ON DUPLICATE KEY UPDATE,
+// and deleting a device archives the metrics of its readings with
+// json_group_object instead of JSON_OBJECTAGG.
+type SQLiteStore struct {
+	*Store
+}
+
+func NewSQLiteStore(db *sql.DB) *SQLiteStore {
+	return &SQLiteStore{Store: NewStore(db)}
+}
+
+const sqliteArchiveMetrics = "json_group_object(metric, value)"
+
+// The upserts are also understood by PostgreSQL.
+const (
+	upsertDeviceKey = "INSERT INTO device_keys(deviceId, keyHash) VALUES (?,?) ON CONFLICT(deviceId) DO UPDATE SET keyHash = excluded.keyHash, createdAt = CURRENT_TIMESTAMP"
+	upsertHeartbeat = `INSERT INTO device_heartbeats(deviceId, rssi, uptime, freeHeap, firmwareVersion, receivedAt)
+		VALUES (?,?,?,?,?,?) ON CONFLICT(deviceId) DO UPDATE SET rssi = excluded.rssi, uptime = excluded.uptime,
+		freeHeap = excluded.freeHeap, firmwareVersion = excluded.firmwareVersion, receivedAt = excluded.receivedAt`
+)
+
+func (s *SQLiteStore) SetDeviceKey(deviceId int, keyHash string) error {
+	if _, err := s.db.Exec(upsertDeviceKey, deviceId, keyHash); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *SQLiteStore) SaveHeartbeat(deviceId int, heartbeat types.DeviceHeartbeatPayload, at time.Time) error {
+	_, err := s.db.Exec(upsertHeartbeat,
+		deviceId, heartbeat.Rssi, heartbeat.Uptime, heartbeat.FreeHeap, heartbeat.FirmwareVersion, at.UTC())
+
+	return err
+}
+
+func (s *SQLiteStore) DeleteDevice(deviceId int, retention types.ReadingRetention) error {
+	return s.deleteDevice(deviceId, retention, sqliteArchiveMetrics)
+}
@@ -4,6 +4,8 @@ import (
 	"air-controller-webservice/types"
 	"database/sql"
 	"fmt"
+	"net/http"
+	"time"
 )
 
 type Store struct {
@@ -14,6 +16,20 @@ func NewStore(db *sql.DB) *Store {
 	return &Store{db: db}
 }
 
+// devices are always read together with their latest heartbeat. Deleted
+// devices whose readings were kept are left out by the queries.
+const (
+	deviceColumns = "devices.id, devices.macAddress, devices.name, devices.localization, devices.createdAt, " +
+		"devices.lastSeenAt, devices.online, device_heartbeats.rssi, device_heartbeats.uptime, " +
+		"device_heartbeats.freeHeap, device_heartbeats.firmwareVersion, device_heartbeats.receivedAt"
+	deviceTables = "devices LEFT JOIN device_heartbeats ON device_heartbeats.deviceId = devices.id"
+
+	requestColumns  = "id, macAddress, createdAt, active, decidedBy, decidedAt"
+	blockedColumns  = "id, macAddress, reason, blockedBy, createdAt"
+	decisionColumns = "device_decisions.id, device_decisions.macAddress, device_decisions.decision, " +
+		"device_decisions.reason, device_decisions.userId, users.username, device_decisions.createdAt"
+)
+
 func (s *Store) CreateDevice(device types.DevicePayload) error {
 	var count int
 	if err := s.db.QueryRow("SELECT Count(*) FROM requested_devices where macAddress = ? AND active = true", device.MACAddress).Scan(&count); err != nil {
@@ -40,7 +56,7 @@ func (s *Store) RequestDevice(requestDevice types.RequestDevicePayload) error {
 	return nil
 }
 func (s *Store) GetDevices() ([]*types.Device, error) {
-	rows, err := s.db.Query("SELECT * FROM devices")
+	rows, err := s.db.Query("SELECT " + deviceColumns + " FROM " + deviceTables + " where devices.deletedAt IS NULL")
 
 	if err != nil {
 		return nil, err
@@ -59,7 +75,15 @@ func (s *Store) GetDevices() ([]*types.Device, error) {
 }
 
 func (s *Store) GetDeviceById(deviceId int) (*types.Device, error) {
-	rows, err := s.db.Query("SELECT * FROM devices where id = ?", deviceId)
+	return s.getDeviceById(deviceId, " AND devices.deletedAt IS NULL")
+}
+
+func (s *Store) GetDeviceByIdIncludingDeleted(deviceId int) (*types.Device, error) {
+	return s.getDeviceById(deviceId, "")
+}
+
+func (s *Store) getDeviceById(deviceId int, condition string) (*types.Device, error) {
+	rows, err := s.db.Query("SELECT "+deviceColumns+" FROM "+deviceTables+" where devices.id = ?"+condition, deviceId)
 
 	if err != nil {
 		return nil, err
@@ -76,8 +100,9 @@ func (s *Store) GetDeviceById(deviceId int) (*types.Device, error) {
 	return device, nil
 }
 
+// GetDeviceByMac finds the device of a MAC address, matched ignoring case.
 func (s *Store) GetDeviceByMac(macAddress string) (*types.Device, error) {
-	rows, err := s.db.Query("SELECT * FROM devices where macAddress = ?", macAddress)
+	rows, err := s.db.Query("SELECT "+deviceColumns+" FROM "+deviceTables+" where UPPER(devices.macAddress) = UPPER(?) AND devices.deletedAt IS NULL", macAddress)
 
 	if err != nil {
 		return nil, err
@@ -95,7 +120,7 @@ func (s *Store) GetDeviceByMac(macAddress string) (*types.Device, error) {
 }
 
 func (s *Store) GetRequestedDevices() ([]*types.RequestDevice, error) {
-	rows, err := s.db.Query("SELECT * FROM requested_devices where active = true")
+	rows, err := s.db.Query("SELECT " + requestColumns + " FROM requested_devices where active = true")
 
 	if err != nil {
 		return nil, err
@@ -114,7 +139,7 @@ func (s *Store) GetRequestedDevices() ([]*types.RequestDevice, error) {
 }
 
 func (s *Store) GetRequestedDevicesByMac(macAddress string) (*types.RequestDevice, error) {
-	rows, err := s.db.Query("SELECT * FROM requested_devices where macAddress = ?", macAddress)
+	rows, err := s.db.Query("SELECT "+requestColumns+" FROM requested_devices where macAddress = ?", macAddress)
 
 	if err != nil {
 		return nil, err
@@ -147,6 +172,515 @@ func (s *Store) DeleteRequestDevice(macAddress string) error {
 	return nil
 }
 
+// SetDeviceKey stores the hash of the device API key, replacing the previous
+// key of the device.
+func (s *Store) SetDeviceKey(deviceId int, keyHash string) error {
+	if _, err := s.db.Exec("INSERT INTO device_keys(deviceId, keyHash) VALUES (?,?) ON DUPLICATE KEY UPDATE keyHash = VALUES(keyHash), createdAt = CURRENT_TIMESTAMP", deviceId, keyHash); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *Store) DeleteDeviceKey(deviceId int) error {
+	if _, err := s.db.Exec("DELETE FROM device_keys where deviceId = ?", deviceId); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *Store) GetDeviceByKeyHash(keyHash string) (*types.Device, error) {
+	rows, err := s.db.Query("SELECT "+deviceColumns+" FROM "+deviceTables+" JOIN device_keys ON device_keys.deviceId = devices.id where device_keys.keyHash = ? AND devices.deletedAt IS NULL", keyHash)
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	device := new(types.Device)
+	for rows.Next() {
+		device, err = ScanRowsIntoDevice(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return device, nil
+}
+
+// MarkDeviceSeen records that a device sent something at the given time and
+// reports whether it was offline until now.
+func (s *Store) MarkDeviceSeen(deviceId int, at time.Time) (bool, error) {
+	res, err := s.db.Exec("UPDATE devices SET online = true, lastSeenAt = ? WHERE id = ? AND online = false", at.UTC(), deviceId)
+	if err != nil {
+		return false, err
+	}
+
+	if changed, err := res.RowsAffected(); err != nil || changed == 1 {
+		return changed == 1, err
+	}
+
+	_, err = s.db.Exec("UPDATE devices SET lastSeenAt = ? WHERE id = ? AND lastSeenAt < ?", at.UTC(), deviceId, at.UTC())
+	return false, err
+}
+
+// MarkDevicesOffline marks the online devices that were not seen since
+// silentSince as offline and returns them. A device is only returned by the
+// instance that flipped it, so concurrent checkers announce it once.
+func (s *Store) MarkDevicesOffline(silentSince time.Time) ([]*types.Device, error) {
+	rows, err := s.db.Query("SELECT "+deviceColumns+" FROM "+deviceTables+" where devices.online = true AND devices.lastSeenAt < ?", silentSince.UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	var silent []*types.Device
+	for rows.Next() {
+		device, err := ScanRowsIntoDevice(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		silent = append(silent, device)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var offline []*types.Device
+	for _, device := range silent {
+		res, err := s.db.Exec("UPDATE devices SET online = false WHERE id = ? AND online = true AND lastSeenAt < ?", device.ID, silentSince.UTC())
+		if err != nil {
+			return nil, err
+		}
+		if changed, err := res.RowsAffected(); err != nil {
+			return nil, err
+		} else if changed == 1 {
+			device.Online = false
+			offline = append(offline, device)
+		}
+	}
+
+	return offline, nil
+}
+
+// SaveHeartbeat replaces the latest heartbeat of a device.
+func (s *Store) SaveHeartbeat(deviceId int, heartbeat types.DeviceHeartbeatPayload, at time.Time) error {
+	_, err := s.db.Exec(`INSERT INTO device_heartbeats(deviceId, rssi, uptime, freeHeap, firmwareVersion, receivedAt)
+		VALUES (?,?,?,?,?,?) ON DUPLICATE KEY UPDATE rssi = VALUES(rssi), uptime = VALUES(uptime),
+		freeHeap = VALUES(freeHeap), firmwareVersion = VALUES(firmwareVersion), receivedAt = VALUES(receivedAt)`,
+		deviceId, heartbeat.Rssi, heartbeat.Uptime, heartbeat.FreeHeap, heartbeat.FirmwareVersion, at.UTC())
+
+	return err
+}
+
+// UpdateDevice changes the name and localization of a device.
+func (s *Store) UpdateDevice(deviceId int, device types.DeviceUpdatePayload) error {
+	if _, err := s.db.Exec("UPDATE devices SET name = COALESCE(?, name), localization = COALESCE(?, localization) where id = ? AND deletedAt IS NULL",
+		device.Name, device.Localization, deviceId); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// archivedReadingColumns are copied from sensor_readings to
+// archived_sensor_readings, the named metrics are archived as a JSON object
+// built by archiveMetrics.
+const (
+	archiveMetrics         = "JSON_OBJECTAGG(metric, value)"
+	archivedReadingColumns = "id, deviceId, temperature, humidity, carbondioxide, airQualityIndex, staticIaq, " +
+		"iaqAccuracy, breathVocEquivalent, pressure, gasResistance, stabilizationStatus, createdAt, measuredAt, bootId, " +
+		"sequence, idempotencyKey"
+)
+
+// DeleteDevice removes a device and its key in one transaction. With
+// KeepReadings the device is only marked as deleted, so the foreign keys of
+// its readings stay valid and its MAC address can be registered again. Its
+// open alerts are resolved and its alert rules disabled, it sends nothing
+// anymore. Otherwise the readings are archived or deleted and everything derived from
+// them, rollups, rejected readings and alerts, is deleted as well.
+func (s *Store) DeleteDevice(deviceId int, retention types.ReadingRetention) error {
+	return s.deleteDevice(deviceId, retention, archiveMetrics)
+}
+
+func (s *Store) deleteDevice(deviceId int, retention types.ReadingRetention, metricsAggregate string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM device_keys where deviceId = ?", deviceId); err != nil {
+		return err
+	}
+
+	if retention == types.KeepReadings {
+		open := []any{deviceId, types.AlertPending, types.AlertFiring}
+		statements := []struct {
+			query string
+			args  []any
+		}{
+			{"INSERT INTO alert_transitions(alertId, ruleId, deviceId, state, value) " +
+				"SELECT id, ruleId, deviceId, ?, value FROM alerts where deviceId = ? AND state IN (?, ?)",
+				append([]any{types.AlertResolved}, open...)},
+			{"UPDATE alerts SET state = ?, resolvedAt = CURRENT_TIMESTAMP where deviceId = ? AND state IN (?, ?)",
+				append([]any{types.AlertResolved}, open...)},
+			{"UPDATE alert_rules SET enabled = false where deviceId = ?", []any{deviceId}},
+			{"UPDATE devices SET deletedAt = CURRENT_TIMESTAMP, online = false where id = ?", []any{deviceId}},
+		}
+		for _, statement := range statements {
+			if _, err := tx.Exec(statement.query, statement.args...); err != nil {
+				return err
+			}
+		}
+		return tx.Commit()
+	}
+
+	statements := []string{
+		"DELETE FROM sensor_reading_values where readingId IN (SELECT id FROM sensor_readings where deviceId = ?)",
+		"DELETE FROM sensor_readings where deviceId = ?",
+		"DELETE FROM sensor_reading_rollups where deviceId = ?",
+		"DELETE FROM rejected_readings where deviceId = ?",
+		"DELETE FROM alerts where deviceId = ?",
+		"DELETE FROM devices where id = ?",
+	}
+	if retention == types.ArchiveReadings {
+		statements = append([]string{
+			"INSERT INTO archived_devices(id, macAddress, name, localization, createdAt) " +
+				"SELECT id, macAddress, name, localization, createdAt FROM devices where id = ?",
+			"INSERT INTO archived_sensor_readings(" + archivedReadingColumns + ", metrics) SELECT " + archivedReadingColumns +
+				", (SELECT " + metricsAggregate + " FROM sensor_reading_values where readingId = sensor_readings.id) " +
+				"FROM sensor_readings where deviceId = ?",
+		}, statements...)
+	}
+
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement, deviceId); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *Store) GetDeclinedDevices() ([]*types.RequestDevice, error) {
+	rows, err := s.db.Query("SELECT " + requestColumns + " FROM requested_devices where active = false ORDER BY decidedAt DESC, id DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	declinedDevices := []*types.RequestDevice{}
+	for rows.Next() {
+		declinedDevice, err := ScanRowsIntoRequestedDevice(rows)
+		if err != nil {
+			return nil, err
+		}
+		declinedDevices = append(declinedDevices, declinedDevice)
+	}
+
+	return declinedDevices, rows.Err()
+}
+
+// DeclineRequestDevice declines the request of the MAC address, matched
+// ignoring case like the bulk operations.
+func (s *Store) DeclineRequestDevice(macAddress string, userId int) error {
+	if _, err := s.db.Exec("UPDATE requested_devices SET active = false, decidedBy = ?, decidedAt = CURRENT_TIMESTAMP where UPPER(macAddress) = UPPER(?)",
+		nullableUserId(userId), macAddress); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ReinstateRequestDevice turns a declined request back into a pending one.
+func (s *Store) ReinstateRequestDevice(macAddress string, userId int) error {
+	if _, err := s.db.Exec("UPDATE requested_devices SET active = true, decidedBy = ?, decidedAt = CURRENT_TIMESTAMP where macAddress = ? AND active = false",
+		nullableUserId(userId), macAddress); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *Store) GetBlockedDevices() ([]*types.BlockedDevice, error) {
+	rows, err := s.db.Query("SELECT " + blockedColumns + " FROM blocked_devices ORDER BY id DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	blockedDevices := []*types.BlockedDevice{}
+	for rows.Next() {
+		blockedDevice, err := scanRowIntoBlockedDevice(rows)
+		if err != nil {
+			return nil, err
+		}
+		blockedDevices = append(blockedDevices, blockedDevice)
+	}
+
+	return blockedDevices, rows.Err()
+}
+
+func (s *Store) GetBlockedDeviceByMac(macAddress string) (*types.BlockedDevice, error) {
+	blockedDevice, err := scanRowIntoBlockedDevice(s.db.QueryRow("SELECT "+blockedColumns+" FROM blocked_devices where UPPER(macAddress) = UPPER(?)", macAddress))
+	if err == sql.ErrNoRows {
+		return new(types.BlockedDevice), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return blockedDevice, nil
+}
+
+// BlockDevice blocks a MAC address and drops its pending or declined request.
+// Blocked addresses and requests are matched ignoring case.
+func (s *Store) BlockDevice(device types.BlockedDevicePayload, userId int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE from requested_devices where UPPER(macAddress) = UPPER(?)", device.MACAddress); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("INSERT INTO blocked_devices(macAddress, reason, blockedBy) VALUES (?,?,?)",
+		device.MACAddress, device.Reason, nullableUserId(userId)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *Store) UnblockDevice(macAddress string) error {
+	if _, err := s.db.Exec("DELETE from blocked_devices where UPPER(macAddress) = UPPER(?)", macAddress); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *Store) CreateDeviceDecision(decision types.DeviceDecisionPayload) error {
+	if _, err := s.db.Exec("INSERT INTO device_decisions(macAddress, decision, reason, userId) VALUES (?,?,?,?)",
+		decision.MACAddress, decision.Decision, decision.Reason, nullableUserId(decision.UserId)); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *Store) GetDeviceDecisions(query types.DeviceDecisionQuery) ([]*types.DeviceDecision, error) {
+	statement := "SELECT " + decisionColumns + " FROM device_decisions LEFT JOIN users ON users.id = device_decisions.userId"
+	args := []any{}
+	if query.MACAddress != "" {
+		statement += " where device_decisions.macAddress = ?"
+		args = append(args, query.MACAddress)
+	}
+	statement += " ORDER BY device_decisions.id DESC LIMIT ?"
+	args = append(args, query.Limit)
+
+	rows, err := s.db.Query(statement, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	decisions := []*types.DeviceDecision{}
+	for rows.Next() {
+		decision := new(types.DeviceDecision)
+		if err := rows.Scan(
+			&decision.ID,
+			&decision.MACAddress,
+			&decision.Decision,
+			&decision.Reason,
+			&decision.UserId,
+			&decision.Username,
+			&decision.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		decisions = append(decisions, decision)
+	}
+
+	return decisions, rows.Err()
+}
+
+// ApproveDevices registers the devices and their keys in one transaction and
+// reports the outcome of every approval in order. An approval whose request
+// is not pending or whose device already exists is skipped, as is one the
+// database refuses, the others are approved anyway. MAC addresses are
+// matched ignoring case, a device keeps the spelling of its request.
+func (s *Store) ApproveDevices(approvals []types.DeviceApproval, userId int) ([]types.DeviceBulkOutcome, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	outcomes := make([]types.DeviceBulkOutcome, len(approvals))
+	for i, approval := range approvals {
+		device := approval.Device
+		outcome := &outcomes[i]
+
+		var status int
+		if device.MACAddress, status, err = checkPendingRequest(tx, device.MACAddress); err != nil {
+			outcome.Status, outcome.Err = status, err
+			continue
+		}
+
+		var existing int
+		err := tx.QueryRow("SELECT id FROM devices where UPPER(macAddress) = UPPER(?) AND deletedAt IS NULL", device.MACAddress).Scan(&existing)
+		if err == nil {
+			outcome.Status, outcome.Err = http.StatusConflict, fmt.Errorf("device %s already exists", device.MACAddress)
+			continue
+		}
+		if err != sql.ErrNoRows {
+			return nil, err
+		}
+
+		outcome.Err, err = inSavepoint(tx, func() error {
+			if _, err := tx.Exec("DELETE from requested_devices where macAddress = ?", device.MACAddress); err != nil {
+				return err
+			}
+			if err := tx.QueryRow("INSERT INTO devices(macAddress, name, localization) VALUES (?,?,?) RETURNING id",
+				device.MACAddress, device.Name, device.Localization).Scan(&outcome.DeviceId); err != nil {
+				return err
+			}
+			if _, err := tx.Exec("INSERT INTO device_keys(deviceId, keyHash) VALUES (?,?)", outcome.DeviceId, approval.KeyHash); err != nil {
+				return err
+			}
+			_, err := tx.Exec("INSERT INTO device_decisions(macAddress, decision, userId) VALUES (?,?,?)",
+				device.MACAddress, types.DecisionApproved, nullableUserId(userId))
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		if outcome.Err != nil {
+			outcome.DeviceId = 0
+			outcome.Status = http.StatusInternalServerError
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return outcomes, nil
+}
+
+// DeclineRequestDevices declines the requests in one transaction and reports
+// the outcome of every request in order. Requests that are not pending are
+// skipped, the others are declined anyway. MAC addresses are matched ignoring
+// case.
+func (s *Store) DeclineRequestDevices(macAddresses []string, userId int) ([]types.DeviceBulkOutcome, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	outcomes := make([]types.DeviceBulkOutcome, len(macAddresses))
+	for i, macAddress := range macAddresses {
+		outcome := &outcomes[i]
+
+		var status int
+		if macAddress, status, err = checkPendingRequest(tx, macAddress); err != nil {
+			outcome.Status, outcome.Err = status, err
+			continue
+		}
+
+		outcome.Err, err = inSavepoint(tx, func() error {
+			if _, err := tx.Exec("UPDATE requested_devices SET active = false, decidedBy = ?, decidedAt = CURRENT_TIMESTAMP where macAddress = ?",
+				nullableUserId(userId), macAddress); err != nil {
+				return err
+			}
+			_, err := tx.Exec("INSERT INTO device_decisions(macAddress, decision, userId) VALUES (?,?,?)",
+				macAddress, types.DecisionDeclined, nullableUserId(userId))
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		if outcome.Err != nil {
+			outcome.Status = http.StatusInternalServerError
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return outcomes, nil
+}
+
+// checkPendingRequest makes sure a MAC address has a pending request and
+// returns the MAC address as the request spells it. It returns the status
+// code for the outcome if not.
+func checkPendingRequest(tx *sql.Tx, macAddress string) (string, int, error) {
+	var requested string
+	var active bool
+	err := tx.QueryRow("SELECT macAddress, active FROM requested_devices where UPPER(macAddress) = UPPER(?)", macAddress).Scan(&requested, &active)
+	if err == sql.ErrNoRows {
+		return "", http.StatusNotFound, fmt.Errorf("no request for %s", macAddress)
+	}
+	if err != nil {
+		return "", http.StatusInternalServerError, err
+	}
+	if !active {
+		return "", http.StatusConflict, fmt.Errorf("request for %s was declined", macAddress)
+	}
+
+	return requested, 0, nil
+}
+
+// inSavepoint runs the statements of one bulk item so that only they are
+// rolled back if one fails, the transaction goes on with the next item.
+// itemErr is why the item failed, err is set if the transaction is unusable.
+func inSavepoint(tx *sql.Tx, statements func() error) (itemErr error, err error) {
+	if _, err := tx.Exec("SAVEPOINT bulk_item"); err != nil {
+		return nil, err
+	}
+
+	if itemErr := statements(); itemErr != nil {
+		if _, err := tx.Exec("ROLLBACK TO SAVEPOINT bulk_item"); err != nil {
+			return nil, err
+		}
+		return itemErr, nil
+	}
+
+	_, err = tx.Exec("RELEASE SAVEPOINT bulk_item")
+	return nil, err
+}
+
+// nullableUserId stores decisions without a known user as NULL.
+func nullableUserId(userId int) *int {
+	if userId == 0 {
+		return nil
+	}
+	return &userId
+}
+
+func scanRowIntoBlockedDevice(rows interface{ Scan(dest ...any) error }) (*types.BlockedDevice, error) {
+	blockedDevice := new(types.BlockedDevice)
+
+	if err := rows.Scan(
+		&blockedDevice.ID,
+		&blockedDevice.MACAddress,
+		&blockedDevice.Reason,
+		&blockedDevice.BlockedBy,
+		&blockedDevice.CreatedAt,
+	); err != nil {
+		return nil, err
+	}
+
+	return blockedDevice, nil
+}
+
 func ScanRowsIntoRequestedDevice(rows *sql.Rows) (*types.RequestDevice, error) {
 	requestedDevice := new(types.RequestDevice)
 
@@ -155,6 +689,8 @@ func ScanRowsIntoRequestedDevice(rows *sql.Rows) (*types.RequestDevice, error) {
 		&requestedDevice.MACAddress,
 		&requestedDevice.CreatedAt,
 		&requestedDevice.Active,
+		&requestedDevice.DecidedBy,
+		&requestedDevice.DecidedAt,
 	); err != nil {
 		return nil, err
 	}
@@ -164,6 +700,9 @@ func ScanRowsIntoRequestedDevice(rows *sql.Rows) (*types.RequestDevice, error) {
 
 func ScanRowsIntoDevice(rows *sql.Rows) (*types.Device, error) {
 	device := new(types.Device)
+	heartbeat := new(types.DeviceHeartbeat)
+	var firmwareVersion sql.NullString
+	var receivedAt sql.NullTime
 
 	if err := rows.Scan(
 		&device.ID,
@@ -171,9 +710,22 @@ func ScanRowsIntoDevice(rows *sql.Rows) (*types.Device, error) {
 		&device.Name,
 		&device.Localization,
 		&device.CreatedAt,
+		&device.LastSeenAt,
+		&device.Online,
+		&heartbeat.Rssi,
+		&heartbeat.Uptime,
+		&heartbeat.FreeHeap,
+		&firmwareVersion,
+		&receivedAt,
 	); err != nil {
 		return nil, err
 	}
 
+	if receivedAt.Valid {
+		heartbeat.FirmwareVersion = firmwareVersion.String
+		heartbeat.ReceivedAt = receivedAt.Time
+		device.Heartbeat = heartbeat
+	}
+
 	return device, nil
 }
@@ -0,0 +1,145 @@
+package device_test
+
+import (
+	"air-controller-webservice/db"
+	"air-controller-webservice/services/alert"
+	"air-controller-webservice/services/device"
+	"air-controller-webservice/services/storetest"
+	"air-controller-webservice/types"
+	"database/sql"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestMemoryStore(t *testing.T) {
+	storetest.RunDeviceStore(t, func(t *testing.T) types.DeviceStore {
+		return device.NewMemoryStore()
+	})
+}
+
+func TestStore(t *testing.T) {
+	for _, backend := range storetest.Backends() {
+		t.Run(backend.Name, func(t *testing.T) {
+			storetest.RunDeviceStore(t, func(t *testing.T) types.DeviceStore {
+				return newStore(backend.Name, backend.Open(t))
+			})
+		})
+	}
+}
+
+// TestDeleteKeepingAlerts checks that a device deleted with its readings kept
+// leaves no alert open and no rule evaluated for it.
+func TestDeleteKeepingAlerts(t *testing.T) {
+	for _, backend := range storetest.Backends() {
+		t.Run(backend.Name, func(t *testing.T) {
+			database := backend.Open(t)
+			store := newStore(backend.Name, database)
+			alertStore := alert.NewStore(database)
+
+			if err := store.RequestDevice(types.RequestDevicePayload{MACAddress: "aa:00"}); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.CreateDevice(types.DevicePayload{MACAddress: "aa:00", Name: "a"}); err != nil {
+				t.Fatal(err)
+			}
+			d, err := store.GetDeviceByMac("aa:00")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ruleId, err := alertStore.CreateAlertRule(types.AlertRulePayload{
+				Name: "co2", DeviceId: &d.ID, Metric: "carbondioxide", Comparator: ">", Threshold: 1500,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			now := time.Now().UTC().Truncate(time.Second)
+			firing := &types.Alert{RuleId: ruleId, DeviceId: d.ID, State: types.AlertFiring, Value: 1600, StartedAt: now, FiredAt: &now}
+			if err := alertStore.CreateAlert(firing); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := store.DeleteDevice(d.ID, types.KeepReadings); err != nil {
+				t.Fatal(err)
+			}
+
+			alerts, err := alertStore.GetAlerts(types.AlertQuery{DeviceId: d.ID, Limit: 10})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(alerts) != 1 || alerts[0].State != types.AlertResolved || alerts[0].ResolvedAt == nil {
+				t.Errorf("alerts of the deleted device = %+v, want one resolved", alerts)
+			}
+
+			transitions, err := alertStore.GetAlertTransitions(types.AlertQuery{DeviceId: d.ID, Limit: 10})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(transitions) == 0 || transitions[0].State != types.AlertResolved {
+				t.Errorf("transitions of the deleted device = %+v, want the resolution first", transitions)
+			}
+
+			rule, err := alertStore.GetAlertRuleById(ruleId)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rule.Enabled {
+				t.Errorf("rule of the deleted device = %+v, want disabled", rule)
+			}
+		})
+	}
+}
+
+// TestApproveDevicesStoreError checks that an approval the database refuses
+// is rolled back alone.
+func TestApproveDevicesStoreError(t *testing.T) {
+	for _, backend := range storetest.Backends() {
+		t.Run(backend.Name, func(t *testing.T) {
+			store := newStore(backend.Name, backend.Open(t))
+
+			for _, macAddress := range []string{"aa:00", "bb:00"} {
+				if err := store.RequestDevice(types.RequestDevicePayload{MACAddress: macAddress}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// the key hash is unique
+			outcomes, err := store.ApproveDevices([]types.DeviceApproval{
+				{Device: types.DevicePayload{MACAddress: "aa:00", Name: "a"}, KeyHash: "hash"},
+				{Device: types.DevicePayload{MACAddress: "bb:00", Name: "b"}, KeyHash: "hash"},
+			}, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(outcomes) != 2 || outcomes[0].Err != nil || outcomes[1].Err == nil || outcomes[1].Status != http.StatusInternalServerError {
+				t.Fatalf("outcomes = %+v", outcomes)
+			}
+
+			if d, err := store.GetDeviceByMac("aa:00"); err != nil || d.ID != outcomes[0].DeviceId {
+				t.Errorf("GetDeviceByMac(aa:00) = %+v, %v, want device %d", d, err, outcomes[0].DeviceId)
+			}
+			if d, err := store.GetDeviceByMac("bb:00"); err != nil || d.ID != 0 {
+				t.Errorf("GetDeviceByMac(bb:00) = %+v, %v, want none", d, err)
+			}
+			request, err := store.GetRequestedDevicesByMac("bb:00")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if request.ID == 0 || !request.Active {
+				t.Errorf("request of the refused approval = %+v, want pending", request)
+			}
+		})
+	}
+}
+
+func newStore(backend string, database *sql.DB) types.DeviceStore {
+	switch backend {
+	case db.SQLite:
+		return device.NewSQLiteStore(database)
+	case db.Postgres:
+		return device.NewPostgresStore(database)
+	default:
+		return device.NewStore(database)
+	}
+}
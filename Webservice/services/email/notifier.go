@@ -0,0 +1,224 @@
+package email
+
+import (
+	"air-controller-webservice/config"
+	"air-controller-webservice/services/events"
+	"air-controller-webservice/types"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/smtp"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	queueSize    = 256
+	maxAttempts  = 3
+	firstBackoff = 10 * time.Second
+	dialTimeout  = 10 * time.Second
+)
+
+type message struct {
+	to      string
+	subject string
+	body    string
+}
+
+// Notifier emails the recipients subscribed to an event. Emails are sent one
+// after the other in the background, a failed email is retried a few times
+// and then dropped with a log line.
+type Notifier struct {
+	store       types.EmailRecipientStore
+	deviceStore types.DeviceStore
+	metricStore types.MetricStore
+	queue       chan message
+}
+
+func NewNotifier(store types.EmailRecipientStore, deviceStore types.DeviceStore, metricStore types.MetricStore) *Notifier {
+	return &Notifier{
+		store:       store,
+		deviceStore: deviceStore,
+		metricStore: metricStore,
+		queue:       make(chan message, queueSize),
+	}
+}
+
+// Enabled reports whether an SMTP server is configured.
+func (n *Notifier) Enabled() bool {
+	return config.Envs.SMTPHost != ""
+}
+
+// Start queues emails for the events published from now on. The recipients
+// and devices are looked up off the publish path.
+func (n *Notifier) Start(broker *events.Broker) {
+	broker.HandleAsync(func(event events.Event) bool {
+		return slices.Contains(emailEvents, event.Type)
+	}, func(event events.Event) {
+		if err := n.enqueue(event); err != nil {
+			log.Println("email: could not queue", event.Type, err)
+		}
+	})
+}
+
+// Run sends the queued emails until ctx is done.
+func (n *Notifier) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-n.queue:
+			n.deliver(ctx, msg)
+		}
+	}
+}
+
+func (n *Notifier) deliver(ctx context.Context, msg message) {
+	backoff := firstBackoff
+	for attempt := 1; ; attempt++ {
+		err := n.Send(msg.to, msg.subject, msg.body)
+		if err == nil {
+			return
+		}
+		if attempt == maxAttempts {
+			log.Printf("email: giving up on %q to %s: %v", msg.subject, msg.to, err)
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (n *Notifier) enqueue(event events.Event) error {
+	recipients, err := n.store.GetEmailRecipients()
+	if err != nil {
+		return err
+	}
+
+	var device *types.Device
+	var unit string
+	switch data := event.Data.(type) {
+	case *types.Device:
+		device = data
+	case *types.AlertEvent:
+		if device, err = n.deviceStore.GetDeviceById(data.Alert.DeviceId); err != nil {
+			return err
+		}
+		if metric, err := n.metricStore.GetMetricByName(data.Rule.Metric); err == nil {
+			unit = metric.Unit
+		}
+	}
+
+	for _, recipient := range recipients {
+		if !recipient.Enabled || !slices.Contains(recipient.Events, event.Type) {
+			continue
+		}
+		// the device filter does not apply to requested devices, they are
+		// not known yet
+		if recipient.DeviceId != nil && device != nil && *recipient.DeviceId != device.ID {
+			continue
+		}
+
+		subject, body, err := Render(recipient.Language, event, device, unit)
+		if err != nil {
+			return err
+		}
+
+		select {
+		case n.queue <- message{to: recipient.Email, subject: subject, body: body}:
+		default:
+			log.Println("email: queue full, dropping email to", recipient.Email)
+		}
+	}
+
+	return nil
+}
+
+// Send delivers one plain text email through the configured SMTP server.
+func (n *Notifier) Send(to, subject, body string) error {
+	if !n.Enabled() {
+		return fmt.Errorf("smtp is not configured")
+	}
+
+	host := config.Envs.SMTPHost
+	addr := net.JoinHostPort(host, config.Envs.SMTPPort)
+	tlsConfig := &tls.Config{ServerName: host}
+
+	var conn net.Conn
+	var err error
+	if config.Envs.SMTPTLS == "tls" {
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: dialTimeout}, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = net.DialTimeout("tcp", addr, dialTimeout)
+	}
+	if err != nil {
+		return err
+	}
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if config.Envs.SMTPTLS == "starttls" {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("%s does not support STARTTLS", host)
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+
+	if config.Envs.SMTPUsername != "" {
+		if err := client.Auth(smtp.PlainAuth("", config.Envs.SMTPUsername, config.Envs.SMTPPassword, host)); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(config.Envs.SMTPFrom); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to); err != nil {
+		return err
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(compose(to, subject, body)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+// compose builds the message with headers. Subjects may contain umlauts, so
+// they are Q-encoded.
+func compose(to, subject, body string) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", config.Envs.SMTPFrom)
+	fmt.Fprintf(&b, "To: %s\r\n", to)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+	return []byte(b.String())
+}
@@ -0,0 +1,229 @@
+package email
+
+import (
+	"air-controller-webservice/middleware"
+	"air-controller-webservice/services/events"
+	"air-controller-webservice/types"
+	"air-controller-webservice/utils"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type Handler struct {
+	store       types.EmailRecipientStore
+	deviceStore types.DeviceStore
+	notifier    *Notifier
+}
+
+func NewHandler(store types.EmailRecipientStore, deviceStore types.DeviceStore, notifier *Notifier) *Handler {
+	return &Handler{store: store, deviceStore: deviceStore, notifier: notifier}
+}
+
+// RegisterRoutes adds the email recipient endpoints, all of them require a
+// login.
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/notification/email", h.handleOptions).Methods("OPTIONS")
+	router.HandleFunc("/notification/email/{id:[0-9]+}", h.handleOptions).Methods("OPTIONS")
+	router.HandleFunc("/notification/email/{id:[0-9]+}/test", h.handleOptions).Methods("OPTIONS")
+
+	middlewareRouter := router.NewRoute().Subrouter()
+	middlewareRouter.HandleFunc("/notification/email", h.handleGet).Methods("GET")
+	middlewareRouter.HandleFunc("/notification/email", h.handlePost).Methods("POST")
+	middlewareRouter.HandleFunc("/notification/email/{id:[0-9]+}", h.handleGetById).Methods("GET")
+	middlewareRouter.HandleFunc("/notification/email/{id:[0-9]+}", h.handlePut).Methods("PUT")
+	middlewareRouter.HandleFunc("/notification/email/{id:[0-9]+}", h.handleDelete).Methods("DELETE")
+	middlewareRouter.HandleFunc("/notification/email/{id:[0-9]+}/test", h.handleTest).Methods("POST")
+	middlewareRouter.Use(middleware.RequireAuth())
+}
+
+func (h *Handler) handleGet(w http.ResponseWriter, r *http.Request) {
+	recipients, err := h.store.GetEmailRecipients()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, recipients)
+}
+
+func (h *Handler) handleGetById(w http.ResponseWriter, r *http.Request) {
+	recipient, ok := h.getRecipientFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, recipient)
+}
+
+func (h *Handler) handlePost(w http.ResponseWriter, r *http.Request) {
+	var payload types.EmailRecipientPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if status, err := h.validateRecipient(&payload); err != nil {
+		utils.WriteError(w, status, err)
+		return
+	}
+
+	id, err := h.store.CreateEmailRecipient(payload)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	recipient, err := h.store.GetEmailRecipientById(id)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, recipient)
+}
+
+func (h *Handler) handlePut(w http.ResponseWriter, r *http.Request) {
+	recipient, ok := h.getRecipientFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var payload types.EmailRecipientPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if status, err := h.validateRecipient(&payload); err != nil {
+		utils.WriteError(w, status, err)
+		return
+	}
+
+	if err := h.store.UpdateEmailRecipient(recipient.ID, payload); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	recipient, err := h.store.GetEmailRecipientById(recipient.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, recipient)
+}
+
+func (h *Handler) handleDelete(w http.ResponseWriter, r *http.Request) {
+	recipient, ok := h.getRecipientFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.store.DeleteEmailRecipient(recipient.ID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, nil)
+}
+
+// handleTest sends a test email to the recipient right away, so the SMTP
+// settings can be checked without waiting for an alert.
+func (h *Handler) handleTest(w http.ResponseWriter, r *http.Request) {
+	recipient, ok := h.getRecipientFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	if !h.notifier.Enabled() {
+		utils.WriteError(w, http.StatusServiceUnavailable, fmt.Errorf("email notifications are disabled, set SMTP_HOST"))
+		return
+	}
+
+	subject, body, err := Render(recipient.Language, events.Event{Type: TestEvent, Time: time.Now()}, nil, "")
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := h.notifier.Send(recipient.Email, subject, body); err != nil {
+		utils.WriteError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.Response{Message: "test email sent to " + recipient.Email})
+}
+
+func (h *Handler) handleOptions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, PUT, OPTIONS, GET, DELETE")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.WriteHeader(http.StatusOK)
+}
+
+// getRecipientFromPath loads the recipient of the {id} path variable and
+// writes the error response if there is none.
+func (h *Handler) getRecipientFromPath(w http.ResponseWriter, r *http.Request) (*types.EmailRecipient, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid recipient id"))
+		return nil, false
+	}
+
+	recipient, err := h.store.GetEmailRecipientById(id)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+
+	if recipient.ID == 0 {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("recipient %d not found", id))
+		return nil, false
+	}
+
+	return recipient, true
+}
+
+// validateRecipient checks a recipient, fills in the default language and
+// normalizes the address to its bare form.
+func (h *Handler) validateRecipient(recipient *types.EmailRecipientPayload) (int, error) {
+	address, err := mail.ParseAddress(recipient.Email)
+	if err != nil {
+		return http.StatusBadRequest, fmt.Errorf("email is not a valid address")
+	}
+	recipient.Email = address.Address
+
+	if recipient.Language == "" {
+		recipient.Language = "de"
+	}
+	if !slices.Contains(languages, recipient.Language) {
+		return http.StatusBadRequest, fmt.Errorf("language must be de or en")
+	}
+
+	if len(recipient.Events) == 0 {
+		return http.StatusBadRequest, fmt.Errorf("events must not be empty")
+	}
+	for _, event := range recipient.Events {
+		if !slices.Contains(emailEvents, event) {
+			return http.StatusBadRequest, fmt.Errorf("unknown event: %s", event)
+		}
+	}
+
+	if recipient.DeviceId != nil {
+		device, err := h.deviceStore.GetDeviceById(*recipient.DeviceId)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		if device.ID == 0 {
+			return http.StatusBadRequest, fmt.Errorf("device %d not found", *recipient.DeviceId)
+		}
+	}
+
+	return http.StatusOK, nil
+}
@@ -0,0 +1,93 @@
+package email
+
+import (
+	"air-controller-webservice/types"
+	"database/sql"
+	"strings"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+const recipientColumns = "id, email, language, events, deviceId, enabled, createdAt"
+
+func (s *Store) GetEmailRecipients() ([]*types.EmailRecipient, error) {
+	rows, err := s.db.Query("SELECT " + recipientColumns + " FROM email_recipients ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	recipients := []*types.EmailRecipient{}
+	for rows.Next() {
+		recipient, err := scanRowIntoRecipient(rows)
+		if err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, recipient)
+	}
+
+	return recipients, rows.Err()
+}
+
+func (s *Store) GetEmailRecipientById(id int) (*types.EmailRecipient, error) {
+	recipient, err := scanRowIntoRecipient(s.db.QueryRow("SELECT "+recipientColumns+" FROM email_recipients WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return new(types.EmailRecipient), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return recipient, nil
+}
+
+func (s *Store) CreateEmailRecipient(recipient types.EmailRecipientPayload) (int, error) {
+	var id int
+	err := s.db.QueryRow("INSERT INTO email_recipients(email, language, events, deviceId, enabled) VALUES (?,?,?,?,?) RETURNING id",
+		recipient.Email, recipient.Language, strings.Join(recipient.Events, ","), recipient.DeviceId,
+		recipient.Enabled == nil || *recipient.Enabled).Scan(&id)
+
+	return id, err
+}
+
+func (s *Store) UpdateEmailRecipient(id int, recipient types.EmailRecipientPayload) error {
+	_, err := s.db.Exec("UPDATE email_recipients SET email = ?, language = ?, events = ?, deviceId = ?, enabled = ? WHERE id = ?",
+		recipient.Email, recipient.Language, strings.Join(recipient.Events, ","), recipient.DeviceId,
+		recipient.Enabled == nil || *recipient.Enabled, id)
+
+	return err
+}
+
+func (s *Store) DeleteEmailRecipient(id int) error {
+	_, err := s.db.Exec("DELETE FROM email_recipients WHERE id = ?", id)
+	return err
+}
+
+func scanRowIntoRecipient(rows interface{ Scan(dest ...any) error }) (*types.EmailRecipient, error) {
+	recipient := new(types.EmailRecipient)
+	var events string
+
+	err := rows.Scan(
+		&recipient.ID,
+		&recipient.Email,
+		&recipient.Language,
+		&events,
+		&recipient.DeviceId,
+		&recipient.Enabled,
+		&recipient.CreatedAt,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	recipient.Events = strings.Split(events, ",")
+
+	return recipient, nil
+}
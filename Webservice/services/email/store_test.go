@@ -0,0 +1,28 @@
+package email_test
+
+import (
+	"air-controller-webservice/db"
+	"air-controller-webservice/services/device"
+	"air-controller-webservice/services/email"
+	"air-controller-webservice/services/storetest"
+	"air-controller-webservice/types"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	for _, backend := range storetest.Backends() {
+		t.Run(backend.Name, func(t *testing.T) {
+			storetest.RunEmailRecipientStore(t, func(t *testing.T) (types.EmailRecipientStore, types.DeviceStore) {
+				database := backend.Open(t)
+				switch backend.Name {
+				case db.SQLite:
+					return email.NewStore(database), device.NewSQLiteStore(database)
+				case db.Postgres:
+					return email.NewStore(database), device.NewPostgresStore(database)
+				default:
+					return email.NewStore(database), device.NewStore(database)
+				}
+			})
+		})
+	}
+}
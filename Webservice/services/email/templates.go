@@ -0,0 +1,180 @@
+package email
+
+import (
+	"air-controller-webservice/services/events"
+	"air-controller-webservice/types"
+	"bytes"
+	"fmt"
+	"text/template"
+	"time"
+)
+
+// TestEvent is sent by the test endpoint.
+const TestEvent = "email.test"
+
+// emailEvents are the events a recipient can subscribe to.
+var emailEvents = []string{
+	events.DeviceRequested,
+	events.DeviceOffline,
+	events.DeviceOnline,
+	events.AlertFiring,
+	events.AlertResolved,
+}
+
+var languages = []string{"de", "en"}
+
+type emailTemplate struct {
+	subject *template.Template
+	body    *template.Template
+}
+
+func newTemplate(subject, body string) emailTemplate {
+	return emailTemplate{
+		subject: template.Must(template.New("subject").Parse(subject)),
+		body:    template.Must(template.New("body").Parse(body)),
+	}
+}
+
+// templates by language and event
+var templates = map[string]map[string]emailTemplate{
+	"en": {
+		events.AlertFiring: newTemplate(
+			`[Air Controller] {{.Rule.Name}}: {{.DeviceName}}`,
+			`The alert "{{.Rule.Name}}" is firing for {{.DeviceName}}{{with .Localization}} in {{.}}{{end}}.
+
+{{.Rule.Metric}} is {{.Value}}{{.Unit}} (limit {{.Rule.Comparator}} {{.Threshold}}{{.Unit}}) since {{.Since}}.
+`),
+		events.AlertResolved: newTemplate(
+			`[Air Controller] Resolved: {{.Rule.Name}}: {{.DeviceName}}`,
+			`The alert "{{.Rule.Name}}" for {{.DeviceName}}{{with .Localization}} in {{.}}{{end}} is resolved.
+
+{{.Rule.Metric}} is back at {{.Value}}{{.Unit}} since {{.At}}.
+`),
+		events.DeviceRequested: newTemplate(
+			`[Air Controller] New device {{.MACAddress}}`,
+			`The device {{.MACAddress}} requested registration at {{.At}}.
+
+Approve or decline it in the dashboard.
+`),
+		events.DeviceOffline: newTemplate(
+			`[Air Controller] {{.DeviceName}} is offline`,
+			`The device {{.DeviceName}} ({{.MACAddress}}){{with .Localization}} in {{.}}{{end}} has not been heard from since {{.Since}}.
+
+Check its power supply and WiFi connection.
+`),
+		events.DeviceOnline: newTemplate(
+			`[Air Controller] {{.DeviceName}} is online again`,
+			`The device {{.DeviceName}} ({{.MACAddress}}){{with .Localization}} in {{.}}{{end}} is online again since {{.At}}.
+`),
+		TestEvent: newTemplate(
+			`[Air Controller] Test email`,
+			`This is a test email of the Air Controller webservice sent at {{.At}}.
+`),
+	},
+	"de": {
+		events.AlertFiring: newTemplate(
+			`[Air Controller] {{.Rule.Name}}: {{.DeviceName}}`,
+			`Der Alarm „{{.Rule.Name}}“ ist für {{.DeviceName}}{{with .Localization}} in {{.}}{{end}} ausgelöst.
+
+{{.Rule.Metric}} liegt seit {{.Since}} bei {{.Value}}{{.Unit}} (Grenzwert {{.Rule.Comparator}} {{.Threshold}}{{.Unit}}).
+`),
+		events.AlertResolved: newTemplate(
+			`[Air Controller] Behoben: {{.Rule.Name}}: {{.DeviceName}}`,
+			`Der Alarm „{{.Rule.Name}}“ für {{.DeviceName}}{{with .Localization}} in {{.}}{{end}} ist behoben.
+
+{{.Rule.Metric}} liegt seit {{.At}} wieder bei {{.Value}}{{.Unit}}.
+`),
+		events.DeviceRequested: newTemplate(
+			`[Air Controller] Neues Gerät {{.MACAddress}}`,
+			`Das Gerät {{.MACAddress}} hat sich am {{.At}} zur Registrierung angemeldet.
+
+Bitte im Dashboard freigeben oder ablehnen.
+`),
+		events.DeviceOffline: newTemplate(
+			`[Air Controller] {{.DeviceName}} ist offline`,
+			`Das Gerät {{.DeviceName}} ({{.MACAddress}}){{with .Localization}} in {{.}}{{end}} hat sich seit {{.Since}} nicht mehr gemeldet.
+
+Bitte Stromversorgung und WLAN-Verbindung prüfen.
+`),
+		events.DeviceOnline: newTemplate(
+			`[Air Controller] {{.DeviceName}} ist wieder online`,
+			`Das Gerät {{.DeviceName}} ({{.MACAddress}}){{with .Localization}} in {{.}}{{end}} ist seit {{.At}} wieder online.
+`),
+		TestEvent: newTemplate(
+			`[Air Controller] Test-E-Mail`,
+			`Dies ist eine Test-E-Mail des Air Controller Webservice, gesendet am {{.At}}.
+`),
+	},
+}
+
+var timeFormats = map[string]string{
+	"de": "02.01.2006 15:04",
+	"en": "2006-01-02 15:04",
+}
+
+// templateData is what the templates see. Times are formatted in the time
+// zone of the webservice (TZ).
+type templateData struct {
+	Rule         *types.AlertRule
+	DeviceName   string
+	Localization string
+	MACAddress   string
+	Value        string
+	Threshold    string
+	Unit         string
+	Since        string
+	At           string
+}
+
+// Render returns subject and body of the email for an event. device and unit
+// may be empty if they are unknown.
+func Render(language string, event events.Event, device *types.Device, unit string) (string, string, error) {
+	tmpl, ok := templates[language][event.Type]
+	if !ok {
+		return "", "", fmt.Errorf("no %s template for %s", language, event.Type)
+	}
+
+	format := func(t time.Time) string {
+		return t.Local().Format(timeFormats[language])
+	}
+
+	data := templateData{At: format(event.Time)}
+	if unit != "" {
+		data.Unit = " " + unit
+	}
+	if device != nil && device.ID != 0 {
+		data.DeviceName = device.Name
+		data.Localization = device.Localization
+		data.MACAddress = device.MACAddress
+	}
+
+	switch value := event.Data.(type) {
+	case *types.RequestDevice:
+		data.MACAddress = value.MACAddress
+	case *types.Device:
+		if value.LastSeenAt != nil {
+			data.Since = format(*value.LastSeenAt)
+		}
+	case *types.AlertEvent:
+		data.Rule = value.Rule
+		data.Value = fmt.Sprintf("%g", value.Alert.Value)
+		data.Threshold = fmt.Sprintf("%g", value.Rule.Threshold)
+		data.Since = format(value.Alert.StartedAt)
+		if value.Alert.ResolvedAt != nil {
+			data.At = format(*value.Alert.ResolvedAt)
+		}
+		if data.DeviceName == "" {
+			data.DeviceName = fmt.Sprintf("device %d", value.Alert.DeviceId)
+		}
+	}
+
+	var subject, body bytes.Buffer
+	if err := tmpl.subject.Execute(&subject, data); err != nil {
+		return "", "", err
+	}
+	if err := tmpl.body.Execute(&body, data); err != nil {
+		return "", "", err
+	}
+
+	return subject.String(), body.String(), nil
+}
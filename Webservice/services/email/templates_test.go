@@ -0,0 +1,141 @@
+package email_test
+
+import (
+	"air-controller-webservice/services/email"
+	"air-controller-webservice/services/events"
+	"air-controller-webservice/types"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRender(t *testing.T) {
+	startedAt := time.Date(2026, 3, 14, 9, 5, 0, 0, time.Local)
+	resolvedAt := startedAt.Add(90 * time.Minute)
+	device := &types.Device{ID: 7, Name: "Klassenzimmer", Localization: "B204", MACAddress: "AA:BB:CC:DD:EE:FF"}
+	rule := &types.AlertRule{Name: "CO2 high", Metric: "co2", Comparator: ">", Threshold: 1500}
+
+	firing := events.Event{
+		Type: events.AlertFiring,
+		Time: startedAt,
+		Data: &types.AlertEvent{Rule: rule, Alert: &types.Alert{DeviceId: 7, Value: 1620.5, StartedAt: startedAt}},
+	}
+	resolved := events.Event{
+		Type: events.AlertResolved,
+		Time: resolvedAt,
+		Data: &types.AlertEvent{Rule: rule, Alert: &types.Alert{DeviceId: 7, Value: 900, StartedAt: startedAt, ResolvedAt: &resolvedAt}},
+	}
+	offline := events.Event{
+		Type: events.DeviceOffline,
+		Time: resolvedAt,
+		Data: &types.Device{ID: 7, Name: "Klassenzimmer", MACAddress: "AA:BB:CC:DD:EE:FF", LastSeenAt: &startedAt},
+	}
+	requested := events.Event{
+		Type: events.DeviceRequested,
+		Time: startedAt,
+		Data: &types.RequestDevice{MACAddress: "11:22:33:44:55:66"},
+	}
+
+	tests := []struct {
+		name     string
+		language string
+		event    events.Event
+		device   *types.Device
+		unit     string
+		subject  string
+		body     []string
+	}{
+		{
+			name:     "firing en",
+			language: "en",
+			event:    firing,
+			device:   device,
+			unit:     "ppm",
+			subject:  "[Air Controller] CO2 high: Klassenzimmer",
+			body:     []string{`The alert "CO2 high" is firing for Klassenzimmer in B204.`, "co2 is 1620.5 ppm (limit > 1500 ppm) since 2026-03-14 09:05."},
+		},
+		{
+			name:     "firing de",
+			language: "de",
+			event:    firing,
+			device:   device,
+			unit:     "ppm",
+			subject:  "[Air Controller] CO2 high: Klassenzimmer",
+			body:     []string{"Der Alarm „CO2 high“ ist für Klassenzimmer in B204 ausgelöst.", "co2 liegt seit 14.03.2026 09:05 bei 1620.5 ppm (Grenzwert > 1500 ppm)."},
+		},
+		{
+			name:     "resolved en",
+			language: "en",
+			event:    resolved,
+			device:   device,
+			subject:  "[Air Controller] Resolved: CO2 high: Klassenzimmer",
+			body:     []string{"co2 is back at 900 since 2026-03-14 10:35."},
+		},
+		{
+			name:     "resolved de",
+			language: "de",
+			event:    resolved,
+			device:   device,
+			subject:  "[Air Controller] Behoben: CO2 high: Klassenzimmer",
+			body:     []string{"co2 liegt seit 14.03.2026 10:35 wieder bei 900."},
+		},
+		{
+			name:     "unknown device",
+			language: "en",
+			event:    firing,
+			subject:  "[Air Controller] CO2 high: device 7",
+			body:     []string{`The alert "CO2 high" is firing for device 7.`},
+		},
+		{
+			name:     "offline en",
+			language: "en",
+			event:    offline,
+			device:   offline.Data.(*types.Device),
+			subject:  "[Air Controller] Klassenzimmer is offline",
+			body:     []string{"The device Klassenzimmer (AA:BB:CC:DD:EE:FF) has not been heard from since 2026-03-14 09:05."},
+		},
+		{
+			name:     "offline de",
+			language: "de",
+			event:    offline,
+			device:   offline.Data.(*types.Device),
+			subject:  "[Air Controller] Klassenzimmer ist offline",
+			body:     []string{"Das Gerät Klassenzimmer (AA:BB:CC:DD:EE:FF) hat sich seit 14.03.2026 09:05 nicht mehr gemeldet."},
+		},
+		{
+			name:     "requested de",
+			language: "de",
+			event:    requested,
+			subject:  "[Air Controller] Neues Gerät 11:22:33:44:55:66",
+			body:     []string{"Das Gerät 11:22:33:44:55:66 hat sich am 14.03.2026 09:05 zur Registrierung angemeldet."},
+		},
+		{
+			name:     "test en",
+			language: "en",
+			event:    events.Event{Type: email.TestEvent, Time: startedAt},
+			subject:  "[Air Controller] Test email",
+			body:     []string{"sent at 2026-03-14 09:05."},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			subject, body, err := email.Render(test.language, test.event, test.device, test.unit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if subject != test.subject {
+				t.Errorf("subject = %q, want %q", subject, test.subject)
+			}
+			for _, want := range test.body {
+				if !strings.Contains(body, want) {
+					t.Errorf("body = %q, want it to contain %q", body, want)
+				}
+			}
+		})
+	}
+
+	if _, _, err := email.Render("fr", firing, device, ""); err == nil {
+		t.Error("Render in an unknown language succeeded")
+	}
+}
@@ -0,0 +1,157 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	ReadingCreated  = "reading.created"
+	DeviceRequested = "device.requested"
+	DeviceApproved  = "device.approved"
+	DeviceDeclined  = "device.declined"
+	DeviceOnline    = "device.online"
+	DeviceOffline   = "device.offline"
+	DeviceDeleted   = "device.deleted"
+	AlertPending    = "alert.pending"
+	AlertFiring     = "alert.firing"
+	AlertResolved   = "alert.resolved"
+)
+
+// subscriberBuffer is how many events a subscriber may fall behind before it
+// counts as slow and is dropped.
+const subscriberBuffer = 64
+
+// handlerQueue is how many events an asynchronous handler may fall behind
+// before Publish waits for it.
+const handlerQueue = 1024
+
+// Event is something that happened in the webservice. DeviceId is 0 for
+// events that do not belong to a device, Data is sent to clients as JSON.
+type Event struct {
+	Type     string    `json:"type"`
+	DeviceId int       `json:"deviceId,omitempty"`
+	Time     time.Time `json:"time"`
+	Data     any       `json:"data"`
+}
+
+// Broker fans events out to all subscribers in the process. Publishing never
+// blocks on subscribers: one whose buffer is full is unsubscribed and its
+// channel closed, so a slow client cannot hold up ingestion and has to
+// reconnect. Handlers are for subsystems that must see every event, they are
+// called synchronously by Publish or, registered with HandleAsync, queued.
+type Broker struct {
+	mu          sync.RWMutex
+	subscribers map[*Subscription]struct{}
+	handlers    []func(Event)
+}
+
+func NewBroker() *Broker {
+	return &Broker{subscribers: map[*Subscription]struct{}{}}
+}
+
+// Subscription receives the events matching its filter on Events until it is
+// unsubscribed.
+type Subscription struct {
+	events chan Event
+	mu     sync.RWMutex
+	filter func(Event) bool
+}
+
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// SetFilter replaces the filter of the subscription, nil receives all events.
+func (s *Subscription) SetFilter(filter func(Event) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.filter = filter
+}
+
+func (s *Subscription) matches(event Event) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.filter == nil || s.filter(event)
+}
+
+func (b *Broker) Subscribe(filter func(Event) bool) *Subscription {
+	subscription := &Subscription{events: make(chan Event, subscriberBuffer), filter: filter}
+
+	b.mu.Lock()
+	b.subscribers[subscription] = struct{}{}
+	b.mu.Unlock()
+
+	return subscription
+}
+
+// Unsubscribe closes the events channel of the subscription. It may be called
+// more than once.
+func (b *Broker) Unsubscribe(subscription *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subscribers[subscription]; ok {
+		delete(b.subscribers, subscription)
+		close(subscription.events)
+	}
+}
+
+// Handle registers a handler for all events. It runs in the goroutine of the
+// publisher, so it has to be quick and may be called concurrently.
+func (b *Broker) Handle(handler func(Event)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers = append(b.handlers, handler)
+}
+
+// HandleAsync registers a handler for the events matching filter, nil for all
+// events. It runs in a goroutine of its own and sees the events in the order
+// they were published. Publish waits while the handler is handlerQueue events
+// behind, so no event is lost. The handler must not publish events matching
+// its own filter, it would wait for itself.
+func (b *Broker) HandleAsync(filter func(Event) bool, handler func(Event)) {
+	queue := make(chan Event, handlerQueue)
+	go func() {
+		for event := range queue {
+			handler(event)
+		}
+	}()
+
+	b.Handle(func(event Event) {
+		if filter == nil || filter(event) {
+			queue <- event
+		}
+	})
+}
+
+func (b *Broker) Publish(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+
+	var slow []*Subscription
+
+	b.mu.RLock()
+	handlers := b.handlers
+	for subscription := range b.subscribers {
+		if !subscription.matches(event) {
+			continue
+		}
+
+		select {
+		case subscription.events <- event:
+		default:
+			slow = append(slow, subscription)
+		}
+	}
+	b.mu.RUnlock()
+
+	for _, subscription := range slow {
+		b.Unsubscribe(subscription)
+	}
+
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
@@ -0,0 +1,104 @@
+package events_test
+
+import (
+	"air-controller-webservice/services/events"
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestSubscribe(t *testing.T) {
+	broker := events.NewBroker()
+	all := broker.Subscribe(nil)
+	readings := broker.Subscribe(func(event events.Event) bool {
+		return event.Type == events.ReadingCreated && event.DeviceId == 1
+	})
+
+	broker.Publish(events.Event{Type: events.ReadingCreated, DeviceId: 2})
+	broker.Publish(events.Event{Type: events.DeviceOnline, DeviceId: 1})
+	broker.Publish(events.Event{Type: events.ReadingCreated, DeviceId: 1})
+
+	expectEvents(t, "all", all, "reading.created 2", "device.online 1", "reading.created 1")
+	expectEvents(t, "readings", readings, "reading.created 1")
+
+	readings.SetFilter(func(event events.Event) bool { return event.DeviceId == 2 })
+	broker.Publish(events.Event{Type: events.ReadingCreated, DeviceId: 1})
+	broker.Publish(events.Event{Type: events.ReadingCreated, DeviceId: 2})
+	expectEvents(t, "readings after SetFilter", readings, "reading.created 2")
+
+	broker.Unsubscribe(readings)
+	broker.Unsubscribe(readings)
+	broker.Publish(events.Event{Type: events.ReadingCreated, DeviceId: 2})
+	if _, ok := <-readings.Events(); ok {
+		t.Error("an unsubscribed subscription received an event")
+	}
+	expectEvents(t, "all", all, "reading.created 1", "reading.created 2", "reading.created 2")
+}
+
+func TestSlowSubscriber(t *testing.T) {
+	broker := events.NewBroker()
+	slow := broker.Subscribe(nil)
+	fast := broker.Subscribe(nil)
+
+	// the slow subscriber does not read while the fast one keeps up
+	const published = 1000
+	for deviceId := range published {
+		broker.Publish(events.Event{Type: events.ReadingCreated, DeviceId: deviceId})
+		if event := <-fast.Events(); event.DeviceId != deviceId {
+			t.Fatalf("fast subscriber received %+v, want device %d", event, deviceId)
+		}
+	}
+
+	received := 0
+	for range slow.Events() {
+		received++
+	}
+	if received == 0 || received >= published {
+		t.Errorf("slow subscriber received %d of %d events before it was dropped", received, published)
+	}
+
+	broker.Publish(events.Event{Type: events.DeviceOnline, DeviceId: 1})
+	expectEvents(t, "fast", fast, "device.online 1")
+}
+
+func TestHandleAsync(t *testing.T) {
+	broker := events.NewBroker()
+	handled := make(chan events.Event, 10)
+	broker.HandleAsync(func(event events.Event) bool {
+		return event.Type == events.ReadingCreated
+	}, func(event events.Event) {
+		handled <- event
+	})
+
+	for deviceId := range 3 {
+		broker.Publish(events.Event{Type: events.ReadingCreated, DeviceId: deviceId})
+		broker.Publish(events.Event{Type: events.DeviceOnline, DeviceId: deviceId})
+	}
+
+	for deviceId := range 3 {
+		event := <-handled
+		if event.Type != events.ReadingCreated || event.DeviceId != deviceId || event.Time.IsZero() {
+			t.Errorf("handled %+v, want the reading of device %d", event, deviceId)
+		}
+	}
+}
+
+// expectEvents checks the events waiting in the subscription, given as type
+// and device id.
+func expectEvents(t *testing.T, name string, subscription *events.Subscription, want ...string) {
+	t.Helper()
+
+	var got []string
+	for waiting := true; waiting; {
+		select {
+		case event := <-subscription.Events():
+			got = append(got, fmt.Sprintf("%s %d", event.Type, event.DeviceId))
+		default:
+			waiting = false
+		}
+	}
+
+	if !slices.Equal(got, want) {
+		t.Errorf("%s received %v, want %v", name, got, want)
+	}
+}
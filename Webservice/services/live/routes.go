@@ -0,0 +1,174 @@
+package live
+
+import (
+	"air-controller-webservice/services/events"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	writeWait      = 10 * time.Second
+	pongWait       = 60 * time.Second
+	pingInterval   = pongWait * 9 / 10
+	maxMessageSize = 4096
+)
+
+// the API is open to all origins, see enableCORS
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+type Handler struct {
+	events *events.Broker
+}
+
+func NewHandler(events *events.Broker) *Handler {
+	return &Handler{events: events}
+}
+
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/ws", h.handleWebSocket).Methods("GET")
+}
+
+// clientMessage is sent by clients to change the devices they receive
+// readings of, e.g. {"action": "subscribe", "deviceIds": [1, 2]}.
+type clientMessage struct {
+	Action    string `json:"action"`
+	DeviceIds []int  `json:"deviceIds"`
+}
+
+// serverMessage answers a clientMessage.
+type serverMessage struct {
+	Type      string `json:"type"`
+	DeviceIds []int  `json:"deviceIds,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// client is one WebSocket connection. It receives all device events and the
+// readings of the devices it subscribed to.
+type client struct {
+	mu      sync.Mutex
+	devices map[int]bool
+}
+
+func (c *client) matches(event events.Event) bool {
+	if strings.HasPrefix(event.Type, "device.") {
+		return true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.devices[event.DeviceId]
+}
+
+func (c *client) subscribed() []int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	deviceIds := make([]int, 0, len(c.devices))
+	for deviceId := range c.devices {
+		deviceIds = append(deviceIds, deviceId)
+	}
+	return deviceIds
+}
+
+func (c *client) handle(message clientMessage) serverMessage {
+	c.mu.Lock()
+	switch message.Action {
+	case "subscribe":
+		for _, deviceId := range message.DeviceIds {
+			c.devices[deviceId] = true
+		}
+	case "unsubscribe":
+		for _, deviceId := range message.DeviceIds {
+			delete(c.devices, deviceId)
+		}
+	default:
+		c.mu.Unlock()
+		return serverMessage{Type: "error", Error: "unknown action: " + message.Action}
+	}
+	c.mu.Unlock()
+
+	return serverMessage{Type: "subscribed", DeviceIds: c.subscribed()}
+}
+
+// handleWebSocket upgrades the connection and sends events until the client
+// goes away or falls behind. Only this goroutine writes to the connection, the
+// answers of the read loop are passed through replies.
+func (h *Handler) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	c := &client{devices: map[int]bool{}}
+	subscription := h.events.Subscribe(c.matches)
+	defer h.events.Unsubscribe(subscription)
+
+	replies := make(chan serverMessage, 8)
+	done := make(chan struct{})
+	go readMessages(conn, c, replies, done)
+
+	ping := time.NewTicker(pingInterval)
+	defer ping.Stop()
+
+	for {
+		var message any
+		select {
+		case <-done:
+			return
+		case event, ok := <-subscription.Events():
+			if !ok {
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too slow"), time.Now().Add(writeWait))
+				return
+			}
+			message = event
+		case reply := <-replies:
+			message = reply
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait)); err != nil {
+				return
+			}
+			continue
+		}
+
+		conn.SetWriteDeadline(time.Now().Add(writeWait))
+		if err := conn.WriteJSON(message); err != nil {
+			return
+		}
+	}
+}
+
+func readMessages(conn *websocket.Conn, c *client, replies chan<- serverMessage, done chan<- struct{}) {
+	defer close(done)
+
+	conn.SetReadLimit(maxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		var message clientMessage
+		if err := conn.ReadJSON(&message); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Println("websocket:", err)
+			}
+			return
+		}
+
+		select {
+		case replies <- c.handle(message):
+		default:
+			// the client sends faster than it reads, skip the answer
+		}
+	}
+}
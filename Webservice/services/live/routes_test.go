@@ -0,0 +1,81 @@
+package live_test
+
+import (
+	"air-controller-webservice/services/events"
+	"air-controller-webservice/services/live"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+// message holds the fields of the events and answers the server sends.
+type message struct {
+	Type      string `json:"type"`
+	DeviceId  int    `json:"deviceId"`
+	DeviceIds []int  `json:"deviceIds"`
+	Error     string `json:"error"`
+}
+
+func TestWebSocket(t *testing.T) {
+	broker := events.NewBroker()
+	router := mux.NewRouter()
+	live.NewHandler(broker).RegisterRoutes(router)
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	send := func(action string, deviceIds ...int) {
+		t.Helper()
+		if err := conn.WriteJSON(map[string]any{"action": action, "deviceIds": deviceIds}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	receive := func() message {
+		t.Helper()
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		var m message
+		if err := conn.ReadJSON(&m); err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+
+	send("subscribe", 1, 2)
+	if reply := receive(); reply.Type != "subscribed" || !slices.Equal(slices.Sorted(slices.Values(reply.DeviceIds)), []int{1, 2}) {
+		t.Fatalf("reply = %+v, want devices 1 and 2 subscribed", reply)
+	}
+	send("unsubscribe", 2)
+	if reply := receive(); reply.Type != "subscribed" || !slices.Equal(reply.DeviceIds, []int{1}) {
+		t.Fatalf("reply = %+v, want device 1 subscribed", reply)
+	}
+	send("replay")
+	if reply := receive(); reply.Type != "error" || reply.Error == "" {
+		t.Fatalf("reply = %+v, want an error", reply)
+	}
+
+	// the replies were sent after the subscription changed, so the events
+	// below are filtered by it
+	broker.Publish(events.Event{Type: events.ReadingCreated, DeviceId: 2})
+	broker.Publish(events.Event{Type: events.DeviceOnline, DeviceId: 3})
+	broker.Publish(events.Event{Type: events.ReadingCreated, DeviceId: 1})
+
+	for _, want := range []message{
+		{Type: events.DeviceOnline, DeviceId: 3},
+		{Type: events.ReadingCreated, DeviceId: 1},
+	} {
+		if got := receive(); got.Type != want.Type || got.DeviceId != want.DeviceId {
+			t.Errorf("received %+v, want %s of device %d", got, want.Type, want.DeviceId)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package metric
+
+import (
+	"air-controller-webservice/types"
+	"sync"
+	"time"
+)
+
+// cacheTTL bounds how long metrics created through another instance of the
+// webservice stay unknown to this one.
+const cacheTTL = time.Minute
+
+// CachedStore keeps the metric registry in memory, it is read for every
+// ingested reading and changes rarely. Creating a metric through the store
+// drops the cache. The returned metrics are shared and must not be modified.
+type CachedStore struct {
+	store types.MetricStore
+
+	mu       sync.Mutex
+	metrics  []*types.Metric
+	loadedAt time.Time
+}
+
+func NewCachedStore(store types.MetricStore) *CachedStore {
+	return &CachedStore{store: store}
+}
+
+func (s *CachedStore) GetMetrics() ([]*types.Metric, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.metrics == nil || time.Since(s.loadedAt) > cacheTTL {
+		metrics, err := s.store.GetMetrics()
+		if err != nil {
+			return nil, err
+		}
+		s.metrics = metrics
+		s.loadedAt = time.Now()
+	}
+
+	return append([]*types.Metric{}, s.metrics...), nil
+}
+
+func (s *CachedStore) GetMetricByName(name string) (*types.Metric, error) {
+	metrics, err := s.GetMetrics()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, metric := range metrics {
+		if metric.Name == name {
+			return metric, nil
+		}
+	}
+
+	return new(types.Metric), nil
+}
+
+func (s *CachedStore) CreateMetric(metric types.MetricPayload) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.metrics = nil
+	return s.store.CreateMetric(metric)
+}
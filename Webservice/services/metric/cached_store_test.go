@@ -0,0 +1,51 @@
+package metric_test
+
+import (
+	"air-controller-webservice/services/metric"
+	"air-controller-webservice/services/storetest"
+	"air-controller-webservice/types"
+	"testing"
+)
+
+func TestCachedStore(t *testing.T) {
+	store := metric.NewStore(storetest.OpenSQLite(t))
+	cached := metric.NewCachedStore(store)
+
+	expectMetric := func(name string, want bool) {
+		t.Helper()
+
+		found, err := cached.GetMetricByName(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (found.Name != "") != want {
+			t.Errorf("GetMetricByName(%q) = %+v, want found %v", name, found, want)
+		}
+	}
+
+	expectMetric("temperature", true)
+	expectMetric("radon", false)
+
+	if err := cached.CreateMetric(types.MetricPayload{Name: "radon", Unit: "Bq/m³"}); err != nil {
+		t.Fatal(err)
+	}
+	expectMetric("radon", true)
+
+	// created by another instance, the cache is still fresh
+	if err := store.CreateMetric(types.MetricPayload{Name: "ozone", Unit: "ppb"}); err != nil {
+		t.Fatal(err)
+	}
+	expectMetric("ozone", false)
+
+	metrics, err := cached.GetMetrics()
+	if err != nil {
+		t.Fatal(err)
+	}
+	all, err := store.GetMetrics()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(metrics) != len(all)-1 {
+		t.Errorf("GetMetrics returned %d metrics, want %d", len(metrics), len(all)-1)
+	}
+}
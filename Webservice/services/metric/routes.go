@@ -0,0 +1,110 @@
+package metric
+
+import (
+	"air-controller-webservice/middleware"
+	"air-controller-webservice/types"
+	"air-controller-webservice/utils"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/gorilla/mux"
+)
+
+const maxPrecision = 6
+
+// metric names are used as JSON keys next to the fixed reading fields, so they
+// follow the same camel case style
+var metricNamePattern = regexp.MustCompile(`^[a-z][a-zA-Z0-9]{0,63}$`)
+
+type Handler struct {
+	store types.MetricStore
+}
+
+func NewHandler(store types.MetricStore) *Handler {
+	return &Handler{store: store}
+}
+
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/metric", h.handleGet).Methods("GET")
+	router.HandleFunc("/metric", h.handleOptions).Methods("OPTIONS")
+
+	middlewareRouter := router.NewRoute().Subrouter()
+	middlewareRouter.HandleFunc("/metric", h.handlePost).Methods("POST")
+	middlewareRouter.Use(middleware.RequireAuth())
+}
+
+func (h *Handler) handleGet(w http.ResponseWriter, r *http.Request) {
+	metrics, err := h.store.GetMetrics()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, metrics)
+}
+
+// handlePost registers a new metric, so device models can start sending it.
+func (h *Handler) handlePost(w http.ResponseWriter, r *http.Request) {
+	var payload types.MetricPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := validateMetric(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	existing, err := h.store.GetMetricByName(payload.Name)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if existing.Name != "" {
+		utils.WriteError(w, http.StatusConflict, fmt.Errorf("metric %s already exists", payload.Name))
+		return
+	}
+
+	if err := h.store.CreateMetric(payload); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	metric, err := h.store.GetMetricByName(payload.Name)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, metric)
+}
+
+func (h *Handler) handleOptions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.WriteHeader(http.StatusOK)
+}
+
+func validateMetric(metric types.MetricPayload) error {
+	if !metricNamePattern.MatchString(metric.Name) {
+		return fmt.Errorf("name must start with a lower case letter and contain only letters and digits (max. 64 characters)")
+	}
+
+	if len(metric.Unit) > 16 {
+		return fmt.Errorf("unit must not be longer than 16 characters")
+	}
+
+	if metric.Min != nil && metric.Max != nil && *metric.Min > *metric.Max {
+		return fmt.Errorf("min must not be greater than max")
+	}
+
+	if metric.Precision < 0 || metric.Precision > maxPrecision {
+		return fmt.Errorf("precision must be between 0 and %d", maxPrecision)
+	}
+
+	return nil
+}
@@ -0,0 +1,74 @@
+package metric
+
+import (
+	"air-controller-webservice/types"
+	"database/sql"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+const metricColumns = "name, unit, minValue, maxValue, `precision`, builtin, createdAt"
+
+func (s *Store) GetMetrics() ([]*types.Metric, error) {
+	rows, err := s.db.Query("SELECT " + metricColumns + " FROM metrics ORDER BY builtin DESC, name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	metrics := []*types.Metric{}
+	for rows.Next() {
+		metric, err := scanRowIntoMetric(rows)
+		if err != nil {
+			return nil, err
+		}
+		metrics = append(metrics, metric)
+	}
+
+	return metrics, rows.Err()
+}
+
+func (s *Store) GetMetricByName(name string) (*types.Metric, error) {
+	metric, err := scanRowIntoMetric(s.db.QueryRow("SELECT "+metricColumns+" FROM metrics WHERE name = ?", name))
+	if err == sql.ErrNoRows {
+		return new(types.Metric), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return metric, nil
+}
+
+func (s *Store) CreateMetric(metric types.MetricPayload) error {
+	_, err := s.db.Exec("INSERT INTO metrics(name, unit, minValue, maxValue, `precision`) VALUES (?,?,?,?,?)",
+		metric.Name, metric.Unit, metric.Min, metric.Max, metric.Precision)
+
+	return err
+}
+
+func scanRowIntoMetric(rows interface{ Scan(dest ...any) error }) (*types.Metric, error) {
+	metric := new(types.Metric)
+
+	err := rows.Scan(
+		&metric.Name,
+		&metric.Unit,
+		&metric.Min,
+		&metric.Max,
+		&metric.Precision,
+		&metric.Builtin,
+		&metric.CreatedAt,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return metric, nil
+}
@@ -0,0 +1,18 @@
+package metric_test
+
+import (
+	"air-controller-webservice/services/metric"
+	"air-controller-webservice/services/storetest"
+	"air-controller-webservice/types"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	for _, backend := range storetest.Backends() {
+		t.Run(backend.Name, func(t *testing.T) {
+			storetest.RunMetricStore(t, func(t *testing.T) types.MetricStore {
+				return metric.NewStore(backend.Open(t))
+			})
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package mqtt
+
+import (
+	"air-controller-webservice/config"
+	"air-controller-webservice/services/auth"
+	sensorreading "air-controller-webservice/services/sensor-reading"
+	"air-controller-webservice/types"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	mochi "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/mochi-mqtt/server/v2/packets"
+)
+
+// Broker is an MQTT broker running inside the webservice, so a single
+// container deployment needs no external broker. Devices connect with their
+// mac address as username and their API key as password and publish to
+// <prefix>/<mac>/reading like with an external broker.
+type Broker struct {
+	server *mochi.Server
+}
+
+func NewBroker(ingester *sensorreading.Ingester, deviceStore types.DeviceStore) (*Broker, error) {
+	server := mochi.New(nil)
+
+	hook := &deviceHook{
+		ingester:    ingester,
+		deviceStore: deviceStore,
+		topicPrefix: config.Envs.MQTTTopicPrefix,
+	}
+	if err := server.AddHook(hook, nil); err != nil {
+		return nil, err
+	}
+
+	tcp := listeners.NewTCP(listeners.Config{ID: "tcp", Address: config.Envs.MQTTListenAddress})
+	if err := server.AddListener(tcp); err != nil {
+		return nil, err
+	}
+
+	return &Broker{server: server}, nil
+}
+
+// Start opens the listener, clients are served in the background.
+func (b *Broker) Start() error {
+	if err := b.server.Serve(); err != nil {
+		return err
+	}
+
+	log.Println("MQTT: embedded broker listening on", config.Envs.MQTTListenAddress)
+	return nil
+}
+
+func (b *Broker) Stop() error {
+	return b.server.Close()
+}
+
+// deviceHook authenticates clients against the device registry, restricts
+// them to the topics of their own mac address and ingests their readings.
+type deviceHook struct {
+	mochi.HookBase
+	ingester    *sensorreading.Ingester
+	deviceStore types.DeviceStore
+	topicPrefix string
+
+	// keyHashes maps client ids to the hash of the key they logged in with.
+	// It is checked again on every publish, so a revoked key stops working
+	// without waiting for the client to reconnect.
+	keyHashes sync.Map
+}
+
+func (h *deviceHook) ID() string {
+	return "air-controller-devices"
+}
+
+func (h *deviceHook) Provides(b byte) bool {
+	return bytes.Contains([]byte{
+		mochi.OnConnectAuthenticate,
+		mochi.OnACLCheck,
+		mochi.OnDisconnect,
+		mochi.OnPublish,
+	}, []byte{b})
+}
+
+func (h *deviceHook) OnConnectAuthenticate(cl *mochi.Client, pk packets.Packet) bool {
+	keyHash := auth.HashDeviceKey(string(pk.Connect.Password))
+
+	device, err := h.deviceStore.GetDeviceByKeyHash(keyHash)
+	if err != nil {
+		log.Println("MQTT:", err)
+		return false
+	}
+
+	if device.ID == 0 || !strings.EqualFold(device.MACAddress, string(pk.Connect.Username)) {
+		return false
+	}
+
+	h.keyHashes.Store(cl.ID, keyHash)
+	return true
+}
+
+// OnACLCheck lets a device publish readings for itself and subscribe below
+// its own <prefix>/<mac>/ branch.
+func (h *deviceHook) OnACLCheck(cl *mochi.Client, topic string, write bool) bool {
+	mac := string(cl.Properties.Username)
+
+	if write {
+		topicMac, ok := MacFromTopic(h.topicPrefix, topic)
+		return ok && strings.EqualFold(topicMac, mac)
+	}
+
+	return strings.HasPrefix(strings.ToUpper(topic), strings.ToUpper(h.topicPrefix+"/"+mac+"/"))
+}
+
+func (h *deviceHook) OnDisconnect(cl *mochi.Client, err error, expire bool) {
+	h.keyHashes.Delete(cl.ID)
+}
+
+// OnPublish acknowledges readings that were stored or can never be stored,
+// the latter are dropped. Readings that failed on a server error are not
+// acknowledged, so the device sends them again.
+func (h *deviceHook) OnPublish(cl *mochi.Client, pk packets.Packet) (packets.Packet, error) {
+	receivedAt := time.Now()
+
+	keyHash, ok := h.keyHashes.Load(cl.ID)
+	if !ok {
+		return pk, packets.CodeSuccessIgnore
+	}
+
+	device, err := h.deviceStore.GetDeviceByKeyHash(keyHash.(string))
+	if err != nil {
+		log.Println("MQTT:", err)
+		return pk, packets.ErrRejectPacket
+	}
+	if device.ID == 0 {
+		log.Printf("MQTT: rejected reading of %s: device key is no longer valid", cl.ID)
+		return pk, packets.CodeSuccessIgnore
+	}
+
+	var message readingMessage
+	if err := json.Unmarshal(pk.Payload, &message); err != nil {
+		log.Printf("MQTT: rejected reading on %s: %v", pk.TopicName, err)
+		return pk, packets.CodeSuccessIgnore
+	}
+
+	if _, err := h.ingester.Ingest(device, message.SensorReadingPayload, receivedAt, message.DeviceUptime); err != nil {
+		log.Printf("MQTT: rejected reading on %s: %v", pk.TopicName, err)
+
+		var rejected *sensorreading.RejectedError
+		if errors.As(err, &rejected) {
+			return pk, packets.CodeSuccessIgnore
+		}
+		return pk, packets.ErrRejectPacket
+	}
+
+	return pk, nil
+}
@@ -0,0 +1,126 @@
+package mqtt
+
+import (
+	"air-controller-webservice/config"
+	sensorreading "air-controller-webservice/services/sensor-reading"
+	"air-controller-webservice/types"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+)
+
+// readingMessage is what devices publish to <prefix>/<mac>/reading,
+// DeviceUptime plays the role of the X-Device-Uptime header. It carries no
+// credentials, the broker authenticates the devices.
+type readingMessage struct {
+	DeviceUptime *int64 `json:"deviceUptime,omitempty"`
+	types.SensorReadingPayload
+}
+
+// Listener subscribes to the reading topics of an external broker and feeds
+// the readings into the same Ingester as POST /sensorreading. The broker has
+// to authenticate every device and let it publish to the topic of its own mac
+// address only, see mosquitto/acl.
+type Listener struct {
+	client      paho.Client
+	ingester    *sensorreading.Ingester
+	deviceStore types.DeviceStore
+	topicPrefix string
+}
+
+func NewListener(ingester *sensorreading.Ingester, deviceStore types.DeviceStore) *Listener {
+	l := &Listener{
+		ingester:    ingester,
+		deviceStore: deviceStore,
+		topicPrefix: config.Envs.MQTTTopicPrefix,
+	}
+
+	opts := paho.NewClientOptions().
+		AddBroker(config.Envs.MQTTBroker).
+		SetClientID(config.Envs.MQTTClientID).
+		SetUsername(config.Envs.MQTTUsername).
+		SetPassword(config.Envs.MQTTPassword).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetOnConnectHandler(l.subscribe)
+	l.client = paho.NewClient(opts)
+
+	return l
+}
+
+// Start connects to the broker. Connection failures are retried in the
+// background, so the API keeps running while the broker is unreachable.
+func (l *Listener) Start() {
+	l.client.Connect()
+	log.Println("MQTT: connecting to", config.Envs.MQTTBroker)
+}
+
+func (l *Listener) Stop() {
+	l.client.Disconnect(250)
+}
+
+// subscribe runs on every (re)connect, the broker forgets subscriptions of
+// clean sessions.
+func (l *Listener) subscribe(client paho.Client) {
+	topic := l.topicPrefix + "/+/reading"
+	token := client.Subscribe(topic, 1, l.handleMessage)
+	token.Wait()
+	if err := token.Error(); err != nil {
+		log.Println("MQTT: subscribe failed:", err)
+		return
+	}
+
+	log.Println("MQTT: subscribed to", topic)
+}
+
+func (l *Listener) handleMessage(_ paho.Client, msg paho.Message) {
+	receivedAt := time.Now()
+	if err := l.Ingest(msg.Topic(), msg.Payload(), receivedAt); err != nil {
+		log.Printf("MQTT: rejected reading on %s: %v", msg.Topic(), err)
+	}
+}
+
+// Ingest stores a reading published on topic by the device of the mac address
+// in the topic.
+func (l *Listener) Ingest(topic string, payload []byte, receivedAt time.Time) error {
+	mac, ok := MacFromTopic(l.topicPrefix, topic)
+	if !ok {
+		return fmt.Errorf("unexpected topic")
+	}
+
+	var message readingMessage
+	if err := json.Unmarshal(payload, &message); err != nil {
+		return err
+	}
+
+	device, err := l.deviceStore.GetDeviceByMac(mac)
+	if err != nil {
+		return err
+	}
+
+	if device.ID == 0 {
+		return fmt.Errorf("unknown device %s", mac)
+	}
+
+	_, err = l.ingester.Ingest(device, message.SensorReadingPayload, receivedAt, message.DeviceUptime)
+	return err
+}
+
+// MacFromTopic extracts the mac address of <prefix>/<mac>/reading.
+func MacFromTopic(prefix string, topic string) (string, bool) {
+	rest, ok := strings.CutPrefix(topic, prefix+"/")
+	if !ok {
+		return "", false
+	}
+
+	mac, ok := strings.CutSuffix(rest, "/reading")
+	if !ok || mac == "" || strings.Contains(mac, "/") {
+		return "", false
+	}
+
+	return mac, true
+}
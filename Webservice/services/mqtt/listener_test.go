@@ -0,0 +1,73 @@
+package mqtt_test
+
+import (
+	"air-controller-webservice/services/device"
+	"air-controller-webservice/services/events"
+	"air-controller-webservice/services/metric"
+	"air-controller-webservice/services/mqtt"
+	sensorreading "air-controller-webservice/services/sensor-reading"
+	"air-controller-webservice/services/storetest"
+	"air-controller-webservice/types"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestListenerIngest(t *testing.T) {
+	devices := device.NewMemoryStore()
+	readings := sensorreading.NewMemoryStore()
+	broker := events.NewBroker()
+	ingester := sensorreading.NewIngester(readings, metric.NewStore(storetest.OpenSQLite(t)),
+		device.NewMonitor(devices, broker, time.Minute), broker)
+	listener := mqtt.NewListener(ingester, devices)
+
+	if err := devices.RequestDevice(types.RequestDevicePayload{MACAddress: "AA:BB:CC:DD:EE:01"}); err != nil {
+		t.Fatal(err)
+	}
+	outcomes, err := devices.ApproveDevices([]types.DeviceApproval{{
+		Device:  types.DevicePayload{MACAddress: "AA:BB:CC:DD:EE:01", Name: "kitchen sensor", Localization: "kitchen"},
+		KeyHash: "hash",
+	}}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	receivedAt := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	reading := `{"temperature": 21.5, "airQualityIndex": 50, "humidity": 40, "carbondioxide": 600`
+	for _, message := range []struct {
+		name    string
+		topic   string
+		payload string
+		stored  bool
+	}{
+		{"reading", "aircontroller/AA:BB:CC:DD:EE:01/reading", reading + `, "uptime": 60000, "deviceUptime": 90000}`, true},
+		{"unknown device", "aircontroller/AA:BB:CC:DD:EE:02/reading", reading + `}`, false},
+		{"other topic", "aircontroller/AA:BB:CC:DD:EE:01/heartbeat", reading + `}`, false},
+		{"other prefix", "other/AA:BB:CC:DD:EE:01/reading", reading + `}`, false},
+		{"reading of another device", "aircontroller/AA:BB:CC:DD:EE:01/reading",
+			reading + `, "deviceMacAddress": "AA:BB:CC:DD:EE:02"}`, false},
+		{"invalid json", "aircontroller/AA:BB:CC:DD:EE:01/reading", reading, false},
+	} {
+		err := listener.Ingest(message.topic, []byte(message.payload), receivedAt)
+		if message.stored && err != nil {
+			t.Errorf("%s: %v", message.name, err)
+		}
+		if !message.stored && err == nil {
+			t.Errorf("%s was stored", message.name)
+		}
+	}
+
+	page, err := readings.GetSensorReadingsByDevice(strconv.Itoa(outcomes[0].DeviceId), types.SensorReadingQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Readings) != 1 {
+		t.Fatalf("stored %d readings, want 1", len(page.Readings))
+	}
+
+	// measured 30s before it was sent by the device uptimes
+	stored := page.Readings[0]
+	if stored.Temperature != 21.5 || stored.Carbondioxide != 600 || !stored.MeasuredAt.Equal(receivedAt.Add(-30*time.Second)) {
+		t.Errorf("stored reading = %+v", stored)
+	}
+}
@@ -0,0 +1,60 @@
+package rollup
+
+import (
+	"database/sql"
+)
+
+// PostgresStore keeps the rollups in a PostgreSQL database without
+// TimescaleDB. It folds the readings like Store, including the row lock on the
+// watermark, but merges buckets with ON CONFLICT instead of ON DUPLICATE KEY
+// UPDATE. With TimescaleDB, TimescaleStore relies on continuous aggregates
+// instead and folds nothing itself.
+type PostgresStore struct {
+	*Store
+}
+
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{Store: NewStore(db)}
+}
+
+func (s *PostgresStore) ProcessPendingReadings(batchSize int) (int, error) {
+	return s.processPendingReadings(batchSize, lockWatermark, upsertOnConflict("LEAST", "GREATEST"))
+}
+
+// HasContinuousAggregates reports whether migration 0002 replaced the rollup
+// table with continuous aggregates, which it does if the server has
+// TimescaleDB loaded.
+func HasContinuousAggregates(db *sql.DB) (bool, error) {
+	var exists bool
+	err := db.QueryRow("SELECT to_regclass('sensor_reading_rollups_hourly') IS NOT NULL").Scan(&exists)
+	return exists, err
+}
+
+// TimescaleStore reads the rollups from the continuous aggregates that
+// migration 0002 creates when TimescaleDB is installed, they are kept up to
+// date by TimescaleDB itself.
+type TimescaleStore struct {
+	*Store
+}
+
+func NewTimescaleStore(db *sql.DB) *TimescaleStore {
+	return &TimescaleStore{Store: NewStore(db)}
+}
+
+// ProcessPendingReadings has nothing to do, the refresh policies of the
+// continuous aggregates materialize new readings.
+func (s *TimescaleStore) ProcessPendingReadings(batchSize int) (int, error) {
+	return 0, nil
+}
+
+// ResetRollups materializes both continuous aggregates again from all
+// readings.
+func (s *TimescaleStore) ResetRollups() error {
+	for _, view := range []string{"sensor_reading_rollups_hourly", "sensor_reading_rollups_daily"} {
+		if _, err := s.db.Exec("CALL refresh_continuous_aggregate('" + view + "', NULL, NULL)"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
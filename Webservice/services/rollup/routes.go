@@ -0,0 +1,58 @@
+package rollup
+
+import (
+	"air-controller-webservice/types"
+	"air-controller-webservice/utils"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+type Handler struct {
+	store types.RollupStore
+}
+
+func NewHandler(store types.RollupStore) *Handler {
+	return &Handler{store: store}
+}
+
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/sensorreading/device/{deviceId}/rollup", h.handleGetByDeviceId).Methods("GET")
+	router.HandleFunc("/sensorreading/device/{deviceId}/rollup", h.handleOptions).Methods("OPTIONS")
+}
+
+func (h *Handler) handleGetByDeviceId(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	deviceId := vars["deviceId"]
+
+	resolution := types.RollupResolution(r.URL.Query().Get("resolution"))
+	if resolution == "" {
+		resolution = types.RollupHourly
+	}
+	if resolution != types.RollupHourly && resolution != types.RollupDaily {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("resolution must be %s or %s", types.RollupHourly, types.RollupDaily))
+		return
+	}
+
+	from, to, err := utils.ParseTimeRange(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	rollups, err := h.store.GetRollups(deviceId, types.RollupQuery{Resolution: resolution, From: from, To: to})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, rollups)
+}
+
+func (h *Handler) handleOptions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "OPTIONS, GET")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,68 @@
+package rollup
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// SQLiteStore keeps the rollups in a SQLite database. It merges buckets with
+// ON CONFLICT instead of ON DUPLICATE KEY UPDATE and uses the scalar MIN and
+// MAX for LEAST and GREATEST, which SQLite lacks. SELECT ... FOR UPDATE does
+// not exist either, so the watermark is read without a row lock.
+type SQLiteStore struct {
+	*Store
+}
+
+func NewSQLiteStore(db *sql.DB) *SQLiteStore {
+	return &SQLiteStore{Store: NewStore(db)}
+}
+
+// SQLite has no row locks. Its transactions take the write lock of the whole
+// database when they begin, see db.NewSQLiteStorage.
+const sqliteLockWatermark = "SELECT lastReadingId FROM sensor_reading_rollup_state WHERE id = 1"
+
+func (s *SQLiteStore) ProcessPendingReadings(batchSize int) (int, error) {
+	return s.processPendingReadings(batchSize, sqliteLockWatermark, upsertOnConflict("MIN", "MAX"))
+}
+
+func (s *SQLiteStore) ResetRollups() error {
+	return s.resetRollups(sqliteLockWatermark)
+}
+
+// upsertOnConflict merges a partial bucket into the stored one with
+// ON CONFLICT DO UPDATE, which SQLite and PostgreSQL both understand. Unlike
+// MariaDB, they evaluate all assignments against the stored row. least and
+// greatest name the scalar minimum and maximum functions of the database.
+func upsertOnConflict(least, greatest string) func(tx *sql.Tx, b *bucket) error {
+	return func(tx *sql.Tx, b *bucket) error {
+		columns := []string{"deviceId", "resolution", "bucketStart", "count"}
+		args := []any{b.deviceId, b.resolution, b.start, b.count}
+		updates := []string{
+			"lastAt = " + greatest + "(sensor_reading_rollups.lastAt, excluded.lastAt)",
+			"count = sensor_reading_rollups.count + excluded.count",
+		}
+
+		for i, metric := range metrics {
+			columns = append(columns, metric+"Count", metric+"Sum", metric+"Min", metric+"Max", metric+"Last")
+			args = append(args, b.stats[i].count, b.stats[i].sum, b.stats[i].min, b.stats[i].max, b.stats[i].last)
+
+			updates = append(updates,
+				fmt.Sprintf("%[1]sCount = sensor_reading_rollups.%[1]sCount + excluded.%[1]sCount", metric),
+				fmt.Sprintf("%[1]sSum = sensor_reading_rollups.%[1]sSum + excluded.%[1]sSum", metric),
+				metric+"Min = "+mergeMin(least, "sensor_reading_rollups."+metric+"Min", "excluded."+metric+"Min"),
+				metric+"Max = "+mergeMin(greatest, "sensor_reading_rollups."+metric+"Max", "excluded."+metric+"Max"),
+				fmt.Sprintf("%[1]sLast = CASE WHEN excluded.lastAt >= sensor_reading_rollups.lastAt "+
+					"THEN excluded.%[1]sLast ELSE sensor_reading_rollups.%[1]sLast END", metric),
+			)
+		}
+		columns = append(columns, "lastAt")
+		args = append(args, b.lastAt.UTC())
+
+		_, err := tx.Exec("INSERT INTO sensor_reading_rollups ("+strings.Join(columns, ", ")+") VALUES (?"+
+			strings.Repeat(", ?", len(columns)-1)+") ON CONFLICT(deviceId, resolution, bucketStart) DO UPDATE SET "+
+			strings.Join(updates, ", "), args...)
+
+		return err
+	}
+}
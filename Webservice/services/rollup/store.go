@@ -0,0 +1,309 @@
+package rollup
+
+import (
+	"air-controller-webservice/types"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// metrics are the sensor_readings columns summarized per bucket. For each of
+// them the rollup table holds <metric>Count, <metric>Sum, <metric>Min,
+// <metric>Max and <metric>Last. Readings without a value for a metric are
+// left out of its count, sum, minimum and maximum.
+var metrics = []string{"temperature", "airQualityIndex", "humidity", "carbondioxide"}
+
+var resolutions = []types.RollupResolution{types.RollupHourly, types.RollupDaily}
+
+// settleDelay keeps the job away from the newest readings, so a reading whose
+// insert commits after one with a higher id is not skipped by the watermark.
+const settleDelay = 10 * time.Second
+
+// lockWatermark reads the watermark and locks its row until the transaction
+// ends.
+const lockWatermark = "SELECT lastReadingId FROM sensor_reading_rollup_state WHERE id = 1 FOR UPDATE"
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+type metricStats struct {
+	count          int
+	sum            float64
+	min, max, last *float64
+}
+
+type bucket struct {
+	deviceId   int
+	resolution types.RollupResolution
+	start      time.Time
+	count      int
+	stats      [4]metricStats
+	lastAt     time.Time
+}
+
+type reading struct {
+	id         int
+	deviceId   int
+	values     [4]*float64
+	at         time.Time
+	receivedAt time.Time
+}
+
+// ProcessPendingReadings folds up to batchSize readings that were inserted
+// since the last run into the hourly and daily rollups and returns how many
+// readings it consumed. The watermark row is locked for the whole run, so
+// concurrent instances do not count a reading twice.
+func (s *Store) ProcessPendingReadings(batchSize int) (int, error) {
+	return s.processPendingReadings(batchSize, lockWatermark, upsertBucket)
+}
+
+func (s *Store) processPendingReadings(batchSize int, lockWatermark string, upsertBucket func(tx *sql.Tx, b *bucket) error) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var lastReadingId int
+	if err := tx.QueryRow(lockWatermark).Scan(&lastReadingId); err != nil {
+		return 0, err
+	}
+
+	readings, err := pendingReadings(tx, lastReadingId, batchSize)
+	if err != nil {
+		return 0, err
+	}
+	if len(readings) == 0 {
+		return 0, nil
+	}
+
+	for _, b := range collectBuckets(readings) {
+		if err := upsertBucket(tx, b); err != nil {
+			return 0, err
+		}
+	}
+
+	if _, err := tx.Exec("UPDATE sensor_reading_rollup_state SET lastReadingId = ? WHERE id = 1", readings[len(readings)-1].id); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return len(readings), nil
+}
+
+func (s *Store) ResetRollups() error {
+	return s.resetRollups(lockWatermark)
+}
+
+func (s *Store) resetRollups(lockWatermark string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var lastReadingId int
+	if err := tx.QueryRow(lockWatermark).Scan(&lastReadingId); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM sensor_reading_rollups"); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE sensor_reading_rollup_state SET lastReadingId = 0 WHERE id = 1"); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *Store) GetRollups(deviceId string, query types.RollupQuery) ([]*types.SensorReadingRollup, error) {
+	columns := []string{"deviceId", "resolution", "bucketStart", "count"}
+	for _, metric := range metrics {
+		columns = append(columns, metric+"Count", metric+"Sum", metric+"Min", metric+"Max", metric+"Last")
+	}
+	columns = append(columns, "lastAt")
+
+	conditions := []string{"deviceId = ?", "resolution = ?"}
+	args := []any{deviceId, query.Resolution}
+	if !query.From.IsZero() {
+		conditions = append(conditions, "bucketStart >= ?")
+		args = append(args, query.From.UTC())
+	}
+	if !query.To.IsZero() {
+		conditions = append(conditions, "bucketStart < ?")
+		args = append(args, query.To.UTC())
+	}
+
+	rows, err := s.db.Query("SELECT "+strings.Join(columns, ", ")+" FROM sensor_reading_rollups WHERE "+
+		strings.Join(conditions, " AND ")+" ORDER BY bucketStart", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rollups := []*types.SensorReadingRollup{}
+	for rows.Next() {
+		rollup, err := scanRowIntoRollup(rows)
+		if err != nil {
+			return nil, err
+		}
+		rollups = append(rollups, rollup)
+	}
+
+	return rollups, rows.Err()
+}
+
+func pendingReadings(tx *sql.Tx, lastReadingId int, batchSize int) ([]reading, error) {
+	rows, err := tx.Query(`SELECT id, deviceId, temperature, airQualityIndex, humidity, carbondioxide, measuredAt, createdAt
+		FROM sensor_readings WHERE id > ? ORDER BY id LIMIT ?`, lastReadingId, batchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cutoff := time.Now().Add(-settleDelay)
+	var readings []reading
+	for rows.Next() {
+		var r reading
+		if err := rows.Scan(&r.id, &r.deviceId, &r.values[0], &r.values[1], &r.values[2], &r.values[3], &r.at, &r.receivedAt); err != nil {
+			return nil, err
+		}
+		if r.receivedAt.After(cutoff) {
+			break
+		}
+		readings = append(readings, r)
+	}
+
+	return readings, rows.Err()
+}
+
+func collectBuckets(readings []reading) []*bucket {
+	var buckets []*bucket
+	index := map[string]*bucket{}
+
+	for _, r := range readings {
+		for _, resolution := range resolutions {
+			start := bucketStart(r.at, resolution)
+			key := fmt.Sprintf("%d/%s/%d", r.deviceId, resolution, start.Unix())
+
+			b, ok := index[key]
+			if !ok {
+				b = &bucket{deviceId: r.deviceId, resolution: resolution, start: start}
+				index[key] = b
+				buckets = append(buckets, b)
+			}
+
+			b.count++
+			for i, value := range r.values {
+				stats := &b.stats[i]
+				if !r.at.Before(b.lastAt) {
+					stats.last = value
+				}
+				if value == nil {
+					continue
+				}
+				stats.count++
+				stats.sum += *value
+				if stats.min == nil || *value < *stats.min {
+					stats.min = value
+				}
+				if stats.max == nil || *value > *stats.max {
+					stats.max = value
+				}
+			}
+			if !r.at.Before(b.lastAt) {
+				b.lastAt = r.at
+			}
+		}
+	}
+
+	return buckets
+}
+
+func bucketStart(t time.Time, resolution types.RollupResolution) time.Time {
+	t = t.UTC()
+	if resolution == types.RollupDaily {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	return t.Truncate(time.Hour)
+}
+
+// upsertBucket merges a partial bucket into the stored one. The Last columns
+// are assigned before lastAt, because MariaDB evaluates the assignments of
+// ON DUPLICATE KEY UPDATE from left to right. The minimum and maximum of a
+// side without values are NULL and must not win, see mergeMin.
+func upsertBucket(tx *sql.Tx, b *bucket) error {
+	columns := []string{"deviceId", "resolution", "bucketStart", "count"}
+	args := []any{b.deviceId, b.resolution, b.start, b.count}
+	var lastUpdates, statUpdates []string
+
+	for i, metric := range metrics {
+		columns = append(columns, metric+"Count", metric+"Sum", metric+"Min", metric+"Max", metric+"Last")
+		args = append(args, b.stats[i].count, b.stats[i].sum, b.stats[i].min, b.stats[i].max, b.stats[i].last)
+
+		lastUpdates = append(lastUpdates, fmt.Sprintf("%[1]sLast = IF(VALUES(lastAt) >= lastAt, VALUES(%[1]sLast), %[1]sLast)", metric))
+		statUpdates = append(statUpdates,
+			fmt.Sprintf("%[1]sCount = %[1]sCount + VALUES(%[1]sCount)", metric),
+			fmt.Sprintf("%[1]sSum = %[1]sSum + VALUES(%[1]sSum)", metric),
+			metric+"Min = "+mergeMin("LEAST", metric+"Min", "VALUES("+metric+"Min)"),
+			metric+"Max = "+mergeMin("GREATEST", metric+"Max", "VALUES("+metric+"Max)"),
+		)
+	}
+	columns = append(columns, "lastAt")
+	args = append(args, b.lastAt.UTC())
+
+	updates := append(lastUpdates, "lastAt = GREATEST(lastAt, VALUES(lastAt))", "count = count + VALUES(count)")
+	updates = append(updates, statUpdates...)
+
+	_, err := tx.Exec("INSERT INTO sensor_reading_rollups ("+strings.Join(columns, ", ")+") VALUES (?"+
+		strings.Repeat(", ?", len(columns)-1)+") ON DUPLICATE KEY UPDATE "+strings.Join(updates, ", "), args...)
+
+	return err
+}
+
+// mergeMin combines two nullable minimums, or maximums with the greatest
+// function, so that NULL only results if both are NULL. LEAST and GREATEST of
+// MariaDB and the scalar MIN and MAX of SQLite return NULL as soon as one
+// argument is NULL.
+func mergeMin(least, stored, excluded string) string {
+	return fmt.Sprintf("%[1]s(COALESCE(%[2]s, %[3]s), COALESCE(%[3]s, %[2]s))", least, stored, excluded)
+}
+
+func scanRowIntoRollup(rows *sql.Rows) (*types.SensorReadingRollup, error) {
+	rollup := new(types.SensorReadingRollup)
+	var sums [4]float64
+	stats := []*types.RollupStats{
+		&rollup.Temperature,
+		&rollup.AirQualityIndex,
+		&rollup.Humidity,
+		&rollup.Carbondioxide,
+	}
+
+	dest := []any{&rollup.DeviceId, &rollup.Resolution, &rollup.BucketStart, &rollup.Count}
+	for i, s := range stats {
+		dest = append(dest, &s.Count, &sums[i], &s.Min, &s.Max, &s.Last)
+	}
+	dest = append(dest, &rollup.LastAt)
+
+	if err := rows.Scan(dest...); err != nil {
+		return nil, err
+	}
+
+	for i, s := range stats {
+		if s.Count > 0 {
+			avg := sums[i] / float64(s.Count)
+			s.Avg = &avg
+		}
+	}
+
+	return rollup, nil
+}
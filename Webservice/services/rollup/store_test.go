@@ -0,0 +1,108 @@
+package rollup_test
+
+import (
+	"air-controller-webservice/db"
+	"air-controller-webservice/services/rollup"
+	"air-controller-webservice/services/storetest"
+	"air-controller-webservice/types"
+	"database/sql"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestMissingValues(t *testing.T) {
+	for _, backend := range storetest.Backends() {
+		t.Run(backend.Name, func(t *testing.T) {
+			database := backend.Open(t)
+			store := newStore(t, backend.Name, database)
+
+			var deviceId int
+			if err := database.QueryRow("INSERT INTO devices(macAddress, name, localization) VALUES (?,?,?) RETURNING id",
+				"aa:00", "a", "kitchen").Scan(&deviceId); err != nil {
+				t.Fatal(err)
+			}
+
+			// the last reading is measured before the second one, so merging
+			// it must keep the last values of the second
+			t0 := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+			for _, r := range []struct {
+				at                                          time.Time
+				temperature, humidity, carbondioxide, index any
+			}{
+				{t0, 20, nil, 800, 50},
+				{t0.Add(10 * time.Minute), nil, nil, 900, 100},
+				{t0.Add(5 * time.Minute), 22, 40, nil, nil},
+			} {
+				if _, err := database.Exec("INSERT INTO sensor_readings(deviceId, temperature, humidity, carbondioxide, "+
+					"airQualityIndex, measuredAt, createdAt) VALUES (?,?,?,?,?,?,?)",
+					deviceId, r.temperature, r.humidity, r.carbondioxide, r.index, r.at, t0); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// one reading per run, so every bucket is merged twice
+			for range 3 {
+				if _, err := store.ProcessPendingReadings(1); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			rollups, err := store.GetRollups(strconv.Itoa(deviceId), types.RollupQuery{Resolution: types.RollupHourly})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rollups) != 1 || rollups[0].Count != 3 || !rollups[0].LastAt.Equal(t0.Add(10*time.Minute)) {
+				t.Fatalf("GetRollups = %+v", rollups)
+			}
+
+			for _, check := range []struct {
+				metric string
+				stats  types.RollupStats
+				want   types.RollupStats
+			}{
+				{"temperature", rollups[0].Temperature, types.RollupStats{Count: 2, Min: value(20), Max: value(22), Avg: value(21)}},
+				{"humidity", rollups[0].Humidity, types.RollupStats{Count: 1, Min: value(40), Max: value(40), Avg: value(40)}},
+				{"carbondioxide", rollups[0].Carbondioxide, types.RollupStats{Count: 2, Min: value(800), Max: value(900), Avg: value(850), Last: value(900)}},
+				{"airQualityIndex", rollups[0].AirQualityIndex, types.RollupStats{Count: 2, Min: value(50), Max: value(100), Avg: value(75), Last: value(100)}},
+			} {
+				if format(check.stats) != format(check.want) {
+					t.Errorf("%s = %s, want %s", check.metric, format(check.stats), format(check.want))
+				}
+			}
+		})
+	}
+}
+
+func newStore(t *testing.T, backend string, database *sql.DB) types.RollupStore {
+	switch backend {
+	case db.SQLite:
+		return rollup.NewSQLiteStore(database)
+	case db.Postgres:
+		if continuous, err := rollup.HasContinuousAggregates(database); err != nil {
+			t.Fatal(err)
+		} else if continuous {
+			t.Skip("TimescaleDB computes the rollups")
+		}
+		return rollup.NewPostgresStore(database)
+	default:
+		return rollup.NewStore(database)
+	}
+}
+
+func value(v float64) *float64 {
+	return &v
+}
+
+func format(stats types.RollupStats) string {
+	formatted := "count " + strconv.Itoa(stats.Count)
+	for i, v := range []*float64{stats.Min, stats.Max, stats.Avg, stats.Last} {
+		formatted += []string{", min ", ", max ", ", avg ", ", last "}[i]
+		if v == nil {
+			formatted += "nil"
+		} else {
+			formatted += strconv.FormatFloat(*v, 'g', -1, 64)
+		}
+	}
+	return formatted
+}
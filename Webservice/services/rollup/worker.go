@@ -0,0 +1,60 @@
+package rollup
+
+import (
+	"air-controller-webservice/types"
+	"context"
+	"log"
+	"time"
+)
+
+const batchSize = 5000
+
+// Worker keeps the rollups up to date by periodically folding newly inserted
+// sensor readings into them.
+type Worker struct {
+	store    types.RollupStore
+	interval time.Duration
+}
+
+func NewWorker(store types.RollupStore, interval time.Duration) *Worker {
+	return &Worker{store: store, interval: interval}
+}
+
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := w.CatchUp(); err != nil {
+			log.Println("rollup:", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CatchUp processes pending readings until none are left and returns how many
+// it processed.
+func (w *Worker) CatchUp() (int, error) {
+	total := 0
+	for {
+		n, err := w.store.ProcessPendingReadings(batchSize)
+		total += n
+		if err != nil || n < batchSize {
+			return total, err
+		}
+	}
+}
+
+// Backfill rebuilds all rollups from the raw sensor readings.
+func (w *Worker) Backfill() (int, error) {
+	if err := w.store.ResetRollups(); err != nil {
+		return 0, err
+	}
+
+	return w.CatchUp()
+}
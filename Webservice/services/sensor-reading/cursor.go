@@ -0,0 +1,41 @@
+package sensorreading
+
+import (
+	"air-controller-webservice/types"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cursors are opaque to clients: base64("<measuredAt unix nanos>:<id>")
+
+func encodeCursor(cursor *types.SensorReadingCursor) string {
+	raw := fmt.Sprintf("%d:%d", cursor.MeasuredAt.UnixNano(), cursor.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(value string) (*types.SensorReadingCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	parts := strings.Split(string(raw), ":")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	nanos, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	id, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	return &types.SensorReadingCursor{MeasuredAt: time.Unix(0, nanos).UTC(), ID: id}, nil
+}
@@ -0,0 +1,219 @@
+package sensorreading
+
+import (
+	"air-controller-webservice/services/device"
+	"air-controller-webservice/services/events"
+	"air-controller-webservice/types"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxKeyLength is the length of the boot ID and idempotency key columns.
+const maxKeyLength = 64
+
+// RejectedError is returned for readings that are not stored because of their
+// content. Status is the matching HTTP status code, Fields lists the invalid
+// values if the reading failed validation.
+type RejectedError struct {
+	Status int
+	Err    error
+	Fields []types.FieldError
+}
+
+func (e *RejectedError) Error() string {
+	if len(e.Fields) == 0 {
+		return e.Err.Error()
+	}
+
+	messages := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		messages[i] = field.Field + " " + field.Message
+	}
+
+	return e.Err.Error() + ": " + strings.Join(messages, ", ")
+}
+
+func (e *RejectedError) Unwrap() error {
+	return e.Err
+}
+
+// Ingester checks and stores the readings of an authenticated device. It is
+// shared by the HTTP handlers and the MQTT listeners, so readings are treated
+// the same no matter how they arrive. Every newly stored reading is published
+// as events.ReadingCreated and marks the device as seen. Rejected payloads,
+// replays and failed inserts do not.
+type Ingester struct {
+	store       types.SensorReadingStore
+	metricStore types.MetricStore
+	monitor     *device.Monitor
+	events      *events.Broker
+}
+
+func NewIngester(store types.SensorReadingStore, metricStore types.MetricStore, monitor *device.Monitor, events *events.Broker) *Ingester {
+	return &Ingester{store: store, metricStore: metricStore, monitor: monitor, events: events}
+}
+
+// Ingest stores a single reading. deviceUptime is the device uptime in
+// milliseconds when it sent the reading, nil if unknown.
+func (i *Ingester) Ingest(device *types.Device, payload types.SensorReadingPayload, receivedAt time.Time, deviceUptime *int64) (*types.SensorReadingInsertResult, error) {
+	registry, err := i.loadRegistry()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := i.prepare(device, &payload, registry, receivedAt, deviceUptime); err != nil {
+		i.recordRejected(device, payload, err)
+		return nil, err
+	}
+
+	result, err := i.store.CreateSensorReading(payload, device.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	i.stored(device, receivedAt, result)
+
+	return result, nil
+}
+
+// IngestBatch stores all acceptable readings in one transaction and reports
+// the outcome per reading. An error is only returned if nothing was stored.
+func (i *Ingester) IngestBatch(device *types.Device, payloads []types.SensorReadingPayload, receivedAt time.Time, deviceUptime *int64) ([]types.SensorReadingBatchResult, error) {
+	results := make([]types.SensorReadingBatchResult, len(payloads))
+	items := make([]types.SensorReadingBatchItem, 0, len(payloads))
+	itemIndexes := make([]int, 0, len(payloads))
+
+	registry, err := i.loadRegistry()
+	if err != nil {
+		return nil, err
+	}
+
+	for index, payload := range payloads {
+		results[index] = types.SensorReadingBatchResult{Index: index, Status: http.StatusCreated}
+
+		if err := i.prepare(device, &payload, registry, receivedAt, deviceUptime); err != nil {
+			i.recordRejected(device, payload, err)
+			results[index].Status = err.Status
+			results[index].Error = err.Err.Error()
+			results[index].Fields = err.Fields
+			continue
+		}
+
+		items = append(items, types.SensorReadingBatchItem{DeviceId: device.ID, Payload: payload})
+		itemIndexes = append(itemIndexes, index)
+	}
+
+	if len(items) == 0 {
+		return results, nil
+	}
+
+	inserted, err := i.store.CreateSensorReadings(items)
+	if err != nil {
+		return nil, err
+	}
+
+	for index, result := range inserted {
+		results[itemIndexes[index]].ID = result.Reading.ID
+		results[itemIndexes[index]].Replayed = result.Replayed
+		i.stored(device, receivedAt, result)
+	}
+
+	return results, nil
+}
+
+func (i *Ingester) prepare(device *types.Device, payload *types.SensorReadingPayload, registry map[string]*types.Metric, receivedAt time.Time, deviceUptime *int64) *RejectedError {
+	if err := checkDeviceMac(payload, device); err != nil {
+		return &RejectedError{Status: http.StatusForbidden, Err: err}
+	}
+
+	if err := resolveMeasuredAt(payload, receivedAt, deviceUptime); err != nil {
+		return &RejectedError{Status: http.StatusBadRequest, Err: err}
+	}
+
+	if fields := validateReading(payload, registry); len(fields) > 0 {
+		return &RejectedError{Status: http.StatusBadRequest, Err: fmt.Errorf("invalid reading"), Fields: fields}
+	}
+
+	for _, key := range []struct{ field, value string }{
+		{"bootId", payload.BootId},
+		{"idempotencyKey", payload.IdempotencyKey},
+	} {
+		if len(key.value) > maxKeyLength {
+			return &RejectedError{
+				Status: http.StatusBadRequest,
+				Err:    fmt.Errorf("%s must not be longer than %d characters", key.field, maxKeyLength),
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkDeviceMac makes sure a device only sends readings for itself. Payloads
+// without a mac address belong to the sending device.
+func checkDeviceMac(payload *types.SensorReadingPayload, device *types.Device) error {
+	if payload.DeviceMacAddress == "" {
+		payload.DeviceMacAddress = device.MACAddress
+		return nil
+	}
+
+	if !strings.EqualFold(payload.DeviceMacAddress, device.MACAddress) {
+		return fmt.Errorf("device %s may not send readings for %s", device.MACAddress, payload.DeviceMacAddress)
+	}
+
+	return nil
+}
+
+func (i *Ingester) loadRegistry() (map[string]*types.Metric, error) {
+	metrics, err := i.metricStore.GetMetrics()
+	if err != nil {
+		return nil, err
+	}
+
+	registry := make(map[string]*types.Metric, len(metrics))
+	for _, metric := range metrics {
+		registry[metric.Name] = metric
+	}
+
+	return registry, nil
+}
+
+// stored marks the device as seen and announces a stored reading, replays
+// were handled the first time.
+func (i *Ingester) stored(device *types.Device, receivedAt time.Time, result *types.SensorReadingInsertResult) {
+	if result.Replayed {
+		return
+	}
+
+	i.monitor.Seen(device, receivedAt)
+	i.events.Publish(events.Event{
+		Type:     events.ReadingCreated,
+		DeviceId: result.Reading.DeviceId,
+		Data:     result.Reading,
+	})
+}
+
+// recordRejected keeps a rejected payload for later inspection. Failing to
+// record it does not change the response to the device.
+func (i *Ingester) recordRejected(device *types.Device, payload types.SensorReadingPayload, rejected *RejectedError) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		log.Println("could not record rejected reading:", err)
+		return
+	}
+
+	err = i.store.CreateRejectedReading(types.RejectedReading{
+		DeviceId: device.ID,
+		Status:   rejected.Status,
+		Error:    rejected.Err.Error(),
+		Fields:   rejected.Fields,
+		Payload:  raw,
+	})
+	if err != nil {
+		log.Println("could not record rejected reading:", err)
+	}
+}
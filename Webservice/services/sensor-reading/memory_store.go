@@ -0,0 +1,263 @@
+package sensorreading
+
+import (
+	"air-controller-webservice/types"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps sensor readings in memory. It behaves like Store and is
+// meant for tests, nothing survives the process. It does not check that the
+// devices or metrics of the readings exist.
+type MemoryStore struct {
+	mu       sync.Mutex
+	readings []*types.SensorReading
+	rejected []*types.RejectedReading
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+func (s *MemoryStore) CreateSensorReading(sensorReading types.SensorReadingPayload, deviceId int) (*types.SensorReadingInsertResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.create(sensorReading, deviceId), nil
+}
+
+// CreateSensorReadings cannot fail half way, the items are simply stored one
+// after the other so replays within the batch are detected.
+func (s *MemoryStore) CreateSensorReadings(items []types.SensorReadingBatchItem) ([]*types.SensorReadingInsertResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	results := make([]*types.SensorReadingInsertResult, len(items))
+	for i, item := range items {
+		results[i] = s.create(item.Payload, item.DeviceId)
+	}
+
+	return results, nil
+}
+
+func (s *MemoryStore) create(sensorReading types.SensorReadingPayload, deviceId int) *types.SensorReadingInsertResult {
+	if original := s.replayed(sensorReading, deviceId); original != nil {
+		return &types.SensorReadingInsertResult{Reading: copyReading(original), Replayed: true}
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	reading := &types.SensorReading{
+		ID:              len(s.readings) + 1,
+		DeviceId:        deviceId,
+		Temperature:     sensorReading.Temperature,
+		AirQualityIndex: sensorReading.AirQualityIndex,
+		Humidity:        sensorReading.Humidity,
+		Carbondioxide:   sensorReading.Carbondioxide,
+		BsecOutput:      sensorReading.BsecOutput,
+		CreatedAt:       now,
+		MeasuredAt:      now,
+		BootId:          sensorReading.BootId,
+		Sequence:        sensorReading.Sequence,
+	}
+	if sensorReading.MeasuredAt != nil {
+		reading.MeasuredAt = sensorReading.MeasuredAt.UTC()
+	}
+	if sensorReading.IdempotencyKey != "" {
+		idempotencyKey := sensorReading.IdempotencyKey
+		reading.IdempotencyKey = &idempotencyKey
+	}
+	if len(sensorReading.Metrics) > 0 {
+		reading.Metrics = map[string]float64{}
+		for metric, value := range sensorReading.Metrics {
+			reading.Metrics[metric] = value
+		}
+	}
+	s.readings = append(s.readings, reading)
+
+	return &types.SensorReadingInsertResult{Reading: copyReading(reading)}
+}
+
+// replayed finds the reading stored with the same boot ID and sequence number
+// or, failing that, the same idempotency key as the payload.
+func (s *MemoryStore) replayed(sensorReading types.SensorReadingPayload, deviceId int) *types.SensorReading {
+	if sensorReading.Sequence != nil {
+		for _, reading := range s.readings {
+			if reading.DeviceId == deviceId && reading.BootId == sensorReading.BootId &&
+				reading.Sequence != nil && *reading.Sequence == *sensorReading.Sequence {
+				return reading
+			}
+		}
+	}
+	if sensorReading.IdempotencyKey != "" {
+		for _, reading := range s.readings {
+			if reading.DeviceId == deviceId && reading.IdempotencyKey != nil && *reading.IdempotencyKey == sensorReading.IdempotencyKey {
+				return reading
+			}
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) GetSensorReadings(query types.SensorReadingQuery) (*types.SensorReadingPage, error) {
+	return s.getSensorReadingPage("", query), nil
+}
+
+func (s *MemoryStore) GetSensorReadingsByDevice(deviceId string, query types.SensorReadingQuery) (*types.SensorReadingPage, error) {
+	return s.getSensorReadingPage(deviceId, query), nil
+}
+
+func (s *MemoryStore) getSensorReadingPage(deviceId string, query types.SensorReadingQuery) *types.SensorReadingPage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	page := &types.SensorReadingPage{Readings: []*types.SensorReading{}}
+	for _, reading := range s.readings {
+		if deviceId != "" && strconv.Itoa(reading.DeviceId) != deviceId ||
+			!measuredWithin(reading, query.From, query.To, query.MinIaqAccuracy) {
+			continue
+		}
+		if after := query.After; after != nil && !(reading.MeasuredAt.After(after.MeasuredAt) ||
+			reading.MeasuredAt.Equal(after.MeasuredAt) && reading.ID > after.ID) {
+			continue
+		}
+		page.Readings = append(page.Readings, copyReading(reading))
+	}
+
+	sort.Slice(page.Readings, func(i, j int) bool {
+		a, b := page.Readings[i], page.Readings[j]
+		if !a.MeasuredAt.Equal(b.MeasuredAt) {
+			return a.MeasuredAt.Before(b.MeasuredAt)
+		}
+		return a.ID < b.ID
+	})
+
+	if query.Limit > 0 && len(page.Readings) > query.Limit {
+		page.Readings = page.Readings[:query.Limit]
+		last := page.Readings[query.Limit-1]
+		page.Next = &types.SensorReadingCursor{MeasuredAt: last.MeasuredAt, ID: last.ID}
+	}
+
+	return page
+}
+
+func (s *MemoryStore) GetSensorReadingAggregates(deviceId string, query types.SensorReadingAggregateQuery) ([]*types.SensorReadingAggregate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bucketSeconds := int64(query.Bucket / time.Second)
+	buckets := map[int64][]*types.SensorReading{}
+	var starts []int64
+	for _, reading := range s.readings {
+		if strconv.Itoa(reading.DeviceId) != deviceId ||
+			!measuredWithin(reading, query.From, query.To, query.MinIaqAccuracy) {
+			continue
+		}
+
+		start := reading.MeasuredAt.Unix() / bucketSeconds * bucketSeconds
+		if _, ok := buckets[start]; !ok {
+			starts = append(starts, start)
+		}
+		buckets[start] = append(buckets[start], reading)
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+
+	aggregates := []*types.SensorReadingAggregate{}
+	for _, start := range starts {
+		readings := buckets[start]
+		aggregates = append(aggregates, &types.SensorReadingAggregate{
+			BucketStart:     time.Unix(start, 0).UTC(),
+			Count:           len(readings),
+			Temperature:     aggregateStats(readings, func(r *types.SensorReading) float32 { return r.Temperature }),
+			AirQualityIndex: aggregateStats(readings, func(r *types.SensorReading) float32 { return r.AirQualityIndex }),
+			Humidity:        aggregateStats(readings, func(r *types.SensorReading) float32 { return r.Humidity }),
+			Carbondioxide:   aggregateStats(readings, func(r *types.SensorReading) float32 { return r.Carbondioxide }),
+		})
+	}
+
+	return aggregates, nil
+}
+
+func (s *MemoryStore) CreateRejectedReading(reading types.RejectedReading) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reading.ID = len(s.rejected) + 1
+	reading.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	reading.Error = truncateRejectedError(reading.Error)
+	if len(reading.Fields) == 0 {
+		reading.Fields = nil
+	}
+	s.rejected = append(s.rejected, copyRejectedReading(&reading))
+
+	return nil
+}
+
+func (s *MemoryStore) GetRejectedReadings(query types.RejectedReadingQuery) ([]*types.RejectedReading, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	readings := []*types.RejectedReading{}
+	for i := len(s.rejected) - 1; i >= 0 && len(readings) < query.Limit; i-- {
+		if query.DeviceId == 0 || s.rejected[i].DeviceId == query.DeviceId {
+			readings = append(readings, copyRejectedReading(s.rejected[i]))
+		}
+	}
+
+	return readings, nil
+}
+
+// measuredWithin applies the filters shared by the listing and the
+// aggregates. Like NULL in SQL, a missing IAQ accuracy never passes
+// minIaqAccuracy.
+func measuredWithin(reading *types.SensorReading, from, to time.Time, minIaqAccuracy *int) bool {
+	if !from.IsZero() && reading.MeasuredAt.Before(from) {
+		return false
+	}
+	if !to.IsZero() && !reading.MeasuredAt.Before(to) {
+		return false
+	}
+	if minIaqAccuracy != nil && (reading.IaqAccuracy == nil || *reading.IaqAccuracy < *minIaqAccuracy) {
+		return false
+	}
+	return true
+}
+
+func aggregateStats(readings []*types.SensorReading, value func(*types.SensorReading) float32) types.AggregateStats {
+	var sum float64
+	min, max := float64(value(readings[0])), float64(value(readings[0]))
+	for _, reading := range readings {
+		v := float64(value(reading))
+		sum += v
+		if v < min {
+			min = v
+		}
+		if v > max {
+			max = v
+		}
+	}
+	avg := sum / float64(len(readings))
+
+	return types.AggregateStats{Avg: &avg, Min: &min, Max: &max}
+}
+
+// copyReading returns a copy of the stored reading with its own metrics map,
+// callers cannot change the stored reading through it.
+func copyReading(reading *types.SensorReading) *types.SensorReading {
+	sensorReading := *reading
+	if reading.Metrics != nil {
+		sensorReading.Metrics = make(map[string]float64, len(reading.Metrics))
+		for metric, value := range reading.Metrics {
+			sensorReading.Metrics[metric] = value
+		}
+	}
+	return &sensorReading
+}
+
+func copyRejectedReading(reading *types.RejectedReading) *types.RejectedReading {
+	rejectedReading := *reading
+	rejectedReading.Fields = append([]types.FieldError(nil), reading.Fields...)
+	rejectedReading.Payload = append([]byte(nil), reading.Payload...)
+	return &rejectedReading
+}
@@ -0,0 +1,55 @@
+package sensorreading
+
+import (
+	"air-controller-webservice/types"
+	"database/sql"
+)
+
+// PostgresStore keeps sensor readings in a PostgreSQL database. Inserts look
+// for replays first, see createPostgresSensorReading, instead of relying on a
+// duplicate key error, and the aggregate buckets are computed with date_bin
+// instead of UNIX_TIMESTAMP and DIV.
+type PostgresStore struct {
+	*Store
+}
+
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{Store: NewStore(db)}
+}
+
+const postgresBucketExpression = "CAST(EXTRACT(EPOCH FROM date_bin(INTERVAL '%[1]d seconds', measuredAt, TIMESTAMPTZ 'epoch')) AS BIGINT)"
+
+func (s *PostgresStore) CreateSensorReading(sensorReading types.SensorReadingPayload, deviceId int) (*types.SensorReadingInsertResult, error) {
+	return s.insertSensorReading(sensorReading, deviceId, createPostgresSensorReading)
+}
+
+func (s *PostgresStore) CreateSensorReadings(items []types.SensorReadingBatchItem) ([]*types.SensorReadingInsertResult, error) {
+	return s.insertSensorReadings(items, createPostgresSensorReading)
+}
+
+func (s *PostgresStore) GetSensorReadingAggregates(deviceId string, query types.SensorReadingAggregateQuery) ([]*types.SensorReadingAggregate, error) {
+	return s.getSensorReadingAggregates(deviceId, query, postgresBucketExpression)
+}
+
+// createPostgresSensorReading looks for a replay before it inserts. The
+// sequence and idempotency key cannot be unique keys, because a TimescaleDB
+// hypertable only allows unique keys that include measuredAt, and a failed
+// insert would abort the transaction. The advisory lock serializes the
+// inserts of a device until the transaction ends.
+func createPostgresSensorReading(db execQueryer, sensorReading types.SensorReadingPayload, deviceId int) (*types.SensorReadingInsertResult, error) {
+	if sensorReading.Sequence != nil || sensorReading.IdempotencyKey != "" {
+		if _, err := db.Exec("SELECT pg_advisory_xact_lock(hashtext('sensor_readings'), ?)", deviceId); err != nil {
+			return nil, err
+		}
+
+		original, err := getReplayedSensorReading(db, sensorReading, deviceId)
+		if err == nil {
+			return &types.SensorReadingInsertResult{Reading: original, Replayed: true}, nil
+		}
+		if err != sql.ErrNoRows {
+			return nil, err
+		}
+	}
+
+	return createSensorReading(db, sensorReading, deviceId)
+}
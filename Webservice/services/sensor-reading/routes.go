@@ -1,85 +1,244 @@
 package sensorreading
 
 import (
-	"air-controller-webservice/services/device"
+	"air-controller-webservice/middleware"
+	"air-controller-webservice/services/events"
 	"air-controller-webservice/types"
 	"air-controller-webservice/utils"
-	"database/sql"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 )
 
+const (
+	maxPageSize         = 10000
+	defaultPageSize     = 1000
+	maxBatchSize        = 1000
+	defaultRejectedPage = 100
+	maxRejectedPage     = 1000
+)
+
 type Handler struct {
-	store types.SensorReadingStore
-	db    *sql.DB
+	store       types.SensorReadingStore
+	deviceStore types.DeviceStore
+	ingester    *Ingester
+	events      *events.Broker
 }
 
-func NewHandler(store types.SensorReadingStore, db *sql.DB) *Handler {
-	return &Handler{store: store, db: db}
+func NewHandler(store types.SensorReadingStore, deviceStore types.DeviceStore, ingester *Ingester, events *events.Broker) *Handler {
+	return &Handler{store: store, deviceStore: deviceStore, ingester: ingester, events: events}
 }
 
 func (h *Handler) RegisterRoutes(router *mux.Router) {
 	router.HandleFunc("/sensorreading", h.handleGet).Methods("GET")
+	router.HandleFunc("/sensorreading/stream", h.handleStream).Methods("GET")
 	router.HandleFunc("/sensorreading/device/{deviceId}", h.handleGetByDeviceId).Methods("GET")
 	router.HandleFunc("/sensorreading/device/{deviceId}", h.handleOptions).Methods("OPTIONS")
-	router.HandleFunc("/sensorreading", h.handlePost).Methods("POST")
+	router.HandleFunc("/sensorreading/device/{deviceId}/aggregate", h.handleGetAggregates).Methods("GET")
+	router.HandleFunc("/sensorreading/device/{deviceId}/aggregate", h.handleOptions).Methods("OPTIONS")
 	router.HandleFunc("/sensorreading", h.handleOptions).Methods("OPTIONS")
+	router.HandleFunc("/sensorreading/batch", h.handleOptions).Methods("OPTIONS")
+	router.HandleFunc("/sensorreading/rejected", h.handleOptions).Methods("OPTIONS")
+
+	middlewareRouter := router.NewRoute().Subrouter()
+	middlewareRouter.HandleFunc("/sensorreading/rejected", h.handleGetRejected).Methods("GET")
+	middlewareRouter.Use(middleware.RequireAuth())
+
+	deviceRouter := router.NewRoute().Subrouter()
+	deviceRouter.HandleFunc("/sensorreading", h.handlePost).Methods("POST")
+	deviceRouter.HandleFunc("/sensorreading/batch", h.handlePostBatch).Methods("POST")
+	deviceRouter.Use(middleware.RequireDeviceAuth(h.deviceStore))
 }
 
 func (h *Handler) handleGet(w http.ResponseWriter, r *http.Request) {
-	sensorReadings, err := h.store.GetSensorReadings()
+	query, err := parseSensorReadingQuery(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	page, err := h.store.GetSensorReadings(query)
 
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	utils.WriteJSON(w, http.StatusOK, sensorReadings)
+	writeSensorReadingPage(w, page)
 }
 
 func (h *Handler) handleGetByDeviceId(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	deviceId := vars["deviceId"]
 
-	sensorReadings, err := h.store.GetSensorReadingsByDevice(deviceId)
+	query, err := parseSensorReadingQuery(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	page, err := h.store.GetSensorReadingsByDevice(deviceId, query)
 
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	utils.WriteJSON(w, http.StatusOK, sensorReadings)
+	writeSensorReadingPage(w, page)
+}
+
+func (h *Handler) handleGetAggregates(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	deviceId := vars["deviceId"]
+
+	query, fns, err := parseAggregateQuery(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	aggregates, err := h.store.GetSensorReadingAggregates(deviceId, query)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	for _, aggregate := range aggregates {
+		for _, stats := range []*types.AggregateStats{
+			&aggregate.Temperature,
+			&aggregate.AirQualityIndex,
+			&aggregate.Humidity,
+			&aggregate.Carbondioxide,
+		} {
+			if !fns["avg"] {
+				stats.Avg = nil
+			}
+			if !fns["min"] {
+				stats.Min = nil
+			}
+			if !fns["max"] {
+				stats.Max = nil
+			}
+		}
+	}
+
+	utils.WriteJSON(w, http.StatusOK, aggregates)
 }
 
 func (h *Handler) handlePost(w http.ResponseWriter, r *http.Request) {
+	receivedAt := time.Now()
 	var payload types.SensorReadingPayload
 	if err := utils.ParseJSON(r, &payload); err != nil {
 		utils.WriteError(w, 400, err)
 		return
 	}
 
-	deviceStore := device.NewStore(h.db)
-	device, err := deviceStore.GetDeviceByMac(payload.DeviceMacAddress)
+	deviceUptime, err := parseDeviceUptime(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if payload.IdempotencyKey == "" {
+		payload.IdempotencyKey = r.Header.Get("Idempotency-Key")
+	}
+
+	device := middleware.DeviceFromContext(r.Context())
+	result, err := h.ingester.Ingest(device, payload, receivedAt, deviceUptime)
+
+	var rejected *RejectedError
+	if errors.As(err, &rejected) {
+		writeRejected(w, rejected)
+		return
+	}
+
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	if device.ID == 0 {
-		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("device with following mac address was not found %s", device.MACAddress))
+	if result.Replayed {
+		w.Header().Set("Idempotent-Replayed", "true")
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, result.Reading)
+}
+
+// handlePostBatch stores readings a device buffered while it was offline.
+// Rejected readings are reported and skipped, all others are inserted in one
+// transaction.
+func (h *Handler) handlePostBatch(w http.ResponseWriter, r *http.Request) {
+	receivedAt := time.Now()
+	var payloads []types.SensorReadingPayload
+	if err := utils.ParseJSON(r, &payloads); err != nil {
+		utils.WriteError(w, 400, err)
+		return
+	}
+
+	deviceUptime, err := parseDeviceUptime(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
 		return
 	}
 
-	err = h.store.CreateSensorReading(payload, device.ID)
+	if len(payloads) == 0 || len(payloads) > maxBatchSize {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("batch must contain between 1 and %d readings", maxBatchSize))
+		return
+	}
 
+	device := middleware.DeviceFromContext(r.Context())
+	results, err := h.ingester.IngestBatch(device, payloads, receivedAt, deviceUptime)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	utils.WriteJSON(w, http.StatusCreated, nil)
+	status := http.StatusCreated
+	for _, result := range results {
+		if result.Status != http.StatusCreated {
+			status = http.StatusMultiStatus
+		}
+	}
+
+	utils.WriteJSON(w, status, results)
+}
+
+// handleGetRejected lists the newest readings that failed validation, of all
+// devices or the one given by the deviceId query parameter.
+func (h *Handler) handleGetRejected(w http.ResponseWriter, r *http.Request) {
+	query := types.RejectedReadingQuery{Limit: defaultRejectedPage}
+	params := r.URL.Query()
+
+	if deviceId := params.Get("deviceId"); deviceId != "" {
+		id, err := strconv.Atoi(deviceId)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid deviceId: %s", deviceId))
+			return
+		}
+		query.DeviceId = id
+	}
+
+	if limit := params.Get("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil || l < 1 || l > maxRejectedPage {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("limit must be between 1 and %d", maxRejectedPage))
+			return
+		}
+		query.Limit = l
+	}
+
+	readings, err := h.store.GetRejectedReadings(query)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, readings)
 }
 
 func (h *Handler) handleOptions(w http.ResponseWriter, r *http.Request) {
@@ -88,3 +247,146 @@ func (h *Handler) handleOptions(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 	w.WriteHeader(http.StatusOK)
 }
+
+// parseSensorReadingQuery reads the from, to, limit, cursor and minAccuracy
+// query parameters. from and to are RFC 3339 timestamps, cursor is the
+// X-Next-Cursor value of the previous page. Without a limit a page holds
+// defaultPageSize readings.
+func parseSensorReadingQuery(r *http.Request) (types.SensorReadingQuery, error) {
+	query := types.SensorReadingQuery{Limit: defaultPageSize}
+	params := r.URL.Query()
+
+	from, to, err := utils.ParseTimeRange(r)
+	if err != nil {
+		return query, err
+	}
+	query.From = from
+	query.To = to
+
+	if limit := params.Get("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil || l < 1 || l > maxPageSize {
+			return query, fmt.Errorf("limit must be between 1 and %d", maxPageSize)
+		}
+		query.Limit = l
+	}
+
+	if cursor := params.Get("cursor"); cursor != "" {
+		after, err := decodeCursor(cursor)
+		if err != nil {
+			return query, err
+		}
+		query.After = after
+	}
+
+	minAccuracy, err := parseMinAccuracy(params.Get("minAccuracy"))
+	if err != nil {
+		return query, err
+	}
+	query.MinIaqAccuracy = minAccuracy
+
+	return query, nil
+}
+
+// parseAggregateQuery reads the bucket, fn, from, to and minAccuracy query
+// parameters. bucket is a duration like 15m, 1h or 1d and fn a comma separated
+// subset of avg, min and max (all of them if omitted).
+func parseAggregateQuery(r *http.Request) (types.SensorReadingAggregateQuery, map[string]bool, error) {
+	var query types.SensorReadingAggregateQuery
+	params := r.URL.Query()
+
+	bucket, err := parseBucket(params.Get("bucket"))
+	if err != nil {
+		return query, nil, err
+	}
+	query.Bucket = bucket
+
+	from, to, err := utils.ParseTimeRange(r)
+	if err != nil {
+		return query, nil, err
+	}
+	query.From = from
+	query.To = to
+
+	minAccuracy, err := parseMinAccuracy(params.Get("minAccuracy"))
+	if err != nil {
+		return query, nil, err
+	}
+	query.MinIaqAccuracy = minAccuracy
+
+	fns := map[string]bool{"avg": true, "min": true, "max": true}
+	if fn := params.Get("fn"); fn != "" {
+		fns = map[string]bool{}
+		for _, name := range strings.Split(fn, ",") {
+			name = strings.TrimSpace(name)
+			if name != "avg" && name != "min" && name != "max" {
+				return query, nil, fmt.Errorf("unknown aggregate function: %s", name)
+			}
+			fns[name] = true
+		}
+	}
+
+	return query, fns, nil
+}
+
+func parseMinAccuracy(value string) (*int, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	accuracy, err := strconv.Atoi(value)
+	if err != nil || accuracy < 0 || accuracy > 3 {
+		return nil, fmt.Errorf("minAccuracy must be between 0 and 3")
+	}
+
+	return &accuracy, nil
+}
+
+func parseBucket(value string) (time.Duration, error) {
+	if value == "" {
+		return time.Hour, nil
+	}
+
+	var bucket time.Duration
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		d, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid bucket: %s", value)
+		}
+		bucket = time.Duration(d) * 24 * time.Hour
+	} else {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return 0, fmt.Errorf("invalid bucket: %s", value)
+		}
+		bucket = d
+	}
+
+	if bucket < time.Minute || bucket%time.Second != 0 {
+		return 0, fmt.Errorf("bucket must be a whole number of seconds and at least 1m")
+	}
+
+	return bucket, nil
+}
+
+// writeRejected answers a rejected reading, with the invalid fields if it
+// failed validation.
+func writeRejected(w http.ResponseWriter, rejected *RejectedError) {
+	if len(rejected.Fields) == 0 {
+		utils.WriteError(w, rejected.Status, rejected)
+		return
+	}
+
+	utils.WriteJSON(w, rejected.Status, map[string]any{
+		"error":  rejected.Err.Error(),
+		"fields": rejected.Fields,
+	})
+}
+
+func writeSensorReadingPage(w http.ResponseWriter, page *types.SensorReadingPage) {
+	if page.Next != nil {
+		w.Header().Set("X-Next-Cursor", encodeCursor(page.Next))
+	}
+
+	utils.WriteJSON(w, http.StatusOK, page.Readings)
+}
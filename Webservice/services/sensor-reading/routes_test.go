@@ -0,0 +1,360 @@
+package sensorreading_test
+
+import (
+	"air-controller-webservice/services/auth"
+	"air-controller-webservice/services/device"
+	"air-controller-webservice/services/events"
+	"air-controller-webservice/services/metric"
+	sensorreading "air-controller-webservice/services/sensor-reading"
+	"air-controller-webservice/services/storetest"
+	"air-controller-webservice/types"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestIngest(t *testing.T) {
+	router, devices, store := newRouter(t)
+	a := approveDevice(t, devices, "AA:BB:CC:DD:EE:01", "key-a")
+	measuredAt := time.Now().Add(-time.Minute).UTC().Truncate(time.Second).Format(time.RFC3339)
+
+	for _, test := range []struct {
+		name   string
+		key    string
+		body   string
+		status int
+	}{
+		{"no key", "", `{"temperature": 21.5}`, http.StatusUnauthorized},
+		{"unknown key", "unknown", `{"temperature": 21.5}`, http.StatusUnauthorized},
+		{"invalid JSON", "key-a", `{`, http.StatusBadRequest},
+		{"implausible value", "key-a", `{"temperature": 21.5, "humidity": 150}`, http.StatusBadRequest},
+		{"other device", "key-a", `{"deviceMacAddress": "AA:BB:CC:DD:EE:02", "temperature": 21.5}`, http.StatusForbidden},
+		{"reading", "key-a", `{"temperature": 21.5, "humidity": 40, "carbondioxide": 800, "airQualityIndex": 50, "measuredAt": "` +
+			measuredAt + `"}`, http.StatusCreated},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			rr := serve(router, http.MethodPost, "/sensorreading", test.key, test.body)
+			if rr.Code != test.status {
+				t.Errorf("status %d %s, want %d", rr.Code, rr.Body, test.status)
+			}
+		})
+	}
+
+	page, err := store.GetSensorReadingsByDevice(fmt.Sprint(a), types.SensorReadingQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Readings) != 1 || page.Readings[0].Temperature != 21.5 || page.Readings[0].MeasuredAt.Format(time.RFC3339) != measuredAt {
+		t.Errorf("stored readings = %+v, want the accepted one", page.Readings)
+	}
+
+	rejected, err := store.GetRejectedReadings(types.RejectedReadingQuery{DeviceId: a, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rejected) != 2 {
+		t.Errorf("rejected readings = %+v, want the implausible one and the one of another device", rejected)
+	}
+
+	t.Run("idempotency key", func(t *testing.T) {
+		body := `{"temperature": 22, "idempotencyKey": "reading-1"}`
+		first := serve(router, http.MethodPost, "/sensorreading", "key-a", body)
+		replay := serve(router, http.MethodPost, "/sensorreading", "key-a", body)
+		if first.Code != http.StatusCreated || replay.Code != http.StatusCreated {
+			t.Fatalf("status %d and %d, want %d", first.Code, replay.Code, http.StatusCreated)
+		}
+		if first.Header().Get("Idempotent-Replayed") != "" || replay.Header().Get("Idempotent-Replayed") != "true" {
+			t.Errorf("Idempotent-Replayed = %q and %q, want only the replay marked",
+				first.Header().Get("Idempotent-Replayed"), replay.Header().Get("Idempotent-Replayed"))
+		}
+
+		var reading, replayed types.SensorReading
+		if err := json.NewDecoder(first.Body).Decode(&reading); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.NewDecoder(replay.Body).Decode(&replayed); err != nil {
+			t.Fatal(err)
+		}
+		if reading.ID == 0 || replayed.ID != reading.ID {
+			t.Errorf("replay returned reading %d, want %d", replayed.ID, reading.ID)
+		}
+	})
+
+	t.Run("batch", func(t *testing.T) {
+		rr := serve(router, http.MethodPost, "/sensorreading/batch", "key-a",
+			`[{"temperature": 20}, {"temperature": 20, "humidity": -1}]`)
+		if rr.Code != http.StatusMultiStatus {
+			t.Fatalf("status %d %s, want %d", rr.Code, rr.Body, http.StatusMultiStatus)
+		}
+
+		var results []types.SensorReadingBatchResult
+		if err := json.NewDecoder(rr.Body).Decode(&results); err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 2 || results[0].Status != http.StatusCreated || results[0].ID == 0 ||
+			results[1].Status != http.StatusBadRequest || len(results[1].Fields) != 1 || results[1].Fields[0].Field != "humidity" {
+			t.Errorf("results = %+v", results)
+		}
+
+		if rr := serve(router, http.MethodPost, "/sensorreading/batch", "key-a", `[]`); rr.Code != http.StatusBadRequest {
+			t.Errorf("empty batch: status %d, want %d", rr.Code, http.StatusBadRequest)
+		}
+	})
+}
+
+func TestIngestUptime(t *testing.T) {
+	router, devices, store := newRouter(t)
+	a := approveDevice(t, devices, "AA:BB:CC:DD:EE:01", "key-a")
+
+	for _, test := range []struct {
+		name         string
+		deviceUptime string
+		uptime       int64
+		status       int
+	}{
+		{"after the device uptime", "1000", 2000, http.StatusBadRequest},
+		{"older than the maximum age", "9223372036854775807", 0, http.StatusBadRequest},
+		{"a minute old", "3600000", 3540000, http.StatusCreated},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/sensorreading",
+				strings.NewReader(fmt.Sprintf(`{"temperature": 21.5, "uptime": %d}`, test.uptime)))
+			r.Header.Set("Authorization", "Bearer key-a")
+			r.Header.Set("X-Device-Uptime", test.deviceUptime)
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, r)
+			if rr.Code != test.status {
+				t.Errorf("status %d %s, want %d", rr.Code, rr.Body, test.status)
+			}
+		})
+	}
+
+	page, err := store.GetSensorReadingsByDevice(fmt.Sprint(a), types.SensorReadingQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Readings) != 1 {
+		t.Fatalf("stored readings = %+v, want the one a minute old", page.Readings)
+	}
+	if age := time.Since(page.Readings[0].MeasuredAt); age < time.Minute || age > 2*time.Minute {
+		t.Errorf("reading measured %v ago, want a minute", age)
+	}
+}
+
+func TestIngestMarksSeen(t *testing.T) {
+	router, devices, _ := newRouter(t)
+	a := approveDevice(t, devices, "AA:BB:CC:DD:EE:01", "key-a")
+
+	lastSeenAt := func() *time.Time {
+		t.Helper()
+		device, err := devices.GetDeviceById(a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return device.LastSeenAt
+	}
+
+	if rr := serve(router, http.MethodPost, "/sensorreading", "key-a", `{"temperature": 21.5, "humidity": 150}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("status %d %s, want %d", rr.Code, rr.Body, http.StatusBadRequest)
+	}
+	if rr := serve(router, http.MethodPost, "/sensorreading/batch", "key-a", `[{"humidity": -1}]`); rr.Code != http.StatusMultiStatus {
+		t.Fatalf("status %d %s, want %d", rr.Code, rr.Body, http.StatusMultiStatus)
+	}
+	if at := lastSeenAt(); at != nil {
+		t.Errorf("rejected readings marked the device seen at %v", at)
+	}
+
+	if rr := serve(router, http.MethodPost, "/sensorreading", "key-a", `{"temperature": 21.5}`); rr.Code != http.StatusCreated {
+		t.Fatalf("status %d %s, want %d", rr.Code, rr.Body, http.StatusCreated)
+	}
+	if lastSeenAt() == nil {
+		t.Error("a stored reading did not mark the device seen")
+	}
+}
+
+func TestQuery(t *testing.T) {
+	router, devices, _ := newRouter(t)
+	a := approveDevice(t, devices, "AA:BB:CC:DD:EE:01", "key-a")
+	approveDevice(t, devices, "AA:BB:CC:DD:EE:02", "key-b")
+
+	start := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	var measuredAt []time.Time
+	for i := range 5 {
+		at := start.Add(time.Duration(i) * time.Minute)
+		for _, key := range []string{"key-a", "key-b"} {
+			body := fmt.Sprintf(`{"temperature": %d, "measuredAt": %q}`, 20+i, at.Format(time.RFC3339))
+			if rr := serve(router, http.MethodPost, "/sensorreading", key, body); rr.Code != http.StatusCreated {
+				t.Fatalf("status %d %s", rr.Code, rr.Body)
+			}
+		}
+		measuredAt = append(measuredAt, at)
+	}
+
+	t.Run("pages", func(t *testing.T) {
+		var paged []types.SensorReading
+		path := fmt.Sprintf("/sensorreading/device/%d?limit=2", a)
+		for pages := 1; ; pages++ {
+			rr := serve(router, http.MethodGet, path, "", "")
+			readings := decodeReadings(t, rr)
+			if len(readings) > 2 {
+				t.Fatalf("page %d has %d readings", pages, len(readings))
+			}
+			paged = append(paged, readings...)
+
+			cursor := rr.Header().Get("X-Next-Cursor")
+			if cursor == "" {
+				if pages != 3 {
+					t.Errorf("got %d pages, want 3", pages)
+				}
+				break
+			}
+			if pages == 3 {
+				t.Fatal("the last page has a cursor")
+			}
+			path = fmt.Sprintf("/sensorreading/device/%d?limit=2&cursor=%s", a, url.QueryEscape(cursor))
+		}
+
+		if len(paged) != len(measuredAt) {
+			t.Fatalf("paged through %d readings, want %d", len(paged), len(measuredAt))
+		}
+		for i, reading := range paged {
+			if reading.DeviceId != a || !reading.MeasuredAt.Equal(measuredAt[i]) {
+				t.Errorf("reading %d = device %d at %v, want device %d at %v", i, reading.DeviceId, reading.MeasuredAt, a, measuredAt[i])
+			}
+		}
+	})
+
+	t.Run("time range", func(t *testing.T) {
+		query := url.Values{
+			"from": {measuredAt[1].Format(time.RFC3339)},
+			"to":   {measuredAt[3].Format(time.RFC3339)},
+		}
+		readings := decodeReadings(t, serve(router, http.MethodGet, "/sensorreading?"+query.Encode(), "", ""))
+		if len(readings) != 4 {
+			t.Fatalf("got %d readings, want the 2 of each device", len(readings))
+		}
+		for _, reading := range readings {
+			if reading.MeasuredAt.Before(measuredAt[1]) || !reading.MeasuredAt.Before(measuredAt[3]) {
+				t.Errorf("reading measured at %v is out of range", reading.MeasuredAt)
+			}
+		}
+	})
+
+	for name, query := range map[string]string{
+		"limit too small":  "limit=0",
+		"limit too large":  "limit=10001",
+		"invalid cursor":   "cursor=invalid",
+		"invalid from":     "from=yesterday",
+		"invalid accuracy": "minAccuracy=4",
+	} {
+		t.Run(name, func(t *testing.T) {
+			rr := serve(router, http.MethodGet, fmt.Sprintf("/sensorreading/device/%d?%s", a, query), "", "")
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("status %d %s, want %d", rr.Code, rr.Body, http.StatusBadRequest)
+			}
+		})
+	}
+}
+
+func TestQueryDefaultPageSize(t *testing.T) {
+	router, devices, store := newRouter(t)
+	a := approveDevice(t, devices, "AA:BB:CC:DD:EE:01", "key-a")
+
+	// one more reading than a page without limit holds
+	start := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	var items []types.SensorReadingBatchItem
+	for i := range 1001 {
+		measuredAt := start.Add(time.Duration(i) * time.Second)
+		items = append(items, types.SensorReadingBatchItem{DeviceId: a,
+			Payload: types.SensorReadingPayload{Temperature: 21, MeasuredAt: &measuredAt}})
+	}
+	if _, err := store.CreateSensorReadings(items); err != nil {
+		t.Fatal(err)
+	}
+
+	rr := serve(router, http.MethodGet, "/sensorreading", "", "")
+	cursor := rr.Header().Get("X-Next-Cursor")
+	if readings := decodeReadings(t, rr); len(readings) != 1000 || cursor == "" {
+		t.Fatalf("got %d readings and cursor %q, want 1000 and a cursor", len(readings), cursor)
+	}
+
+	rr = serve(router, http.MethodGet, "/sensorreading?cursor="+url.QueryEscape(cursor), "", "")
+	if rr.Header().Get("X-Next-Cursor") != "" {
+		t.Error("the last page has a cursor")
+	}
+	if readings := decodeReadings(t, rr); len(readings) != 1 || !readings[0].MeasuredAt.Equal(start.Add(1000*time.Second)) {
+		t.Errorf("last page = %+v, want the last reading", readings)
+	}
+}
+
+// newRouter serves the sensor reading routes on the memory stores, the
+// metrics are read from a SQLite database.
+func newRouter(t *testing.T) (*mux.Router, types.DeviceStore, types.SensorReadingStore) {
+	store, devices := sensorreading.NewMemoryStore(), device.NewMemoryStore()
+	broker := events.NewBroker()
+	monitor := device.NewMonitor(devices, broker, time.Minute)
+	ingester := sensorreading.NewIngester(store, metric.NewStore(storetest.OpenSQLite(t)), monitor, broker)
+
+	router := mux.NewRouter()
+	sensorreading.NewHandler(store, devices, ingester, broker).RegisterRoutes(router)
+
+	return router, devices, store
+}
+
+// approveDevice registers a device with the given key and returns its id.
+func approveDevice(t *testing.T, devices types.DeviceStore, macAddress string, key string) int {
+	t.Helper()
+
+	if err := devices.RequestDevice(types.RequestDevicePayload{MACAddress: macAddress}); err != nil {
+		t.Fatal(err)
+	}
+	outcomes, err := devices.ApproveDevices([]types.DeviceApproval{{
+		Device:  types.DevicePayload{MACAddress: macAddress, Name: macAddress},
+		KeyHash: auth.HashDeviceKey(key),
+	}}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(outcomes) != 1 || outcomes[0].Err != nil || outcomes[0].DeviceId == 0 {
+		t.Fatalf("ApproveDevices = %+v", outcomes)
+	}
+
+	return outcomes[0].DeviceId
+}
+
+// serve sends a request authenticated with a device key, if one is given.
+func serve(handler http.Handler, method, path, key, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if key != "" {
+		r.Header.Set("Authorization", "Bearer "+key)
+	}
+	r.Header.Set("Content-Type", "application/json")
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, r)
+
+	return rr
+}
+
+func decodeReadings(t *testing.T, rr *httptest.ResponseRecorder) []types.SensorReading {
+	t.Helper()
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status %d %s, want %d", rr.Code, rr.Body, http.StatusOK)
+	}
+
+	var readings []types.SensorReading
+	if err := json.NewDecoder(rr.Body).Decode(&readings); err != nil {
+		t.Fatal(err)
+	}
+
+	return readings
+}
@@ -0,0 +1,23 @@
+package sensorreading
+
+import (
+	"air-controller-webservice/types"
+	"database/sql"
+)
+
+// SQLiteStore keeps sensor readings in a SQLite database. Only the aggregates
+// differ, SQLite has no UNIX_TIMESTAMP and DIV, the buckets are computed from
+// strftime('%s') instead. Inserts and their RETURNING clause are the same.
+type SQLiteStore struct {
+	*Store
+}
+
+func NewSQLiteStore(db *sql.DB) *SQLiteStore {
+	return &SQLiteStore{Store: NewStore(db)}
+}
+
+const sqliteBucketExpression = "(CAST(strftime('%%s', measuredAt) AS INTEGER) / %[1]d) * %[1]d"
+
+func (s *SQLiteStore) GetSensorReadingAggregates(deviceId string, query types.SensorReadingAggregateQuery) ([]*types.SensorReadingAggregate, error) {
+	return s.getSensorReadingAggregates(deviceId, query, sqliteBucketExpression)
+}
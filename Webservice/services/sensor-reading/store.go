@@ -3,7 +3,16 @@ package sensorreading
 import (
 	"air-controller-webservice/types"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-sql-driver/mysql"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
 )
 
 type Store struct {
@@ -14,59 +23,430 @@ func NewStore(db *sql.DB) *Store {
 	return &Store{db: db}
 }
 
-func (s *Store) CreateSensorReading(sensorReading types.SensorReadingPayload, deviceId int) error {
-	_, err := s.db.Exec("INSERT INTO sensor_readings(deviceId, temperature, humidity, carbondioxide, airQualityIndex) VALUES (?,?,?,?,?)",
+const (
+	sensorReadingColumns = "id, deviceId, temperature, humidity, carbondioxide, airQualityIndex, " +
+		"staticIaq, iaqAccuracy, breathVocEquivalent, pressure, gasResistance, stabilizationStatus, " +
+		"createdAt, measuredAt, bootId, sequence, idempotencyKey"
+	insertSensorReading = "INSERT INTO sensor_readings(deviceId, temperature, humidity, carbondioxide, airQualityIndex, " +
+		"staticIaq, iaqAccuracy, breathVocEquivalent, pressure, gasResistance, stabilizationStatus, " +
+		"measuredAt, bootId, sequence, idempotencyKey) VALUES (?,?,?,?,?,?,?,?,?,?,?,COALESCE(?, CURRENT_TIMESTAMP),?,?,?) RETURNING id"
+)
+
+// execQueryer is implemented by *sql.DB and *sql.Tx.
+type execQueryer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// CreateSensorReading stores a reading. If the device already sent a reading
+// with the same boot ID and sequence number or with the same idempotency key,
+// nothing is inserted and the stored reading is returned as replayed.
+func (s *Store) CreateSensorReading(sensorReading types.SensorReadingPayload, deviceId int) (*types.SensorReadingInsertResult, error) {
+	return s.insertSensorReading(sensorReading, deviceId, createSensorReading)
+}
+
+// CreateSensorReadings inserts all items in one transaction, either all of
+// them are stored or none. Replays are detected per item like in
+// CreateSensorReading, the results are in the order of the items.
+func (s *Store) CreateSensorReadings(items []types.SensorReadingBatchItem) ([]*types.SensorReadingInsertResult, error) {
+	return s.insertSensorReadings(items, createSensorReading)
+}
+
+// createFunc stores a single reading within a transaction.
+type createFunc func(db execQueryer, sensorReading types.SensorReadingPayload, deviceId int) (*types.SensorReadingInsertResult, error)
+
+func (s *Store) insertSensorReading(sensorReading types.SensorReadingPayload, deviceId int, create createFunc) (*types.SensorReadingInsertResult, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := create(tx, sensorReading, deviceId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (s *Store) insertSensorReadings(items []types.SensorReadingBatchItem, create createFunc) ([]*types.SensorReadingInsertResult, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	results := make([]*types.SensorReadingInsertResult, len(items))
+	for i, item := range items {
+		results[i], err = create(tx, item.Payload, item.DeviceId)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+func createSensorReading(db execQueryer, sensorReading types.SensorReadingPayload, deviceId int) (*types.SensorReadingInsertResult, error) {
+	var idempotencyKey *string
+	if sensorReading.IdempotencyKey != "" {
+		idempotencyKey = &sensorReading.IdempotencyKey
+	}
+
+	var id int
+	err := db.QueryRow(insertSensorReading,
 		deviceId,
 		sensorReading.Temperature,
 		sensorReading.Humidity,
 		sensorReading.Carbondioxide,
-		sensorReading.AirQualityIndex)
+		sensorReading.AirQualityIndex,
+		sensorReading.StaticIaq,
+		sensorReading.IaqAccuracy,
+		sensorReading.BreathVocEquivalent,
+		sensorReading.Pressure,
+		sensorReading.GasResistance,
+		sensorReading.StabilizationStatus,
+		sensorReading.MeasuredAt,
+		sensorReading.BootId,
+		sensorReading.Sequence,
+		idempotencyKey).Scan(&id)
+	if isDuplicateEntry(err) {
+		original, err := getReplayedSensorReading(db, sensorReading, deviceId)
+		if err != nil {
+			return nil, err
+		}
+		return &types.SensorReadingInsertResult{Reading: original, Replayed: true}, nil
+	}
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	for metric, value := range sensorReading.Metrics {
+		if _, err := db.Exec("INSERT INTO sensor_reading_values(readingId, metric, value) VALUES (?,?,?)", id, metric, value); err != nil {
+			return nil, err
+		}
 	}
 
-	fmt.Println("inserted")
+	reading, err := getSensorReading(db, "id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &types.SensorReadingInsertResult{Reading: reading}, nil
+}
+
+func getSensorReading(db execQueryer, condition string, args ...any) (*types.SensorReading, error) {
+	reading, err := scanRowIntoSensorReading(db.QueryRow("SELECT "+sensorReadingColumns+" FROM sensor_readings WHERE "+condition, args...))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := loadMetrics(db, []*types.SensorReading{reading}); err != nil {
+		return nil, err
+	}
+
+	return reading, nil
+}
+
+// metricsChunkSize is how many readings loadMetrics looks up per query, far
+// below the placeholder limits of the backends (32766 for SQLite).
+const metricsChunkSize = 1000
+
+// loadMetrics fills in the metrics maps of the readings from
+// sensor_reading_values.
+func loadMetrics(db execQueryer, readings []*types.SensorReading) error {
+	byId := make(map[int]*types.SensorReading, len(readings))
+	for _, reading := range readings {
+		byId[reading.ID] = reading
+	}
+
+	for start := 0; start < len(readings); start += metricsChunkSize {
+		chunk := readings[start:min(start+metricsChunkSize, len(readings))]
+		args := make([]any, 0, len(chunk))
+		for _, reading := range chunk {
+			args = append(args, reading.ID)
+		}
+
+		if err := loadMetricsChunk(db, byId, args); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
 
-func (s *Store) GetSensorReadings() ([]*types.SensorReading, error) {
-	rows, err := s.db.Query("SELECT * FROM sensor_readings")
+func loadMetricsChunk(db execQueryer, byId map[int]*types.SensorReading, ids []any) error {
+	rows, err := db.Query("SELECT readingId, metric, value FROM sensor_reading_values WHERE readingId IN (?"+
+		strings.Repeat(",?", len(ids)-1)+")", ids...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var readingId int
+		var metric string
+		var value float64
+		if err := rows.Scan(&readingId, &metric, &value); err != nil {
+			return err
+		}
+
+		reading := byId[readingId]
+		if reading.Metrics == nil {
+			reading.Metrics = map[string]float64{}
+		}
+		reading.Metrics[metric] = value
+	}
+
+	return rows.Err()
+}
+
+func getReplayedSensorReading(db execQueryer, sensorReading types.SensorReadingPayload, deviceId int) (*types.SensorReading, error) {
+	if sensorReading.Sequence != nil {
+		reading, err := getSensorReading(db, "deviceId = ? AND bootId = ? AND sequence = ?",
+			deviceId, sensorReading.BootId, *sensorReading.Sequence)
+		if err != sql.ErrNoRows {
+			return reading, err
+		}
+	}
+
+	return getSensorReading(db, "deviceId = ? AND idempotencyKey = ?", deviceId, sensorReading.IdempotencyKey)
+}
+
+func isDuplicateEntry(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	var sqliteErr *sqlite.Error
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 ||
+		errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+}
+
+func (s *Store) GetSensorReadings(query types.SensorReadingQuery) (*types.SensorReadingPage, error) {
+	return s.getSensorReadingPage(nil, nil, query)
+}
+
+func (s *Store) GetSensorReadingsByDevice(deviceId string, query types.SensorReadingQuery) (*types.SensorReadingPage, error) {
+	return s.getSensorReadingPage([]string{"deviceId = ?"}, []any{deviceId}, query)
+}
+
+func (s *Store) getSensorReadingPage(conditions []string, args []any, query types.SensorReadingQuery) (*types.SensorReadingPage, error) {
+	if !query.From.IsZero() {
+		conditions = append(conditions, "measuredAt >= ?")
+		args = append(args, query.From.UTC())
+	}
+	if !query.To.IsZero() {
+		conditions = append(conditions, "measuredAt < ?")
+		args = append(args, query.To.UTC())
+	}
+	if query.MinIaqAccuracy != nil {
+		conditions = append(conditions, "iaqAccuracy >= ?")
+		args = append(args, *query.MinIaqAccuracy)
+	}
+	if query.After != nil {
+		conditions = append(conditions, "(measuredAt > ? OR (measuredAt = ? AND id > ?))")
+		args = append(args, query.After.MeasuredAt.UTC(), query.After.MeasuredAt.UTC(), query.After.ID)
+	}
+
+	sqlQuery := "SELECT " + sensorReadingColumns + " FROM sensor_readings"
+	if len(conditions) > 0 {
+		sqlQuery += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	sqlQuery += " ORDER BY measuredAt, id"
+	if query.Limit > 0 {
+		// fetch one extra row to find out whether another page follows
+		sqlQuery += " LIMIT ?"
+		args = append(args, query.Limit+1)
+	}
+
+	rows, err := s.db.Query(sqlQuery, args...)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	var sensorReadings []*types.SensorReading
+	page := &types.SensorReadingPage{Readings: []*types.SensorReading{}}
 	for rows.Next() {
 		sensorReading, err := scanRowIntoSensorReading(rows)
 		if err != nil {
 			return nil, err
 		}
-		sensorReadings = append(sensorReadings, sensorReading)
+		page.Readings = append(page.Readings, sensorReading)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	if query.Limit > 0 && len(page.Readings) > query.Limit {
+		page.Readings = page.Readings[:query.Limit]
+		last := page.Readings[query.Limit-1]
+		page.Next = &types.SensorReadingCursor{MeasuredAt: last.MeasuredAt, ID: last.ID}
 	}
 
-	return sensorReadings, nil
+	if err := loadMetrics(s.db, page.Readings); err != nil {
+		return nil, err
+	}
+
+	return page, nil
 }
 
-func (s *Store) GetSensorReadingsByDevice(deviceId string) ([]*types.SensorReading, error) {
-	rows, err := s.db.Query("SELECT * FROM sensor_readings where deviceId = ?", deviceId)
+// bucketExpression maps measuredAt to the unix time of the start of its
+// bucket, it is formatted with the bucket length in seconds.
+const bucketExpression = "(UNIX_TIMESTAMP(measuredAt) DIV %[1]d) * %[1]d"
+
+func (s *Store) GetSensorReadingAggregates(deviceId string, query types.SensorReadingAggregateQuery) ([]*types.SensorReadingAggregate, error) {
+	return s.getSensorReadingAggregates(deviceId, query, bucketExpression)
+}
+
+func (s *Store) getSensorReadingAggregates(deviceId string, query types.SensorReadingAggregateQuery, bucketExpression string) ([]*types.SensorReadingAggregate, error) {
+	bucketSeconds := int64(query.Bucket / time.Second)
+	conditions := []string{"deviceId = ?"}
+	args := []any{deviceId}
+	if !query.From.IsZero() {
+		conditions = append(conditions, "measuredAt >= ?")
+		args = append(args, query.From.UTC())
+	}
+	if !query.To.IsZero() {
+		conditions = append(conditions, "measuredAt < ?")
+		args = append(args, query.To.UTC())
+	}
+	if query.MinIaqAccuracy != nil {
+		conditions = append(conditions, "iaqAccuracy >= ?")
+		args = append(args, *query.MinIaqAccuracy)
+	}
+
+	rows, err := s.db.Query(`SELECT `+fmt.Sprintf(bucketExpression, bucketSeconds)+` AS bucket, COUNT(*),
+		AVG(temperature), MIN(temperature), MAX(temperature),
+		AVG(airQualityIndex), MIN(airQualityIndex), MAX(airQualityIndex),
+		AVG(humidity), MIN(humidity), MAX(humidity),
+		AVG(carbondioxide), MIN(carbondioxide), MAX(carbondioxide)
+		FROM sensor_readings WHERE `+strings.Join(conditions, " AND ")+`
+		GROUP BY bucket ORDER BY bucket`, args...)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	var sensorReadings []*types.SensorReading
+	aggregates := []*types.SensorReadingAggregate{}
 	for rows.Next() {
-		sensorReading, err := scanRowIntoSensorReading(rows)
+		aggregate, err := scanRowIntoSensorReadingAggregate(rows)
 		if err != nil {
 			return nil, err
 		}
-		sensorReadings = append(sensorReadings, sensorReading)
+		aggregates = append(aggregates, aggregate)
 	}
 
-	return sensorReadings, nil
+	return aggregates, rows.Err()
+}
+
+// maxRejectedErrorLength is the length of rejected_readings.error in
+// characters, longer errors are cut off.
+const maxRejectedErrorLength = 255
+
+func truncateRejectedError(message string) string {
+	if utf8.RuneCountInString(message) <= maxRejectedErrorLength {
+		return message
+	}
+	return string([]rune(message)[:maxRejectedErrorLength])
+}
+
+func (s *Store) CreateRejectedReading(reading types.RejectedReading) error {
+	var fieldErrors []byte
+	if len(reading.Fields) > 0 {
+		var err error
+		if fieldErrors, err = json.Marshal(reading.Fields); err != nil {
+			return err
+		}
+	}
+
+	_, err := s.db.Exec("INSERT INTO rejected_readings(deviceId, status, error, fieldErrors, payload) VALUES (?,?,?,?,?)",
+		reading.DeviceId, reading.Status, truncateRejectedError(reading.Error), fieldErrors, []byte(reading.Payload))
+
+	return err
+}
+
+func (s *Store) GetRejectedReadings(query types.RejectedReadingQuery) ([]*types.RejectedReading, error) {
+	sqlQuery := "SELECT id, deviceId, status, error, fieldErrors, payload, createdAt FROM rejected_readings"
+	var args []any
+	if query.DeviceId != 0 {
+		sqlQuery += " WHERE deviceId = ?"
+		args = append(args, query.DeviceId)
+	}
+	sqlQuery += " ORDER BY id DESC LIMIT ?"
+	args = append(args, query.Limit)
+
+	rows, err := s.db.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	readings := []*types.RejectedReading{}
+	for rows.Next() {
+		reading := new(types.RejectedReading)
+		var fieldErrors, payload []byte
+		if err := rows.Scan(&reading.ID, &reading.DeviceId, &reading.Status, &reading.Error, &fieldErrors, &payload, &reading.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		if fieldErrors != nil {
+			if err := json.Unmarshal(fieldErrors, &reading.Fields); err != nil {
+				return nil, err
+			}
+		}
+		reading.Payload = payload
+
+		readings = append(readings, reading)
+	}
+
+	return readings, rows.Err()
+}
+
+func scanRowIntoSensorReadingAggregate(rows *sql.Rows) (*types.SensorReadingAggregate, error) {
+	aggregate := new(types.SensorReadingAggregate)
+	var bucket int64
+	var stats [12]sql.NullFloat64
+
+	dest := []any{&bucket, &aggregate.Count}
+	for i := range stats {
+		dest = append(dest, &stats[i])
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return nil, err
+	}
+
+	aggregate.BucketStart = time.Unix(bucket, 0).UTC()
+	for i, target := range []*types.AggregateStats{
+		&aggregate.Temperature,
+		&aggregate.AirQualityIndex,
+		&aggregate.Humidity,
+		&aggregate.Carbondioxide,
+	} {
+		target.Avg = nullFloat(stats[i*3])
+		target.Min = nullFloat(stats[i*3+1])
+		target.Max = nullFloat(stats[i*3+2])
+	}
+
+	return aggregate, nil
+}
+
+func nullFloat(value sql.NullFloat64) *float64 {
+	if !value.Valid {
+		return nil
+	}
+	return &value.Float64
 }
 
-func scanRowIntoSensorReading(rows *sql.Rows) (*types.SensorReading, error) {
+func scanRowIntoSensorReading(rows interface{ Scan(dest ...any) error }) (*types.SensorReading, error) {
 	sensorReading := new(types.SensorReading)
 
 	err := rows.Scan(
@@ -76,7 +456,17 @@ func scanRowIntoSensorReading(rows *sql.Rows) (*types.SensorReading, error) {
 		&sensorReading.Humidity,
 		&sensorReading.Carbondioxide,
 		&sensorReading.AirQualityIndex,
+		&sensorReading.StaticIaq,
+		&sensorReading.IaqAccuracy,
+		&sensorReading.BreathVocEquivalent,
+		&sensorReading.Pressure,
+		&sensorReading.GasResistance,
+		&sensorReading.StabilizationStatus,
 		&sensorReading.CreatedAt,
+		&sensorReading.MeasuredAt,
+		&sensorReading.BootId,
+		&sensorReading.Sequence,
+		&sensorReading.IdempotencyKey,
 	)
 
 	if err != nil {
@@ -0,0 +1,34 @@
+package sensorreading_test
+
+import (
+	"air-controller-webservice/db"
+	"air-controller-webservice/services/device"
+	sensorreading "air-controller-webservice/services/sensor-reading"
+	"air-controller-webservice/services/storetest"
+	"air-controller-webservice/types"
+	"testing"
+)
+
+func TestMemoryStore(t *testing.T) {
+	storetest.RunSensorReadingStore(t, func(t *testing.T) (types.SensorReadingStore, types.DeviceStore) {
+		return sensorreading.NewMemoryStore(), device.NewMemoryStore()
+	})
+}
+
+func TestStore(t *testing.T) {
+	for _, backend := range storetest.Backends() {
+		t.Run(backend.Name, func(t *testing.T) {
+			storetest.RunSensorReadingStore(t, func(t *testing.T) (types.SensorReadingStore, types.DeviceStore) {
+				database := backend.Open(t)
+				switch backend.Name {
+				case db.SQLite:
+					return sensorreading.NewSQLiteStore(database), device.NewSQLiteStore(database)
+				case db.Postgres:
+					return sensorreading.NewPostgresStore(database), device.NewPostgresStore(database)
+				default:
+					return sensorreading.NewStore(database), device.NewStore(database)
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package sensorreading
+
+import (
+	"air-controller-webservice/services/events"
+	"air-controller-webservice/utils"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// keepAliveInterval keeps proxies from closing idle streams.
+const keepAliveInterval = 15 * time.Second
+
+// handleStream pushes every new reading, of all devices or the one given by
+// the deviceId query parameter, as Server-Sent Event. A client that cannot keep
+// up is disconnected and has to reconnect.
+func (h *Handler) handleStream(w http.ResponseWriter, r *http.Request) {
+	deviceId := 0
+	if value := r.URL.Query().Get("deviceId"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid deviceId: %s", value))
+			return
+		}
+		deviceId = id
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		utils.WriteError(w, http.StatusInternalServerError, fmt.Errorf("streaming is not supported"))
+		return
+	}
+
+	subscription := h.events.Subscribe(func(event events.Event) bool {
+		return event.Type == events.ReadingCreated && (deviceId == 0 || event.DeviceId == deviceId)
+	})
+	defer h.events.Unsubscribe(subscription)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case event, ok := <-subscription.Events():
+			if !ok {
+				return
+			}
+
+			data, err := json.Marshal(event.Data)
+			if err != nil {
+				return
+			}
+
+			if _, err := fmt.Fprintf(w, "event: reading\ndata: %s\n\n", data); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package sensorreading_test
+
+import (
+	"air-controller-webservice/types"
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStream(t *testing.T) {
+	router, devices, _ := newRouter(t)
+	a := approveDevice(t, devices, "AA:BB:CC:DD:EE:01", "key-a")
+	approveDevice(t, devices, "AA:BB:CC:DD:EE:02", "key-b")
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	response, err := http.Get(fmt.Sprintf("%s/sensorreading/stream?deviceId=%d", server.URL, a))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK || response.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("status %d, Content-Type %q", response.StatusCode, response.Header.Get("Content-Type"))
+	}
+
+	// the stream is subscribed once the headers arrived, the reading of the
+	// other device comes first and must be skipped
+	for _, key := range []string{"key-b", "key-a"} {
+		if rr := serve(router, http.MethodPost, "/sensorreading", key, `{"temperature": 21.5}`); rr.Code != http.StatusCreated {
+			t.Fatalf("status %d %s", rr.Code, rr.Body)
+		}
+	}
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(response.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	var event []string
+	for len(event) == 0 || event[len(event)-1] != "" {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				t.Fatalf("the stream ended after %q", event)
+			}
+			event = append(event, line)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out after %q", event)
+		}
+	}
+
+	if len(event) != 3 || event[0] != "event: reading" || !strings.HasPrefix(event[1], "data: ") {
+		t.Fatalf("event = %q, want a reading", event)
+	}
+	var reading types.SensorReading
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(event[1], "data: ")), &reading); err != nil {
+		t.Fatal(err)
+	}
+	if reading.DeviceId != a || reading.Temperature != 21.5 || reading.ID == 0 {
+		t.Errorf("streamed reading = %+v, want the one of device %d", reading, a)
+	}
+}
+
+func TestStreamInvalidDevice(t *testing.T) {
+	router, _, _ := newRouter(t)
+
+	rr := serve(router, http.MethodGet, "/sensorreading/stream?deviceId=first", "", "")
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("status %d %s, want %d", rr.Code, rr.Body, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,65 @@
+package sensorreading
+
+import (
+	"air-controller-webservice/config"
+	"air-controller-webservice/types"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// deviceUptimeHeader carries the device uptime in milliseconds at the moment
+// the request was sent. Together with the uptime of a reading it tells how old
+// the reading is, even if the device has no synchronized clock.
+const deviceUptimeHeader = "X-Device-Uptime"
+
+func parseDeviceUptime(r *http.Request) (*int64, error) {
+	value := r.Header.Get(deviceUptimeHeader)
+	if value == "" {
+		return nil, nil
+	}
+
+	uptime, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || uptime < 0 {
+		return nil, fmt.Errorf("invalid %s header: %s", deviceUptimeHeader, value)
+	}
+
+	return &uptime, nil
+}
+
+// resolveMeasuredAt sets payload.MeasuredAt to the moment the reading was
+// taken. A device timestamp is used as is, otherwise the age of the reading is
+// derived from the uptimes, otherwise the reading counts as measured when it
+// was received. Timestamps too far in the future or the past are rejected.
+func resolveMeasuredAt(payload *types.SensorReadingPayload, receivedAt time.Time, deviceUptime *int64) error {
+	measuredAt := receivedAt
+
+	switch {
+	case payload.MeasuredAt != nil:
+		measuredAt = *payload.MeasuredAt
+	case payload.Uptime != nil && deviceUptime != nil:
+		age := *deviceUptime - *payload.Uptime
+		if *payload.Uptime < 0 || age < 0 {
+			return fmt.Errorf("uptime %d is after the device uptime %d", *payload.Uptime, *deviceUptime)
+		}
+		// checked before the conversion, which overflows for ages of
+		// about 292 years and more
+		if age > config.Envs.MaxReadingAge.Milliseconds() {
+			return fmt.Errorf("uptime %d is older than %s", *payload.Uptime, config.Envs.MaxReadingAge)
+		}
+		measuredAt = receivedAt.Add(-time.Duration(age) * time.Millisecond)
+	}
+
+	if measuredAt.After(receivedAt.Add(config.Envs.MaxClockSkew)) {
+		return fmt.Errorf("measuredAt %s is in the future", measuredAt.Format(time.RFC3339))
+	}
+	if measuredAt.Before(receivedAt.Add(-config.Envs.MaxReadingAge)) {
+		return fmt.Errorf("measuredAt %s is older than %s", measuredAt.Format(time.RFC3339), config.Envs.MaxReadingAge)
+	}
+
+	measuredAt = measuredAt.UTC()
+	payload.MeasuredAt = &measuredAt
+
+	return nil
+}
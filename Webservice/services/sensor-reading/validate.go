@@ -0,0 +1,162 @@
+package sensorreading
+
+import (
+	"air-controller-webservice/types"
+	"fmt"
+	"math"
+	"sort"
+)
+
+type fieldValue struct {
+	name  string
+	value *float64
+}
+
+// builtinFields returns the numeric fixed fields of a payload under their
+// metric names. Optional fields that were not sent have a nil value.
+func builtinFields(payload *types.SensorReadingPayload) []fieldValue {
+	float := func(value float32) *float64 {
+		v := float64(value)
+		return &v
+	}
+	optional := func(value *float32) *float64 {
+		if value == nil {
+			return nil
+		}
+		return float(*value)
+	}
+
+	var iaqAccuracy *float64
+	if payload.IaqAccuracy != nil {
+		v := float64(*payload.IaqAccuracy)
+		iaqAccuracy = &v
+	}
+
+	return []fieldValue{
+		{"temperature", float(payload.Temperature)},
+		{"humidity", float(payload.Humidity)},
+		{"carbondioxide", float(payload.Carbondioxide)},
+		{"airQualityIndex", float(payload.AirQualityIndex)},
+		{"staticIaq", optional(payload.StaticIaq)},
+		{"iaqAccuracy", iaqAccuracy},
+		{"breathVocEquivalent", optional(payload.BreathVocEquivalent)},
+		{"pressure", optional(payload.Pressure)},
+		{"gasResistance", optional(payload.GasResistance)},
+	}
+}
+
+// validateReading checks all values of a payload against the valid range of
+// their metric and returns one error per implausible field. Named channels
+// must be registered and not builtin, they are rounded to the precision of
+// their metric.
+func validateReading(payload *types.SensorReadingPayload, registry map[string]*types.Metric) []types.FieldError {
+	var fields []types.FieldError
+
+	for _, field := range builtinFields(payload) {
+		metric, ok := registry[field.name]
+		if !ok || field.value == nil {
+			continue
+		}
+
+		if message := checkRange(metric, *field.value); message != "" {
+			fields = append(fields, types.FieldError{Field: field.name, Message: message})
+		}
+	}
+
+	names := make([]string, 0, len(payload.Metrics))
+	for name := range payload.Metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		field := "metrics." + name
+		value := payload.Metrics[name]
+
+		metric, ok := registry[name]
+		if !ok {
+			fields = append(fields, types.FieldError{Field: field, Message: "is not a registered metric"})
+			continue
+		}
+
+		if metric.Builtin {
+			fields = append(fields, types.FieldError{Field: field, Message: "must be sent as field " + name})
+			continue
+		}
+
+		if message := checkRange(metric, value); message != "" {
+			fields = append(fields, types.FieldError{Field: field, Message: message})
+			continue
+		}
+
+		scale := math.Pow(10, float64(metric.Precision))
+		payload.Metrics[name] = math.Round(value*scale) / scale
+	}
+
+	return fields
+}
+
+// checkRange returns why value is implausible for metric, or an empty string.
+func checkRange(metric *types.Metric, value float64) string {
+	unit := ""
+	if metric.Unit != "" {
+		unit = " " + metric.Unit
+	}
+
+	switch {
+	case metric.Min != nil && metric.Max != nil && (value < *metric.Min || value > *metric.Max):
+		return fmt.Sprintf("must be between %g and %g%s", *metric.Min, *metric.Max, unit)
+	case metric.Min != nil && value < *metric.Min:
+		return fmt.Sprintf("must be at least %g%s", *metric.Min, unit)
+	case metric.Max != nil && value > *metric.Max:
+		return fmt.Sprintf("must be at most %g%s", *metric.Max, unit)
+	}
+
+	return ""
+}
+
+// MetricValue returns the value of the named metric of a stored reading, false
+// if the reading has none. stabilizationStatus counts as 1 if stabilized.
+func MetricValue(reading *types.SensorReading, name string) (float64, bool) {
+	optional := func(value *float32) (float64, bool) {
+		if value == nil {
+			return 0, false
+		}
+		return float64(*value), true
+	}
+
+	switch name {
+	case "temperature":
+		return float64(reading.Temperature), true
+	case "humidity":
+		return float64(reading.Humidity), true
+	case "carbondioxide":
+		return float64(reading.Carbondioxide), true
+	case "airQualityIndex":
+		return float64(reading.AirQualityIndex), true
+	case "staticIaq":
+		return optional(reading.StaticIaq)
+	case "breathVocEquivalent":
+		return optional(reading.BreathVocEquivalent)
+	case "pressure":
+		return optional(reading.Pressure)
+	case "gasResistance":
+		return optional(reading.GasResistance)
+	case "iaqAccuracy":
+		if reading.IaqAccuracy == nil {
+			return 0, false
+		}
+		return float64(*reading.IaqAccuracy), true
+	case "stabilizationStatus":
+		if reading.StabilizationStatus == nil {
+			return 0, false
+		}
+		if *reading.StabilizationStatus {
+			return 1, true
+		}
+		return 0, true
+	}
+
+	value, ok := reading.Metrics[name]
+	return value, ok
+}
@@ -0,0 +1,246 @@
+package storetest
+
+import (
+	"air-controller-webservice/types"
+	"slices"
+	"testing"
+	"time"
+)
+
+// RunAlertStore checks an AlertStore, newStores returns an empty store and
+// the device store its devices are registered in.
+func RunAlertStore(t *testing.T, newStores func(t *testing.T) (types.AlertStore, types.DeviceStore)) {
+	t.Run("rules", func(t *testing.T) {
+		store, devices := newStores(t)
+		a := approveDevice(t, devices, "aa:00", "hash-a")
+
+		localization := "kitchen"
+		first, err := store.CreateAlertRule(types.AlertRulePayload{Name: "co2 high", DeviceId: &a, Metric: "carbondioxide",
+			Comparator: ">", Threshold: 1500, DurationSeconds: 300, Hysteresis: 100})
+		if err != nil {
+			t.Fatal(err)
+		}
+		second, err := store.CreateAlertRule(types.AlertRulePayload{Name: "cold", Localization: &localization,
+			Metric: "temperature", Comparator: "<", Threshold: 18})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if first == 0 || second == first {
+			t.Fatalf("CreateAlertRule returned ids %d and %d", first, second)
+		}
+
+		rule, err := store.GetAlertRuleById(first)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rule.ID != first || rule.Name != "co2 high" || rule.DeviceId == nil || *rule.DeviceId != a || rule.Localization != nil ||
+			rule.Metric != "carbondioxide" || rule.Comparator != ">" || rule.Threshold != 1500 || rule.DurationSeconds != 300 ||
+			rule.Hysteresis != 100 || !rule.Enabled || rule.CreatedAt.IsZero() {
+			t.Errorf("GetAlertRuleById(%d) = %+v", first, rule)
+		}
+
+		disabled := false
+		if err := store.UpdateAlertRule(second, types.AlertRulePayload{Name: "cold", Localization: &localization,
+			Metric: "temperature", Comparator: "<=", Threshold: 17.5, Enabled: &disabled}); err != nil {
+			t.Fatal(err)
+		}
+
+		rules, err := store.GetAlertRules()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rules) != 2 || rules[0].ID != first || rules[1].ID != second {
+			t.Fatalf("GetAlertRules = %+v, want rules %d and %d", rules, first, second)
+		}
+		if updated := rules[1]; updated.Localization == nil || *updated.Localization != "kitchen" || updated.DeviceId != nil ||
+			updated.Comparator != "<=" || updated.Threshold != 17.5 || updated.Enabled {
+			t.Errorf("updated rule = %+v", updated)
+		}
+
+		if err := store.DeleteAlertRule(first); err != nil {
+			t.Fatal(err)
+		}
+		if rule, err = store.GetAlertRuleById(first); err != nil {
+			t.Fatal(err)
+		}
+		if rule.ID != 0 {
+			t.Errorf("GetAlertRuleById of a deleted rule = %+v", rule)
+		}
+	})
+
+	t.Run("alert lifecycle", func(t *testing.T) {
+		store, devices := newStores(t)
+		a := approveDevice(t, devices, "aa:00", "hash-a")
+		ruleId := createAlertRule(t, store, a)
+
+		active, err := store.GetActiveAlert(ruleId, a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if active.ID != 0 {
+			t.Errorf("GetActiveAlert without alerts = %+v", active)
+		}
+
+		alert := &types.Alert{RuleId: ruleId, DeviceId: a, State: types.AlertPending, Value: 1600, StartedAt: t0}
+		if err := store.CreateAlert(alert); err != nil {
+			t.Fatal(err)
+		}
+		if alert.ID == 0 {
+			t.Fatal("CreateAlert did not set the id")
+		}
+
+		// a new value without a state change records no transition
+		alert.Value = 1650
+		if err := store.UpdateAlert(alert, false); err != nil {
+			t.Fatal(err)
+		}
+
+		firedAt := t0.Add(5 * time.Minute)
+		alert.State, alert.Value, alert.FiredAt = types.AlertFiring, 1700, &firedAt
+		if err := store.UpdateAlert(alert, true); err != nil {
+			t.Fatal(err)
+		}
+
+		active, err = store.GetActiveAlert(ruleId, a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if active.ID != alert.ID || active.State != types.AlertFiring || active.Value != 1700 || !active.StartedAt.Equal(t0) ||
+			active.FiredAt == nil || !active.FiredAt.Equal(firedAt) || active.ResolvedAt != nil {
+			t.Errorf("GetActiveAlert = %+v", active)
+		}
+
+		resolvedAt := t0.Add(20 * time.Minute)
+		alert.State, alert.Value, alert.ResolvedAt = types.AlertResolved, 1300, &resolvedAt
+		if err := store.UpdateAlert(alert, true); err != nil {
+			t.Fatal(err)
+		}
+
+		if active, err = store.GetActiveAlert(ruleId, a); err != nil {
+			t.Fatal(err)
+		}
+		if active.ID != 0 {
+			t.Errorf("GetActiveAlert after resolving = %+v", active)
+		}
+
+		transitions, err := store.GetAlertTransitions(types.AlertQuery{RuleId: ruleId, Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []struct {
+			state types.AlertState
+			value float64
+			at    time.Time
+		}{
+			{types.AlertResolved, 1300, resolvedAt},
+			{types.AlertFiring, 1700, firedAt},
+			{types.AlertPending, 1600, t0},
+		}
+		if len(transitions) != len(want) {
+			t.Fatalf("GetAlertTransitions = %+v, want %d transitions", transitions, len(want))
+		}
+		for i, transition := range transitions {
+			if transition.AlertId != alert.ID || transition.DeviceId != a || transition.State != want[i].state ||
+				transition.Value != want[i].value || !transition.At.Equal(want[i].at) {
+				t.Errorf("transition %d = %+v, want %+v", i, transition, want[i])
+			}
+		}
+	})
+
+	t.Run("query", func(t *testing.T) {
+		store, devices := newStores(t)
+		a := approveDevice(t, devices, "aa:00", "hash-a")
+		b := approveDevice(t, devices, "bb:00", "hash-b")
+		ruleId := createAlertRule(t, store, a)
+		otherRuleId := createAlertRule(t, store, b)
+
+		var ids []int
+		for _, alert := range []*types.Alert{
+			{RuleId: ruleId, DeviceId: a, State: types.AlertResolved, Value: 1, StartedAt: t0},
+			{RuleId: ruleId, DeviceId: a, State: types.AlertFiring, Value: 2, StartedAt: t0.Add(time.Hour)},
+			{RuleId: otherRuleId, DeviceId: b, State: types.AlertFiring, Value: 3, StartedAt: t0},
+			{RuleId: otherRuleId, DeviceId: a, State: types.AlertPending, Value: 4, StartedAt: t0},
+		} {
+			if err := store.CreateAlert(alert); err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, alert.ID)
+		}
+
+		for _, test := range []struct {
+			name  string
+			query types.AlertQuery
+			want  []int
+		}{
+			{"all", types.AlertQuery{Limit: 10}, []int{ids[3], ids[2], ids[1], ids[0]}},
+			{"limit", types.AlertQuery{Limit: 2}, []int{ids[3], ids[2]}},
+			{"state", types.AlertQuery{State: types.AlertFiring, Limit: 10}, []int{ids[2], ids[1]}},
+			{"rule", types.AlertQuery{RuleId: ruleId, Limit: 10}, []int{ids[1], ids[0]}},
+			{"device", types.AlertQuery{DeviceId: a, Limit: 10}, []int{ids[3], ids[1], ids[0]}},
+			{"rule and device", types.AlertQuery{RuleId: otherRuleId, DeviceId: a, Limit: 10}, []int{ids[3]}},
+		} {
+			alerts, err := store.GetAlerts(test.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []int
+			for _, alert := range alerts {
+				got = append(got, alert.ID)
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("%s: GetAlerts = %v, want %v", test.name, got, test.want)
+			}
+
+			transitions, err := store.GetAlertTransitions(test.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = nil
+			for _, transition := range transitions {
+				got = append(got, transition.AlertId)
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("%s: GetAlertTransitions = %v, want the transitions of %v", test.name, got, test.want)
+			}
+		}
+	})
+
+	t.Run("delete rule", func(t *testing.T) {
+		store, devices := newStores(t)
+		a := approveDevice(t, devices, "aa:00", "hash-a")
+		ruleId := createAlertRule(t, store, a)
+
+		alert := &types.Alert{RuleId: ruleId, DeviceId: a, State: types.AlertFiring, Value: 1600, StartedAt: t0}
+		if err := store.CreateAlert(alert); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.DeleteAlertRule(ruleId); err != nil {
+			t.Fatal(err)
+		}
+
+		alerts, err := store.GetAlerts(types.AlertQuery{Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		transitions, err := store.GetAlertTransitions(types.AlertQuery{Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(alerts) != 0 || len(transitions) != 0 {
+			t.Errorf("after deleting the rule: alerts %+v, transitions %+v", alerts, transitions)
+		}
+	})
+}
+
+// createAlertRule creates an enabled rule for the device and returns its id.
+func createAlertRule(t *testing.T, store types.AlertStore, deviceId int) int {
+	t.Helper()
+
+	id, err := store.CreateAlertRule(types.AlertRulePayload{Name: "co2 high", DeviceId: &deviceId, Metric: "carbondioxide",
+		Comparator: ">", Threshold: 1500})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return id
+}
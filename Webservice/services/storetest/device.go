@@ -0,0 +1,587 @@
+package storetest
+
+import (
+	"air-controller-webservice/types"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// t0 is the time the suites measure and see devices at. It is a whole second
+// within the range of a MariaDB TIMESTAMP.
+var t0 = time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+
+// RunDeviceStore checks a DeviceStore, newStore returns an empty store. The
+// decisions are made without a user, the suite does not create users.
+func RunDeviceStore(t *testing.T, newStore func(t *testing.T) types.DeviceStore) {
+	t.Run("request and approve", func(t *testing.T) {
+		store := newStore(t)
+
+		requestDevice(t, store, "aa:00")
+		if err := store.RequestDevice(types.RequestDevicePayload{MACAddress: "aa:00"}); err == nil {
+			t.Error("requesting a MAC address twice succeeded")
+		}
+
+		requested, err := store.GetRequestedDevices()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(requested) != 1 || requested[0].MACAddress != "aa:00" || !requested[0].Active {
+			t.Errorf("GetRequestedDevices = %+v", requested)
+		}
+
+		id := approveDevice(t, store, "aa:00", "hash-a")
+
+		device, err := store.GetDeviceById(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if device.ID != id || device.MACAddress != "aa:00" || device.Name != "aa:00 name" || device.Localization != "kitchen" {
+			t.Errorf("GetDeviceById(%d) = %+v", id, device)
+		}
+		if device.Online || device.LastSeenAt != nil || device.Heartbeat != nil {
+			t.Errorf("new device %+v was seen", device)
+		}
+		if device.CreatedAt.IsZero() {
+			t.Error("CreatedAt is not set")
+		}
+		expectDeviceId(t, "GetDeviceByMac", id)(store.GetDeviceByMac("aa:00"))
+		expectDeviceId(t, "GetDeviceByMac in upper case", id)(store.GetDeviceByMac("AA:00"))
+		expectDeviceId(t, "GetDeviceByKeyHash", id)(store.GetDeviceByKeyHash("hash-a"))
+
+		request, err := store.GetRequestedDevicesByMac("aa:00")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if request.ID != 0 {
+			t.Errorf("approved request %+v is left", request)
+		}
+
+		decisions, err := store.GetDeviceDecisions(types.DeviceDecisionQuery{Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(decisions) != 1 || decisions[0].MACAddress != "aa:00" || decisions[0].Decision != types.DecisionApproved ||
+			decisions[0].UserId != nil {
+			t.Errorf("GetDeviceDecisions = %+v", decisions)
+		}
+	})
+
+	t.Run("create device", func(t *testing.T) {
+		store := newStore(t)
+
+		payload := types.DevicePayload{MACAddress: "aa:00", Name: "a", Localization: "kitchen"}
+		if err := store.CreateDevice(payload); err == nil {
+			t.Error("CreateDevice without a request succeeded")
+		}
+
+		requestDevice(t, store, "aa:00")
+		if err := store.CreateDevice(payload); err != nil {
+			t.Fatal(err)
+		}
+
+		request, err := store.GetRequestedDevicesByMac("aa:00")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if request.ID == 0 || request.Active {
+			t.Errorf("request after CreateDevice = %+v", request)
+		}
+
+		devices, err := store.GetDevices()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(devices) != 1 || devices[0].MACAddress != "aa:00" {
+			t.Errorf("GetDevices = %+v", devices)
+		}
+	})
+
+	t.Run("unknown device", func(t *testing.T) {
+		store := newStore(t)
+
+		expectDeviceId(t, "GetDeviceById", 0)(store.GetDeviceById(42))
+		expectDeviceId(t, "GetDeviceByMac", 0)(store.GetDeviceByMac("aa:00"))
+		expectDeviceId(t, "GetDeviceByKeyHash", 0)(store.GetDeviceByKeyHash("hash-a"))
+
+		devices, err := store.GetDevices()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(devices) != 0 {
+			t.Errorf("GetDevices = %+v", devices)
+		}
+
+		request, err := store.GetRequestedDevicesByMac("aa:00")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if request.ID != 0 {
+			t.Errorf("GetRequestedDevicesByMac = %+v", request)
+		}
+	})
+
+	t.Run("approve per item", func(t *testing.T) {
+		store := newStore(t)
+
+		approveDevice(t, store, "dd:00", "hash-d")
+		for _, macAddress := range []string{"aa:00", "cc:00", "dd:00"} {
+			requestDevice(t, store, macAddress)
+		}
+		if err := store.DeclineRequestDevice("cc:00", 0); err != nil {
+			t.Fatal(err)
+		}
+
+		outcomes, err := store.ApproveDevices([]types.DeviceApproval{
+			{Device: types.DevicePayload{MACAddress: "aa:00"}, KeyHash: "hash-a"},
+			{Device: types.DevicePayload{MACAddress: "bb:00"}, KeyHash: "hash-b"},
+			{Device: types.DevicePayload{MACAddress: "cc:00"}, KeyHash: "hash-c"},
+			{Device: types.DevicePayload{MACAddress: "dd:00"}, KeyHash: "hash-d2"},
+		}, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectOutcomes(t, outcomes, 0, http.StatusNotFound, http.StatusConflict, http.StatusConflict)
+
+		expectDeviceId(t, "GetDeviceByMac", outcomes[0].DeviceId)(store.GetDeviceByMac("aa:00"))
+		expectDeviceId(t, "GetDeviceByKeyHash", outcomes[0].DeviceId)(store.GetDeviceByKeyHash("hash-a"))
+		expectDeviceId(t, "GetDeviceByKeyHash", 0)(store.GetDeviceByKeyHash("hash-c"))
+		expectDeviceId(t, "GetDeviceByKeyHash", 0)(store.GetDeviceByKeyHash("hash-d2"))
+
+		request, err := store.GetRequestedDevicesByMac("dd:00")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !request.Active {
+			t.Errorf("request of the existing device after the approval = %+v", request)
+		}
+
+		// requests are matched ignoring case, the device keeps their spelling
+		requestDevice(t, store, "ee:0a")
+		if outcomes, err = store.ApproveDevices([]types.DeviceApproval{
+			{Device: types.DevicePayload{MACAddress: "EE:0A"}, KeyHash: "hash-e"},
+		}, 0); err != nil {
+			t.Fatal(err)
+		}
+		expectOutcomes(t, outcomes, 0)
+		expectDeviceId(t, "GetDeviceByMac", outcomes[0].DeviceId)(store.GetDeviceByMac("ee:0a"))
+	})
+
+	t.Run("decline and reinstate", func(t *testing.T) {
+		store := newStore(t)
+
+		requestDevice(t, store, "aa:00")
+		requestDevice(t, store, "bb:00")
+		outcomes, err := store.DeclineRequestDevices([]string{"aa:00"}, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectOutcomes(t, outcomes, 0)
+
+		requested, err := store.GetRequestedDevices()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(requested) != 1 || requested[0].MACAddress != "bb:00" {
+			t.Errorf("GetRequestedDevices = %+v", requested)
+		}
+
+		declined, err := store.GetDeclinedDevices()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(declined) != 1 || declined[0].MACAddress != "aa:00" || declined[0].DecidedAt == nil || declined[0].DecidedBy != nil {
+			t.Errorf("GetDeclinedDevices = %+v", declined)
+		}
+
+		if err := store.ReinstateRequestDevice("aa:00", 0); err != nil {
+			t.Fatal(err)
+		}
+		request, err := store.GetRequestedDevicesByMac("aa:00")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !request.Active {
+			t.Errorf("reinstated request = %+v", request)
+		}
+
+		if outcomes, err = store.DeclineRequestDevices([]string{"aa:00", "cc:00"}, 0); err != nil {
+			t.Fatal(err)
+		}
+		expectOutcomes(t, outcomes, 0, http.StatusNotFound)
+		if outcomes, err = store.DeclineRequestDevices([]string{"aa:00"}, 0); err != nil {
+			t.Fatal(err)
+		}
+		expectOutcomes(t, outcomes, http.StatusConflict)
+
+		decisions, err := store.GetDeviceDecisions(types.DeviceDecisionQuery{MACAddress: "aa:00", Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(decisions) != 2 || decisions[0].Decision != types.DecisionDeclined || decisions[1].Decision != types.DecisionDeclined {
+			t.Errorf("GetDeviceDecisions = %+v", decisions)
+		}
+	})
+
+	t.Run("declined order", func(t *testing.T) {
+		store := newStore(t)
+
+		for _, macAddress := range []string{"aa:00", "bb:00"} {
+			requestDevice(t, store, macAddress)
+			// requests are matched ignoring case
+			if err := store.DeclineRequestDevice(strings.ToUpper(macAddress), 0); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		declined, err := store.GetDeclinedDevices()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(declined) != 2 || declined[0].MACAddress != "bb:00" || declined[1].MACAddress != "aa:00" {
+			t.Errorf("GetDeclinedDevices = %+v, want the latest decision first", declined)
+		}
+	})
+
+	t.Run("block", func(t *testing.T) {
+		store := newStore(t)
+
+		// blocked addresses and requests are matched ignoring case
+		requestDevice(t, store, "aa:00")
+		for _, macAddress := range []string{"AA:00", "bb:00"} {
+			if err := store.BlockDevice(types.BlockedDevicePayload{MACAddress: macAddress, Reason: "spam"}, 0); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := store.BlockDevice(types.BlockedDevicePayload{MACAddress: "AA:00"}, 0); err == nil {
+			t.Error("blocking a MAC address twice succeeded")
+		}
+
+		request, err := store.GetRequestedDevicesByMac("aa:00")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if request.ID != 0 {
+			t.Errorf("request of a blocked device = %+v", request)
+		}
+
+		blocked, err := store.GetBlockedDeviceByMac("aa:00")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if blocked.ID == 0 || blocked.Reason != "spam" || blocked.BlockedBy != nil || blocked.CreatedAt.IsZero() {
+			t.Errorf("GetBlockedDeviceByMac = %+v", blocked)
+		}
+
+		all, err := store.GetBlockedDevices()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(all) != 2 || all[0].MACAddress != "bb:00" || all[1].MACAddress != "AA:00" {
+			t.Errorf("GetBlockedDevices = %+v, want the newest first", all)
+		}
+
+		if err := store.UnblockDevice("aa:00"); err != nil {
+			t.Fatal(err)
+		}
+		if blocked, err = store.GetBlockedDeviceByMac("aa:00"); err != nil {
+			t.Fatal(err)
+		}
+		if blocked.ID != 0 {
+			t.Errorf("unblocked device = %+v", blocked)
+		}
+	})
+
+	t.Run("keys", func(t *testing.T) {
+		store := newStore(t)
+
+		a := approveDevice(t, store, "aa:00", "hash-a")
+		b := approveDevice(t, store, "bb:00", "hash-b")
+
+		if err := store.SetDeviceKey(a, "hash-c"); err != nil {
+			t.Fatal(err)
+		}
+		expectDeviceId(t, "GetDeviceByKeyHash of the replaced key", 0)(store.GetDeviceByKeyHash("hash-a"))
+		expectDeviceId(t, "GetDeviceByKeyHash", a)(store.GetDeviceByKeyHash("hash-c"))
+
+		if err := store.SetDeviceKey(b, "hash-c"); err == nil {
+			t.Error("SetDeviceKey with the key of another device succeeded")
+		}
+
+		if err := store.DeleteDeviceKey(a); err != nil {
+			t.Fatal(err)
+		}
+		expectDeviceId(t, "GetDeviceByKeyHash of the deleted key", 0)(store.GetDeviceByKeyHash("hash-c"))
+		expectDeviceId(t, "GetDeviceByKeyHash", b)(store.GetDeviceByKeyHash("hash-b"))
+	})
+
+	t.Run("seen and offline", func(t *testing.T) {
+		store := newStore(t)
+
+		id := approveDevice(t, store, "aa:00", "hash-a")
+
+		for _, seen := range []struct {
+			at         time.Time
+			cameOnline bool
+			lastSeenAt time.Time
+		}{
+			{t0, true, t0},
+			{t0.Add(time.Minute), false, t0.Add(time.Minute)},
+			{t0, false, t0.Add(time.Minute)},
+		} {
+			cameOnline, err := store.MarkDeviceSeen(id, seen.at)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cameOnline != seen.cameOnline {
+				t.Errorf("MarkDeviceSeen(%v) = %v, want %v", seen.at, cameOnline, seen.cameOnline)
+			}
+
+			device, err := store.GetDeviceById(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !device.Online || device.LastSeenAt == nil || !device.LastSeenAt.Equal(seen.lastSeenAt) {
+				t.Errorf("after MarkDeviceSeen(%v) the device is %+v, want seen at %v", seen.at, device, seen.lastSeenAt)
+			}
+		}
+
+		for _, check := range []struct {
+			silentSince time.Time
+			offline     int
+		}{
+			{t0.Add(time.Minute), 0},
+			{t0.Add(2 * time.Minute), 1},
+			{t0.Add(2 * time.Minute), 0},
+		} {
+			offline, err := store.MarkDevicesOffline(check.silentSince)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(offline) != check.offline {
+				t.Errorf("MarkDevicesOffline(%v) = %+v, want %d devices", check.silentSince, offline, check.offline)
+			}
+			for _, device := range offline {
+				if device.ID != id || device.Online {
+					t.Errorf("MarkDevicesOffline returned %+v", device)
+				}
+			}
+		}
+
+		device, err := store.GetDeviceById(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if device.Online {
+			t.Error("device is still online")
+		}
+	})
+
+	t.Run("heartbeat", func(t *testing.T) {
+		store := newStore(t)
+
+		id := approveDevice(t, store, "aa:00", "hash-a")
+		rssi, uptime, freeHeap := -60, int64(5000), 20000
+		for i, firmwareVersion := range []string{"1.0.0", "1.1.0"} {
+			at := t0.Add(time.Duration(i) * time.Minute)
+			if err := store.SaveHeartbeat(id, types.DeviceHeartbeatPayload{
+				Rssi: &rssi, Uptime: &uptime, FreeHeap: &freeHeap, FirmwareVersion: firmwareVersion,
+			}, at); err != nil {
+				t.Fatal(err)
+			}
+
+			device, err := store.GetDeviceById(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			heartbeat := device.Heartbeat
+			if heartbeat == nil || heartbeat.FirmwareVersion != firmwareVersion || !heartbeat.ReceivedAt.Equal(at) ||
+				heartbeat.Rssi == nil || *heartbeat.Rssi != rssi || heartbeat.Uptime == nil || *heartbeat.Uptime != uptime ||
+				heartbeat.FreeHeap == nil || *heartbeat.FreeHeap != freeHeap {
+				t.Errorf("heartbeat = %+v, want firmware %s received at %v", heartbeat, firmwareVersion, at)
+			}
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		store := newStore(t)
+
+		id := approveDevice(t, store, "aa:00", "hash-a")
+		name := "hallway sensor"
+		if err := store.UpdateDevice(id, types.DeviceUpdatePayload{Name: &name}); err != nil {
+			t.Fatal(err)
+		}
+
+		device, err := store.GetDeviceById(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if device.Name != name || device.Localization != "kitchen" {
+			t.Errorf("updated device = %+v", device)
+		}
+	})
+
+	t.Run("delete keeping readings", func(t *testing.T) {
+		store := newStore(t)
+
+		id := approveDevice(t, store, "aa:00", "hash-a")
+		if err := store.DeleteDevice(id, types.KeepReadings); err != nil {
+			t.Fatal(err)
+		}
+
+		expectDeviceId(t, "GetDeviceById", 0)(store.GetDeviceById(id))
+		expectDeviceId(t, "GetDeviceByMac", 0)(store.GetDeviceByMac("aa:00"))
+		expectDeviceId(t, "GetDeviceByKeyHash", 0)(store.GetDeviceByKeyHash("hash-a"))
+		devices, err := store.GetDevices()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(devices) != 0 {
+			t.Errorf("GetDevices = %+v", devices)
+		}
+
+		deleted, err := store.GetDeviceByIdIncludingDeleted(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if deleted.ID != id || deleted.MACAddress != "aa:00" || deleted.Online {
+			t.Errorf("GetDeviceByIdIncludingDeleted(%d) = %+v", id, deleted)
+		}
+
+		if again := approveDevice(t, store, "aa:00", "hash-a"); again == id {
+			t.Errorf("registering the MAC address again reused id %d", id)
+		}
+
+		// the readings kept can be archived later
+		if err := store.DeleteDevice(id, types.ArchiveReadings); err != nil {
+			t.Fatal(err)
+		}
+		expectDeviceId(t, "GetDeviceByIdIncludingDeleted", 0)(store.GetDeviceByIdIncludingDeleted(id))
+	})
+
+	for _, retention := range []types.ReadingRetention{types.ArchiveReadings, types.DeleteReadings} {
+		t.Run("delete with "+string(retention), func(t *testing.T) {
+			store := newStore(t)
+
+			id := approveDevice(t, store, "aa:00", "hash-a")
+			if err := store.DeleteDevice(id, retention); err != nil {
+				t.Fatal(err)
+			}
+
+			expectDeviceId(t, "GetDeviceById", 0)(store.GetDeviceById(id))
+			expectDeviceId(t, "GetDeviceByKeyHash", 0)(store.GetDeviceByKeyHash("hash-a"))
+		})
+	}
+
+	t.Run("decisions", func(t *testing.T) {
+		store := newStore(t)
+
+		for _, decision := range []types.DeviceDecisionPayload{
+			{MACAddress: "aa:00", Decision: types.DecisionBlocked, Reason: "spam"},
+			{MACAddress: "bb:00", Decision: types.DecisionDeclined},
+			{MACAddress: "aa:00", Decision: types.DecisionUnblocked},
+		} {
+			if err := store.CreateDeviceDecision(decision); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		for _, check := range []struct {
+			query     types.DeviceDecisionQuery
+			decisions []types.DeviceDecisionType
+		}{
+			{types.DeviceDecisionQuery{Limit: 10}, []types.DeviceDecisionType{types.DecisionUnblocked, types.DecisionDeclined, types.DecisionBlocked}},
+			{types.DeviceDecisionQuery{MACAddress: "aa:00", Limit: 10}, []types.DeviceDecisionType{types.DecisionUnblocked, types.DecisionBlocked}},
+			{types.DeviceDecisionQuery{Limit: 1}, []types.DeviceDecisionType{types.DecisionUnblocked}},
+			{types.DeviceDecisionQuery{Limit: 0}, []types.DeviceDecisionType{}},
+		} {
+			decisions, err := store.GetDeviceDecisions(check.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(decisions) != len(check.decisions) {
+				t.Errorf("GetDeviceDecisions(%+v) = %+v, want %v", check.query, decisions, check.decisions)
+				continue
+			}
+			for i, decision := range decisions {
+				if decision.Decision != check.decisions[i] {
+					t.Errorf("GetDeviceDecisions(%+v)[%d] = %+v, want %s", check.query, i, decision, check.decisions[i])
+				}
+			}
+		}
+
+		decisions, err := store.GetDeviceDecisions(types.DeviceDecisionQuery{MACAddress: "aa:00", Limit: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(decisions) != 1 || decisions[0].Reason != "" || decisions[0].UserId != nil || decisions[0].Username != nil {
+			t.Errorf("GetDeviceDecisions = %+v", decisions)
+		}
+	})
+}
+
+func requestDevice(t *testing.T, store types.DeviceStore, macAddress string) {
+	t.Helper()
+
+	if err := store.RequestDevice(types.RequestDevicePayload{MACAddress: macAddress}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// approveDevice registers a device through a request and its approval and
+// returns its id. The device is requested unless a request is pending.
+func approveDevice(t *testing.T, store types.DeviceStore, macAddress string, keyHash string) int {
+	t.Helper()
+
+	request, err := store.GetRequestedDevicesByMac(macAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !request.Active {
+		requestDevice(t, store, macAddress)
+	}
+
+	outcomes, err := store.ApproveDevices([]types.DeviceApproval{{
+		Device:  types.DevicePayload{MACAddress: macAddress, Name: macAddress + " name", Localization: "kitchen"},
+		KeyHash: keyHash,
+	}}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectOutcomes(t, outcomes, 0)
+
+	return outcomes[0].DeviceId
+}
+
+// expectOutcomes checks the status of every outcome of a bulk operation, 0
+// expects the item to be done.
+func expectOutcomes(t *testing.T, outcomes []types.DeviceBulkOutcome, statuses ...int) {
+	t.Helper()
+
+	if len(outcomes) != len(statuses) {
+		t.Fatalf("%d outcomes, want %d: %+v", len(outcomes), len(statuses), outcomes)
+	}
+	for i, outcome := range outcomes {
+		if outcome.Status != statuses[i] || (outcome.Err == nil) != (statuses[i] == 0) {
+			t.Errorf("outcome %d = %+v, want status %d", i, outcome, statuses[i])
+		}
+	}
+}
+
+// expectDeviceId returns a check of the result of a device lookup, an id of 0
+// expects no device.
+func expectDeviceId(t *testing.T, lookup string, id int) func(*types.Device, error) {
+	t.Helper()
+
+	return func(device *types.Device, err error) {
+		t.Helper()
+
+		if err != nil {
+			t.Fatalf("%s: %v", lookup, err)
+		}
+		if device.ID != id {
+			t.Errorf("%s = %+v, want id %d", lookup, device, id)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package storetest
+
+import (
+	"air-controller-webservice/types"
+	"slices"
+	"testing"
+)
+
+// RunEmailRecipientStore checks an EmailRecipientStore, newStores returns an
+// empty store and the device store its devices are registered in.
+func RunEmailRecipientStore(t *testing.T, newStores func(t *testing.T) (types.EmailRecipientStore, types.DeviceStore)) {
+	t.Run("recipients", func(t *testing.T) {
+		store, devices := newStores(t)
+		a := approveDevice(t, devices, "aa:00", "hash-a")
+
+		first, err := store.CreateEmailRecipient(types.EmailRecipientPayload{Email: "caretaker@example.com", Language: "de",
+			Events: []string{"alert.firing", "device.offline"}, DeviceId: &a})
+		if err != nil {
+			t.Fatal(err)
+		}
+		disabled := false
+		second, err := store.CreateEmailRecipient(types.EmailRecipientPayload{Email: "admin@example.com", Language: "en",
+			Events: []string{"device.requested"}, Enabled: &disabled})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if first == 0 || second == first {
+			t.Fatalf("CreateEmailRecipient returned ids %d and %d", first, second)
+		}
+
+		recipient, err := store.GetEmailRecipientById(first)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if recipient.ID != first || recipient.Email != "caretaker@example.com" || recipient.Language != "de" ||
+			!slices.Equal(recipient.Events, []string{"alert.firing", "device.offline"}) || recipient.DeviceId == nil ||
+			*recipient.DeviceId != a || !recipient.Enabled || recipient.CreatedAt.IsZero() {
+			t.Errorf("GetEmailRecipientById(%d) = %+v", first, recipient)
+		}
+
+		enabled := true
+		if err := store.UpdateEmailRecipient(second, types.EmailRecipientPayload{Email: "it@example.com", Language: "de",
+			Events: []string{"device.requested", "device.online"}, DeviceId: &a, Enabled: &enabled}); err != nil {
+			t.Fatal(err)
+		}
+
+		recipients, err := store.GetEmailRecipients()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(recipients) != 2 || recipients[0].ID != first || recipients[1].ID != second {
+			t.Fatalf("GetEmailRecipients = %+v, want recipients %d and %d", recipients, first, second)
+		}
+		if updated := recipients[1]; updated.Email != "it@example.com" || updated.Language != "de" ||
+			!slices.Equal(updated.Events, []string{"device.requested", "device.online"}) || updated.DeviceId == nil ||
+			*updated.DeviceId != a || !updated.Enabled {
+			t.Errorf("updated recipient = %+v", updated)
+		}
+
+		if err := store.DeleteEmailRecipient(first); err != nil {
+			t.Fatal(err)
+		}
+		if recipient, err = store.GetEmailRecipientById(first); err != nil {
+			t.Fatal(err)
+		}
+		if recipient.ID != 0 {
+			t.Errorf("GetEmailRecipientById of a deleted recipient = %+v", recipient)
+		}
+	})
+
+	t.Run("all devices", func(t *testing.T) {
+		store, _ := newStores(t)
+
+		id, err := store.CreateEmailRecipient(types.EmailRecipientPayload{Email: "admin@example.com", Language: "en",
+			Events: []string{"*"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		recipient, err := store.GetEmailRecipientById(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if recipient.DeviceId != nil || !slices.Equal(recipient.Events, []string{"*"}) {
+			t.Errorf("GetEmailRecipientById(%d) = %+v", id, recipient)
+		}
+	})
+}
@@ -0,0 +1,82 @@
+package storetest
+
+import (
+	"air-controller-webservice/types"
+	"testing"
+)
+
+// RunMetricStore checks a MetricStore, newStore returns a store holding only
+// the metrics added by the migrations.
+func RunMetricStore(t *testing.T, newStore func(t *testing.T) types.MetricStore) {
+	t.Run("builtin metrics", func(t *testing.T) {
+		store := newStore(t)
+
+		metrics, err := store.GetMetrics()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(metrics) == 0 || metrics[0].Name != "airQualityIndex" || !metrics[0].Builtin {
+			t.Fatalf("GetMetrics = %+v, want the builtin metrics first, by name", metrics)
+		}
+		for i := 1; i < len(metrics); i++ {
+			if metrics[i].Builtin && !metrics[i-1].Builtin {
+				t.Errorf("builtin metric %s listed after %s", metrics[i].Name, metrics[i-1].Name)
+			}
+		}
+
+		temperature, err := store.GetMetricByName("temperature")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if temperature.Unit != "°C" || temperature.Min == nil || *temperature.Min != -40 || temperature.Max == nil ||
+			*temperature.Max != 85 || temperature.Precision != 2 || !temperature.Builtin || temperature.CreatedAt.IsZero() {
+			t.Errorf("GetMetricByName(temperature) = %+v", temperature)
+		}
+	})
+
+	t.Run("create and get", func(t *testing.T) {
+		store := newStore(t)
+
+		max := 5000.0
+		if err := store.CreateMetric(types.MetricPayload{Name: "radon", Unit: "Bq/m³", Max: &max, Precision: 1}); err != nil {
+			t.Fatal(err)
+		}
+
+		radon, err := store.GetMetricByName("radon")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if radon.Name != "radon" || radon.Unit != "Bq/m³" || radon.Min != nil || radon.Max == nil || *radon.Max != max ||
+			radon.Precision != 1 || radon.Builtin {
+			t.Errorf("GetMetricByName(radon) = %+v", radon)
+		}
+
+		metrics, err := store.GetMetrics()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if last := metrics[len(metrics)-1]; last.Name != "radon" {
+			t.Errorf("GetMetrics ends with %s, want radon", last.Name)
+		}
+	})
+
+	t.Run("unknown metric", func(t *testing.T) {
+		store := newStore(t)
+
+		metric, err := store.GetMetricByName("radon")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if metric.Name != "" {
+			t.Errorf("GetMetricByName of an unknown metric = %+v", metric)
+		}
+	})
+
+	t.Run("duplicate name", func(t *testing.T) {
+		store := newStore(t)
+
+		if err := store.CreateMetric(types.MetricPayload{Name: "temperature", Unit: "K"}); err == nil {
+			t.Error("CreateMetric with a taken name succeeded")
+		}
+	})
+}
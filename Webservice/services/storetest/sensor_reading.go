@@ -0,0 +1,493 @@
+package storetest
+
+import (
+	"air-controller-webservice/types"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RunSensorReadingStore checks a SensorReadingStore, newStores returns an
+// empty store and the device store its devices are registered in. The values
+// are exactly representable as float32, so every backend returns them
+// unchanged.
+func RunSensorReadingStore(t *testing.T, newStores func(t *testing.T) (types.SensorReadingStore, types.DeviceStore)) {
+	t.Run("create and list", func(t *testing.T) {
+		store, devices := newStores(t)
+		a := approveDevice(t, devices, "aa:00", "hash-a")
+		b := approveDevice(t, devices, "bb:00", "hash-b")
+
+		iaqAccuracy, pressure := 3, float32(1013.25)
+		payload := reading(t0.Add(2 * time.Minute))
+		payload.BsecOutput = types.BsecOutput{IaqAccuracy: &iaqAccuracy, Pressure: &pressure}
+		payload.Metrics = map[string]float64{"pm25": 12.5}
+		created := createReading(t, store, payload, a)
+		if created.ID == 0 || created.DeviceId != a || created.Temperature != 21.5 || created.Humidity != 40 ||
+			created.Carbondioxide != 800 || created.AirQualityIndex != 50 || !created.MeasuredAt.Equal(payload.MeasuredAt.UTC()) {
+			t.Errorf("CreateSensorReading = %+v", created)
+		}
+		if created.IaqAccuracy == nil || *created.IaqAccuracy != 3 || created.Pressure == nil || *created.Pressure != pressure ||
+			created.StaticIaq != nil {
+			t.Errorf("BSEC output = %+v", created.BsecOutput)
+		}
+		if !reflect.DeepEqual(created.Metrics, payload.Metrics) {
+			t.Errorf("Metrics = %v, want %v", created.Metrics, payload.Metrics)
+		}
+		if created.CreatedAt.IsZero() {
+			t.Error("CreatedAt is not set")
+		}
+
+		createReading(t, store, reading(t0), a)
+		createReading(t, store, reading(t0.Add(time.Minute)), a)
+		createReading(t, store, reading(t0.Add(time.Minute)), b)
+
+		page, err := store.GetSensorReadingsByDevice(strconv.Itoa(a), types.SensorReadingQuery{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectMeasuredAt(t, page, t0, t0.Add(time.Minute), t0.Add(2*time.Minute))
+		if page.Next != nil {
+			t.Errorf("Next = %+v without a limit", page.Next)
+		}
+		if last := page.Readings[len(page.Readings)-1]; !reflect.DeepEqual(last.Metrics, payload.Metrics) {
+			t.Errorf("listed Metrics = %v, want %v", last.Metrics, payload.Metrics)
+		}
+
+		if page, err = store.GetSensorReadings(types.SensorReadingQuery{}); err != nil {
+			t.Fatal(err)
+		}
+		expectMeasuredAt(t, page, t0, t0.Add(time.Minute), t0.Add(time.Minute), t0.Add(2*time.Minute))
+
+		if page, err = store.GetSensorReadingsByDevice(strconv.Itoa(b+a), types.SensorReadingQuery{}); err != nil {
+			t.Fatal(err)
+		}
+		if page.Readings == nil || len(page.Readings) != 0 {
+			t.Errorf("readings of an unknown device = %+v", page.Readings)
+		}
+	})
+
+	t.Run("replay", func(t *testing.T) {
+		store, devices := newStores(t)
+		a := approveDevice(t, devices, "aa:00", "hash-a")
+		b := approveDevice(t, devices, "bb:00", "hash-b")
+
+		sequence := int64(7)
+		first := reading(t0)
+		first.Sequence = &sequence
+		first.IdempotencyKey = "key-1"
+		original := createReading(t, store, first, a)
+
+		for _, replay := range []struct {
+			name     string
+			sequence *int64
+			key      string
+		}{
+			{"sequence", &sequence, ""},
+			{"idempotency key", nil, "key-1"},
+			{"sequence before idempotency key", &sequence, "key-2"},
+		} {
+			payload := reading(t0.Add(time.Minute))
+			payload.Temperature = 30
+			payload.Sequence = replay.sequence
+			payload.IdempotencyKey = replay.key
+
+			result, err := store.CreateSensorReading(payload, a)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !result.Replayed || result.Reading.ID != original.ID || result.Reading.Temperature != original.Temperature {
+				t.Errorf("replay by %s = %+v, want %+v replayed", replay.name, result.Reading, original)
+			}
+		}
+
+		result, err := store.CreateSensorReading(first, b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Replayed {
+			t.Error("the sequence of another device was replayed")
+		}
+		if result.Reading.Sequence == nil || *result.Reading.Sequence != sequence ||
+			result.Reading.IdempotencyKey == nil || *result.Reading.IdempotencyKey != "key-1" {
+			t.Errorf("stored reading = %+v", result.Reading)
+		}
+
+		page, err := store.GetSensorReadingsByDevice(strconv.Itoa(a), types.SensorReadingQuery{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectMeasuredAt(t, page, t0)
+	})
+
+	t.Run("sequence reset", func(t *testing.T) {
+		store, devices := newStores(t)
+		a := approveDevice(t, devices, "aa:00", "hash-a")
+
+		sequence := int64(1)
+		first := reading(t0)
+		first.BootId = "boot-1"
+		first.Sequence = &sequence
+		original := createReading(t, store, first, a)
+
+		rebooted := reading(t0.Add(time.Minute))
+		rebooted.BootId = "boot-2"
+		rebooted.Sequence = &sequence
+		result, err := store.CreateSensorReading(rebooted, a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Replayed || result.Reading.BootId != "boot-2" {
+			t.Errorf("reading after a reboot = %+v, replayed %v", result.Reading, result.Replayed)
+		}
+
+		replay := reading(t0.Add(2 * time.Minute))
+		replay.BootId = "boot-1"
+		replay.Sequence = &sequence
+		if result, err = store.CreateSensorReading(replay, a); err != nil {
+			t.Fatal(err)
+		}
+		if !result.Replayed || result.Reading.ID != original.ID {
+			t.Errorf("replay of the first boot = %+v, want %+v replayed", result.Reading, original)
+		}
+
+		page, err := store.GetSensorReadingsByDevice(strconv.Itoa(a), types.SensorReadingQuery{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectMeasuredAt(t, page, t0, t0.Add(time.Minute))
+	})
+
+	t.Run("batch", func(t *testing.T) {
+		store, devices := newStores(t)
+		a := approveDevice(t, devices, "aa:00", "hash-a")
+		b := approveDevice(t, devices, "bb:00", "hash-b")
+
+		sequence := int64(1)
+		payload := reading(t0)
+		payload.Sequence = &sequence
+		results, err := store.CreateSensorReadings([]types.SensorReadingBatchItem{
+			{DeviceId: a, Payload: payload},
+			{DeviceId: b, Payload: payload},
+			{DeviceId: a, Payload: payload},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(results) != 3 {
+			t.Fatalf("CreateSensorReadings returned %d results", len(results))
+		}
+		if results[0].Replayed || results[1].Replayed || !results[2].Replayed {
+			t.Errorf("replayed = %v, %v, %v, want only the last", results[0].Replayed, results[1].Replayed, results[2].Replayed)
+		}
+		if results[0].Reading.DeviceId != a || results[1].Reading.DeviceId != b || results[2].Reading.ID != results[0].Reading.ID {
+			t.Errorf("results = %+v, %+v, %+v", results[0].Reading, results[1].Reading, results[2].Reading)
+		}
+	})
+
+	t.Run("paging", func(t *testing.T) {
+		store, devices := newStores(t)
+		a := approveDevice(t, devices, "aa:00", "hash-a")
+
+		measuredAt := []time.Time{t0, t0.Add(time.Minute), t0.Add(time.Minute), t0.Add(2 * time.Minute), t0.Add(3 * time.Minute)}
+		for _, at := range measuredAt {
+			createReading(t, store, reading(at), a)
+		}
+
+		all, err := store.GetSensorReadingsByDevice(strconv.Itoa(a), types.SensorReadingQuery{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectMeasuredAt(t, all, measuredAt...)
+		if all.Readings[1].ID > all.Readings[2].ID {
+			t.Errorf("readings measured at the same time are not in id order")
+		}
+
+		query := types.SensorReadingQuery{Limit: 2}
+		var paged []*types.SensorReading
+		for pages := 1; ; pages++ {
+			page, err := store.GetSensorReadingsByDevice(strconv.Itoa(a), query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			paged = append(paged, page.Readings...)
+			if page.Next == nil {
+				if pages != 3 {
+					t.Errorf("got %d pages, want 3", pages)
+				}
+				break
+			}
+			if pages == 3 {
+				t.Fatal("the last page has a cursor")
+			}
+			query.After = page.Next
+		}
+		if len(paged) != len(all.Readings) {
+			t.Fatalf("paged through %d readings, want %d", len(paged), len(all.Readings))
+		}
+		for i := range paged {
+			if paged[i].ID != all.Readings[i].ID {
+				t.Errorf("reading %d of the pages is %d, want %d", i, paged[i].ID, all.Readings[i].ID)
+			}
+		}
+
+		page, err := store.GetSensorReadingsByDevice(strconv.Itoa(a), types.SensorReadingQuery{
+			From: t0.Add(time.Minute),
+			To:   t0.Add(3 * time.Minute),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectMeasuredAt(t, page, t0.Add(time.Minute), t0.Add(time.Minute), t0.Add(2*time.Minute))
+	})
+
+	t.Run("metrics of a large page", func(t *testing.T) {
+		store, devices := newStores(t)
+		a := approveDevice(t, devices, "aa:00", "hash-a")
+
+		// more readings than the SQL stores look up in one query
+		var items []types.SensorReadingBatchItem
+		for i := range 2500 {
+			payload := reading(t0.Add(time.Duration(i) * time.Second))
+			payload.Metrics = map[string]float64{"pm25": float64(i)}
+			items = append(items, types.SensorReadingBatchItem{DeviceId: a, Payload: payload})
+		}
+		if _, err := store.CreateSensorReadings(items); err != nil {
+			t.Fatal(err)
+		}
+
+		page, err := store.GetSensorReadingsByDevice(strconv.Itoa(a), types.SensorReadingQuery{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Readings) != len(items) {
+			t.Fatalf("got %d readings, want %d", len(page.Readings), len(items))
+		}
+		for i, reading := range page.Readings {
+			if reading.Metrics["pm25"] != float64(i) {
+				t.Fatalf("reading %d has metrics %v, want pm25 %d", i, reading.Metrics, i)
+			}
+		}
+	})
+
+	t.Run("iaq accuracy", func(t *testing.T) {
+		store, devices := newStores(t)
+		a := approveDevice(t, devices, "aa:00", "hash-a")
+
+		for i, accuracy := range []*int{nil, intPointer(1), intPointer(3)} {
+			payload := reading(t0.Add(time.Duration(i) * time.Minute))
+			payload.IaqAccuracy = accuracy
+			createReading(t, store, payload, a)
+		}
+
+		page, err := store.GetSensorReadingsByDevice(strconv.Itoa(a), types.SensorReadingQuery{MinIaqAccuracy: intPointer(3)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectMeasuredAt(t, page, t0.Add(2*time.Minute))
+
+		aggregates, err := store.GetSensorReadingAggregates(strconv.Itoa(a), types.SensorReadingAggregateQuery{
+			Bucket:         time.Hour,
+			MinIaqAccuracy: intPointer(1),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(aggregates) != 1 || aggregates[0].Count != 2 {
+			t.Errorf("aggregates of accurate readings = %+v", aggregates)
+		}
+	})
+
+	t.Run("aggregates", func(t *testing.T) {
+		store, devices := newStores(t)
+		a := approveDevice(t, devices, "aa:00", "hash-a")
+		b := approveDevice(t, devices, "bb:00", "hash-b")
+
+		for _, r := range []struct {
+			deviceId    int
+			at          time.Time
+			temperature float32
+			aqi         float32
+		}{
+			{a, t0, 20, 50},
+			{a, t0.Add(10 * time.Minute), 22, 100},
+			{a, t0.Add(time.Hour), 18, 25},
+			{a, t0.Add(2 * time.Hour), 30, 30},
+			{b, t0, 40, 40},
+		} {
+			payload := reading(r.at)
+			payload.Temperature = r.temperature
+			payload.AirQualityIndex = r.aqi
+			createReading(t, store, payload, r.deviceId)
+		}
+
+		aggregates, err := store.GetSensorReadingAggregates(strconv.Itoa(a), types.SensorReadingAggregateQuery{
+			Bucket: time.Hour,
+			From:   t0,
+			To:     t0.Add(2 * time.Hour),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(aggregates) != 2 {
+			t.Fatalf("GetSensorReadingAggregates returned %d buckets, want 2", len(aggregates))
+		}
+
+		hour := t0.Truncate(time.Hour)
+		for i, want := range []struct {
+			bucketStart   time.Time
+			count         int
+			temperature   [3]float64
+			airQuality    [3]float64
+			carbondioxide [3]float64
+		}{
+			{hour, 2, [3]float64{21, 20, 22}, [3]float64{75, 50, 100}, [3]float64{800, 800, 800}},
+			{hour.Add(time.Hour), 1, [3]float64{18, 18, 18}, [3]float64{25, 25, 25}, [3]float64{800, 800, 800}},
+		} {
+			aggregate := aggregates[i]
+			if !aggregate.BucketStart.Equal(want.bucketStart) || aggregate.Count != want.count {
+				t.Errorf("bucket %d starts at %v with %d readings, want %v with %d", i, aggregate.BucketStart, aggregate.Count,
+					want.bucketStart, want.count)
+			}
+			expectStats(t, "temperature", aggregate.Temperature, want.temperature)
+			expectStats(t, "airQualityIndex", aggregate.AirQualityIndex, want.airQuality)
+			expectStats(t, "carbondioxide", aggregate.Carbondioxide, want.carbondioxide)
+		}
+
+		if aggregates, err = store.GetSensorReadingAggregates(strconv.Itoa(b+a), types.SensorReadingAggregateQuery{Bucket: time.Hour}); err != nil {
+			t.Fatal(err)
+		}
+		if aggregates == nil || len(aggregates) != 0 {
+			t.Errorf("aggregates of an unknown device = %+v", aggregates)
+		}
+	})
+
+	t.Run("rejected readings", func(t *testing.T) {
+		store, devices := newStores(t)
+		a := approveDevice(t, devices, "aa:00", "hash-a")
+		b := approveDevice(t, devices, "bb:00", "hash-b")
+
+		fields := []types.FieldError{{Field: "temperature", Message: "must be at most 100"}}
+		for _, rejected := range []types.RejectedReading{
+			{DeviceId: a, Status: 422, Error: "implausible values", Fields: fields, Payload: json.RawMessage(`{"temperature": 500}`)},
+			{DeviceId: b, Status: 400, Error: "invalid JSON", Payload: json.RawMessage(`{"temperature": "hot"}`)},
+			{DeviceId: a, Status: 400, Error: "invalid JSON", Payload: json.RawMessage(`{"humidity": "wet"}`)},
+		} {
+			if err := store.CreateRejectedReading(rejected); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		all, err := store.GetRejectedReadings(types.RejectedReadingQuery{Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(all) != 3 || all[0].DeviceId != a || all[1].DeviceId != b || all[2].DeviceId != a || all[0].ID < all[1].ID {
+			t.Fatalf("GetRejectedReadings = %+v, want the newest first", all)
+		}
+		first := all[2]
+		if first.Status != 422 || first.Error != "implausible values" || !reflect.DeepEqual(first.Fields, fields) ||
+			first.CreatedAt.IsZero() {
+			t.Errorf("rejected reading = %+v", first)
+		}
+		expectJSON(t, first.Payload, `{"temperature": 500}`)
+		if all[0].Fields != nil {
+			t.Errorf("Fields = %v, want none", all[0].Fields)
+		}
+
+		ofDevice, err := store.GetRejectedReadings(types.RejectedReadingQuery{DeviceId: a, Limit: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ofDevice) != 1 || ofDevice[0].ID != all[0].ID {
+			t.Errorf("newest rejected reading of device %d = %+v", a, ofDevice)
+		}
+
+		long := strings.Repeat("ü", 300)
+		if err := store.CreateRejectedReading(types.RejectedReading{DeviceId: a, Status: 400, Error: long,
+			Payload: json.RawMessage(`{}`)}); err != nil {
+			t.Fatal(err)
+		}
+		if ofDevice, err = store.GetRejectedReadings(types.RejectedReadingQuery{DeviceId: a, Limit: 1}); err != nil {
+			t.Fatal(err)
+		}
+		if len(ofDevice) != 1 || ofDevice[0].Error != long[:2*255] {
+			t.Errorf("rejected reading with a long error = %+v, want the error cut off after 255 characters", ofDevice)
+		}
+	})
+}
+
+// reading returns a payload measured at the given time.
+func reading(measuredAt time.Time) types.SensorReadingPayload {
+	return types.SensorReadingPayload{
+		Temperature:     21.5,
+		AirQualityIndex: 50,
+		Humidity:        40,
+		Carbondioxide:   800,
+		MeasuredAt:      &measuredAt,
+	}
+}
+
+func createReading(t *testing.T, store types.SensorReadingStore, payload types.SensorReadingPayload, deviceId int) *types.SensorReading {
+	t.Helper()
+
+	result, err := store.CreateSensorReading(payload, deviceId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Replayed {
+		t.Fatalf("reading %+v was replayed", payload)
+	}
+
+	return result.Reading
+}
+
+func expectMeasuredAt(t *testing.T, page *types.SensorReadingPage, measuredAt ...time.Time) {
+	t.Helper()
+
+	if len(page.Readings) != len(measuredAt) {
+		t.Fatalf("got %d readings, want %d", len(page.Readings), len(measuredAt))
+	}
+	for i, reading := range page.Readings {
+		if !reading.MeasuredAt.Equal(measuredAt[i]) {
+			t.Errorf("reading %d was measured at %v, want %v", i, reading.MeasuredAt, measuredAt[i])
+		}
+	}
+}
+
+// expectStats compares the average, minimum and maximum of a metric.
+func expectStats(t *testing.T, metric string, stats types.AggregateStats, want [3]float64) {
+	t.Helper()
+
+	for i, name := range []string{"avg", "min", "max"} {
+		value := []*float64{stats.Avg, stats.Min, stats.Max}[i]
+		if value == nil {
+			t.Errorf("%s %s is nil, want %v", metric, name, want[i])
+		} else if *value != want[i] {
+			t.Errorf("%s %s = %v, want %v", metric, name, *value, want[i])
+		}
+	}
+}
+
+// expectJSON compares JSON semantically, PostgreSQL normalizes JSONB.
+func expectJSON(t *testing.T, got json.RawMessage, want string) {
+	t.Helper()
+
+	var gotValue, wantValue any
+	if err := json.Unmarshal(got, &gotValue); err != nil {
+		t.Fatalf("invalid JSON %s: %v", got, err)
+	}
+	if err := json.Unmarshal([]byte(want), &wantValue); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotValue, wantValue) {
+		t.Errorf("JSON = %s, want %s", got, want)
+	}
+}
+
+func intPointer(i int) *int {
+	return &i
+}
@@ -0,0 +1,80 @@
+package storetest
+
+import (
+	"air-controller-webservice/types"
+	"testing"
+)
+
+// RunUserStore checks a UserStore, newStore returns an empty store.
+func RunUserStore(t *testing.T, newStore func(t *testing.T) types.UserStore) {
+	t.Run("create and get", func(t *testing.T) {
+		store := newStore(t)
+
+		if err := store.CreateUser(types.User{Username: "alice", Password: "hash"}); err != nil {
+			t.Fatal(err)
+		}
+
+		user, err := store.GetUserByUsername("alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.ID == 0 || user.Username != "alice" || user.Password != "hash" {
+			t.Errorf("GetUserByUsername = %+v", user)
+		}
+		if user.CreatedAt.IsZero() {
+			t.Error("CreatedAt is not set")
+		}
+
+		byId, err := store.GetUserByID(user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if byId.Username != "alice" {
+			t.Errorf("GetUserByID(%d) = %+v", user.ID, byId)
+		}
+	})
+
+	t.Run("unknown user", func(t *testing.T) {
+		store := newStore(t)
+
+		if _, err := store.GetUserByUsername("nobody"); err == nil {
+			t.Error("GetUserByUsername of an unknown user succeeded")
+		}
+		if _, err := store.GetUserByID(42); err == nil {
+			t.Error("GetUserByID of an unknown user succeeded")
+		}
+	})
+
+	t.Run("duplicate username", func(t *testing.T) {
+		store := newStore(t)
+
+		if err := store.CreateUser(types.User{Username: "alice", Password: "hash"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.CreateUser(types.User{Username: "alice", Password: "other"}); err == nil {
+			t.Error("CreateUser with a taken username succeeded")
+		}
+	})
+
+	t.Run("ids", func(t *testing.T) {
+		store := newStore(t)
+
+		for _, username := range []string{"alice", "bob"} {
+			if err := store.CreateUser(types.User{Username: username, Password: "hash"}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		alice, err := store.GetUserByUsername("alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		bob, err := store.GetUserByUsername("bob")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if alice.ID == bob.ID {
+			t.Errorf("both users have id %d", alice.ID)
+		}
+	})
+}
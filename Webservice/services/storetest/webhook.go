@@ -0,0 +1,183 @@
+package storetest
+
+import (
+	"air-controller-webservice/types"
+	"slices"
+	"testing"
+	"time"
+)
+
+// RunWebhookStore checks a WebhookStore, newStore returns an empty store.
+func RunWebhookStore(t *testing.T, newStore func(t *testing.T) types.WebhookStore) {
+	t.Run("webhooks", func(t *testing.T) {
+		store := newStore(t)
+
+		first, err := store.CreateWebhook(types.WebhookPayload{Name: "chat", URL: "https://chat.example.com/hook", Format: "slack",
+			Events: []string{"alert.firing", "alert.resolved"}}, "secret-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		disabled := false
+		second, err := store.CreateWebhook(types.WebhookPayload{Name: "all", URL: "https://example.com/hook", Format: "json",
+			Events: []string{"*"}, Enabled: &disabled}, "secret-2")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if first == 0 || second == first {
+			t.Fatalf("CreateWebhook returned ids %d and %d", first, second)
+		}
+
+		webhook, err := store.GetWebhookById(first)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if webhook.ID != first || webhook.Name != "chat" || webhook.URL != "https://chat.example.com/hook" || webhook.Format != "slack" ||
+			!slices.Equal(webhook.Events, []string{"alert.firing", "alert.resolved"}) || !webhook.Enabled ||
+			webhook.Secret != "secret-1" || webhook.CreatedAt.IsZero() {
+			t.Errorf("GetWebhookById(%d) = %+v", first, webhook)
+		}
+
+		enabled := true
+		if err := store.UpdateWebhook(second, types.WebhookPayload{Name: "devices", URL: "https://example.com/devices", Format: "json",
+			Events: []string{"device.offline"}, Enabled: &enabled}); err != nil {
+			t.Fatal(err)
+		}
+
+		webhooks, err := store.GetWebhooks()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(webhooks) != 2 || webhooks[0].ID != first || webhooks[1].ID != second {
+			t.Fatalf("GetWebhooks = %+v, want webhooks %d and %d", webhooks, first, second)
+		}
+		if updated := webhooks[1]; updated.Name != "devices" || updated.URL != "https://example.com/devices" ||
+			!slices.Equal(updated.Events, []string{"device.offline"}) || !updated.Enabled || updated.Secret != "secret-2" {
+			t.Errorf("updated webhook = %+v", updated)
+		}
+
+		if err := store.DeleteWebhook(first); err != nil {
+			t.Fatal(err)
+		}
+		if webhook, err = store.GetWebhookById(first); err != nil {
+			t.Fatal(err)
+		}
+		if webhook.ID != 0 {
+			t.Errorf("GetWebhookById of a deleted webhook = %+v", webhook)
+		}
+	})
+
+	t.Run("deliveries", func(t *testing.T) {
+		store := newStore(t)
+		webhookId := createWebhook(t, store)
+		otherId := createWebhook(t, store)
+
+		due, later := t0, t0.Add(time.Hour)
+		var deliveries []*types.WebhookDelivery
+		for _, delivery := range []*types.WebhookDelivery{
+			{WebhookId: webhookId, Event: "alert.firing", Body: []byte(`{"value": 1600, "device": {"id": 1}}`), NextAttemptAt: &due},
+			{WebhookId: webhookId, Event: "alert.resolved", Body: []byte(`{"value": 900}`), NextAttemptAt: &later},
+			{WebhookId: otherId, Event: "device.offline", Body: []byte(`{}`), NextAttemptAt: &later},
+		} {
+			delivery.Status = types.DeliveryPending
+			if err := store.CreateDelivery(delivery); err != nil {
+				t.Fatal(err)
+			}
+			if delivery.ID == 0 {
+				t.Fatal("CreateDelivery did not set the id")
+			}
+			deliveries = append(deliveries, delivery)
+		}
+
+		ids, err := store.GetDueWebhookIds(t0.Add(-time.Second))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ids) != 0 {
+			t.Errorf("GetDueWebhookIds before the first attempt = %v", ids)
+		}
+		if ids, err = store.GetDueWebhookIds(later); err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(ids, []int{webhookId, otherId}) {
+			t.Errorf("GetDueWebhookIds = %v, want %v", ids, []int{webhookId, otherId})
+		}
+
+		dueDeliveries, err := store.GetDueDeliveries(webhookId, t0, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(dueDeliveries) != 1 || dueDeliveries[0].ID != deliveries[0].ID {
+			t.Fatalf("GetDueDeliveries = %+v, want delivery %d", dueDeliveries, deliveries[0].ID)
+		}
+		first := dueDeliveries[0]
+		if first.Event != "alert.firing" || first.Status != types.DeliveryPending || first.Attempts != 0 ||
+			first.NextAttemptAt == nil || !first.NextAttemptAt.Equal(due) || first.ResponseStatus != nil ||
+			first.DeliveredAt != nil || first.CreatedAt.IsZero() {
+			t.Errorf("due delivery = %+v", first)
+		}
+		expectJSON(t, first.Body, `{"value": 1600, "device": {"id": 1}}`)
+
+		leasedUntil := t0.Add(time.Minute)
+		if claimed, err := store.ClaimDelivery(first, t0, leasedUntil); err != nil || !claimed {
+			t.Fatalf("ClaimDelivery = %v, %v, want claimed", claimed, err)
+		}
+		if claimed, err := store.ClaimDelivery(first, t0, leasedUntil); err != nil || claimed {
+			t.Errorf("ClaimDelivery of a leased delivery = %v, %v, want not claimed", claimed, err)
+		}
+		if dueDeliveries, err = store.GetDueDeliveries(webhookId, t0, 10); err != nil {
+			t.Fatal(err)
+		}
+		if len(dueDeliveries) != 0 {
+			t.Errorf("GetDueDeliveries during the lease = %+v", dueDeliveries)
+		}
+
+		deliveredAt, status := t0.Add(10*time.Second), 204
+		first.Status, first.Attempts, first.NextAttemptAt = types.DeliveryDelivered, 1, nil
+		first.ResponseStatus, first.DeliveredAt = &status, &deliveredAt
+		if err := store.UpdateDelivery(first); err != nil {
+			t.Fatal(err)
+		}
+
+		log, err := store.GetDeliveries(webhookId, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(log) != 2 || log[0].ID != deliveries[1].ID || log[1].ID != deliveries[0].ID {
+			t.Fatalf("GetDeliveries = %+v, want the newest first", log)
+		}
+		if delivered := log[1]; delivered.Status != types.DeliveryDelivered || delivered.Attempts != 1 ||
+			delivered.NextAttemptAt != nil || delivered.ResponseStatus == nil || *delivered.ResponseStatus != 204 ||
+			delivered.DeliveredAt == nil || !delivered.DeliveredAt.Equal(deliveredAt) {
+			t.Errorf("delivered = %+v", delivered)
+		}
+		if log, err = store.GetDeliveries(webhookId, 1); err != nil {
+			t.Fatal(err)
+		}
+		if len(log) != 1 || log[0].ID != deliveries[1].ID {
+			t.Errorf("GetDeliveries with limit 1 = %+v", log)
+		}
+
+		if err := store.DeleteWebhook(webhookId); err != nil {
+			t.Fatal(err)
+		}
+		if log, err = store.GetDeliveries(webhookId, 10); err != nil {
+			t.Fatal(err)
+		}
+		if len(log) != 0 {
+			t.Errorf("GetDeliveries of a deleted webhook = %+v", log)
+		}
+	})
+}
+
+// createWebhook creates an enabled webhook for all events and returns its id.
+func createWebhook(t *testing.T, store types.WebhookStore) int {
+	t.Helper()
+
+	id, err := store.CreateWebhook(types.WebhookPayload{Name: "all", URL: "https://example.com/hook", Format: "json",
+		Events: []string{"*"}}, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return id
+}
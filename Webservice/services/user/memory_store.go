@@ -0,0 +1,65 @@
+package user
+
+import (
+	"air-controller-webservice/types"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps users in memory. It behaves like Store and is meant for
+// tests, nothing survives the process.
+type MemoryStore struct {
+	mu    sync.Mutex
+	users []types.User
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+func (s *MemoryStore) GetUserByUsername(username string) (*types.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, u := range s.users {
+		if u.Username == username {
+			return &u, nil
+		}
+	}
+
+	return nil, fmt.Errorf("user not found")
+}
+
+func (s *MemoryStore) GetUserByID(id int) (*types.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, u := range s.users {
+		if u.ID == id {
+			return &u, nil
+		}
+	}
+
+	return nil, fmt.Errorf("user not found")
+}
+
+func (s *MemoryStore) CreateUser(user types.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, u := range s.users {
+		if u.Username == user.Username {
+			return fmt.Errorf("username %s already exists", user.Username)
+		}
+	}
+
+	s.users = append(s.users, types.User{
+		ID:        len(s.users) + 1,
+		Username:  user.Username,
+		Password:  user.Password,
+		CreatedAt: time.Now().UTC(),
+	})
+
+	return nil
+}
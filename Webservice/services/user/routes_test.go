@@ -0,0 +1,61 @@
+package user_test
+
+import (
+	"air-controller-webservice/services/user"
+	"air-controller-webservice/types"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestRegisterAndLogin(t *testing.T) {
+	router := mux.NewRouter()
+	user.NewHandler(user.NewMemoryStore()).RegisterRoutes(router)
+
+	credentials := types.RegisterUserPayload{Username: "alice", Password: "secret"}
+	for _, step := range []struct {
+		path    string
+		payload any
+		status  int
+	}{
+		{"/register", credentials, http.StatusCreated},
+		{"/register", credentials, http.StatusConflict},
+		{"/login", types.LoginUserPayload{Username: "alice", Password: "wrong"}, http.StatusBadRequest},
+		{"/login", types.LoginUserPayload{Username: "bob", Password: "secret"}, http.StatusBadRequest},
+		{"/login", types.LoginUserPayload(credentials), http.StatusOK},
+	} {
+		rr := post(t, router, step.path, step.payload)
+		if rr.Code != step.status {
+			t.Fatalf("POST %s %+v = %d %s, want %d", step.path, step.payload, rr.Code, rr.Body, step.status)
+		}
+		if rr.Code != http.StatusOK {
+			continue
+		}
+
+		var token types.LoginToken
+		if err := json.NewDecoder(rr.Body).Decode(&token); err != nil {
+			t.Fatal(err)
+		}
+		if token.Token == "" {
+			t.Error("login returned no token")
+		}
+	}
+}
+
+func post(t *testing.T, handler http.Handler, path string, payload any) *httptest.ResponseRecorder {
+	t.Helper()
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body)))
+
+	return rr
+}
@@ -62,8 +62,6 @@ func (s *Store) CreateUser(user types.User) error {
 		return err
 	}
 
-	fmt.Println("inserted")
-
 	return nil
 }
 
@@ -0,0 +1,24 @@
+package user_test
+
+import (
+	"air-controller-webservice/services/storetest"
+	"air-controller-webservice/services/user"
+	"air-controller-webservice/types"
+	"testing"
+)
+
+func TestMemoryStore(t *testing.T) {
+	storetest.RunUserStore(t, func(t *testing.T) types.UserStore {
+		return user.NewMemoryStore()
+	})
+}
+
+func TestStore(t *testing.T) {
+	for _, backend := range storetest.Backends() {
+		t.Run(backend.Name, func(t *testing.T) {
+			storetest.RunUserStore(t, func(t *testing.T) types.UserStore {
+				return user.NewStore(backend.Open(t))
+			})
+		})
+	}
+}
@@ -0,0 +1,294 @@
+package webhook
+
+import (
+	"air-controller-webservice/services/events"
+	"air-controller-webservice/types"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	maxAttempts    = 8
+	firstBackoff   = 30 * time.Second
+	maxBackoff     = time.Hour
+	pollInterval   = 5 * time.Second
+	batchSize      = 100
+	requestTimeout = 10 * time.Second
+
+	// lease keeps a delivery being sent from other instances, it has to
+	// outlast the request.
+	lease = time.Minute
+
+	// maxErrorLength is the size of webhook_deliveries.error
+	maxErrorLength = 1024
+)
+
+// Dispatcher queues a delivery for every webhook subscribed to an event and
+// sends the queue in the background. Failed deliveries are retried with
+// exponential backoff until maxAttempts is reached.
+type Dispatcher struct {
+	store  types.WebhookStore
+	client *http.Client
+	wake   chan struct{}
+
+	// sending holds the ids of the webhooks whose deliveries are being sent,
+	// a webhook is sent to by one goroutine at a time.
+	mu      sync.Mutex
+	sending map[int]bool
+	senders sync.WaitGroup
+}
+
+func NewDispatcher(store types.WebhookStore) *Dispatcher {
+	return &Dispatcher{
+		store:   store,
+		client:  &http.Client{Timeout: requestTimeout},
+		wake:    make(chan struct{}, 1),
+		sending: map[int]bool{},
+	}
+}
+
+// Start queues the events published from now on. The deliveries are created
+// in the background, so the publisher does not wait for the database.
+func (d *Dispatcher) Start(broker *events.Broker) {
+	broker.HandleAsync(func(event events.Event) bool {
+		return slices.Contains(webhookEvents, event.Type)
+	}, func(event events.Event) {
+		if err := d.enqueue(event); err != nil {
+			log.Println("webhook: could not queue", event.Type, err)
+		}
+	})
+}
+
+func (d *Dispatcher) enqueue(event events.Event) error {
+	webhooks, err := d.store.GetWebhooks()
+	if err != nil {
+		return err
+	}
+
+	queued := false
+	for _, webhook := range webhooks {
+		if !webhook.Enabled || !(slices.Contains(webhook.Events, "*") || slices.Contains(webhook.Events, event.Type)) {
+			continue
+		}
+
+		delivery, err := newDelivery(webhook, event)
+		if err != nil {
+			return err
+		}
+		if err := d.store.CreateDelivery(delivery); err != nil {
+			return err
+		}
+		queued = true
+	}
+
+	if queued {
+		select {
+		case d.wake <- struct{}{}:
+		default:
+		}
+	}
+
+	return nil
+}
+
+// Run sends due deliveries until ctx is done.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := d.SendDue(); err != nil {
+			log.Println("webhook:", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			d.Wait()
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+// SendDue starts sending the due deliveries in the background, one goroutine
+// per webhook, so a slow or failing receiver only holds up its own
+// deliveries. Webhooks still busy with an earlier call are skipped.
+func (d *Dispatcher) SendDue() error {
+	webhookIds, err := d.store.GetDueWebhookIds(time.Now())
+	if err != nil {
+		return err
+	}
+
+	for _, webhookId := range webhookIds {
+		d.mu.Lock()
+		busy := d.sending[webhookId]
+		d.sending[webhookId] = true
+		d.mu.Unlock()
+		if busy {
+			continue
+		}
+
+		d.senders.Add(1)
+		go func() {
+			defer d.senders.Done()
+			d.sendDue(webhookId)
+
+			d.mu.Lock()
+			delete(d.sending, webhookId)
+			d.mu.Unlock()
+		}()
+	}
+
+	return nil
+}
+
+// Wait blocks until the sends started by SendDue are done.
+func (d *Dispatcher) Wait() {
+	d.senders.Wait()
+}
+
+// sendDue sends a batch of the due deliveries of a webhook. Errors are logged,
+// the deliveries stay due and are sent by a later call.
+func (d *Dispatcher) sendDue(webhookId int) {
+	now := time.Now()
+	deliveries, err := d.store.GetDueDeliveries(webhookId, now, batchSize)
+	if err != nil {
+		log.Printf("webhook %d: %v", webhookId, err)
+		return
+	}
+
+	webhook, err := d.store.GetWebhookById(webhookId)
+	if err != nil {
+		log.Printf("webhook %d: %v", webhookId, err)
+		return
+	}
+	if webhook.ID == 0 {
+		// deleted together with its deliveries in the meantime
+		return
+	}
+
+	for _, delivery := range deliveries {
+		now := time.Now()
+		claimed, err := d.store.ClaimDelivery(delivery, now, now.Add(lease))
+		if err != nil {
+			log.Printf("webhook %d: could not claim delivery %d: %v", webhookId, delivery.ID, err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		if err := d.Send(webhook, delivery); err != nil {
+			log.Printf("webhook %d: could not store delivery %d: %v", webhookId, delivery.ID, err)
+		}
+	}
+}
+
+// Send attempts a delivery once and stores the outcome. The returned error is
+// about storing it, a failed request is recorded in the delivery.
+func (d *Dispatcher) Send(webhook *types.Webhook, delivery *types.WebhookDelivery) error {
+	delivery.Attempts++
+	status, err := d.post(webhook, delivery)
+
+	now := time.Now().UTC()
+	delivery.ResponseStatus = status
+	delivery.Error = ""
+	if err != nil {
+		delivery.Error = err.Error()
+		if len(delivery.Error) > maxErrorLength {
+			delivery.Error = delivery.Error[:maxErrorLength]
+		}
+	}
+
+	switch {
+	case err == nil:
+		delivery.Status = types.DeliveryDelivered
+		delivery.DeliveredAt = &now
+		delivery.NextAttemptAt = nil
+	case delivery.Attempts >= maxAttempts:
+		delivery.Status = types.DeliveryFailed
+		delivery.NextAttemptAt = nil
+	default:
+		next := now.Add(backoff(delivery.Attempts))
+		delivery.Status = types.DeliveryPending
+		delivery.NextAttemptAt = &next
+	}
+
+	return d.store.UpdateDelivery(delivery)
+}
+
+func (d *Dispatcher) post(webhook *types.Webhook, delivery *types.WebhookDelivery) (*int, error) {
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(delivery.Body))
+	if err != nil {
+		return nil, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "air-controller-webservice")
+	req.Header.Set("X-AirController-Event", delivery.Event)
+	req.Header.Set("X-AirController-Delivery", strconv.Itoa(delivery.ID))
+	req.Header.Set("X-AirController-Timestamp", timestamp)
+	req.Header.Set("X-AirController-Signature", "sha256="+Sign(webhook.Secret, timestamp, delivery.Body))
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return &res.StatusCode, fmt.Errorf("unexpected response status %d", res.StatusCode)
+	}
+
+	return &res.StatusCode, nil
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of "<timestamp>.<body>". Receivers
+// recompute it with the webhook secret and should reject old timestamps to
+// prevent replays.
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// backoff is the delay after the given number of failed attempts: 30s, 1m,
+// 2m, ... up to an hour.
+func backoff(attempts int) time.Duration {
+	delay := firstBackoff << (attempts - 1)
+	if delay > maxBackoff || delay <= 0 {
+		return maxBackoff
+	}
+	return delay
+}
+
+func newDelivery(webhook *types.Webhook, event events.Event) (*types.WebhookDelivery, error) {
+	body, err := render(webhook.Format, event)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	return &types.WebhookDelivery{
+		WebhookId:     webhook.ID,
+		Event:         event.Type,
+		Body:          body,
+		Status:        types.DeliveryPending,
+		NextAttemptAt: &now,
+	}, nil
+}
@@ -0,0 +1,163 @@
+package webhook_test
+
+import (
+	"air-controller-webservice/services/storetest"
+	"air-controller-webservice/services/webhook"
+	"air-controller-webservice/types"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRetryWithBackoff(t *testing.T) {
+	store := webhook.NewStore(storetest.OpenSQLite(t))
+	dispatcher := webhook.NewDispatcher(store)
+
+	status := http.StatusInternalServerError
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	hook, delivery := createDelivery(t, store, server.URL)
+
+	// 30s, 1m, 2m, ... after each failed attempt, the 8th failure is final
+	for attempt := 1; attempt <= 8; attempt++ {
+		before := time.Now()
+		if err := dispatcher.Send(hook, delivery); err != nil {
+			t.Fatal(err)
+		}
+
+		if delivery.Attempts != attempt || delivery.ResponseStatus == nil || *delivery.ResponseStatus != status ||
+			delivery.Error == "" {
+			t.Fatalf("attempt %d: delivery = %+v", attempt, delivery)
+		}
+		if attempt == 8 {
+			if delivery.Status != types.DeliveryFailed || delivery.NextAttemptAt != nil {
+				t.Errorf("after the last attempt: status %s, next attempt %v", delivery.Status, delivery.NextAttemptAt)
+			}
+			break
+		}
+
+		backoff := 30 * time.Second << (attempt - 1)
+		if delivery.Status != types.DeliveryPending || delivery.NextAttemptAt == nil ||
+			delivery.NextAttemptAt.Before(before.Add(backoff)) || delivery.NextAttemptAt.After(time.Now().Add(backoff)) {
+			t.Errorf("attempt %d: status %s, next attempt %v, want pending in %v", attempt, delivery.Status, delivery.NextAttemptAt, backoff)
+		}
+	}
+
+	status = http.StatusNoContent
+	hook, delivery = createDelivery(t, store, server.URL)
+	if err := dispatcher.Send(hook, delivery); err != nil {
+		t.Fatal(err)
+	}
+	if delivery.Status != types.DeliveryDelivered || delivery.DeliveredAt == nil || delivery.NextAttemptAt != nil ||
+		delivery.Error != "" {
+		t.Errorf("delivered delivery = %+v", delivery)
+	}
+
+	stored, err := store.GetDeliveries(hook.ID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 1 || stored[0].Status != types.DeliveryDelivered || stored[0].Attempts != 1 {
+		t.Errorf("deliveries of webhook %d = %+v", hook.ID, stored)
+	}
+}
+
+func TestSendDue(t *testing.T) {
+	store := webhook.NewStore(storetest.OpenSQLite(t))
+	dispatcher := webhook.NewDispatcher(store)
+
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer fast.Close()
+
+	slowHook, _ := createDelivery(t, store, slow.URL)
+	fastHook, fastDelivery := createDelivery(t, store, fast.URL)
+
+	// claimed by another instance, it must not be sent
+	claimedHook, claimed := createDelivery(t, store, fast.URL)
+	if ok, err := store.ClaimDelivery(claimed, time.Now(), time.Now().Add(time.Minute)); err != nil || !ok {
+		t.Fatalf("ClaimDelivery = %v, %v", ok, err)
+	}
+	if ok, err := store.ClaimDelivery(claimed, time.Now(), time.Now().Add(time.Minute)); err != nil || ok {
+		t.Fatalf("second ClaimDelivery = %v, %v, want not claimed", ok, err)
+	}
+
+	if err := dispatcher.SendDue(); err != nil {
+		t.Fatal(err)
+	}
+
+	expectStatus := func(hook *types.Webhook, id int, want types.WebhookDeliveryStatus) {
+		t.Helper()
+
+		for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+			deliveries, err := store.GetDeliveries(hook.ID, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, delivery := range deliveries {
+				if delivery.ID == id && delivery.Status == want {
+					return
+				}
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("deliveries of webhook %d = %+v, want %d %s", hook.ID, deliveries, id, want)
+			}
+		}
+	}
+
+	// the slow receiver does not hold up the other one
+	expectStatus(fastHook, fastDelivery.ID, types.DeliveryDelivered)
+	expectStatus(claimedHook, claimed.ID, types.DeliveryPending)
+
+	// the slow webhook is still busy, its delivery is leased and not due
+	if err := dispatcher.SendDue(); err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+	dispatcher.Wait()
+
+	deliveries, err := store.GetDeliveries(slowHook.ID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 1 || deliveries[0].Status != types.DeliveryDelivered || deliveries[0].Attempts != 1 {
+		t.Errorf("deliveries of the slow webhook = %+v", deliveries)
+	}
+}
+
+// createDelivery creates a webhook for url with a due delivery.
+func createDelivery(t *testing.T, store *webhook.Store, url string) (*types.Webhook, *types.WebhookDelivery) {
+	t.Helper()
+
+	id, err := store.CreateWebhook(types.WebhookPayload{Name: "test", URL: url, Format: "json", Events: []string{"*"}}, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hook, err := store.GetWebhookById(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC()
+	delivery := &types.WebhookDelivery{
+		WebhookId:     id,
+		Event:         "reading.created",
+		Body:          json.RawMessage(`{"type": "reading.created"}`),
+		Status:        types.DeliveryPending,
+		NextAttemptAt: &now,
+	}
+	if err := store.CreateDelivery(delivery); err != nil {
+		t.Fatal(err)
+	}
+
+	return hook, delivery
+}
@@ -0,0 +1,277 @@
+package webhook
+
+import (
+	"air-controller-webservice/middleware"
+	"air-controller-webservice/services/events"
+	"air-controller-webservice/types"
+	"air-controller-webservice/utils"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+type Handler struct {
+	store      types.WebhookStore
+	dispatcher *Dispatcher
+}
+
+func NewHandler(store types.WebhookStore, dispatcher *Dispatcher) *Handler {
+	return &Handler{store: store, dispatcher: dispatcher}
+}
+
+// RegisterRoutes adds the webhook endpoints, all of them require a login as
+// webhooks carry secrets and their URLs often contain tokens.
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/webhook", h.handleOptions).Methods("OPTIONS")
+	router.HandleFunc("/webhook/{id:[0-9]+}", h.handleOptions).Methods("OPTIONS")
+	router.HandleFunc("/webhook/{id:[0-9]+}/delivery", h.handleOptions).Methods("OPTIONS")
+	router.HandleFunc("/webhook/{id:[0-9]+}/test", h.handleOptions).Methods("OPTIONS")
+
+	middlewareRouter := router.NewRoute().Subrouter()
+	middlewareRouter.HandleFunc("/webhook", h.handleGet).Methods("GET")
+	middlewareRouter.HandleFunc("/webhook", h.handlePost).Methods("POST")
+	middlewareRouter.HandleFunc("/webhook/{id:[0-9]+}", h.handleGetById).Methods("GET")
+	middlewareRouter.HandleFunc("/webhook/{id:[0-9]+}", h.handlePut).Methods("PUT")
+	middlewareRouter.HandleFunc("/webhook/{id:[0-9]+}", h.handleDelete).Methods("DELETE")
+	middlewareRouter.HandleFunc("/webhook/{id:[0-9]+}/delivery", h.handleGetDeliveries).Methods("GET")
+	middlewareRouter.HandleFunc("/webhook/{id:[0-9]+}/test", h.handleTest).Methods("POST")
+	middlewareRouter.Use(middleware.RequireAuth())
+}
+
+func (h *Handler) handleGet(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := h.store.GetWebhooks()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	for _, webhook := range webhooks {
+		webhook.Secret = ""
+	}
+
+	utils.WriteJSON(w, http.StatusOK, webhooks)
+}
+
+func (h *Handler) handleGetById(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := h.getWebhookFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	webhook.Secret = ""
+	utils.WriteJSON(w, http.StatusOK, webhook)
+}
+
+// handlePost creates a webhook with a new secret. The secret is only part of
+// this response.
+func (h *Handler) handlePost(w http.ResponseWriter, r *http.Request) {
+	var payload types.WebhookPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := validateWebhook(&payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	secret, err := generateSecret()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	id, err := h.store.CreateWebhook(payload, secret)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	webhook, err := h.store.GetWebhookById(id)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, webhook)
+}
+
+func (h *Handler) handlePut(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := h.getWebhookFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var payload types.WebhookPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := validateWebhook(&payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := h.store.UpdateWebhook(webhook.ID, payload); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	webhook, err := h.store.GetWebhookById(webhook.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	webhook.Secret = ""
+	utils.WriteJSON(w, http.StatusOK, webhook)
+}
+
+func (h *Handler) handleDelete(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := h.getWebhookFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.store.DeleteWebhook(webhook.ID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, nil)
+}
+
+func (h *Handler) handleGetDeliveries(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := h.getWebhookFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	limit := defaultPageSize
+	if value := r.URL.Query().Get("limit"); value != "" {
+		l, err := strconv.Atoi(value)
+		if err != nil || l < 1 || l > maxPageSize {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("limit must be between 1 and %d", maxPageSize))
+			return
+		}
+		limit = l
+	}
+
+	deliveries, err := h.store.GetDeliveries(webhook.ID, limit)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, deliveries)
+}
+
+// handleTest sends a test event to the webhook right away and returns the
+// logged delivery. A failed test is retried like any other delivery.
+func (h *Handler) handleTest(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := h.getWebhookFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	delivery, err := newDelivery(webhook, events.Event{Type: TestEvent, Data: map[string]string{"webhook": webhook.Name}})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	delivery.NextAttemptAt = nil
+
+	if err := h.store.CreateDelivery(delivery); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := h.dispatcher.Send(webhook, delivery); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, delivery)
+}
+
+func (h *Handler) handleOptions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, PUT, OPTIONS, GET, DELETE")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.WriteHeader(http.StatusOK)
+}
+
+// getWebhookFromPath loads the webhook of the {id} path variable and writes
+// the error response if there is none.
+func (h *Handler) getWebhookFromPath(w http.ResponseWriter, r *http.Request) (*types.Webhook, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid webhook id"))
+		return nil, false
+	}
+
+	webhook, err := h.store.GetWebhookById(id)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+
+	if webhook.ID == 0 {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("webhook %d not found", id))
+		return nil, false
+	}
+
+	return webhook, true
+}
+
+// validateWebhook checks a webhook and fills in the default format.
+func validateWebhook(webhook *types.WebhookPayload) error {
+	if webhook.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+
+	target, err := url.Parse(webhook.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return fmt.Errorf("url must be an absolute http or https url")
+	}
+
+	if webhook.Format == "" {
+		webhook.Format = FormatJSON
+	}
+	if webhook.Format != FormatJSON && webhook.Format != FormatSlack && webhook.Format != FormatTeams {
+		return fmt.Errorf("format must be one of json, slack and teams")
+	}
+
+	if len(webhook.Events) == 0 {
+		return fmt.Errorf("events must not be empty")
+	}
+	for _, event := range webhook.Events {
+		if event != "*" && !slices.Contains(webhookEvents, event) {
+			return fmt.Errorf("unknown event: %s", event)
+		}
+	}
+
+	return nil
+}
+
+func generateSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(secret), nil
+}
@@ -0,0 +1,224 @@
+package webhook
+
+import (
+	"air-controller-webservice/types"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+const (
+	webhookColumns  = "id, name, url, format, events, enabled, secret, createdAt"
+	deliveryColumns = "id, webhookId, event, body, status, attempts, nextAttemptAt, responseStatus, error, createdAt, deliveredAt"
+)
+
+func (s *Store) GetWebhooks() ([]*types.Webhook, error) {
+	rows, err := s.db.Query("SELECT " + webhookColumns + " FROM webhooks ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []*types.Webhook{}
+	for rows.Next() {
+		webhook, err := scanRowIntoWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+
+	return webhooks, rows.Err()
+}
+
+func (s *Store) GetWebhookById(id int) (*types.Webhook, error) {
+	webhook, err := scanRowIntoWebhook(s.db.QueryRow("SELECT "+webhookColumns+" FROM webhooks WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return new(types.Webhook), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return webhook, nil
+}
+
+func (s *Store) CreateWebhook(webhook types.WebhookPayload, secret string) (int, error) {
+	var id int
+	err := s.db.QueryRow("INSERT INTO webhooks(name, url, format, events, enabled, secret) VALUES (?,?,?,?,?,?) RETURNING id",
+		webhook.Name, webhook.URL, webhook.Format, strings.Join(webhook.Events, ","), webhook.Enabled == nil || *webhook.Enabled, secret).Scan(&id)
+
+	return id, err
+}
+
+func (s *Store) UpdateWebhook(id int, webhook types.WebhookPayload) error {
+	_, err := s.db.Exec("UPDATE webhooks SET name = ?, url = ?, format = ?, events = ?, enabled = ? WHERE id = ?",
+		webhook.Name, webhook.URL, webhook.Format, strings.Join(webhook.Events, ","), webhook.Enabled == nil || *webhook.Enabled, id)
+
+	return err
+}
+
+// DeleteWebhook removes the webhook together with its delivery log.
+func (s *Store) DeleteWebhook(id int) error {
+	_, err := s.db.Exec("DELETE FROM webhooks WHERE id = ?", id)
+	return err
+}
+
+func (s *Store) CreateDelivery(delivery *types.WebhookDelivery) error {
+	return s.db.QueryRow("INSERT INTO webhook_deliveries(webhookId, event, body, status, attempts, nextAttemptAt) VALUES (?,?,?,?,?,?) RETURNING id",
+		delivery.WebhookId, delivery.Event, []byte(delivery.Body), delivery.Status, delivery.Attempts, delivery.NextAttemptAt).Scan(&delivery.ID)
+}
+
+func (s *Store) UpdateDelivery(delivery *types.WebhookDelivery) error {
+	_, err := s.db.Exec(`UPDATE webhook_deliveries SET status = ?, attempts = ?, nextAttemptAt = ?, responseStatus = ?,
+		error = ?, deliveredAt = ? WHERE id = ?`,
+		delivery.Status, delivery.Attempts, delivery.NextAttemptAt, delivery.ResponseStatus, delivery.Error,
+		delivery.DeliveredAt, delivery.ID)
+
+	return err
+}
+
+// GetDueWebhookIds returns the webhooks that have pending deliveries whose
+// next attempt is due.
+func (s *Store) GetDueWebhookIds(now time.Time) ([]int, error) {
+	rows, err := s.db.Query("SELECT DISTINCT webhookId FROM webhook_deliveries WHERE status = ? AND nextAttemptAt <= ? ORDER BY webhookId",
+		types.DeliveryPending, now.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// GetDueDeliveries returns the pending deliveries of a webhook whose next
+// attempt is due, oldest first.
+func (s *Store) GetDueDeliveries(webhookId int, now time.Time, limit int) ([]*types.WebhookDelivery, error) {
+	return s.getDeliveries("WHERE webhookId = ? AND status = ? AND nextAttemptAt <= ? ORDER BY nextAttemptAt, id LIMIT ?",
+		webhookId, types.DeliveryPending, now.UTC(), limit)
+}
+
+// ClaimDelivery moves the next attempt of a due delivery to leasedUntil, so
+// other instances of the webservice do not send it as well. If the instance
+// dies while sending, it is sent again once the lease ran out. It reports
+// false if the delivery is not due any more, e.g. because another instance
+// claimed it first.
+func (s *Store) ClaimDelivery(delivery *types.WebhookDelivery, now time.Time, leasedUntil time.Time) (bool, error) {
+	result, err := s.db.Exec("UPDATE webhook_deliveries SET nextAttemptAt = ? WHERE id = ? AND status = ? AND nextAttemptAt <= ?",
+		leasedUntil.UTC(), delivery.ID, types.DeliveryPending, now.UTC())
+	if err != nil {
+		return false, err
+	}
+
+	claimed, err := result.RowsAffected()
+	if err != nil || claimed == 0 {
+		return false, err
+	}
+
+	delivery.NextAttemptAt = &leasedUntil
+	return true, nil
+}
+
+// GetDeliveries returns the delivery log of a webhook, newest first.
+func (s *Store) GetDeliveries(webhookId int, limit int) ([]*types.WebhookDelivery, error) {
+	return s.getDeliveries("WHERE webhookId = ? ORDER BY id DESC LIMIT ?", webhookId, limit)
+}
+
+func (s *Store) getDeliveries(clauses string, args ...any) ([]*types.WebhookDelivery, error) {
+	rows, err := s.db.Query("SELECT "+deliveryColumns+" FROM webhook_deliveries "+clauses, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*types.WebhookDelivery{}
+	for rows.Next() {
+		delivery, err := scanRowIntoDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, rows.Err()
+}
+
+func scanRowIntoWebhook(rows interface{ Scan(dest ...any) error }) (*types.Webhook, error) {
+	webhook := new(types.Webhook)
+	var events string
+
+	err := rows.Scan(
+		&webhook.ID,
+		&webhook.Name,
+		&webhook.URL,
+		&webhook.Format,
+		&events,
+		&webhook.Enabled,
+		&webhook.Secret,
+		&webhook.CreatedAt,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	webhook.Events = strings.Split(events, ",")
+
+	return webhook, nil
+}
+
+func scanRowIntoDelivery(rows interface{ Scan(dest ...any) error }) (*types.WebhookDelivery, error) {
+	delivery := new(types.WebhookDelivery)
+	var body []byte
+	var nextAttemptAt, deliveredAt sql.NullTime
+	var responseStatus sql.NullInt32
+
+	err := rows.Scan(
+		&delivery.ID,
+		&delivery.WebhookId,
+		&delivery.Event,
+		&body,
+		&delivery.Status,
+		&delivery.Attempts,
+		&nextAttemptAt,
+		&responseStatus,
+		&delivery.Error,
+		&delivery.CreatedAt,
+		&deliveredAt,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	delivery.Body = body
+	if nextAttemptAt.Valid {
+		delivery.NextAttemptAt = &nextAttemptAt.Time
+	}
+	if deliveredAt.Valid {
+		delivery.DeliveredAt = &deliveredAt.Time
+	}
+	if responseStatus.Valid {
+		status := int(responseStatus.Int32)
+		delivery.ResponseStatus = &status
+	}
+
+	return delivery, nil
+}
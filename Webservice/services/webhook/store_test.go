@@ -0,0 +1,18 @@
+package webhook_test
+
+import (
+	"air-controller-webservice/services/storetest"
+	"air-controller-webservice/services/webhook"
+	"air-controller-webservice/types"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	for _, backend := range storetest.Backends() {
+		t.Run(backend.Name, func(t *testing.T) {
+			storetest.RunWebhookStore(t, func(t *testing.T) types.WebhookStore {
+				return webhook.NewStore(backend.Open(t))
+			})
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package webhook
+
+import (
+	"air-controller-webservice/services/events"
+	"air-controller-webservice/types"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	FormatJSON  = "json"
+	FormatSlack = "slack"
+	FormatTeams = "teams"
+)
+
+// TestEvent is sent by the test delivery endpoint.
+const TestEvent = "webhook.test"
+
+// webhookEvents are the events a webhook can subscribe to.
+var webhookEvents = []string{
+	events.DeviceRequested,
+	events.DeviceApproved,
+	events.DeviceDeclined,
+	events.DeviceOnline,
+	events.DeviceOffline,
+	events.DeviceDeleted,
+	events.AlertPending,
+	events.AlertFiring,
+	events.AlertResolved,
+}
+
+// render builds the request body for a webhook. json sends the event as is,
+// slack and teams a message in the format of their incoming webhooks.
+func render(format string, event events.Event) ([]byte, error) {
+	switch format {
+	case FormatSlack:
+		return json.Marshal(map[string]string{"text": describe(event)})
+	case FormatTeams:
+		return json.Marshal(map[string]string{
+			"@type":    "MessageCard",
+			"@context": "https://schema.org/extensions",
+			"summary":  event.Type,
+			"title":    "Air Controller",
+			"text":     describe(event),
+		})
+	}
+
+	return json.Marshal(event)
+}
+
+// describe returns a one line, human readable text of an event.
+func describe(event events.Event) string {
+	switch data := event.Data.(type) {
+	case *types.RequestDevice:
+		return fmt.Sprintf("New device %s requests registration", data.MACAddress)
+	case *types.Device:
+		switch event.Type {
+		case events.DeviceOnline:
+			return fmt.Sprintf("Device %s (%s) in %s is online again", data.Name, data.MACAddress, data.Localization)
+		case events.DeviceOffline:
+			return fmt.Sprintf("Device %s (%s) in %s is offline, last seen %s", data.Name, data.MACAddress, data.Localization,
+				data.LastSeenAt.UTC().Format(time.RFC3339))
+		case events.DeviceDeleted:
+			return fmt.Sprintf("Device %s (%s) in %s was deleted", data.Name, data.MACAddress, data.Localization)
+		}
+		return fmt.Sprintf("Device %s (%s) in %s was approved", data.Name, data.MACAddress, data.Localization)
+	case types.RequestDevicePayload:
+		return fmt.Sprintf("Registration of device %s was declined", data.MACAddress)
+	case *types.AlertEvent:
+		rule, alert := data.Rule, data.Alert
+		condition := fmt.Sprintf("%s is %g (%s %g)", rule.Metric, alert.Value, rule.Comparator, rule.Threshold)
+		switch alert.State {
+		case types.AlertFiring:
+			return fmt.Sprintf("Alert %q is firing for device %d: %s", rule.Name, alert.DeviceId, condition)
+		case types.AlertResolved:
+			return fmt.Sprintf("Alert %q is resolved for device %d: %s", rule.Name, alert.DeviceId, condition)
+		default:
+			return fmt.Sprintf("Alert %q is pending for device %d: %s", rule.Name, alert.DeviceId, condition)
+		}
+	}
+
+	if event.Type == TestEvent {
+		return "Test delivery from the Air Controller webservice"
+	}
+
+	return event.Type
+}
@@ -1,6 +1,9 @@
 package types
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 type UserStore interface {
 	GetUserByUsername(username string) (*User, error)
@@ -30,27 +33,405 @@ type LoginToken struct {
 }
 
 type SensorReadingStore interface {
-	CreateSensorReading(sensorReading SensorReadingPayload, deviceId int) error
-	GetSensorReadingsByDevice(deviceId string) ([]*SensorReading, error)
-	GetSensorReadings() ([]*SensorReading, error)
+	CreateSensorReading(sensorReading SensorReadingPayload, deviceId int) (*SensorReadingInsertResult, error)
+	CreateSensorReadings(items []SensorReadingBatchItem) ([]*SensorReadingInsertResult, error)
+	GetSensorReadingsByDevice(deviceId string, query SensorReadingQuery) (*SensorReadingPage, error)
+	GetSensorReadings(query SensorReadingQuery) (*SensorReadingPage, error)
+	GetSensorReadingAggregates(deviceId string, query SensorReadingAggregateQuery) ([]*SensorReadingAggregate, error)
+	CreateRejectedReading(reading RejectedReading) error
+	GetRejectedReadings(query RejectedReadingQuery) ([]*RejectedReading, error)
+}
+
+// SensorReadingQuery pages through the readings measured in [From, To) in
+// (measuredAt, id) order, zero values are unbounded. MinIaqAccuracy skips
+// readings with a lower BSEC IAQ accuracy, e.g. 3 keeps calibrated ones only.
+type SensorReadingQuery struct {
+	From           time.Time
+	To             time.Time
+	Limit          int
+	After          *SensorReadingCursor
+	MinIaqAccuracy *int
+}
+
+// SensorReadingCursor points at the last reading of a page.
+type SensorReadingCursor struct {
+	MeasuredAt time.Time
+	ID         int
+}
+
+type SensorReadingPage struct {
+	Readings []*SensorReading
+	Next     *SensorReadingCursor
+}
+
+// SensorReadingAggregateQuery groups the readings measured in [From, To) into
+// buckets of the given width, aligned to the unix epoch.
+type SensorReadingAggregateQuery struct {
+	Bucket         time.Duration
+	From           time.Time
+	To             time.Time
+	MinIaqAccuracy *int
+}
+
+type SensorReadingAggregate struct {
+	BucketStart     time.Time      `json:"bucketStart"`
+	Count           int            `json:"count"`
+	Temperature     AggregateStats `json:"temperature"`
+	AirQualityIndex AggregateStats `json:"airQualityIndex"`
+	Humidity        AggregateStats `json:"humidity"`
+	Carbondioxide   AggregateStats `json:"carbondioxide"`
+}
+
+type AggregateStats struct {
+	Avg *float64 `json:"avg,omitempty"`
+	Min *float64 `json:"min,omitempty"`
+	Max *float64 `json:"max,omitempty"`
 }
 
 type SensorReading struct {
-	ID              int       `json:"id"`
-	DeviceId        int       `json:"deviceId"`
-	Temperature     float32   `json:"temperature"`
-	AirQualityIndex float32   `json:"airQualityIndex"`
-	Humidity        float32   `json:"humidity"`
-	Carbondioxide   float32   `json:"carbondioxide"`
-	CreatedAt       time.Time `json:"createdAt"`
+	ID              int     `json:"id"`
+	DeviceId        int     `json:"deviceId"`
+	Temperature     float32 `json:"temperature"`
+	AirQualityIndex float32 `json:"airQualityIndex"`
+	Humidity        float32 `json:"humidity"`
+	Carbondioxide   float32 `json:"carbondioxide"`
+	BsecOutput
+	Metrics        map[string]float64 `json:"metrics,omitempty"`
+	CreatedAt      time.Time          `json:"createdAt"`
+	MeasuredAt     time.Time          `json:"measuredAt"`
+	BootId         string             `json:"bootId,omitempty"`
+	Sequence       *int64             `json:"sequence,omitempty"`
+	IdempotencyKey *string            `json:"idempotencyKey,omitempty"`
+}
+
+// BsecOutput holds the BSEC library outputs besides the four main values.
+// They are optional, as older firmware does not send them. IaqAccuracy goes
+// from 0 (sensor not calibrated yet) to 3 (calibrated), Pressure is in hPa and
+// GasResistance in Ohm.
+type BsecOutput struct {
+	StaticIaq           *float32 `json:"staticIaq,omitempty"`
+	IaqAccuracy         *int     `json:"iaqAccuracy,omitempty"`
+	BreathVocEquivalent *float32 `json:"breathVocEquivalent,omitempty"`
+	Pressure            *float32 `json:"pressure,omitempty"`
+	GasResistance       *float32 `json:"gasResistance,omitempty"`
+	StabilizationStatus *bool    `json:"stabilizationStatus,omitempty"`
 }
 
+// SensorReadingPayload is what a device posts. Metrics holds the channels of
+// device models beyond the fixed fields, by names registered in the metric
+// registry. MeasuredAt is the device clock at measurement time, Uptime the
+// device uptime in milliseconds at measurement time. Both are optional, see
+// sensorreading.resolveMeasuredAt. Sequence and IdempotencyKey are optional as
+// well and unique per device, a retried post carrying one of them is not
+// stored twice. A device that counts its sequence from the start after a
+// reboot sends a new BootId with every boot, the sequence is unique per BootId.
 type SensorReadingPayload struct {
 	DeviceMacAddress string  `json:"deviceMacAddress"`
 	Temperature      float32 `json:"temperature"`
 	AirQualityIndex  float32 `json:"airQualityIndex"`
 	Humidity         float32 `json:"humidity"`
 	Carbondioxide    float32 `json:"carbondioxide"`
+	BsecOutput
+	Metrics        map[string]float64 `json:"metrics,omitempty"`
+	MeasuredAt     *time.Time         `json:"measuredAt,omitempty"`
+	Uptime         *int64             `json:"uptime,omitempty"`
+	BootId         string             `json:"bootId,omitempty"`
+	Sequence       *int64             `json:"sequence,omitempty"`
+	IdempotencyKey string             `json:"idempotencyKey,omitempty"`
+}
+
+// SensorReadingInsertResult is the stored reading. Replayed is set if the
+// reading was stored by an earlier request with the same sequence number or
+// idempotency key.
+type SensorReadingInsertResult struct {
+	Reading  *SensorReading
+	Replayed bool
+}
+
+type MetricStore interface {
+	GetMetrics() ([]*Metric, error)
+	GetMetricByName(name string) (*Metric, error)
+	CreateMetric(metric MetricPayload) error
+}
+
+// Metric describes a channel devices may report. Builtin metrics are the fixed
+// fields of a reading, all others are sent in its metrics map. Values outside
+// [Min, Max] are implausible, Precision is the number of decimals kept.
+type Metric struct {
+	Name      string    `json:"name"`
+	Unit      string    `json:"unit"`
+	Min       *float64  `json:"min"`
+	Max       *float64  `json:"max"`
+	Precision int       `json:"precision"`
+	Builtin   bool      `json:"builtin"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type MetricPayload struct {
+	Name      string   `json:"name"`
+	Unit      string   `json:"unit"`
+	Min       *float64 `json:"min"`
+	Max       *float64 `json:"max"`
+	Precision int      `json:"precision"`
+}
+
+type AlertStore interface {
+	GetAlertRules() ([]*AlertRule, error)
+	GetAlertRuleById(id int) (*AlertRule, error)
+	CreateAlertRule(rule AlertRulePayload) (int, error)
+	UpdateAlertRule(id int, rule AlertRulePayload) error
+	DeleteAlertRule(id int) error
+	GetActiveAlert(ruleId int, deviceId int) (*Alert, error)
+	CreateAlert(alert *Alert) error
+	UpdateAlert(alert *Alert, transition bool) error
+	GetAlerts(query AlertQuery) ([]*Alert, error)
+	GetAlertTransitions(query AlertQuery) ([]*AlertTransition, error)
+}
+
+// AlertRule fires when Metric compared to Threshold holds for Duration
+// seconds. It applies to one device, to all devices at a Localization or to
+// all devices if both are nil. A firing alert resolves once the value is back
+// beyond the threshold by Hysteresis.
+type AlertRule struct {
+	ID              int       `json:"id"`
+	Name            string    `json:"name"`
+	DeviceId        *int      `json:"deviceId"`
+	Localization    *string   `json:"localization"`
+	Metric          string    `json:"metric"`
+	Comparator      string    `json:"comparator"`
+	Threshold       float64   `json:"threshold"`
+	DurationSeconds int       `json:"durationSeconds"`
+	Hysteresis      float64   `json:"hysteresis"`
+	Enabled         bool      `json:"enabled"`
+	CreatedAt       time.Time `json:"createdAt"`
+}
+
+type AlertRulePayload struct {
+	Name            string  `json:"name"`
+	DeviceId        *int    `json:"deviceId"`
+	Localization    *string `json:"localization"`
+	Metric          string  `json:"metric"`
+	Comparator      string  `json:"comparator"`
+	Threshold       float64 `json:"threshold"`
+	DurationSeconds int     `json:"durationSeconds"`
+	Hysteresis      float64 `json:"hysteresis"`
+	Enabled         *bool   `json:"enabled"`
+}
+
+type AlertState string
+
+const (
+	AlertPending  AlertState = "pending"
+	AlertFiring   AlertState = "firing"
+	AlertResolved AlertState = "resolved"
+)
+
+// Alert is one occurrence of a rule for a device. StartedAt is when the
+// condition first held, Value the latest value of the metric.
+type Alert struct {
+	ID         int        `json:"id"`
+	RuleId     int        `json:"ruleId"`
+	DeviceId   int        `json:"deviceId"`
+	State      AlertState `json:"state"`
+	Value      float64    `json:"value"`
+	StartedAt  time.Time  `json:"startedAt"`
+	FiredAt    *time.Time `json:"firedAt"`
+	ResolvedAt *time.Time `json:"resolvedAt"`
+}
+
+// AlertTransition records an alert entering State.
+type AlertTransition struct {
+	ID       int        `json:"id"`
+	AlertId  int        `json:"alertId"`
+	RuleId   int        `json:"ruleId"`
+	DeviceId int        `json:"deviceId"`
+	State    AlertState `json:"state"`
+	Value    float64    `json:"value"`
+	At       time.Time  `json:"at"`
+}
+
+// AlertQuery filters alerts and transitions, zero values match all. Results
+// are ordered newest first.
+type AlertQuery struct {
+	State    AlertState
+	RuleId   int
+	DeviceId int
+	Limit    int
+}
+
+// AlertEvent is the data of the alert events.
+type AlertEvent struct {
+	Rule  *AlertRule `json:"rule"`
+	Alert *Alert     `json:"alert"`
+}
+
+type WebhookStore interface {
+	GetWebhooks() ([]*Webhook, error)
+	GetWebhookById(id int) (*Webhook, error)
+	CreateWebhook(webhook WebhookPayload, secret string) (int, error)
+	UpdateWebhook(id int, webhook WebhookPayload) error
+	DeleteWebhook(id int) error
+	CreateDelivery(delivery *WebhookDelivery) error
+	UpdateDelivery(delivery *WebhookDelivery) error
+	GetDueWebhookIds(now time.Time) ([]int, error)
+	GetDueDeliveries(webhookId int, now time.Time, limit int) ([]*WebhookDelivery, error)
+	ClaimDelivery(delivery *WebhookDelivery, now time.Time, leasedUntil time.Time) (bool, error)
+	GetDeliveries(webhookId int, limit int) ([]*WebhookDelivery, error)
+}
+
+// Webhook receives the events listed in Events ("*" for all) as POST to URL.
+// Format is json, slack or teams. Secret signs the requests, it is only
+// returned when the webhook is created.
+type Webhook struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	URL       string    `json:"url"`
+	Format    string    `json:"format"`
+	Events    []string  `json:"events"`
+	Enabled   bool      `json:"enabled"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type WebhookPayload struct {
+	Name    string   `json:"name"`
+	URL     string   `json:"url"`
+	Format  string   `json:"format"`
+	Events  []string `json:"events"`
+	Enabled *bool    `json:"enabled"`
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	DeliveryPending   WebhookDeliveryStatus = "pending"
+	DeliveryDelivered WebhookDeliveryStatus = "delivered"
+	DeliveryFailed    WebhookDeliveryStatus = "failed"
+)
+
+// WebhookDelivery is one event sent to a webhook. Body is rendered when the
+// event happens, so retries send the same request.
+type WebhookDelivery struct {
+	ID             int                   `json:"id"`
+	WebhookId      int                   `json:"webhookId"`
+	Event          string                `json:"event"`
+	Body           json.RawMessage       `json:"body"`
+	Status         WebhookDeliveryStatus `json:"status"`
+	Attempts       int                   `json:"attempts"`
+	NextAttemptAt  *time.Time            `json:"nextAttemptAt"`
+	ResponseStatus *int                  `json:"responseStatus"`
+	Error          string                `json:"error,omitempty"`
+	CreatedAt      time.Time             `json:"createdAt"`
+	DeliveredAt    *time.Time            `json:"deliveredAt"`
+}
+
+type EmailRecipientStore interface {
+	GetEmailRecipients() ([]*EmailRecipient, error)
+	GetEmailRecipientById(id int) (*EmailRecipient, error)
+	CreateEmailRecipient(recipient EmailRecipientPayload) (int, error)
+	UpdateEmailRecipient(id int, recipient EmailRecipientPayload) error
+	DeleteEmailRecipient(id int) error
+}
+
+// EmailRecipient gets an email for the listed events in Language (de or en).
+// If DeviceId is set, only alerts and status changes of that device are sent.
+type EmailRecipient struct {
+	ID        int       `json:"id"`
+	Email     string    `json:"email"`
+	Language  string    `json:"language"`
+	Events    []string  `json:"events"`
+	DeviceId  *int      `json:"deviceId"`
+	Enabled   bool      `json:"enabled"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type EmailRecipientPayload struct {
+	Email    string   `json:"email"`
+	Language string   `json:"language"`
+	Events   []string `json:"events"`
+	DeviceId *int     `json:"deviceId"`
+	Enabled  *bool    `json:"enabled"`
+}
+
+type RollupStore interface {
+	ProcessPendingReadings(batchSize int) (int, error)
+	ResetRollups() error
+	GetRollups(deviceId string, query RollupQuery) ([]*SensorReadingRollup, error)
+}
+
+type RollupResolution string
+
+const (
+	RollupHourly RollupResolution = "hourly"
+	RollupDaily  RollupResolution = "daily"
+)
+
+type RollupQuery struct {
+	Resolution RollupResolution
+	From       time.Time
+	To         time.Time
+}
+
+type SensorReadingRollup struct {
+	DeviceId        int              `json:"deviceId"`
+	Resolution      RollupResolution `json:"resolution"`
+	BucketStart     time.Time        `json:"bucketStart"`
+	Count           int              `json:"count"`
+	Temperature     RollupStats      `json:"temperature"`
+	AirQualityIndex RollupStats      `json:"airQualityIndex"`
+	Humidity        RollupStats      `json:"humidity"`
+	Carbondioxide   RollupStats      `json:"carbondioxide"`
+	LastAt          time.Time        `json:"lastAt"`
+}
+
+// RollupStats summarizes the readings of a bucket that have a value for the
+// metric, Count of them. Min, Max and Avg are nil if none has, Last is the
+// value of the latest reading and nil if it was sent without one.
+type RollupStats struct {
+	Count int      `json:"count"`
+	Min   *float64 `json:"min"`
+	Max   *float64 `json:"max"`
+	Avg   *float64 `json:"avg"`
+	Last  *float64 `json:"last"`
+}
+
+type SensorReadingBatchItem struct {
+	DeviceId int
+	Payload  SensorReadingPayload
+}
+
+type SensorReadingBatchResult struct {
+	Index    int          `json:"index"`
+	Status   int          `json:"status"`
+	ID       int          `json:"id,omitempty"`
+	Replayed bool         `json:"replayed,omitempty"`
+	Error    string       `json:"error,omitempty"`
+	Fields   []FieldError `json:"fields,omitempty"`
+}
+
+// FieldError explains why a single value of a reading was rejected.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// RejectedReading is a reading that failed the checks on ingestion, kept with
+// the reason so faulty devices can be diagnosed.
+type RejectedReading struct {
+	ID        int             `json:"id"`
+	DeviceId  int             `json:"deviceId"`
+	Status    int             `json:"status"`
+	Error     string          `json:"error"`
+	Fields    []FieldError    `json:"fields,omitempty"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
+
+// RejectedReadingQuery returns the newest rejected readings first. A DeviceId
+// of 0 means all devices.
+type RejectedReadingQuery struct {
+	DeviceId int
+	Limit    int
 }
 
 type DeviceStore interface {
@@ -58,19 +439,82 @@ type DeviceStore interface {
 	RequestDevice(requestDevice RequestDevicePayload) error
 	GetDevices() ([]*Device, error)
 	GetDeviceById(deviceId int) (*Device, error)
+	// GetDeviceByIdIncludingDeleted also finds devices deleted with
+	// KeepReadings, they can still be archived or deleted for good.
+	GetDeviceByIdIncludingDeleted(deviceId int) (*Device, error)
 	GetDeviceByMac(macAddress string) (*Device, error)
 	GetRequestedDevices() ([]*RequestDevice, error)
 	GetRequestedDevicesByMac(macAddress string) (*RequestDevice, error)
 	DeactivateDevice(macAddress string) error
 	DeleteRequestDevice(macAddress string) error
+	SetDeviceKey(deviceId int, keyHash string) error
+	DeleteDeviceKey(deviceId int) error
+	GetDeviceByKeyHash(keyHash string) (*Device, error)
+	MarkDeviceSeen(deviceId int, at time.Time) (bool, error)
+	MarkDevicesOffline(silentSince time.Time) ([]*Device, error)
+	SaveHeartbeat(deviceId int, heartbeat DeviceHeartbeatPayload, at time.Time) error
+	UpdateDevice(deviceId int, device DeviceUpdatePayload) error
+	DeleteDevice(deviceId int, retention ReadingRetention) error
+	GetDeclinedDevices() ([]*RequestDevice, error)
+	DeclineRequestDevice(macAddress string, userId int) error
+	ReinstateRequestDevice(macAddress string, userId int) error
+	GetBlockedDevices() ([]*BlockedDevice, error)
+	GetBlockedDeviceByMac(macAddress string) (*BlockedDevice, error)
+	BlockDevice(device BlockedDevicePayload, userId int) error
+	UnblockDevice(macAddress string) error
+	CreateDeviceDecision(decision DeviceDecisionPayload) error
+	GetDeviceDecisions(query DeviceDecisionQuery) ([]*DeviceDecision, error)
+	ApproveDevices(approvals []DeviceApproval, userId int) ([]DeviceBulkOutcome, error)
+	DeclineRequestDevices(macAddresses []string, userId int) ([]DeviceBulkOutcome, error)
 }
 
+// Device is an approved device. LastSeenAt is when it last sent a reading or
+// heartbeat, Heartbeat is its latest heartbeat, nil if it never sent one.
 type Device struct {
-	ID           int       `json:"id"`
-	MACAddress   string    `json:"macAddress"`
-	Name         string    `json:"name"`
-	Localization string    `json:"localization"`
-	CreatedAt    time.Time `json:"createdAt"`
+	ID           int              `json:"id"`
+	MACAddress   string           `json:"macAddress"`
+	Name         string           `json:"name"`
+	Localization string           `json:"localization"`
+	CreatedAt    time.Time        `json:"createdAt"`
+	LastSeenAt   *time.Time       `json:"lastSeenAt"`
+	Online       bool             `json:"online"`
+	Heartbeat    *DeviceHeartbeat `json:"heartbeat"`
+}
+
+// DeviceUpdatePayload changes a device, nil fields are left as they are.
+type DeviceUpdatePayload struct {
+	Name         *string `json:"name"`
+	Localization *string `json:"localization"`
+}
+
+// ReadingRetention decides what happens to the sensor readings of a deleted
+// device.
+type ReadingRetention string
+
+const (
+	// KeepReadings only hides the device, its readings stay queryable.
+	KeepReadings ReadingRetention = "keep"
+	// ArchiveReadings moves the readings to archived_sensor_readings.
+	ArchiveReadings ReadingRetention = "archive"
+	// DeleteReadings deletes the readings.
+	DeleteReadings ReadingRetention = "cascade"
+)
+
+// DeviceHeartbeat is the health a device reports. Uptime is in milliseconds
+// like the X-Device-Uptime header, FreeHeap in bytes.
+type DeviceHeartbeat struct {
+	Rssi            *int      `json:"rssi"`
+	Uptime          *int64    `json:"uptime"`
+	FreeHeap        *int      `json:"freeHeap"`
+	FirmwareVersion string    `json:"firmwareVersion"`
+	ReceivedAt      time.Time `json:"receivedAt"`
+}
+
+type DeviceHeartbeatPayload struct {
+	Rssi            *int   `json:"rssi"`
+	Uptime          *int64 `json:"uptime"`
+	FreeHeap        *int   `json:"freeHeap"`
+	FirmwareVersion string `json:"firmwareVersion"`
 }
 
 type DevicePayload struct {
@@ -79,15 +523,105 @@ type DevicePayload struct {
 	Localization string `json:"localization"`
 }
 
+// DeviceApproval is one device of a bulk approval, KeyHash the hash of the
+// API key issued to it.
+type DeviceApproval struct {
+	Device  DevicePayload
+	KeyHash string
+}
+
+// DeviceBulkOutcome is what ApproveDevices or DeclineRequestDevices did with
+// one item. Err is set if the item was skipped, Status is then the matching
+// HTTP status code. DeviceId is the id of an approved device.
+type DeviceBulkOutcome struct {
+	DeviceId int
+	Status   int
+	Err      error
+}
+
+// DeviceBulkResult is the outcome of one item of a bulk approval or decline.
+// Key is the API key of an approved device, it is not shown again.
+type DeviceBulkResult struct {
+	Index      int    `json:"index"`
+	MACAddress string `json:"macAddress"`
+	Status     int    `json:"status"`
+	Error      string `json:"error,omitempty"`
+	DeviceId   int    `json:"deviceId,omitempty"`
+	Key        string `json:"key,omitempty"`
+}
+
+// DeviceKey is handed out once when a device is approved or its key is
+// rotated. Only the hash of Key is stored.
+type DeviceKey struct {
+	DeviceId   int    `json:"deviceId"`
+	MACAddress string `json:"macAddress"`
+	Key        string `json:"key"`
+}
+
+// RequestDevice is a registration request. Active requests are pending,
+// declined ones are inactive. DecidedBy and DecidedAt tell who declined or
+// reinstated the request last.
 type RequestDevice struct {
+	ID         int        `json:"id"`
+	MACAddress string     `json:"macAddress"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	Active     bool       `json:"active"`
+	DecidedBy  *int       `json:"decidedBy"`
+	DecidedAt  *time.Time `json:"decidedAt"`
+}
+
+type RequestDevicePayload struct {
+	MACAddress string `json:"macAddress"`
+}
+
+// BlockedDevice is a MAC address that may not request registration.
+type BlockedDevice struct {
 	ID         int       `json:"id"`
 	MACAddress string    `json:"macAddress"`
+	Reason     string    `json:"reason"`
+	BlockedBy  *int      `json:"blockedBy"`
 	CreatedAt  time.Time `json:"createdAt"`
-	Active     bool      `json:"active"`
 }
 
-type RequestDevicePayload struct {
+type BlockedDevicePayload struct {
 	MACAddress string `json:"macAddress"`
+	Reason     string `json:"reason"`
+}
+
+type DeviceDecisionType string
+
+const (
+	DecisionApproved   DeviceDecisionType = "approved"
+	DecisionDeclined   DeviceDecisionType = "declined"
+	DecisionReinstated DeviceDecisionType = "reinstated"
+	DecisionBlocked    DeviceDecisionType = "blocked"
+	DecisionUnblocked  DeviceDecisionType = "unblocked"
+)
+
+// DeviceDecision records a user deciding on a MAC address. UserId and
+// Username are nil once the user is deleted.
+type DeviceDecision struct {
+	ID         int                `json:"id"`
+	MACAddress string             `json:"macAddress"`
+	Decision   DeviceDecisionType `json:"decision"`
+	Reason     string             `json:"reason"`
+	UserId     *int               `json:"userId"`
+	Username   *string            `json:"username"`
+	CreatedAt  time.Time          `json:"createdAt"`
+}
+
+type DeviceDecisionPayload struct {
+	MACAddress string
+	Decision   DeviceDecisionType
+	Reason     string
+	UserId     int
+}
+
+// DeviceDecisionQuery filters decisions, an empty MACAddress matches all.
+// Results are ordered newest first.
+type DeviceDecisionQuery struct {
+	MACAddress string
+	Limit      int
 }
 
 type Response struct {
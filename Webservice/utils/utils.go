@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 )
 
 func ParseJSON(r *http.Request, payload any) error {
@@ -22,3 +23,32 @@ func WriteJSON(w http.ResponseWriter, status int, v any) error {
 func WriteError(w http.ResponseWriter, status int, err error) {
 	WriteJSON(w, status, map[string]string{"error": err.Error()})
 }
+
+// ParseTimeRange reads the optional RFC 3339 from and to query parameters.
+// Missing parameters are returned as zero times.
+func ParseTimeRange(r *http.Request) (time.Time, time.Time, error) {
+	var from, to time.Time
+	params := r.URL.Query()
+
+	if value := params.Get("from"); value != "" {
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return from, to, fmt.Errorf("invalid from: %s", value)
+		}
+		from = t
+	}
+
+	if value := params.Get("to"); value != "" {
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return from, to, fmt.Errorf("invalid to: %s", value)
+		}
+		to = t
+	}
+
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		return from, to, fmt.Errorf("from must be before to")
+	}
+
+	return from, to, nil
+}